@@ -0,0 +1,122 @@
+// Package apiversion mounts the REST API once per version, so a version can
+// change its handlers and response envelope without breaking clients of the
+// older ones. Every request of a version carries it in its locals, where the
+// response helpers, the auth redirect and the metrics pick it up.
+//
+// A new version is added by declaring a Version next to V1 and mounting it
+// with its own route function. The legacy routes are built by Legacy from
+// the configured dates. Routes that do not change can be shared by
+// calling the route function of the previous version after registering the
+// new handlers, Fiber serves the route registered first.
+package apiversion
+
+import (
+	"fmt"
+	"gambler/backend/apperr"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Envelope wraps the bodies of successful responses and renders errors
+type Envelope interface {
+	Success(status int, body interface{}) interface{}
+	Failure(err *apperr.Error) interface{}
+}
+
+type Version struct {
+	// Name labels the metrics of the version
+	Name   string
+	Prefix string
+	// Envelope renders the responses
+	Envelope Envelope
+	// Deprecated is the time the version was deprecated, zero while it is
+	// supported. Deprecated versions answer with the Deprecation header and
+	// a Link to their successor.
+	Deprecated time.Time
+	// Sunset is the time the version will be removed, zero if unknown
+	Sunset    time.Time
+	Successor *Version
+}
+
+const localsKey = "apiVersion"
+
+var (
+	V1 = &Version{Name: "v1", Prefix: "/v1", Envelope: Standard{}}
+
+	// Versions lists every mounted version with a prefix
+	Versions = []*Version{V1}
+)
+
+// Legacy returns the version serving the routes of V1 without a prefix, as
+// they were mounted before versioning, until the deployed clients have
+// moved to /v1. Zero times leave out the Deprecation or Sunset header.
+func Legacy(deprecated, sunset time.Time) *Version {
+	return &Version{
+		Name:       "legacy",
+		Envelope:   V1.Envelope,
+		Deprecated: deprecated,
+		Sunset:     sunset,
+		Successor:  V1,
+	}
+}
+
+// Mount registers the routes of the version below its prefix
+func (v *Version) Mount(app *fiber.App, routes func(fiber.Router)) {
+	routes(app.Group(v.Prefix, v.handler))
+}
+
+func (v *Version) handler(c *fiber.Ctx) error {
+	// The legacy routes have no prefix, so their middleware also runs for
+	// paths of other versions that did not match a route
+	if _, ok := c.Locals(localsKey).(*Version); ok {
+		return c.Next()
+	}
+	c.Locals(localsKey, v)
+
+	if !v.Deprecated.IsZero() {
+		c.Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+		if v.Successor != nil {
+			path := v.Successor.Prefix + strings.TrimPrefix(c.Path(), v.Prefix)
+			c.Append(fiber.HeaderLink, fmt.Sprintf(`<%s>; rel="successor-version"`, path))
+		}
+	}
+	if !v.Sunset.IsZero() {
+		c.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+	}
+	return c.Next()
+}
+
+// From returns the version of the request, nil outside of the versioned API
+func From(c *fiber.Ctx) *Version {
+	v, _ := c.Locals(localsKey).(*Version)
+	return v
+}
+
+// EnvelopeOf returns the envelope of the version of the request, Standard
+// outside of the versioned API
+func EnvelopeOf(c *fiber.Ctx) Envelope {
+	if v := From(c); v != nil && v.Envelope != nil {
+		return v.Envelope
+	}
+	return Standard{}
+}
+
+// Prefix returns the path prefix of the version of the request, e.g. to
+// redirect within the same version
+func Prefix(c *fiber.Ctx) string {
+	if v := From(c); v != nil {
+		return v.Prefix
+	}
+	return ""
+}
+
+// Label returns the metrics label of the version of the request
+func Label(c *fiber.Ctx) string {
+	if v := From(c); v != nil {
+		return v.Name
+	}
+	return "none"
+}
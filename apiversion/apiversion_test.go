@@ -0,0 +1,129 @@
+package apiversion
+
+import (
+	"encoding/json"
+	"gambler/backend/apperr"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// v2Envelope is the envelope of a breaking version, without the success
+// flag and with the error code as a string
+type v2Envelope struct{}
+
+func (v2Envelope) Success(status int, body interface{}) interface{} {
+	return map[string]interface{}{"data": body}
+}
+
+func (v2Envelope) Failure(err *apperr.Error) interface{} {
+	return map[string]interface{}{"error": err.Code}
+}
+
+// versionedApp mounts version 1, a version 2 changing one route and sharing
+// the other, and the legacy routes
+func versionedApp(legacy *Version) *fiber.App {
+	v2 := &Version{Name: "v2", Prefix: "/v2", Envelope: v2Envelope{}}
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		e := apperr.From(err)
+		return c.Status(e.Status).JSON(EnvelopeOf(c).Failure(e))
+	}})
+	reply := func(body string) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			return c.JSON(EnvelopeOf(c).Success(200, body+" "+Label(c)))
+		}
+	}
+	v1 := func(router fiber.Router) {
+		router.Get("/bets", reply("bets"))
+		router.Get("/user", reply("user"))
+	}
+
+	V1.Mount(app, v1)
+	v2.Mount(app, func(router fiber.Router) {
+		router.Get("/bets", reply("bets of v2"))
+		v1(router)
+	})
+	app.Get("/unversioned", reply("unversioned"))
+	legacy.Mount(app, v1)
+	return app
+}
+
+func TestVersions(t *testing.T) {
+	app := versionedApp(Legacy(time.Time{}, time.Time{}))
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/v1/bets", `{"success":true,"message":"Success","code":200,"body":"bets v1"}`},
+		{"/v2/bets", `{"data":"bets of v2 v2"}`},
+		{"/v2/user", `{"data":"user v2"}`},
+		{"/bets", `{"success":true,"message":"Success","code":200,"body":"bets legacy"}`},
+		{"/unversioned", `{"success":true,"message":"Success","code":200,"body":"unversioned none"}`},
+		{"/v2/missing", `{"error":"NOT_FOUND"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !jsonEqual(t, body, tt.body) {
+				t.Errorf("body = %s, want %s", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	deprecated := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.April, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		legacy     *Version
+		path       string
+		deprecated string
+		link       string
+		sunset     string
+	}{
+		{"current version", Legacy(deprecated, sunset), "/v1/bets", "", "", ""},
+		{"deprecated", Legacy(deprecated, time.Time{}), "/bets", "@1792368000", `</v1/bets>; rel="successor-version"`, ""},
+		{"sunset", Legacy(deprecated, sunset), "/user", "@1792368000", `</v1/user>; rel="successor-version"`, "Thu, 01 Apr 2027 12:00:00 GMT"},
+		{"supported", Legacy(time.Time{}, time.Time{}), "/bets", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := versionedApp(tt.legacy).Test(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Header.Get("Deprecation"); got != tt.deprecated {
+				t.Errorf("Deprecation = %q, want %q", got, tt.deprecated)
+			}
+			if got := resp.Header.Get(fiber.HeaderLink); got != tt.link {
+				t.Errorf("Link = %q, want %q", got, tt.link)
+			}
+			if got := resp.Header.Get("Sunset"); got != tt.sunset {
+				t.Errorf("Sunset = %q, want %q", got, tt.sunset)
+			}
+		})
+	}
+}
+
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var a, b interface{}
+	if err := json.Unmarshal(got, &a); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &b); err != nil {
+		t.Fatal(err)
+	}
+	ga, _ := json.Marshal(a)
+	gb, _ := json.Marshal(b)
+	return string(ga) == string(gb)
+}
@@ -0,0 +1,37 @@
+package apiversion
+
+import "gambler/backend/apperr"
+
+type (
+	// Response is the body of every answer of version 1
+	Response struct {
+		Success bool        `json:"success"`
+		Message string      `json:"message"`
+		Code    int         `json:"code"`
+		Error   apperr.Code `json:"error,omitempty"`
+		Body    interface{} `json:"body,omitempty"`
+	}
+
+	// Standard is the envelope of version 1, also used outside of the
+	// versioned API
+	Standard struct{}
+)
+
+func (Standard) Success(status int, body interface{}) interface{} {
+	return Response{
+		Success: true,
+		Message: "Success",
+		Code:    status,
+		Body:    body,
+	}
+}
+
+func (Standard) Failure(err *apperr.Error) interface{} {
+	return Response{
+		Success: false,
+		Message: err.Message,
+		Code:    err.Status,
+		Error:   err.Code,
+		Body:    err.Details,
+	}
+}
@@ -0,0 +1,126 @@
+// Package apperr defines the errors returned by the handlers and services.
+// Every error has a stable code that clients can rely on, the HTTP status it
+// maps to and a message that is safe to show to users. The underlying cause
+// is kept for logs but never sent to clients.
+package apperr
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Code identifies a kind of error, its value never changes
+type Code string
+
+type Error struct {
+	Code    Code
+	Status  int
+	Message string
+	// Details are sent to the client along with the message, e.g. the fields
+	// that failed validation
+	Details interface{}
+	// Err is the underlying cause
+	Err error
+}
+
+// New defines an error, the result is meant to be stored in a package level
+// variable and wrapped at the point of failure
+func New(code Code, status int, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Err.Error()
+	}
+	return string(e.Code)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target has the same code, so errors.Is matches wrapped
+// copies against the package level definition
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e caused by err
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithMessage returns a copy of e with a more specific user facing message
+func (e *Error) WithMessage(message string) *Error {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// WithDetails returns a copy of e carrying details for the client
+func (e *Error) WithDetails(details interface{}) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// From converts any error to an *Error. Fiber errors keep their status and
+// anything unknown becomes an internal error wrapping err.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fromStatus(fe.Code).WithMessage(fe.Message).Wrap(err)
+	}
+	return ErrInternal.Wrap(err)
+}
+
+// CodeOf returns the code of err, or the internal error code when err is not
+// an *Error
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	return From(err).Code
+}
+
+func fromStatus(status int) *Error {
+	switch status {
+	case fiber.StatusBadRequest:
+		return ErrBadRequest
+	case fiber.StatusUnauthorized:
+		return ErrUnauthorized
+	case fiber.StatusForbidden:
+		return ErrForbidden
+	case fiber.StatusNotFound:
+		return ErrNotFound
+	case fiber.StatusMethodNotAllowed:
+		return ErrMethodNotAllowed
+	case fiber.StatusRequestEntityTooLarge:
+		return ErrBodyTooLarge
+	case fiber.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case fiber.StatusUpgradeRequired:
+		return ErrUpgradeRequired
+	}
+	if status >= 500 {
+		return ErrInternal
+	}
+	return New(ErrBadRequest.Code, status, ErrBadRequest.Message)
+}
+
+// Status returns the HTTP status err is rendered with
+func Status(err error) int {
+	return From(err).Status
+}
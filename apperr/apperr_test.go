@@ -0,0 +1,65 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestFrom(t *testing.T) {
+	cause := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		err     error
+		code    Code
+		status  int
+		message string
+	}{
+		{"defined error", ErrTokenExpired, ErrTokenExpired.Code, http.StatusUnauthorized, ErrTokenExpired.Message},
+		{"wrapped cause", ErrDatabase.Wrap(cause), ErrDatabase.Code, ErrDatabase.Status, ErrDatabase.Message},
+		{"wrapped by fmt", fmt.Errorf("placing bet: %w", ErrBetOptionNotFound), ErrBetOptionNotFound.Code, http.StatusBadRequest, ErrBetOptionNotFound.Message},
+		{"specific message", ErrForbidden.WithMessage("Admins only"), ErrForbidden.Code, http.StatusForbidden, "Admins only"},
+		{"fiber not found", fiber.ErrNotFound, ErrNotFound.Code, http.StatusNotFound, fiber.ErrNotFound.Message},
+		{"fiber body limit", fiber.ErrRequestEntityTooLarge, ErrBodyTooLarge.Code, http.StatusRequestEntityTooLarge, fiber.ErrRequestEntityTooLarge.Message},
+		{"fiber other client error", fiber.ErrConflict, ErrBadRequest.Code, http.StatusConflict, fiber.ErrConflict.Message},
+		{"fiber server error", fiber.ErrBadGateway, ErrInternal.Code, ErrInternal.Status, fiber.ErrBadGateway.Message},
+		{"unknown error", cause, ErrInternal.Code, http.StatusInternalServerError, ErrInternal.Message},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := From(tt.err)
+			if e.Code != tt.code || e.Status != tt.status || e.Message != tt.message {
+				t.Errorf("From = %s %d %q, want %s %d %q", e.Code, e.Status, e.Message, tt.code, tt.status, tt.message)
+			}
+			if CodeOf(tt.err) != tt.code || Status(tt.err) != tt.status {
+				t.Errorf("CodeOf = %s and Status = %d, want %s and %d", CodeOf(tt.err), Status(tt.err), tt.code, tt.status)
+			}
+		})
+	}
+
+	if From(nil) != nil || CodeOf(nil) != "" {
+		t.Error("nil did not stay nil")
+	}
+}
+
+func TestIs(t *testing.T) {
+	cause := errors.New("no rows")
+	wrapped := ErrRecordNotFound.Wrap(cause)
+
+	if !errors.Is(wrapped, ErrRecordNotFound) {
+		t.Error("a wrapped copy does not match its definition")
+	}
+	if !errors.Is(wrapped, cause) {
+		t.Error("the cause is not reachable")
+	}
+	if errors.Is(wrapped, ErrNotFound) {
+		t.Error("errors with the same status but another code match")
+	}
+	ErrForbidden.WithMessage("Admins only").WithDetails("role")
+	if ErrRecordNotFound.Err != nil || ErrForbidden.Message == "Admins only" || ErrForbidden.Details != nil {
+		t.Error("copies changed the definition")
+	}
+}
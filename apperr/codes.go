@@ -0,0 +1,84 @@
+package apperr
+
+import "net/http"
+
+// Generic errors
+var (
+	ErrInternal         = New("INTERNAL_ERROR", http.StatusInternalServerError, "Something went wrong, please try again later")
+	ErrBadRequest       = New("BAD_REQUEST", http.StatusBadRequest, "The request could not be read")
+	ErrValidation       = New("VALIDATION_FAILED", http.StatusBadRequest, "Some fields are missing or invalid")
+	ErrUnauthorized     = New("UNAUTHORIZED", http.StatusUnauthorized, "You need to sign in")
+	ErrForbidden        = New("FORBIDDEN", http.StatusForbidden, "You are not allowed to do this")
+	ErrNotFound         = New("NOT_FOUND", http.StatusNotFound, "Not found")
+	ErrMethodNotAllowed = New("METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed, "Method not allowed")
+	ErrBodyTooLarge     = New("BODY_TOO_LARGE", http.StatusRequestEntityTooLarge, "The request is too large")
+	ErrTooManyRequests  = New("TOO_MANY_REQUESTS", http.StatusTooManyRequests, "Too many requests")
+	ErrUpgradeRequired  = New("UPGRADE_REQUIRED", http.StatusUpgradeRequired, "Connect with a websocket client")
+)
+
+// Database errors
+var (
+	ErrDatabase       = New("DB_UNKNOWN_ERR", http.StatusInternalServerError, "Something went wrong, please try again later")
+	ErrRecordNotFound = New("DB_REC_NOTFOUND", http.StatusNotFound, "Not found")
+	ErrDuplicateKey   = New("DB_DUP_KEY", http.StatusConflict, "Already exists")
+)
+
+// Authentication errors
+var (
+	ErrInvalidCredentials = New("INVALID_CREDENTIALS", http.StatusUnauthorized, "Wrong username or password")
+	ErrLoginThrottled     = New("LOGIN_THROTTLED", http.StatusTooManyRequests, "Too many failed sign ins, please try again later")
+	ErrTokenSign          = New("JWT_FAILED_TO_SIGN", http.StatusInternalServerError, "Could not sign you in, please try again later")
+	ErrTokenDecode        = New("JWT_FAILED_TO_DECODE", http.StatusUnauthorized, "Your session is invalid, please sign in again")
+	ErrTokenInvalid       = New("JWT_INVALID", http.StatusUnauthorized, "Your session is invalid, please sign in again")
+	ErrTokenExpired       = New("JWT_EXPIRED", http.StatusUnauthorized, "Your session has expired, please sign in again")
+	ErrNoToken            = New("JWT_NO_KEY", http.StatusUnauthorized, "You need to sign in")
+	ErrTokenReused        = New("JWT_REUSED", http.StatusUnauthorized, "Your session was ended for your security, please sign in again")
+	ErrSessionRevoked     = New("SESSION_REVOKED", http.StatusUnauthorized, "Your session has ended, please sign in again")
+	ErrTokenRevoked       = New("JWT_REVOKED", http.StatusUnauthorized, "You have been signed out, please sign in again")
+	ErrLinkInvalid        = New("LINK_INVALID", http.StatusBadRequest, "The link is invalid or has expired, please request a new one")
+	ErrEmailVerified      = New("EMAIL_ALREADY_VERIFIED", http.StatusConflict, "Your email address is already verified")
+	ErrMFAInvalid         = New("MFA_INVALID", http.StatusUnauthorized, "The code is wrong or was already used")
+	ErrMFAAttempts        = New("MFA_TOO_MANY_ATTEMPTS", http.StatusTooManyRequests, "Too many wrong codes, please sign in again")
+	ErrMFARequired        = New("MFA_REQUIRED", http.StatusForbidden, "Enable two-factor authentication to use this")
+	ErrMFAEnabled         = New("MFA_ALREADY_ENABLED", http.StatusConflict, "Two-factor authentication is already enabled")
+	ErrMFANotEnabled      = New("MFA_NOT_ENABLED", http.StatusConflict, "Two-factor authentication is not enabled")
+	ErrMFANotStarted      = New("MFA_NOT_STARTED", http.StatusConflict, "Start setting up two-factor authentication first")
+	ErrOIDCDisabled       = New("OIDC_DISABLED", http.StatusNotFound, "Single sign-on is not configured")
+	ErrOIDCState          = New("OIDC_STATE_INVALID", http.StatusBadRequest, "The sign in expired or was started in another browser, please try again")
+	ErrOIDCFailed         = New("OIDC_FAILED", http.StatusUnauthorized, "Single sign-on failed, please try again")
+	ErrOIDCNoAccount      = New("OIDC_NO_ACCOUNT", http.StatusForbidden, "No account is linked to this identity")
+	ErrCSRF               = New("CSRF_TOKEN_INVALID", http.StatusForbidden, "The request could not be verified, please reload the page and try again")
+)
+
+// API key errors
+var (
+	ErrAPIKeyScope = New("API_KEY_SCOPE", http.StatusForbidden, "The API key does not allow this")
+	ErrAPIKeyLimit = New("API_KEY_LIMIT", http.StatusConflict, "You have created the maximum number of API keys")
+)
+
+// Websocket errors
+var (
+	ErrWSNotConnected = New("WS_UUID_NOTFOUND", http.StatusNotFound, "Not connected")
+	ErrWSInvalidConn  = New("WS_INVALID_CONN", http.StatusBadRequest, "Invalid websocket message")
+	ErrWSSend         = New("WS_UNKNOWN_ERR", http.StatusInternalServerError, "Could not send the message")
+	ErrWSUnknownEvent = New("WS_COMMAND_NOTFOUND", http.StatusBadRequest, "Unknown event")
+)
+
+// Cache errors
+var (
+	ErrCache         = New("RD_UNKNOWN", http.StatusInternalServerError, "Something went wrong, please try again later")
+	ErrCacheNotFound = New("RD_KEY_NOT_FOUND", http.StatusNotFound, "Not found")
+)
+
+// Bet errors
+var (
+	ErrBetNotActive      = New("BET_NOT_ACTIVE", http.StatusConflict, "The bet is not open")
+	ErrBetOptionNotFound = New("BET_OPTION_NOT_FOUND", http.StatusBadRequest, "The bet has no such option")
+	ErrBetInvalidStatus  = New("BET_INVALID_STATUS", http.StatusBadRequest, "Unknown bet status")
+)
+
+// Webhook errors
+var (
+	ErrWebhookLimit   = New("WEBHOOK_LIMIT", http.StatusConflict, "You have registered the maximum number of webhooks")
+	ErrWebhookPending = New("WEBHOOK_DELIVERY_PENDING", http.StatusConflict, "The delivery is still being retried")
+)
@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"gambler/backend/database/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionBalanceAdjust = "balance.adjust"
+	ActionLedgerFix     = "balance.ledger_fix"
+	ActionBetCreate     = "bet.create"
+	ActionBetResolve    = "bet.resolve"
+	ActionBetCancel     = "bet.cancel"
+	ActionUserRole      = "user.role"
+	ActionUserUnlock    = "user.unlock"
+	ActionLogin         = "auth.login"
+	ActionLoginFailed   = "auth.login_failed"
+	ActionTokenRevoke   = "auth.token_revoke"
+	ActionEmailVerify   = "auth.email_verify"
+	ActionPasswordReset = "auth.password_reset"
+	ActionMFAEnable     = "auth.mfa_enable"
+	ActionMFADisable    = "auth.mfa_disable"
+	ActionRecoveryCodes = "auth.recovery_codes"
+	ActionIdentityLink  = "auth.identity_link"
+	ActionKeyRotate     = "auth.key_rotate"
+	ActionAPIKeyCreate  = "api_key.create"
+	ActionAPIKeyDelete  = "api_key.delete"
+	ActionWebhookCreate = "webhook.create"
+	ActionWebhookDelete = "webhook.delete"
+)
+
+// Targets of the recorded actions
+const (
+	TargetUser    = "user"
+	TargetBet     = "bet"
+	TargetWebhook = "webhook"
+	TargetAPIKey  = "api_key"
+	TargetKey     = "signing_key"
+)
+
+// Kinds of actors
+const (
+	ActorUser      = "user"
+	ActorAnonymous = "anonymous"
+	ActorCLI       = "cli"
+	ActorSystem    = "system"
+)
+
+type (
+	// Actor is who performs the audited action, it travels in the context
+	// of the request or command
+	Actor struct {
+		Type string
+		ID   *uint
+		IP   string
+	}
+
+	actorKey struct{}
+
+	// hashed lists the fields covered by the hash in a fixed order
+	hashed struct {
+		PrevHash   string          `json:"prev_hash"`
+		CreatedAt  string          `json:"created_at"`
+		ActorType  string          `json:"actor_type"`
+		ActorID    *uint           `json:"actor_id"`
+		Action     string          `json:"action"`
+		TargetType string          `json:"target_type"`
+		TargetID   string          `json:"target_id"`
+		Before     json.RawMessage `json:"before"`
+		After      json.RawMessage `json:"after"`
+		IP         string          `json:"ip"`
+		RequestID  string          `json:"request_id"`
+	}
+)
+
+// WithActor returns a copy of ctx carrying the actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored in ctx, actions without one are
+// attributed to the system
+func ActorFrom(ctx context.Context) Actor {
+	if ctx != nil {
+		if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+			return actor
+		}
+	}
+	return Actor{Type: ActorSystem}
+}
+
+// UserActor is the signed in user performing a request
+func UserActor(c *fiber.Ctx, userID uint) Actor {
+	return Actor{Type: ActorUser, ID: &userID, IP: ClientIP(c)}
+}
+
+// AnonymousActor is a caller that has not signed in
+func AnonymousActor(c *fiber.Ctx) Actor {
+	return Actor{Type: ActorAnonymous, IP: ClientIP(c)}
+}
+
+// ClientIP is the address the rate limiter sees, the proxy header is only
+// read on requests from server.trusted_proxies
+func ClientIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
+// Timestamp truncates t to the precision Postgres stores, so the hash of an
+// entry can be recomputed from the stored row
+func Timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// Hash computes the chained hash of an entry from its content and
+// entry.PrevHash
+func Hash(entry models.AuditLog) string {
+	data, err := json.Marshal(hashed{
+		PrevHash:   entry.PrevHash,
+		CreatedAt:  Timestamp(entry.CreatedAt).Format(time.RFC3339Nano),
+		ActorType:  entry.ActorType,
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		Before:     raw(entry.Before),
+		After:      raw(entry.After),
+		IP:         entry.IP,
+		RequestID:  entry.RequestID,
+	})
+	if err != nil {
+		// The raw documents were produced by json.Marshal, this cannot fail
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Check reports why entry does not follow the entry whose hash is prev, ""
+// when it does. prev is empty for the first entry.
+func Check(prev string, entry models.AuditLog) string {
+	if entry.PrevHash != prev {
+		return "previous hash does not match the preceding entry"
+	}
+	if Hash(entry) != entry.Hash {
+		return "hash does not match the content of the entry"
+	}
+	return ""
+}
+
+func raw(doc []byte) json.RawMessage {
+	if len(doc) == 0 {
+		return json.RawMessage("null")
+	}
+	return doc
+}
@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"gambler/backend/database/models"
+	"gambler/backend/database/models/customTypes"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// chain returns entries linked like appendAudit links them
+func chain() []models.AuditLog {
+	admin := uint(1)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	entries := []models.AuditLog{
+		{ActorType: ActorUser, ActorID: &admin, Action: ActionBalanceAdjust, TargetType: TargetUser, TargetID: "7",
+			Before: customTypes.JSON(`{"balance":100}`), After: customTypes.JSON(`{"balance":150}`), IP: "203.0.113.5", RequestID: "req-1"},
+		{ActorType: ActorAnonymous, Action: ActionLoginFailed, TargetType: TargetUser, TargetID: "7", IP: "198.51.100.9"},
+		{ActorType: ActorCLI, Action: ActionBetCancel, TargetType: TargetBet, TargetID: "42",
+			Before: customTypes.JSON(`{"status":"active"}`), After: customTypes.JSON(`{"status":"cancelled"}`)},
+		{ActorType: ActorSystem, Action: ActionKeyRotate, TargetType: TargetKey, TargetID: `"k2"`},
+	}
+	prev := ""
+	for i := range entries {
+		entries[i].ID = uint(i + 1)
+		entries[i].CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		entries[i].PrevHash = prev
+		entries[i].Hash = Hash(entries[i])
+		prev = entries[i].Hash
+	}
+	return entries
+}
+
+// verify walks the chain like handlers.VerifyAuditChain and returns the ID
+// of the first broken entry, 0 when the chain is intact
+func verify(entries []models.AuditLog) (uint, string) {
+	prev := ""
+	for _, entry := range entries {
+		if reason := Check(prev, entry); reason != "" {
+			return entry.ID, reason
+		}
+		prev = entry.Hash
+	}
+	return 0, ""
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func([]models.AuditLog) []models.AuditLog
+		brokenAt uint
+	}{
+		{"intact", func(e []models.AuditLog) []models.AuditLog { return e }, 0},
+		{"edited amount", func(e []models.AuditLog) []models.AuditLog {
+			e[0].After = customTypes.JSON(`{"balance":1500}`)
+			return e
+		}, 1},
+		{"edited actor", func(e []models.AuditLog) []models.AuditLog {
+			e[2].ActorType = ActorSystem
+			return e
+		}, 3},
+		{"edited ip", func(e []models.AuditLog) []models.AuditLog {
+			e[1].IP = "127.0.0.1"
+			return e
+		}, 2},
+		{"edited and rehashed", func(e []models.AuditLog) []models.AuditLog {
+			e[1].TargetID = "8"
+			e[1].Hash = Hash(e[1])
+			return e
+		}, 3},
+		{"deleted entry", func(e []models.AuditLog) []models.AuditLog {
+			return append(e[:1], e[2:]...)
+		}, 3},
+		{"swapped entries", func(e []models.AuditLog) []models.AuditLog {
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, 3},
+		{"deleted first entry", func(e []models.AuditLog) []models.AuditLog {
+			return e[1:]
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brokenAt, reason := verify(tt.tamper(chain()))
+			if brokenAt != tt.brokenAt {
+				t.Errorf("broken at %d (%s), want %d", brokenAt, reason, tt.brokenAt)
+			}
+		})
+	}
+}
+
+func TestHashSurvivesStorage(t *testing.T) {
+	entries := chain()
+	stored := entries[0]
+	// Postgres keeps microseconds and returns the time in the local zone
+	stored.CreatedAt = Timestamp(stored.CreatedAt).In(time.FixedZone("CEST", 2*60*60))
+	if Hash(stored) != entries[0].Hash {
+		t.Error("hash changed after a round trip through the database")
+	}
+
+	empty := entries[1]
+	empty.Before = customTypes.JSON{}
+	if Hash(empty) != entries[1].Hash {
+		t.Error("empty and missing before documents hash differently")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{"untrusted sender", []string{"10.0.0.1"}, "0.0.0.0"},
+		{"trusted proxy", []string{"0.0.0.0"}, "203.0.113.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{
+				EnableTrustedProxyCheck: true,
+				TrustedProxies:          tt.proxies,
+				ProxyHeader:             fiber.HeaderXForwardedFor,
+			})
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(AnonymousActor(c).IP)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(fiber.HeaderXForwardedFor, "203.0.113.5")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if got := string(body); got != tt.want {
+				t.Errorf("IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,15 @@
 package calculator
 
 import (
-	"fmt"
+	"context"
+	"gambler/backend/apperr"
 	"gambler/backend/database/models/customTypes"
 	"gambler/backend/handlers"
-	"gambler/backend/tools"
+	"gambler/backend/logging"
+	"gambler/backend/tracing"
 	"math"
 
-	"github.com/gofiber/fiber/v2/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type (
@@ -17,16 +19,25 @@ type (
 	}
 )
 
-func CalculateWinningAmount(betID uint, userID uint, inputIndex int, userBetted float64) (float64, int) {
-	bet, err := handlers.Cache.GetBetById(betID)
-	if err != -1 {
+var calcLog = logging.For("calculator")
+
+func CalculateWinningAmount(ctx context.Context, betID uint, userID uint, inputIndex int, userBetted float64) (float64, error) {
+	ctx, span := tracing.Start(ctx, "calculator.CalculateWinningAmount",
+		attribute.Int("bet.id", int(betID)),
+		attribute.Int("bet.option", inputIndex),
+	)
+	defer span.End()
+
+	bet, err := handlers.Cache.WithContext(ctx).GetBetById(betID)
+	if err != nil {
+		tracing.Fail(span, string(apperr.CodeOf(err)))
 		return 0, err
 	}
 	if bet.Status != customTypes.Open {
-		return 0, tools.BET_NOT_ACTIVE
+		return 0, apperr.ErrBetNotActive
 	}
 	if inputIndex >= len(bet.BetOptions) {
-		return 0, tools.BET_OPTION_NOT_FOUND
+		return 0, apperr.ErrBetOptionNotFound
 	}
 	input := bet.BetOptions[inputIndex]
 
@@ -44,11 +55,9 @@ func CalculateWinningAmount(betID uint, userID uint, inputIndex int, userBetted
 	}
 
 	if sumBet == 0.0 {
-		return 0, -1
+		return 0, nil
 	}
 
-	log.Info(fmt.Sprintf("Amount: %v, SumBet: %v, OtherWin: %v", amount, sumBet, otherWin))
-
 	var winAmount float64 // Total amount will win
 	if otherWin == 0.0 {
 		winAmount = amount - sumBet // If no one bet on that option
@@ -58,18 +67,28 @@ func CalculateWinningAmount(betID uint, userID uint, inputIndex int, userBetted
 
 	winPercentage := math.Trunc((winAmount+sumBet)/sumBet*100) / 100
 
-	fmt.Println("Winning percentage: ", winPercentage, winAmount, amount, otherWin, sumBet)
+	calcLog.DebugContext(ctx, "calculated winning percentage", "percentage", winPercentage, "win_amount", winAmount, "amount", amount, "other_win", otherWin, "sum_bet", sumBet)
 
-	return winPercentage, -1
+	return winPercentage, nil
 }
 
-func CalculateWinForExistedBet(betID uint, userID uint, inputIndex int) (float64, int) {
-	bet, err := handlers.Cache.GetBetById(betID)
-	if err != -1 {
+func CalculateWinForExistedBet(ctx context.Context, betID uint, userID uint, inputIndex int) (float64, error) {
+	ctx, span := tracing.Start(ctx, "calculator.CalculateWinForExistedBet",
+		attribute.Int("bet.id", int(betID)),
+		attribute.Int("bet.option", inputIndex),
+	)
+	defer span.End()
+
+	bet, err := handlers.Cache.WithContext(ctx).GetBetById(betID)
+	if err != nil {
+		tracing.Fail(span, string(apperr.CodeOf(err)))
 		return 0, err
 	}
 	if bet.Status != customTypes.Open {
-		return 0, tools.BET_NOT_ACTIVE
+		return 0, apperr.ErrBetNotActive
+	}
+	if inputIndex >= len(bet.BetOptions) {
+		return 0, apperr.ErrBetOptionNotFound
 	}
 	input := bet.BetOptions[inputIndex]
 
@@ -87,7 +106,7 @@ func CalculateWinForExistedBet(betID uint, userID uint, inputIndex int) (float64
 	}
 
 	if sumBet == 0.0 {
-		return 0, -1
+		return 0, nil
 	}
 
 	var winAmount float64
@@ -99,7 +118,7 @@ func CalculateWinForExistedBet(betID uint, userID uint, inputIndex int) (float64
 
 	winPercentage := math.Trunc(winAmount/sumBet*100) / 100
 
-	fmt.Println("Winning percentage: ", winPercentage, winAmount, amount, otherWin, sumBet)
+	calcLog.DebugContext(ctx, "calculated winning percentage", "percentage", winPercentage, "win_amount", winAmount, "amount", amount, "other_win", otherWin, "sum_bet", sumBet)
 
-	return winPercentage, -1
+	return winPercentage, nil
 }
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/notifier"
+	"strings"
+)
+
+// runAlert implements `alert test`, which sends one alert through every
+// configured destination and waits for the delivery
+func runAlert(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		return usageError("usage: gambler alert test [-severity level] <message>")
+	}
+	fs := flag.NewFlagSet("alert test", flag.ContinueOnError)
+	level := fs.String("severity", "error", "severity of the test alert")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	severity, ok := notifier.ParseSeverity(*level)
+	if !ok {
+		return usageError("unknown severity %q", *level)
+	}
+	message := strings.Join(fs.Args(), " ")
+	if message == "" {
+		message = "Test alert from the gambler CLI"
+	}
+
+	dispatcher, err := notifier.New(cfg.Alerting)
+	if err != nil {
+		return fail("ALERT", err)
+	}
+	dispatcher.Start()
+	notifier.Alerts = dispatcher
+
+	notifier.Notify(severity, "%s", message)
+	if err := dispatcher.Flush(context.Background()); err != nil {
+		return fail("ALERT", err)
+	}
+	fmt.Println("[ALERT] Test alert sent")
+	return 0
+}
@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/handlers"
+)
+
+// runAudit implements `audit verify`, which recomputes the hash chain of the
+// audit log and fails when an entry was altered or removed
+func runAudit(cfg *config.Config, args []string) int {
+	if len(args) != 1 || args[0] != "verify" {
+		return usageError("usage: gambler audit verify")
+	}
+
+	openStores(cfg)
+
+	result, err := handlers.DB.VerifyAuditChain()
+	if err != nil {
+		return fail("AUDIT", err)
+	}
+	if !result.Valid {
+		fmt.Printf("[AUDIT] Chain broken at entry %d after %d entries: %s\n", *result.BrokenAt, result.Checked, result.Reason)
+		return 1
+	}
+	fmt.Printf("[AUDIT] Verified %d entries\n", result.Checked)
+	return 0
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/handlers"
+	"gambler/backend/tools"
+)
+
+// runBet implements `bet resolve <id> <option>` and `bet cancel <id>`
+func runBet(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		return usageError("bet needs a subcommand")
+	}
+	switch args[0] {
+	case "resolve":
+		if len(args) != 3 {
+			return usageError("usage: gambler bet resolve <id> <option>")
+		}
+		betID := tools.ParseUInt(args[1])
+		if betID == 0 {
+			return usageError("invalid bet id %q", args[1])
+		}
+
+		openStores(cfg)
+		bet, err := operatorDB().ResolveBet(betID, args[2])
+		if err != nil {
+			return fail("BET", err)
+		}
+		refreshCachedBet(bet.ID)
+		fmt.Printf("[BET] Resolved %q with %q\n", bet.Name, bet.Result)
+	case "cancel":
+		if len(args) != 2 {
+			return usageError("usage: gambler bet cancel <id>")
+		}
+		betID := tools.ParseUInt(args[1])
+		if betID == 0 {
+			return usageError("invalid bet id %q", args[1])
+		}
+
+		openStores(cfg)
+		bet, err := operatorDB().CancelBetByID(betID)
+		if err != nil {
+			return fail("BET", err)
+		}
+		refreshCachedBet(bet.ID)
+		fmt.Printf("[BET] Cancelled %q and refunded %d stakes\n", bet.Name, len(bet.UserBets))
+	default:
+		return usageError("unknown bet subcommand %q", args[0])
+	}
+	return 0
+}
+
+// refreshCachedBet keeps the Redis copy in sync, the database change is
+// already committed so a cache failure is only reported
+func refreshCachedBet(betID uint) {
+	if err := handlers.Cache.UpdateBet(betID); err != nil {
+		fmt.Printf("[BET] Failed to update bet %d in cache: %s, run `gambler cache rebuild`\n", betID, err)
+	}
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/handlers"
+)
+
+// runCache implements `cache rebuild`
+func runCache(cfg *config.Config, args []string) int {
+	if len(args) != 1 || args[0] != "rebuild" {
+		return usageError("usage: gambler cache rebuild")
+	}
+
+	openStores(cfg)
+	if err := handlers.Cache.LoadDatabaseBets(); err != nil {
+		return fail("CACHE", err)
+	}
+	fmt.Println("[CACHE] Active bets reloaded")
+	return 0
+}
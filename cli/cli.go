@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gambler/backend/audit"
+	"gambler/backend/config"
+	"gambler/backend/handlers"
+	"gambler/backend/logging"
+	"os"
+)
+
+const usage = `usage: gambler [-config file] [-<section>.<setting> value ...] <command> [arguments]
+
+Run "gambler -h" to list every setting that can be passed as a flag.
+
+Commands:
+  serve                                  start the HTTP server (default)
+  migrate <up|down [steps]|status>       manage the database schema
+  seed                                   create demo users and bets
+  user create-admin <username> <email>   create or promote an admin account
+  user set-balance <username> <amount>   set the balance of a user
+  user sign-out <username>               end every session of a user
+  user unlock <username>                 lift the lock after failed sign ins
+  bet resolve <id> <option>              close a bet and pay out the winners
+  bet cancel <id>                        cancel a bet and refund every stake
+  cache rebuild                          reload the active bets into Redis
+  ledger reconcile [-fix]                compare balances with their history
+  alert test [-severity level] <message>  send a test alert to every destination
+  audit verify                           check the hash chain of the audit log
+  openapi <print|check>                  print the API spec or compare it with the routes
+  config                                 print the effective configuration`
+
+// Run loads the configuration from the global flags, dispatches the remaining
+// command line arguments (without the program name) to the matching command
+// and returns the process exit code
+func Run(args []string) int {
+	cfg, args, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(usage)
+		return 0
+	}
+	if err != nil {
+		return fail("CONFIG", err)
+	}
+	if err := logging.Init(cfg.Logging); err != nil {
+		return fail("CONFIG", err)
+	}
+
+	if len(args) == 0 {
+		return runServe(cfg, args)
+	}
+
+	switch args[0] {
+	case "serve":
+		return runServe(cfg, args[1:])
+	case "migrate":
+		return runMigrate(cfg, args[1:])
+	case "seed":
+		return runSeed(cfg, args[1:])
+	case "user":
+		return runUser(cfg, args[1:])
+	case "bet":
+		return runBet(cfg, args[1:])
+	case "cache":
+		return runCache(cfg, args[1:])
+	case "ledger":
+		return runLedger(cfg, args[1:])
+	case "alert":
+		return runAlert(cfg, args[1:])
+	case "audit":
+		return runAudit(cfg, args[1:])
+	case "openapi":
+		return runOpenAPI(cfg, args[1:])
+	case "config":
+		fmt.Println(cfg)
+		return 0
+	case "help":
+		fmt.Println(usage)
+		return 0
+	default:
+		return usageError("unknown command %q", args[0])
+	}
+}
+
+func usageError(format string, a ...interface{}) int {
+	fmt.Fprintf(os.Stderr, format+"\n\n%s\n", append(a, usage)...)
+	return 2
+}
+
+func fail(scope string, a ...interface{}) int {
+	fmt.Fprintln(os.Stderr, append([]interface{}{"[" + scope + "]"}, a...)...)
+	return 1
+}
+
+// openStores connects the database, validator and cache handlers the same
+// way the server does, so commands share the handlers' behaviour
+func openStores(cfg *config.Config) {
+	handlers.NewDB(cfg.Database)
+	handlers.NewValidator()
+	handlers.NewCache(cfg.Redis)
+}
+
+// operatorDB is the database handler for commands changing data, so their
+// audit entries are attributed to the command line
+func operatorDB() handlers.DBHandler {
+	ctx := audit.WithActor(context.Background(), audit.Actor{Type: audit.ActorCLI})
+	return handlers.DB.WithContext(ctx)
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/handlers"
+)
+
+// runLedger implements `ledger reconcile`, which compares every balance with
+// the sum of its history and optionally books the difference
+func runLedger(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "reconcile" {
+		return usageError("usage: gambler ledger reconcile [-fix]")
+	}
+	fs := flag.NewFlagSet("ledger reconcile", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "record an adjustment entry for every mismatch")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	openStores(cfg)
+
+	discrepancies, err := handlers.DB.FindLedgerDiscrepancies()
+	if err != nil {
+		return fail("LEDGER", err)
+	}
+	if len(*discrepancies) == 0 {
+		fmt.Println("[LEDGER] All balances match their history")
+		return 0
+	}
+
+	for _, d := range *discrepancies {
+		diff := d.Balance - d.LedgerTotal
+		fmt.Printf("%-20s balance %12.2f  history %12.2f  diff %+12.2f\n", d.Username, d.Balance, d.LedgerTotal, diff)
+		if !*fix {
+			continue
+		}
+		if _, err := operatorDB().ReconcileBalance(d.UserID, "Ledger reconciliation"); err != nil {
+			return fail("LEDGER", err)
+		}
+	}
+
+	if !*fix {
+		fmt.Printf("[LEDGER] %d mismatches found, rerun with -fix to book adjustments\n", len(*discrepancies))
+		return 1
+	}
+	fmt.Printf("[LEDGER] Booked %d adjustments\n", len(*discrepancies))
+	return 0
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/database"
+	"gambler/backend/database/migrations"
+	"strconv"
+)
+
+// runMigrate implements `migrate up`, `migrate down [steps]` and `migrate status`
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		return usageError("migrate needs a subcommand")
+	}
+
+	migrator, err := migrations.New(database.InitDatabase(cfg.Database))
+	if err != nil {
+		return fail("MIGRATE", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("[MIGRATE] Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fail("MIGRATE", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("[MIGRATE] Schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return usageError("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("[MIGRATE] Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fail("MIGRATE", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return fail("MIGRATE", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return usageError("unknown migrate subcommand %q", args[0])
+	}
+	return 0
+}
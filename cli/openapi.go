@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/openapi"
+	"gambler/backend/tools"
+)
+
+// runOpenAPI implements `openapi print` and `openapi check`. The check mounts
+// the routes without connecting to Postgres or Redis, so it can run in CI and
+// fails when a route is added or removed without updating the spec.
+func runOpenAPI(cfg *config.Config, args []string) int {
+	if len(args) != 1 {
+		return usageError("usage: gambler openapi <print|check>")
+	}
+	switch args[0] {
+	case "print":
+		spec, err := openapi.JSON()
+		if err != nil {
+			return fail("OPENAPI", err)
+		}
+		fmt.Println(string(spec))
+	case "check":
+		cookies := tools.NewCookies(cfg.Cookies)
+		app := newApp(cfg, cookies)
+		registerRoutes(app, cfg, cookies)
+		drift := openapi.Check(app)
+		for _, line := range drift {
+			fmt.Println("[OPENAPI]", line)
+		}
+		if len(drift) > 0 {
+			return 1
+		}
+		fmt.Println("[OPENAPI] The spec matches the routes")
+	default:
+		return usageError("unknown openapi subcommand %q", args[0])
+	}
+	return 0
+}
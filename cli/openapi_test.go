@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"gambler/backend/config"
+	"gambler/backend/openapi"
+	"gambler/backend/tools"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// routedApp mounts the routes like serve does. The stores are not opened,
+// so the handlers can be registered but not called.
+func routedApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: tools.ErrorHandler})
+	registerRoutes(app, &config.Config{}, tools.NewCookies(config.CookieConfig{}))
+	return app
+}
+
+// TestOpenAPIMatchesRoutes is `gambler openapi check` without a
+// configuration, it fails when a route is added or removed without
+// updating the spec
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	for _, drift := range openapi.Check(routedApp()) {
+		t.Error(drift)
+	}
+}
+
+func TestOpenAPIReportsDrift(t *testing.T) {
+	app := routedApp()
+	app.Get("/v1/bets/hidden", func(c *fiber.Ctx) error { return nil })
+
+	drift := openapi.Check(app)
+	if len(drift) != 1 || drift[0] != "GET /bets/hidden is routed but not documented" {
+		t.Fatalf("drift = %q, want the undocumented route", drift)
+	}
+}
+
+// TestDocsAssets follows the documentation page: everything it loads comes
+// from the server itself
+func TestDocsAssets(t *testing.T) {
+	app := routedApp()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assets := regexp.MustCompile(`(?:src|href)="([^"]+)"`).FindAllStringSubmatch(string(page), -1)
+	if len(assets) == 0 {
+		t.Fatal("the page loads no assets")
+	}
+	for _, asset := range assets {
+		url := asset[1]
+		if !regexp.MustCompile(`^/[^/]`).MatchString(url) {
+			t.Errorf("the page loads %s from another origin", url)
+			continue
+		}
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.ContentLength == 0 {
+			t.Errorf("GET %s = %d with %d bytes, want the file", url, resp.StatusCode, resp.ContentLength)
+		}
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/docs/index.html", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /docs/index.html = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/database/models"
+	"gambler/backend/database/models/customTypes"
+	"gambler/backend/handlers"
+	"gambler/backend/password"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const seedPassword = "gambler123"
+
+type seedBet struct {
+	Name        string
+	Description string
+	Options     []string
+	Author      string
+	Option      string
+	Amount      float64
+	Duration    time.Duration
+}
+
+var (
+	seedUsers = []models.User{
+		{Username: "alice", Name: "Alice Demo", Email: "alice@example.com"},
+		{Username: "bob", Name: "Bob Demo", Email: "bob@example.com"},
+		{Username: "carol", Name: "Carol Demo", Email: "carol@example.com"},
+	}
+	seedBets = []seedBet{
+		{
+			Name:        "Coffee machine fixed by Friday",
+			Description: "Will facilities repair it this week",
+			Options:     []string{"Yes", "No"},
+			Author:      "alice",
+			Option:      "No",
+			Amount:      50,
+			Duration:    72 * time.Hour,
+		},
+		{
+			Name:        "Standup longer than 15 minutes",
+			Description: "Tomorrow's standup duration",
+			Options:     []string{"Yes", "No"},
+			Author:      "bob",
+			Option:      "Yes",
+			Amount:      25,
+			Duration:    24 * time.Hour,
+		},
+		{
+			Name:        "Friday lunch",
+			Description: "Where does the team eat on Friday",
+			Options:     []string{"Pizza", "Sushi", "Burgers"},
+			Author:      "carol",
+			Option:      "Sushi",
+			Amount:      40,
+			Duration:    96 * time.Hour,
+		},
+	}
+)
+
+// runSeed creates demo users and bets, skipping the ones that already exist
+func runSeed(cfg *config.Config, args []string) int {
+	if len(args) > 0 {
+		return usageError("seed does not take arguments")
+	}
+
+	openStores(cfg)
+
+	hashed, hashErr := password.New(cfg.Auth).Hash(seedPassword)
+	if hashErr != nil {
+		return fail("SEED", hashErr)
+	}
+
+	userIDs := map[string]uint{}
+	for _, seed := range seedUsers {
+		user, err := handlers.DB.GetUserByUsername(seed.Username)
+		if errors.Is(err, apperr.ErrRecordNotFound) {
+			seed.Password = hashed
+			if err := handlers.DB.CreateUser(seed); err != nil {
+				return fail("SEED", err)
+			}
+			if user, err = handlers.DB.GetUserByUsername(seed.Username); err != nil {
+				return fail("SEED", err)
+			}
+			if _, err := operatorDB().AdjustUserBalance(user.ID, 1000, "Demo balance"); err != nil {
+				return fail("SEED", err)
+			}
+			fmt.Printf("[SEED] Created user %s\n", seed.Username)
+		} else if err != nil {
+			return fail("SEED", err)
+		}
+		userIDs[seed.Username] = user.ID
+	}
+
+	for _, seed := range seedBets {
+		if _, err := handlers.DB.GetBetByBetName(seed.Name); err == nil {
+			continue
+		} else if !errors.Is(err, apperr.ErrRecordNotFound) {
+			return fail("SEED", err)
+		}
+
+		authorID := userIDs[seed.Author]
+		bet := models.Bet{
+			Name:        seed.Name,
+			Description: seed.Description,
+			BetOptions:  pq.StringArray(seed.Options),
+			Status:      customTypes.Open,
+			EndsAt:      time.Now().Add(seed.Duration),
+			Author:      &authorID,
+		}
+		if err := handlers.DB.CreateBet(bet, authorID, seed.Option, seed.Amount); err != nil {
+			return fail("SEED", err)
+		}
+		fmt.Printf("[SEED] Created bet %q\n", seed.Name)
+	}
+
+	fmt.Printf("[SEED] Done, demo users log in with password %q\n", seedPassword)
+	return 0
+}
@@ -0,0 +1,320 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"gambler/backend/apiversion"
+	"gambler/backend/config"
+	"gambler/backend/database/migrations"
+	"gambler/backend/handlers"
+	"gambler/backend/handlers/routine"
+	"gambler/backend/handlers/websocket"
+	"gambler/backend/health"
+	"gambler/backend/keyring"
+	"gambler/backend/lifecycle"
+	"gambler/backend/mailer"
+	"gambler/backend/metrics"
+	"gambler/backend/middleware"
+	"gambler/backend/notifier"
+	"gambler/backend/openapi"
+	apikeysController "gambler/backend/routes/apikeys/controller"
+	apikeysService "gambler/backend/routes/apikeys/service"
+	authController "gambler/backend/routes/auth/controller"
+	authService "gambler/backend/routes/auth/service"
+	betsController "gambler/backend/routes/bets/controller"
+	rootController "gambler/backend/routes/root/controller"
+	userController "gambler/backend/routes/user/controller"
+	webhooksController "gambler/backend/routes/webhooks/controller"
+	webhooksService "gambler/backend/routes/webhooks/service"
+	wsController "gambler/backend/routes/ws/controller"
+	"gambler/backend/tools"
+	"gambler/backend/tracing"
+	"log/slog"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+)
+
+// runServe starts the HTTP and websocket server and keeps it running until
+// SIGINT or SIGTERM, then shuts every component down gracefully
+func runServe(cfg *config.Config, args []string) int {
+	if len(args) > 0 {
+		return usageError("serve does not take arguments")
+	}
+
+	slog.Info("loaded configuration", "config", cfg.Redacted())
+
+	manager := lifecycle.New(cfg.Server.ShutdownTimeout)
+	health.Checks.DrainOn(manager.Stopping())
+
+	// Started first and stopped last so the spans of every other
+	// component's shutdown are still exported
+	var shutdownTracing func(context.Context) error
+	manager.Add(lifecycle.Component{
+		Name: "tracing",
+		Start: func(ctx context.Context) error {
+			var err error
+			shutdownTracing, err = tracing.Init(ctx, cfg.Tracing)
+			return err
+		},
+		Stop: func(ctx context.Context) error {
+			return shutdownTracing(ctx)
+		},
+	})
+
+	manager.Add(lifecycle.Component{
+		Name: "database",
+		Start: func(ctx context.Context) error {
+			handlers.NewDB(cfg.Database)
+			handlers.NewValidator()
+			metrics.RegisterBetCollector(betStats)
+
+			migrator, err := migrations.New(handlers.DB.DB)
+			if err != nil {
+				return err
+			}
+			health.Checks.Register(health.Check{Name: "database", Run: handlers.DB.Ping})
+			health.Checks.Register(health.Check{
+				Name:     "migrations",
+				Run:      pendingMigrations(migrator),
+				CacheFor: time.Minute,
+			})
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return handlers.DB.Close()
+		},
+	})
+
+	manager.Add(lifecycle.Component{
+		Name: "cache",
+		Start: func(ctx context.Context) error {
+			handlers.NewCache(cfg.Redis)
+			health.Checks.Register(health.Check{Name: "redis", Run: handlers.Cache.Ping})
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return handlers.Cache.Close()
+		},
+	})
+
+	manager.Add(lifecycle.Component{
+		Name: "notifier",
+		Start: func(ctx context.Context) error {
+			dispatcher, err := notifier.New(cfg.Alerting)
+			if err != nil {
+				return err
+			}
+			dispatcher.Start()
+			notifier.Alerts = dispatcher
+			return nil
+		},
+		// Delivers the alerts raised while the other components shut down
+		Stop: func(ctx context.Context) error {
+			return notifier.Alerts.Flush(ctx)
+		},
+	})
+
+	manager.Add(lifecycle.Component{
+		Name: "mailer",
+		Start: func(ctx context.Context) error {
+			mail, err := mailer.New(cfg.Mail)
+			if err != nil {
+				return err
+			}
+			mailer.Mail = mail
+			return nil
+		},
+		// Sends the emails of the last requests
+		Stop: func(ctx context.Context) error {
+			return mailer.Mail.Close(ctx)
+		},
+	})
+
+	var rotation *routine.KeyRotation
+	manager.Add(lifecycle.Component{
+		Name: "signing keys",
+		Start: func(ctx context.Context) error {
+			ring, err := keyring.New(cfg.Auth)
+			if err != nil {
+				return err
+			}
+			// Creates the first key on a fresh database
+			if err := ring.Refresh(ctx); err != nil {
+				return err
+			}
+			if _, err := ring.Signing(); err != nil {
+				return err
+			}
+			keyring.Ring = ring
+			rotation = routine.StartKeyRotation(ring)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return rotation.Stop(ctx)
+		},
+	})
+
+	var expiry *routine.ExpiryListener
+	manager.Add(lifecycle.Component{
+		Name: "expiry scheduler",
+		Start: func(ctx context.Context) error {
+			expiry = routine.ListenForExpiredKeys(cfg.Redis.DB)
+			health.Checks.Register(health.Check{Name: "expiry_subscriber", Run: expiry.Alive, Liveness: true})
+			health.Checks.Register(health.Check{Name: "expiry_heartbeat", Run: expiry.Heartbeat})
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return expiry.Stop(ctx)
+		},
+	})
+
+	var webhooks *routine.WebhookWorker
+	manager.Add(lifecycle.Component{
+		Name: "webhooks",
+		Start: func(ctx context.Context) error {
+			webhooks = routine.StartWebhookWorker(cfg.Webhooks)
+			health.Checks.Register(health.Check{Name: "webhook_worker", Run: webhooks.Alive, Liveness: true})
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return webhooks.Stop(ctx)
+		},
+	})
+
+	manager.Add(lifecycle.Component{
+		Name: "websocket",
+		Start: func(ctx context.Context) error {
+			websocket.NewWebSocketHandler(&handlers.Cache, cfg.WebSocket)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return websocket.WebSocket.CloseAll(ctx)
+		},
+	})
+
+	cookies := tools.NewCookies(cfg.Cookies)
+	app := newApp(cfg, cookies)
+	manager.Add(lifecycle.Component{
+		Name: "http",
+		Start: func(ctx context.Context) error {
+			registerRoutes(app, cfg, cookies)
+			go func() {
+				if err := app.Listen(cfg.Server.Addr()); err != nil {
+					manager.Fail(fmt.Errorf("http server stopped: %w", err))
+				}
+			}()
+			return nil
+		},
+		// Keeps serving while /readyz reports the shutdown, then waits for
+		// in-flight requests such as bet placements to finish
+		Stop: func(ctx context.Context) error {
+			select {
+			case <-time.After(cfg.Server.DrainDelay):
+			case <-ctx.Done():
+			}
+			return app.ShutdownWithContext(ctx)
+		},
+	})
+
+	if err := manager.Run(context.Background()); err != nil {
+		return fail("SERVER", err)
+	}
+	return 0
+}
+
+// pendingMigrations fails while the schema is behind the binary
+func pendingMigrations(migrator *migrations.Migrator) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations, run gambler migrate up", len(pending))
+		}
+		return nil
+	}
+}
+
+func betStats() ([]metrics.BetStat, error) {
+	stats, err := handlers.DB.GetBetStats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bet stats: %w", err)
+	}
+	return *stats, nil
+}
+
+// jwksHandler publishes the public signing keys, so other services can
+// verify the access tokens without asking this one
+func jwksHandler(c *fiber.Ctx) error {
+	if keyring.Ring == nil {
+		return fiber.ErrServiceUnavailable
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(keyring.Ring.JWKS())
+}
+
+func newApp(cfg *config.Config, cookies *tools.Cookies) *fiber.App {
+	app := fiber.New(fiber.Config{
+		JSONEncoder:  json.Marshal,
+		JSONDecoder:  json.Unmarshal,
+		ErrorHandler: tools.ErrorHandler,
+		// c.IP() only takes the client address from the proxy header on
+		// requests coming from one of the trusted proxies
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxies,
+		ProxyHeader:             cfg.Server.ProxyHeader,
+	})
+
+	tools.ConfigureApp(app, cfg.Server)
+	app.Use(middleware.CSRF(cfg.Auth.CookieSecret, cookies, middleware.NewAuth(cfg.Auth, cookies).RefreshSession))
+	return app
+}
+
+// registerRoutes mounts every route group, it needs the stores to be open
+// because some routes wrap the Redis backed response cache
+func registerRoutes(app *fiber.App, cfg *config.Config, cookies *tools.Cookies) {
+	guards := middleware.NewAuth(cfg.Auth, cookies)
+	v1 := v1Routes(
+		guards,
+		authService.New(cfg.Auth, cfg.Mail, cfg.OIDC, guards, cookies),
+		apikeysService.New(cfg.Auth, guards),
+		webhooksService.New(cfg.Webhooks, guards),
+	)
+
+	app.Get("/openapi.json", openapi.Handler())
+	app.Get("/docs", openapi.DocsHandler())
+	app.Get("/docs/:file", openapi.DocsAssetHandler())
+	app.Get("/.well-known/jwks.json", jwksHandler)
+
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.Status(200).JSON(tools.GlobalErrorHandlerResp{
+			Success: true,
+			Message: "Welcome to Gambler API",
+			Code:    200,
+		})
+	})
+
+	// The websocket protocol carries its own version in every frame
+	wsController.InitWsRoute(app, guards, cookies)
+
+	apiversion.V1.Mount(app, v1)
+	// Mounted last, its middleware matches every path
+	legacy := apiversion.Legacy(cfg.Server.LegacyDeprecatedTime(), cfg.Server.LegacySunsetTime())
+	legacy.Mount(app, v1)
+}
+
+// v1Routes returns the registration of the route groups of version 1 of
+// the API
+func v1Routes(guards *middleware.Auth, auth *authService.Service, apikeys *apikeysService.Service, webhooks *webhooksService.Service) func(fiber.Router) {
+	return func(router fiber.Router) {
+		userController.InitUserRoute(router, guards)
+		authController.InitAuthRoute(router, guards, auth)
+		betsController.InitBetsRoute(router, guards)
+		rootController.InitRootRoute(router, guards)
+		webhooksController.InitWebhooksRoute(router, guards, webhooks)
+		apikeysController.InitAPIKeysRoute(router, guards, apikeys)
+	}
+}
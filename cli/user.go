@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/config"
+	"gambler/backend/database/models"
+	"gambler/backend/database/models/customTypes"
+	"gambler/backend/handlers"
+	"gambler/backend/password"
+	"strconv"
+)
+
+// runUser implements `user create-admin`, `user set-balance`,
+// `user sign-out` and `user unlock`
+func runUser(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		return usageError("user needs a subcommand")
+	}
+	switch args[0] {
+	case "create-admin":
+		return runCreateAdmin(cfg, args[1:])
+	case "set-balance":
+		return runSetBalance(cfg, args[1:])
+	case "sign-out":
+		return runSignOut(cfg, args[1:])
+	case "unlock":
+		return runUnlock(cfg, args[1:])
+	default:
+		return usageError("unknown user subcommand %q", args[0])
+	}
+}
+
+func runCreateAdmin(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("user create-admin", flag.ContinueOnError)
+	plain := fs.String("password", "", "password of the new account, generated when empty")
+	name := fs.String("name", "Administrator", "display name of the new account")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		return usageError("usage: gambler user create-admin [-password pw] [-name name] <username> <email>")
+	}
+	username, email := fs.Arg(0), fs.Arg(1)
+
+	openStores(cfg)
+
+	// Promote the account when it already exists
+	if user, err := handlers.DB.GetUserByUsername(username); err == nil {
+		if _, err := operatorDB().SetUserRole(user.ID, customTypes.RoleAdmin); err != nil {
+			return fail("USER", err)
+		}
+		fmt.Printf("[USER] Promoted %s (%d) to admin\n", user.Username, user.ID)
+		return 0
+	} else if !errors.Is(err, apperr.ErrRecordNotFound) {
+		return fail("USER", err)
+	}
+
+	generated := *plain == ""
+	if generated {
+		*plain = randomPassword()
+	}
+	hashed, hashErr := password.New(cfg.Auth).Hash(*plain)
+	if hashErr != nil {
+		return fail("USER", hashErr)
+	}
+
+	_, err := operatorDB().CreateAdmin(models.User{
+		Username: username,
+		Password: hashed,
+		Email:    email,
+		Name:     *name,
+	})
+	if err != nil {
+		return fail("USER", err)
+	}
+
+	fmt.Printf("[USER] Created admin %s\n", username)
+	if generated {
+		fmt.Printf("[USER] Generated password: %s\n", *plain)
+	}
+	return 0
+}
+
+func runSetBalance(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("user set-balance", flag.ContinueOnError)
+	reason := fs.String("reason", "Balance set by operator", "reason stored in the balance history")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		return usageError("usage: gambler user set-balance [-reason text] <username> <amount>")
+	}
+	amount, parseErr := strconv.ParseFloat(fs.Arg(1), 64)
+	if parseErr != nil || amount < 0 {
+		return usageError("invalid amount %q", fs.Arg(1))
+	}
+
+	openStores(cfg)
+
+	user, err := handlers.DB.GetUserByUsername(fs.Arg(0))
+	if err != nil {
+		return fail("USER", err)
+	}
+
+	updated, previous, err := operatorDB().SetUserBalance(user.ID, amount, *reason)
+	if err != nil {
+		return fail("USER", err)
+	}
+
+	fmt.Printf("[USER] Balance of %s changed from %.2f to %.2f\n", user.Username, previous, updated.Balance)
+	return 0
+}
+
+// runSignOut ends every session of a user, e.g. before banning the account,
+// and rejects the access tokens already issued to them
+func runSignOut(cfg *config.Config, args []string) int {
+	if len(args) != 1 {
+		return usageError("usage: gambler user sign-out <username>")
+	}
+
+	openStores(cfg)
+
+	user, err := handlers.DB.GetUserByUsername(args[0])
+	if err != nil {
+		return fail("USER", err)
+	}
+	revoked, err := operatorDB().RevokeAllSessions(user.ID, handlers.RevokedByOperator)
+	if err != nil {
+		return fail("USER", err)
+	}
+	if err := handlers.Cache.DenySessions(revoked, cfg.Auth.AccessTokenTTL); err != nil {
+		return fail("USER", err)
+	}
+
+	fmt.Printf("[USER] Signed %s out of %d sessions\n", user.Username, len(revoked))
+	return 0
+}
+
+// runUnlock lifts the lock of an account after failed sign ins
+func runUnlock(cfg *config.Config, args []string) int {
+	if len(args) != 1 {
+		return usageError("usage: gambler user unlock <username>")
+	}
+
+	openStores(cfg)
+
+	user, err := handlers.DB.GetUserByUsername(args[0])
+	if err != nil {
+		return fail("USER", err)
+	}
+	locked, err := handlers.Cache.UnlockLogin(user.Username)
+	if err != nil {
+		return fail("USER", err)
+	}
+	err = operatorDB().RecordAudit(audit.ActionUserUnlock, audit.TargetUser, user.ID, nil, map[string]interface{}{
+		"locked": locked,
+	})
+	if err != nil {
+		return fail("USER", err)
+	}
+
+	if locked {
+		fmt.Printf("[USER] Unlocked %s\n", user.Username)
+	} else {
+		fmt.Printf("[USER] %s was not locked, cleared the failed sign ins\n", user.Username)
+	}
+	return 0
+}
+
+func randomPassword() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
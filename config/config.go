@@ -0,0 +1,538 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type (
+	// Config is the complete runtime configuration of the service. Every
+	// field can be set from a default, the optional JSON config file, an
+	// environment variable and a command line flag, in that order of
+	// precedence. Fields tagged secret are redacted when printed.
+	Config struct {
+		Server    ServerConfig    `json:"server"`
+		Database  DatabaseConfig  `json:"database"`
+		Redis     RedisConfig     `json:"redis"`
+		Auth      AuthConfig      `json:"auth"`
+		WebSocket WebSocketConfig `json:"websocket"`
+		Alerting  AlertingConfig  `json:"alerting"`
+		Logging   LoggingConfig   `json:"logging"`
+		Tracing   TracingConfig   `json:"tracing"`
+		Webhooks  WebhookConfig   `json:"webhooks"`
+		Mail      MailConfig      `json:"mail"`
+		OIDC      OIDCConfig      `json:"oidc"`
+		Cookies   CookieConfig    `json:"cookies"`
+	}
+
+	ServerConfig struct {
+		Host             string        `json:"host" env:"HOST" usage:"interface the HTTP server listens on"`
+		Port             int           `json:"port" env:"PORT" default:"4201" usage:"port the HTTP server listens on"`
+		CORSOrigins      []string      `json:"cors_origins" env:"CORS_ORIGINS" default:"http://localhost:4200" usage:"comma separated origins allowed to call the API with cookies, e.g. https://gambler.example.com"`
+		ProxyHeader      string        `json:"proxy_header" env:"PROXY_HEADER" usage:"header the reverse proxy sets to the client address, e.g. X-Real-IP, only read on requests from server.trusted_proxies"`
+		TrustedProxies   []string      `json:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"comma separated addresses or CIDR ranges of the reverse proxies"`
+		RateLimitMax     int           `json:"rate_limit_max" env:"RATE_LIMIT_MAX" default:"20" usage:"requests allowed per client and window"`
+		RateLimitWindow  time.Duration `json:"rate_limit_window" env:"RATE_LIMIT_WINDOW" default:"1m" usage:"window of the rate limiter"`
+		ShutdownTimeout  time.Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"15s" usage:"time allowed for a graceful shutdown"`
+		DrainDelay       time.Duration `json:"drain_delay" env:"DRAIN_DELAY" default:"0s" usage:"time /readyz reports shutting down before the server stops accepting requests"`
+		LegacyDeprecated string        `json:"legacy_deprecated" env:"API_LEGACY_DEPRECATED" default:"2026-10-19T00:00:00Z" usage:"RFC 3339 time the unversioned routes were deprecated, sent in the Deprecation header"`
+		LegacySunset     string        `json:"legacy_sunset" env:"API_LEGACY_SUNSET" usage:"RFC 3339 time the unversioned routes will be removed, sent in the Sunset header"`
+		MetricsToken     string        `json:"metrics_token" env:"METRICS_TOKEN" secret:"true" usage:"bearer token Prometheus sends to scrape /metrics, which is not served without one"`
+	}
+
+	DatabaseConfig struct {
+		DSN string `json:"dsn" env:"POSTGRES_DB" secret:"true" usage:"Postgres connection string"`
+	}
+
+	RedisConfig struct {
+		Host     string `json:"host" env:"REDIS_HOST" usage:"Redis host"`
+		Port     int    `json:"port" env:"REDIS_PORT" default:"6379" usage:"Redis port"`
+		Password string `json:"password" env:"REDIS_PSW" secret:"true" usage:"Redis password"`
+		DB       int    `json:"db" env:"REDIS_DB" default:"0" usage:"Redis database index"`
+	}
+
+	AuthConfig struct {
+		JWTSecret       string        `json:"jwt_secret" env:"JWT_SECRET" secret:"true" usage:"secret encrypting the token signing keys stored in the database"`
+		JWTAlgorithm    string        `json:"jwt_algorithm" env:"JWT_ALGORITHM" default:"EdDSA" usage:"algorithm of new token signing keys (EdDSA or RS256)"`
+		JWTKeyRotation  time.Duration `json:"jwt_key_rotation" env:"JWT_KEY_ROTATION" default:"720h" usage:"age after which a new key signs the tokens"`
+		JWTIssuer       string        `json:"jwt_issuer" env:"JWT_ISSUER" default:"gambler" usage:"iss of the tokens, also the aud of refresh tokens"`
+		JWTAudience     string        `json:"jwt_audience" env:"JWT_AUDIENCE" default:"gambler-api" usage:"aud of access tokens, services verifying them with the JWKS check it"`
+		HashSecret      string        `json:"hash_secret" env:"HASH_SECRET" secret:"true" usage:"secret prefixed to passwords of bcrypt hashes and keying recovery code hashes"`
+		CookieSecret    string        `json:"cookie_secret" env:"COOKIE_SECRET" secret:"true" usage:"secret signing the CSRF tokens"`
+		AccessTokenTTL  time.Duration `json:"access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"15m" usage:"lifetime of access tokens"`
+		RefreshTokenTTL time.Duration `json:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" default:"168h" usage:"lifetime of refresh tokens"`
+		BcryptCost      int           `json:"bcrypt_cost" env:"BCRYPT_COST" default:"10" usage:"bcrypt cost for new password hashes"`
+		PasswordHasher  string        `json:"password_hasher" env:"PASSWORD_HASHER" default:"argon2id" usage:"hash of new passwords (argon2id or bcrypt)"`
+		Argon2Memory    int           `json:"argon2_memory" env:"ARGON2_MEMORY" default:"19456" usage:"memory of argon2id password hashes in KiB"`
+		Argon2Time      int           `json:"argon2_time" env:"ARGON2_TIME" default:"2" usage:"passes of argon2id password hashes"`
+		Argon2Threads   int           `json:"argon2_threads" env:"ARGON2_THREADS" default:"1" usage:"lanes of argon2id password hashes"`
+		PasswordPeppers []string      `json:"password_peppers" env:"PASSWORD_PEPPERS" secret:"true" usage:"comma separated id=secret peppers of argon2id password hashes, alphanumeric ids of up to 8 characters"`
+		PasswordPepper  string        `json:"password_pepper" env:"PASSWORD_PEPPER_ID" usage:"id of the pepper of new argon2id password hashes, empty for none"`
+		MasterIDs       []string      `json:"master_ids" env:"MASTER_IDS" usage:"comma separated user ids that always have admin rights"`
+		VerifyEmailTTL  time.Duration `json:"verify_email_ttl" env:"VERIFY_EMAIL_TTL" default:"48h" usage:"lifetime of email verification links"`
+		ResetTTL        time.Duration `json:"reset_ttl" env:"PASSWORD_RESET_TTL" default:"1h" usage:"lifetime of password reset links"`
+		MFAIssuer       string        `json:"mfa_issuer" env:"MFA_ISSUER" default:"Gambler" usage:"name authenticator apps show for the account"`
+		MFAChallengeTTL time.Duration `json:"mfa_challenge_ttl" env:"MFA_CHALLENGE_TTL" default:"5m" usage:"time allowed to enter the second factor after the password"`
+		AdminRequireMFA bool          `json:"admin_require_mfa" env:"ADMIN_REQUIRE_MFA" default:"false" usage:"deny the admin routes to admins without two-factor authentication"`
+		// Failed sign ins are counted per username and per client address
+		LoginFailureWindow time.Duration `json:"login_failure_window" env:"LOGIN_FAILURE_WINDOW" default:"1h" usage:"time a failed sign in is counted"`
+		LoginDelayAfter    int           `json:"login_delay_after" env:"LOGIN_DELAY_AFTER" default:"3" usage:"failed sign ins of an account before each next one has to wait"`
+		LoginDelay         time.Duration `json:"login_delay" env:"LOGIN_DELAY" default:"1s" usage:"first wait after login_delay_after failures, doubled on each failure"`
+		LockoutThreshold   int           `json:"lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD" default:"10" usage:"failed sign ins that lock an account"`
+		IPLockoutThreshold int           `json:"ip_lockout_threshold" env:"LOGIN_IP_LOCKOUT_THRESHOLD" default:"50" usage:"failed sign ins that lock a client address"`
+		LockoutDuration    time.Duration `json:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" default:"15m" usage:"time a locked account or address cannot sign in"`
+		APIKeysPerUser     int           `json:"api_keys_per_user" env:"API_KEYS_PER_USER" default:"10" usage:"API keys a user can create, 0 for no limit"`
+	}
+
+	WebSocketConfig struct {
+		Version int `json:"version" env:"WEBSOCKET_VERSION" default:"1" usage:"websocket protocol version sent in every frame"`
+	}
+
+	AlertingConfig struct {
+		DiscordWebhookURL string        `json:"discord_webhook_url" env:"ALERT_DISCORD_WEBHOOK_URL" secret:"true" usage:"Discord webhook receiving alerts"`
+		SlackWebhookURL   string        `json:"slack_webhook_url" env:"ALERT_SLACK_WEBHOOK_URL" secret:"true" usage:"Slack incoming webhook receiving alerts"`
+		HTTPURL           string        `json:"http_url" env:"ALERT_HTTP_URL" secret:"true" usage:"endpoint receiving alerts as JSON"`
+		HTTPAuthorization string        `json:"http_authorization" env:"ALERT_HTTP_AUTHORIZATION" secret:"true" usage:"Authorization header sent to alerting.http_url"`
+		File              string        `json:"file" env:"ALERT_FILE" default:"stdout" usage:"file alerts are appended to, \"stdout\" or empty to disable"`
+		MinSeverity       string        `json:"min_severity" env:"ALERT_MIN_SEVERITY" default:"warning" usage:"lowest severity delivered (info, warning, error, critical)"`
+		QueueSize         int           `json:"queue_size" env:"ALERT_QUEUE_SIZE" default:"256" usage:"alerts buffered before new ones are dropped"`
+		MaxRetries        int           `json:"max_retries" env:"ALERT_MAX_RETRIES" default:"5" usage:"retries per destination"`
+		RetryBackoff      time.Duration `json:"retry_backoff" env:"ALERT_RETRY_BACKOFF" default:"1s" usage:"delay before the first retry, doubled on each attempt"`
+		DedupWindow       time.Duration `json:"dedup_window" env:"ALERT_DEDUP_WINDOW" default:"5m" usage:"period in which identical alerts are delivered once"`
+	}
+
+	LoggingConfig struct {
+		Level              string        `json:"level" env:"LOG_LEVEL" default:"info" usage:"lowest level logged (debug, info, warn, error)"`
+		Format             string        `json:"format" env:"LOG_FORMAT" default:"json" usage:"log output format (json or text)"`
+		Components         []string      `json:"components" env:"LOG_COMPONENTS" usage:"comma separated component=level overrides, e.g. websocket=debug,database=warn"`
+		SlowQueryThreshold time.Duration `json:"slow_query_threshold" env:"LOG_SLOW_QUERY_THRESHOLD" default:"500ms" usage:"queries slower than this are logged as warnings"`
+	}
+
+	TracingConfig struct {
+		Exporter      string   `json:"exporter" env:"TRACING_EXPORTER" default:"none" usage:"where spans are sent (none, otlp, stdout or file)"`
+		OTLPEndpoint  string   `json:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"http://localhost:4318" usage:"URL of the OTLP/HTTP collector"`
+		OTLPHeaders   []string `json:"otlp_headers" env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true" usage:"comma separated key=value headers sent to the collector"`
+		File          string   `json:"file" env:"TRACING_FILE" default:"traces.json" usage:"file spans are appended to by the file exporter"`
+		ServiceName   string   `json:"service_name" env:"OTEL_SERVICE_NAME" default:"gambler-backend" usage:"service.name resource attribute"`
+		SamplePercent int      `json:"sample_percent" env:"TRACING_SAMPLE_PERCENT" default:"100" usage:"percentage of new traces that are recorded"`
+	}
+
+	WebhookConfig struct {
+		PollInterval         time.Duration `json:"poll_interval" env:"WEBHOOK_POLL_INTERVAL" default:"5s" usage:"how often due webhook deliveries are picked up"`
+		BatchSize            int           `json:"batch_size" env:"WEBHOOK_BATCH_SIZE" default:"20" usage:"deliveries sent per poll"`
+		Timeout              time.Duration `json:"timeout" env:"WEBHOOK_TIMEOUT" default:"10s" usage:"time a webhook endpoint has to answer"`
+		MaxAttempts          int           `json:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"8" usage:"attempts before a delivery is marked failed"`
+		RetryBackoff         time.Duration `json:"retry_backoff" env:"WEBHOOK_RETRY_BACKOFF" default:"30s" usage:"delay before the first retry, doubled on each attempt"`
+		MaxPerUser           int           `json:"max_per_user" env:"WEBHOOK_MAX_PER_USER" default:"10" usage:"webhooks a user can register"`
+		AllowPrivateNetworks bool          `json:"allow_private_networks" env:"WEBHOOK_ALLOW_PRIVATE_NETWORKS" default:"false" usage:"allow webhook URLs that resolve to loopback or private addresses"`
+	}
+
+	MailConfig struct {
+		Transport    string        `json:"transport" env:"MAIL_TRANSPORT" default:"file" usage:"how emails are sent (smtp or file)"`
+		File         string        `json:"file" env:"MAIL_FILE" default:"stdout" usage:"file the file transport appends emails to, or stdout"`
+		From         string        `json:"from" env:"MAIL_FROM" default:"Gambler <no-reply@localhost>" usage:"sender address of the emails"`
+		LinkBaseURL  string        `json:"link_base_url" env:"MAIL_LINK_BASE_URL" default:"http://localhost:4200" usage:"frontend URL the links in emails point to"`
+		SMTPHost     string        `json:"smtp_host" env:"SMTP_HOST" usage:"SMTP server of the smtp transport"`
+		SMTPPort     int           `json:"smtp_port" env:"SMTP_PORT" default:"587" usage:"SMTP port, STARTTLS is used when offered"`
+		SMTPUsername string        `json:"smtp_username" env:"SMTP_USERNAME" usage:"SMTP user, empty to send without authentication"`
+		SMTPPassword string        `json:"smtp_password" env:"SMTP_PASSWORD" secret:"true" usage:"SMTP password"`
+		Timeout      time.Duration `json:"timeout" env:"MAIL_TIMEOUT" default:"30s" usage:"time allowed to send one email"`
+	}
+
+	// CookieConfig sets the attributes of the cookies the server sets
+	CookieConfig struct {
+		Secure     bool   `json:"secure" env:"COOKIE_SECURE" default:"true" usage:"only send cookies over HTTPS, browsers make an exception for http://localhost"`
+		Domain     string `json:"domain" env:"COOKIE_DOMAIN" usage:"domain sharing the cookies with its subdomains, empty for the API host only"`
+		HostPrefix bool   `json:"host_prefix" env:"COOKIE_HOST_PREFIX" default:"false" usage:"prefix the cookie names with __Host-, which keeps subdomains from setting them; needs cookies.secure and no cookies.domain"`
+		SameSite   string `json:"same_site" env:"COOKIE_SAMESITE" default:"Lax" usage:"SameSite of the cookies (Strict, Lax or None)"`
+	}
+
+	// OIDCConfig configures single sign-on with an OpenID Connect identity
+	// provider, it is disabled while Issuer is empty
+	OIDCConfig struct {
+		Issuer       string        `json:"issuer" env:"OIDC_ISSUER" usage:"issuer URL of the identity provider, empty disables single sign-on"`
+		ClientID     string        `json:"client_id" env:"OIDC_CLIENT_ID" usage:"client id registered at the identity provider"`
+		ClientSecret string        `json:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" usage:"client secret, empty for a public client"`
+		RedirectURL  string        `json:"redirect_url" env:"OIDC_REDIRECT_URL" usage:"callback URL registered at the identity provider, ending in /v1/auth/oidc/callback"`
+		Scopes       []string      `json:"scopes" env:"OIDC_SCOPES" default:"openid,profile,email" usage:"comma separated scopes requested from the identity provider"`
+		GroupsClaim  string        `json:"groups_claim" env:"OIDC_GROUPS_CLAIM" default:"groups" usage:"ID token claim listing the groups of the user"`
+		AdminGroups  []string      `json:"admin_groups" env:"OIDC_ADMIN_GROUPS" usage:"comma separated groups whose members are admins, empty to leave roles alone"`
+		CreateUsers  bool          `json:"create_users" env:"OIDC_CREATE_USERS" default:"true" usage:"create an account on the first single sign-on of a new identity"`
+		LinkByEmail  bool          `json:"link_by_email" env:"OIDC_LINK_BY_EMAIL" default:"true" usage:"link a new identity to the account with its verified email address"`
+		PostLoginURL string        `json:"post_login_url" env:"OIDC_POST_LOGIN_URL" default:"http://localhost:4200" usage:"frontend URL users are sent to after signing in"`
+		StateTTL     time.Duration `json:"state_ttl" env:"OIDC_STATE_TTL" default:"10m" usage:"time allowed to sign in at the identity provider"`
+		Timeout      time.Duration `json:"timeout" env:"OIDC_TIMEOUT" default:"10s" usage:"time the identity provider has to answer"`
+	}
+)
+
+// Addr returns the address the HTTP server listens on
+func (s ServerConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// LegacyDeprecatedTime returns the parsed LegacyDeprecated, zero when it is
+// not set
+func (s ServerConfig) LegacyDeprecatedTime() time.Time {
+	t, _ := time.Parse(time.RFC3339, s.LegacyDeprecated)
+	return t
+}
+
+// LegacySunsetTime returns the parsed LegacySunset, zero when it is not set
+func (s ServerConfig) LegacySunsetTime() time.Time {
+	t, _ := time.Parse(time.RFC3339, s.LegacySunset)
+	return t
+}
+
+// Enabled reports whether single sign-on is configured
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+// isLoopback reports whether host names the local machine, where a mock
+// identity provider may run without TLS
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Peppers returns the parsed PasswordPeppers by id
+func (a AuthConfig) Peppers() map[string]string {
+	peppers := map[string]string{}
+	for _, pepper := range a.PasswordPeppers {
+		if id, secret, ok := strings.Cut(pepper, "="); ok {
+			peppers[strings.TrimSpace(id)] = secret
+		}
+	}
+	return peppers
+}
+
+// IsMaster reports whether the user id is listed in MasterIDs
+func (a AuthConfig) IsMaster(userId string) bool {
+	for _, id := range a.MasterIDs {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports every missing or out of range setting at once
+func (c *Config) Validate() error {
+	problems := []string{}
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		add("server.port must be between 1 and 65535")
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		add("server.cors_origins must not be empty")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			add("server.cors_origins must only list origins like https://example.com, got %q", origin)
+		}
+	}
+	if c.Server.ProxyHeader != "" && len(c.Server.TrustedProxies) == 0 {
+		add("server.trusted_proxies is required with server.proxy_header, or any client could set its own address")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			add("server.trusted_proxies must only list addresses or CIDR ranges, got %q", proxy)
+		}
+	}
+	if c.Server.RateLimitMax < 1 {
+		add("server.rate_limit_max must be positive")
+	}
+	if c.Server.RateLimitWindow <= 0 {
+		add("server.rate_limit_window must be positive")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		add("server.shutdown_timeout must be positive")
+	}
+	if c.Server.DrainDelay < 0 || c.Server.DrainDelay >= c.Server.ShutdownTimeout {
+		add("server.drain_delay must not be negative and shorter than server.shutdown_timeout")
+	}
+	if c.Server.LegacyDeprecated != "" {
+		if _, err := time.Parse(time.RFC3339, c.Server.LegacyDeprecated); err != nil {
+			add("server.legacy_deprecated must be an RFC 3339 time")
+		}
+	}
+	if c.Server.LegacySunset != "" {
+		if _, err := time.Parse(time.RFC3339, c.Server.LegacySunset); err != nil {
+			add("server.legacy_sunset must be an RFC 3339 time")
+		} else if c.Server.LegacySunsetTime().Before(c.Server.LegacyDeprecatedTime()) {
+			add("server.legacy_sunset must not be before server.legacy_deprecated")
+		}
+	}
+	if c.Database.DSN == "" {
+		add("database.dsn (POSTGRES_DB) is required")
+	}
+	if c.Redis.Host == "" {
+		add("redis.host (REDIS_HOST) is required")
+	}
+	if c.Redis.Port < 1 || c.Redis.Port > 65535 {
+		add("redis.port must be between 1 and 65535")
+	}
+	if c.Redis.DB < 0 {
+		add("redis.db must not be negative")
+	}
+	if c.Auth.JWTSecret == "" {
+		add("auth.jwt_secret (JWT_SECRET) is required")
+	}
+	if c.Auth.HashSecret == "" {
+		add("auth.hash_secret (HASH_SECRET) is required")
+	}
+	switch c.Auth.JWTAlgorithm {
+	case "EdDSA", "RS256":
+	default:
+		add("auth.jwt_algorithm must be EdDSA or RS256")
+	}
+	if c.Auth.JWTKeyRotation <= 0 {
+		add("auth.jwt_key_rotation must be positive")
+	}
+	if c.Auth.JWTIssuer == "" || c.Auth.JWTAudience == "" {
+		add("auth.jwt_issuer and auth.jwt_audience must not be empty")
+	} else if c.Auth.JWTIssuer == c.Auth.JWTAudience {
+		add("auth.jwt_audience must differ from auth.jwt_issuer, or refresh tokens would pass as access tokens")
+	}
+	if c.Auth.CookieSecret == "" {
+		add("auth.cookie_secret (COOKIE_SECRET) is required")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		add("auth.access_token_ttl must be positive")
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		add("auth.refresh_token_ttl must be longer than auth.access_token_ttl")
+	}
+	if c.Auth.VerifyEmailTTL <= 0 {
+		add("auth.verify_email_ttl must be positive")
+	}
+	if c.Auth.ResetTTL <= 0 {
+		add("auth.reset_ttl must be positive")
+	}
+	if c.Auth.MFAIssuer == "" || strings.Contains(c.Auth.MFAIssuer, ":") {
+		add("auth.mfa_issuer must not be empty or contain a colon")
+	}
+	if c.Auth.MFAChallengeTTL <= 0 {
+		add("auth.mfa_challenge_ttl must be positive")
+	}
+	if c.Auth.LoginFailureWindow <= 0 {
+		add("auth.login_failure_window must be positive")
+	}
+	if c.Auth.LoginDelayAfter < 0 {
+		add("auth.login_delay_after must not be negative")
+	}
+	if c.Auth.LoginDelay <= 0 {
+		add("auth.login_delay must be positive")
+	}
+	if c.Auth.LockoutThreshold <= c.Auth.LoginDelayAfter {
+		add("auth.lockout_threshold must be greater than auth.login_delay_after")
+	}
+	if c.Auth.IPLockoutThreshold < c.Auth.LockoutThreshold {
+		add("auth.ip_lockout_threshold must not be less than auth.lockout_threshold")
+	}
+	if c.Auth.LockoutDuration <= 0 {
+		add("auth.lockout_duration must be positive")
+	}
+	if c.Auth.APIKeysPerUser < 0 {
+		add("auth.api_keys_per_user must not be negative")
+	}
+	if c.Auth.BcryptCost < bcrypt.MinCost || c.Auth.BcryptCost > bcrypt.MaxCost {
+		add("auth.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	switch c.Auth.PasswordHasher {
+	case "argon2id", "bcrypt":
+	default:
+		add("auth.password_hasher must be argon2id or bcrypt")
+	}
+	if c.Auth.Argon2Threads < 1 || c.Auth.Argon2Threads > 255 {
+		add("auth.argon2_threads must be between 1 and 255")
+	}
+	if c.Auth.Argon2Memory < 8*c.Auth.Argon2Threads {
+		add("auth.argon2_memory must be at least 8 KiB per thread")
+	}
+	if c.Auth.Argon2Time < 1 {
+		add("auth.argon2_time must be positive")
+	}
+	for _, pepper := range c.Auth.PasswordPeppers {
+		id, secret, ok := strings.Cut(pepper, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || len(id) > 8 || strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" || secret == "" {
+			add("auth.password_peppers entries must look like id=secret with an alphanumeric id of up to 8 characters")
+			break
+		}
+	}
+	if c.Auth.PasswordPepper != "" {
+		if _, ok := c.Auth.Peppers()[c.Auth.PasswordPepper]; !ok {
+			add("auth.password_pepper must be the id of an entry of auth.password_peppers")
+		}
+	}
+	if c.WebSocket.Version < 1 || c.WebSocket.Version > 255 {
+		add("websocket.version must be between 1 and 255")
+	}
+	switch strings.ToLower(c.Alerting.MinSeverity) {
+	case "info", "warning", "error", "critical":
+	default:
+		add("alerting.min_severity must be one of info, warning, error, critical")
+	}
+	if c.Alerting.QueueSize < 1 {
+		add("alerting.queue_size must be positive")
+	}
+	if c.Alerting.MaxRetries < 0 {
+		add("alerting.max_retries must not be negative")
+	}
+	if c.Alerting.RetryBackoff <= 0 {
+		add("alerting.retry_backoff must be positive")
+	}
+	if c.Alerting.DedupWindow < 0 {
+		add("alerting.dedup_window must not be negative")
+	}
+	if !validLogLevel(c.Logging.Level) {
+		add("logging.level must be one of debug, info, warn, error")
+	}
+	switch strings.ToLower(c.Logging.Format) {
+	case "json", "text":
+	default:
+		add("logging.format must be json or text")
+	}
+	for _, override := range c.Logging.Components {
+		component, level, ok := strings.Cut(override, "=")
+		if !ok || strings.TrimSpace(component) == "" || !validLogLevel(level) {
+			add("logging.components entry %q must look like component=level", override)
+		}
+	}
+	if c.Logging.SlowQueryThreshold <= 0 {
+		add("logging.slow_query_threshold must be positive")
+	}
+	switch strings.ToLower(c.Tracing.Exporter) {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.OTLPEndpoint == "" {
+			add("tracing.otlp_endpoint (OTEL_EXPORTER_OTLP_ENDPOINT) is required by the otlp exporter")
+		}
+	case "file":
+		if c.Tracing.File == "" {
+			add("tracing.file (TRACING_FILE) is required by the file exporter")
+		}
+	default:
+		add("tracing.exporter must be one of none, otlp, stdout, file")
+	}
+	for _, header := range c.Tracing.OTLPHeaders {
+		if name, _, ok := strings.Cut(header, "="); !ok || strings.TrimSpace(name) == "" {
+			add("tracing.otlp_headers entries must look like key=value")
+			break
+		}
+	}
+	if c.Tracing.SamplePercent < 0 || c.Tracing.SamplePercent > 100 {
+		add("tracing.sample_percent must be between 0 and 100")
+	}
+	if c.Webhooks.PollInterval <= 0 {
+		add("webhooks.poll_interval must be positive")
+	}
+	if c.Webhooks.BatchSize < 1 {
+		add("webhooks.batch_size must be positive")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		add("webhooks.timeout must be positive")
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		add("webhooks.max_attempts must be positive")
+	}
+	if c.Webhooks.RetryBackoff <= 0 {
+		add("webhooks.retry_backoff must be positive")
+	}
+	if c.Webhooks.MaxPerUser < 0 {
+		add("webhooks.max_per_user must not be negative")
+	}
+	switch strings.ToLower(c.Mail.Transport) {
+	case "file":
+		if c.Mail.File == "" {
+			add("mail.file (MAIL_FILE) is required by the file transport")
+		}
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			add("mail.smtp_host (SMTP_HOST) is required by the smtp transport")
+		}
+		if c.Mail.SMTPPort < 1 || c.Mail.SMTPPort > 65535 {
+			add("mail.smtp_port must be between 1 and 65535")
+		}
+	default:
+		add("mail.transport must be smtp or file")
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		add("mail.from must be an email address")
+	}
+	if u, err := url.Parse(c.Mail.LinkBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("mail.link_base_url must be an http or https URL")
+	}
+	if c.Mail.Timeout <= 0 {
+		add("mail.timeout must be positive")
+	}
+	if c.OIDC.Enabled() {
+		if u, err := url.Parse(c.OIDC.Issuer); err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname()))) {
+			add("oidc.issuer must be an https URL, or http on localhost")
+		}
+		if c.OIDC.ClientID == "" {
+			add("oidc.client_id (OIDC_CLIENT_ID) is required with oidc.issuer")
+		}
+		if u, err := url.Parse(c.OIDC.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("oidc.redirect_url must be an http or https URL")
+		}
+		if u, err := url.Parse(c.OIDC.PostLoginURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("oidc.post_login_url must be an http or https URL")
+		}
+		found := false
+		for _, scope := range c.OIDC.Scopes {
+			found = found || scope == "openid"
+		}
+		if !found {
+			add("oidc.scopes must contain openid")
+		}
+		if c.OIDC.GroupsClaim == "" && len(c.OIDC.AdminGroups) > 0 {
+			add("oidc.groups_claim is required with oidc.admin_groups")
+		}
+		if c.OIDC.StateTTL <= 0 {
+			add("oidc.state_ttl must be positive")
+		}
+		if c.OIDC.Timeout <= 0 {
+			add("oidc.timeout must be positive")
+		}
+	}
+	switch c.Cookies.SameSite {
+	case "Strict", "Lax":
+	case "None":
+		if !c.Cookies.Secure {
+			add("cookies.same_site None needs cookies.secure")
+		}
+	default:
+		add("cookies.same_site must be Strict, Lax or None")
+	}
+	if c.Cookies.HostPrefix && (!c.Cookies.Secure || c.Cookies.Domain != "") {
+		add("cookies.host_prefix needs cookies.secure and no cookies.domain")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validLogLevel(level string) bool {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug", "info", "warn", "warning", "error":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// load reads the defaults, the required secrets and args
+func load(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	t.Setenv("POSTGRES_DB", "postgres://localhost/gambler")
+	t.Setenv("REDIS_HOST", "localhost")
+	t.Setenv("JWT_SECRET", "jwt")
+	t.Setenv("HASH_SECRET", "hash")
+	t.Setenv("COOKIE_SECRET", "cookie")
+	cfg, _, err := Load(args)
+	return cfg, err
+}
+
+func TestValidateProxies(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"direct", nil, ""},
+		{"trusted proxies", []string{"-server.proxy_header=X-Real-IP", "-server.trusted_proxies=10.0.0.0/8,192.0.2.7"}, ""},
+		{"header without proxies", []string{"-server.proxy_header=X-Real-IP"}, "server.trusted_proxies is required"},
+		{"invalid proxy", []string{"-server.proxy_header=X-Real-IP", "-server.trusted_proxies=proxy.local"}, `got "proxy.local"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(t, tt.args...)
+			if tt.want == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		err  string
+	}{
+		{"default", nil, []string{"http://localhost:4200"}, ""},
+		{"configured", []string{"-server.cors_origins=https://gambler.example.com,https://admin.example.com"}, []string{"https://gambler.example.com", "https://admin.example.com"}, ""},
+		{"path", []string{"-server.cors_origins=https://gambler.example.com/app"}, nil, "must only list origins"},
+		{"without scheme", []string{"-server.cors_origins=gambler.example.com"}, nil, "must only list origins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.args...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(cfg.Server.CORSOrigins, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("origins = %v, want %v", cfg.Server.CORSOrigins, tt.want)
+			}
+		})
+	}
+}
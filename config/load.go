@@ -0,0 +1,266 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const redacted = "[REDACTED]"
+
+// field is a single setting discovered on Config through its struct tags
+type field struct {
+	section string
+	key     string
+	env     string
+	def     string
+	usage   string
+	secret  bool
+	value   reflect.Value
+}
+
+func (f field) name() string {
+	return f.section + "." + f.key
+}
+
+// Load builds the configuration from the defaults, the optional JSON config
+// file, the environment (a .env file is loaded into it when present) and the
+// command line flags, then validates it. The arguments left after the flags
+// are returned so the caller can dispatch the command.
+func Load(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	fields := fieldsOf(cfg)
+
+	for _, f := range fields {
+		if f.def == "" {
+			continue
+		}
+		if err := f.set(f.def); err != nil {
+			return nil, nil, fmt.Errorf("default of %s: %w", f.name(), err)
+		}
+	}
+
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+
+	flagValues := map[string]string{}
+	flags := flag.NewFlagSet("gambler", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path of an optional JSON config file")
+	for _, f := range fields {
+		name := f.name()
+		usage := fmt.Sprintf("%s (env %s)", f.usage, f.env)
+		if f.def != "" {
+			usage += fmt.Sprintf(" (default %q)", f.def)
+		}
+		flags.Func(name, usage, func(raw string) error {
+			flagValues[name] = raw
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, fields); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, f := range fields {
+		raw, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			return nil, nil, fmt.Errorf("environment variable %s: %w", f.env, err)
+		}
+	}
+
+	for _, f := range fields {
+		raw, ok := flagValues[f.name()]
+		if !ok {
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			return nil, nil, fmt.Errorf("flag -%s: %w", f.name(), err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// loadFile applies a JSON file shaped like {"server": {"port": 4201}}
+func loadFile(path string, fields []field) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	sections := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(content, &sections); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	byName := map[string]field{}
+	for _, f := range fields {
+		byName[f.name()] = f
+	}
+
+	for section, values := range sections {
+		for key, value := range values {
+			f, ok := byName[section+"."+key]
+			if !ok {
+				return fmt.Errorf("config file %s: unknown setting %s.%s", path, section, key)
+			}
+			if err := f.set(stringify(value)); err != nil {
+				return fmt.Errorf("config file %s: %s: %w", path, f.name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, stringify(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// fieldsOf lists the settings of every section of cfg
+func fieldsOf(cfg *Config) []field {
+	fields := []field{}
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		sectionValue := root.Field(i)
+		for j := 0; j < sectionValue.NumField(); j++ {
+			setting := section.Type.Field(j)
+			fields = append(fields, field{
+				section: section.Tag.Get("json"),
+				key:     setting.Tag.Get("json"),
+				env:     setting.Tag.Get("env"),
+				def:     setting.Tag.Get("default"),
+				usage:   setting.Tag.Get("usage"),
+				secret:  setting.Tag.Get("secret") == "true",
+				value:   sectionValue.Field(j),
+			})
+		}
+	}
+	return fields
+}
+
+func (f field) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(raw)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		f.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		f.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", raw)
+		}
+		f.value.SetInt(int64(d))
+	case []string:
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with every secret replaced
+func (c Config) Redacted() Config {
+	clone := c
+	for _, f := range fieldsOf(&clone) {
+		if !f.secret {
+			continue
+		}
+		switch f.value.Kind() {
+		case reflect.Slice:
+			// A new slice, the copy shares the items with c
+			if n := f.value.Len(); n > 0 {
+				items := make([]string, n)
+				for i := range items {
+					items[i] = redacted
+				}
+				f.value.Set(reflect.ValueOf(items))
+			}
+		default:
+			if f.value.String() != "" {
+				f.value.SetString(redacted)
+			}
+		}
+	}
+	return clone
+}
+
+// String renders the configuration as JSON with secrets redacted, so it is
+// safe to log
+func (c Config) String() string {
+	redactedCfg := c.Redacted()
+	out, err := json.MarshalIndent(printable(redactedCfg), "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// printable converts the configuration into nested maps so durations are
+// rendered as "15m0s" instead of nanoseconds
+func printable(c Config) map[string]map[string]interface{} {
+	out := map[string]map[string]interface{}{}
+	for _, f := range fieldsOf(&c) {
+		if out[f.section] == nil {
+			out[f.section] = map[string]interface{}{}
+		}
+		value := f.value.Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		out[f.section][f.key] = value
+	}
+	return out
+}
@@ -1,41 +1,36 @@
 package database
 
 import (
-	"fmt"
-	"gambler/backend/tools"
-
-	"log"
-	"os"
-	"time"
+	"gambler/backend/config"
+	"gambler/backend/logging"
+	"gambler/backend/metrics"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
-func InitDatabase() *gorm.DB {
-	newLogger := logger.New(
-		log.New(os.Stdout, "[DATABASE]\r\n", log.LstdFlags),
-		logger.Config{
-			SlowThreshold:             time.Second * 3,
-			LogLevel:                  logger.Info,
-			IgnoreRecordNotFoundError: true,
-			ParameterizedQueries:      true,
-			Colorful:                  true,
-		},
-	)
-
-	Database, err := gorm.Open(postgres.Open(tools.DATABASE), &gorm.Config{
+func InitDatabase(cfg config.DatabaseConfig) *gorm.DB {
+	Database, err := gorm.Open(postgres.Open(cfg.DSN), &gorm.Config{
 		TranslateError: true,
-		Logger:         newLogger,
+		Logger:         logging.GormLogger{},
 	})
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Println("[DATABASE] Database connected")
+	if err := Database.Use(metrics.GormPlugin{}); err != nil {
+		panic(err)
+	}
+	// Bound values are left out of the spans like they are in the logs
+	if err := Database.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables())); err != nil {
+		panic(err)
+	}
+
+	logging.For("database").Info("database connected")
 
-	// Database.AutoMigrate(&models.User{}, &models.BalanceHistory{}, &models.Bet{}, &models.UserBet{})
+	// The schema is owned by the versioned SQL files in database/migrations,
+	// run `gambler migrate up` instead of relying on AutoMigrate
 
 	return Database
 }
@@ -0,0 +1,367 @@
+// Package dbtest is an in-memory database/sql driver for the tests of the
+// database code. A test answers the statements it expects by the start of
+// their SQL and keeps the rows it needs itself; the driver takes care of
+// transactions, the audit log and the statements every caller sends.
+//
+// Transactions run one at a time, so a row locked FOR UPDATE stays locked
+// until the transaction ends. Locking against a real database is covered by
+// the tests built with the integration tag, see Postgres.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const driverName = "dbtest"
+
+// PostgresEnv names the connection string of the database the integration
+// tests run against
+const PostgresEnv = "GAMBLER_TEST_POSTGRES"
+
+var (
+	dbs   = map[string]*DB{}
+	dbsMu sync.Mutex
+	// opened numbers the fakes, a test may create several
+	opened int
+)
+
+func init() {
+	sql.Register(driverName, fakeDriver{})
+}
+
+type (
+	// Statement is a query or exec sent to the fake
+	Statement struct {
+		Query string
+		Args  []driver.NamedValue
+		conn  *conn
+	}
+
+	// Result answers a statement. Queries return Rows of Columns, which
+	// default to the id of a RETURNING clause, execs return Affected.
+	Result struct {
+		Columns  []string
+		Rows     [][]driver.Value
+		Affected int64
+	}
+
+	// Handler answers the statements starting with the prefix it is
+	// registered for
+	Handler func(s *Statement) (Result, error)
+
+	// DB is a fake database. Handlers and the changes they defer to the
+	// commit run one at a time, so they can share the state of the test
+	// without further locking.
+	DB struct {
+		name string
+
+		// tx is held by the open transaction
+		tx sync.Mutex
+
+		mu        sync.Mutex
+		handlers  map[string]Handler
+		committed []string
+		audited   []string
+	}
+
+	fakeDriver struct{}
+
+	conn struct {
+		db *DB
+		// pending holds the changes of the open transaction
+		pending []func()
+		inTx    bool
+	}
+
+	fakeTx struct{ conn *conn }
+
+	rows struct {
+		columns []string
+		values  [][]driver.Value
+	}
+)
+
+// New creates a fake that answers the advisory locks, savepoints and the
+// audit log. Audit entries are kept as their action.
+func New(t *testing.T) *DB {
+	db := &DB{handlers: map[string]Handler{}}
+	db.Answer("SELECT pg_advisory_xact_lock", Result{})
+	db.Answer("SAVEPOINT", Result{})
+	db.Answer("RELEASE SAVEPOINT", Result{})
+	db.Answer("ROLLBACK TO SAVEPOINT", Result{})
+	db.Answer(`SELECT "hash" FROM "audit_logs"`, Result{Columns: []string{"hash"}})
+	db.Handle(`INSERT INTO "audit_logs"`, func(s *Statement) (Result, error) {
+		action := s.Arg(4).(string)
+		s.OnCommit(func() { db.audited = append(db.audited, action) })
+		return Result{Rows: [][]driver.Value{{int64(1)}}}, nil
+	})
+
+	dbsMu.Lock()
+	opened++
+	db.name = fmt.Sprintf("%s#%d", t.Name(), opened)
+	dbs[db.name] = db
+	dbsMu.Unlock()
+	t.Cleanup(func() {
+		dbsMu.Lock()
+		delete(dbs, db.name)
+		dbsMu.Unlock()
+	})
+	return db
+}
+
+// Handle answers the statements starting with prefix. The handler of the
+// longest matching prefix answers, the empty prefix matches every
+// statement. Registering a prefix again replaces its handler.
+func (db *DB) Handle(prefix string, h Handler) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.handlers[prefix] = h
+}
+
+// Answer answers the statements starting with prefix with result
+func (db *DB) Answer(prefix string, result Result) {
+	db.Handle(prefix, func(*Statement) (Result, error) { return result, nil })
+}
+
+// Fail answers the statements starting with prefix with err
+func (db *DB) Fail(prefix string, err error) {
+	db.Handle(prefix, func(*Statement) (Result, error) { return Result{}, err })
+}
+
+// Gorm opens the fake like the postgres connection of the handlers
+func (db *DB) Gorm(t *testing.T) *gorm.DB {
+	t.Helper()
+	gdb, err := gorm.Open(postgres.New(postgres.Config{DriverName: driverName, DSN: db.name}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gdb
+}
+
+// SQL opens the fake as a connection pool
+func (db *DB) SQL(t *testing.T) *sql.DB {
+	t.Helper()
+	sqlDB, err := sql.Open(driverName, db.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return sqlDB
+}
+
+// Committed returns the statements changing data in the order they were
+// committed, with the audit entries as their action. Statements outside of
+// a transaction count as committed at once.
+func (db *DB) Committed() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string{}, db.committed...)
+}
+
+// Audited returns the actions of the committed audit entries
+func (db *DB) Audited() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string{}, db.audited...)
+}
+
+// Arg returns the value of the placeholder $n
+func (s *Statement) Arg(n int) driver.Value {
+	return s.Args[n-1].Value
+}
+
+// InTx reports whether the statement runs in a transaction
+func (s *Statement) InTx() bool {
+	return s.conn.inTx
+}
+
+// OnCommit defers a change to the commit of the transaction, it is dropped
+// on rollback. Outside of a transaction the change applies at once.
+func (s *Statement) OnCommit(apply func()) {
+	if s.conn.inTx {
+		s.conn.pending = append(s.conn.pending, apply)
+		return
+	}
+	apply()
+}
+
+// Postgres opens a new schema in the database named by
+// GAMBLER_TEST_POSTGRES and skips the test without it. The schema is dropped
+// after the test, creating the tables is left to the test.
+func Postgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(PostgresEnv)
+	if dsn == "" {
+		t.Skip(PostgresEnv + " is not set")
+	}
+	admin := openPostgres(t, dsn)
+	schema := fmt.Sprintf("test_%d_%d", os.Getpid(), time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+
+	// Every connection of the pool works in the schema
+	separator := " "
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		separator = "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+	}
+	return openPostgres(t, dsn+separator+"search_path="+schema)
+}
+
+func openPostgres(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	db, ok := dbs[name]
+	if !ok {
+		return nil, fmt.Errorf("no fake database %q", name)
+	}
+	return &conn{db: db}, nil
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *conn) Close() error { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	c.db.tx.Lock()
+	c.pending, c.inTx = nil, true
+	return fakeTx{c}, nil
+}
+
+func (tx fakeTx) Commit() error {
+	db := tx.conn.db
+	db.mu.Lock()
+	for _, apply := range tx.conn.pending {
+		apply()
+	}
+	db.mu.Unlock()
+	tx.end()
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.end()
+	return nil
+}
+
+func (tx fakeTx) end() {
+	tx.conn.pending, tx.conn.inTx = nil, false
+	tx.conn.db.tx.Unlock()
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.Affected), nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if result.Columns == nil {
+		result.Columns = []string{"id"}
+	}
+	return &rows{columns: result.Columns, values: append([][]driver.Value(nil), result.Rows...)}, nil
+}
+
+// run answers a statement with the handler of the longest matching prefix
+// and records the statements changing data
+func (c *conn) run(query string, args []driver.NamedValue) (Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var handler Handler
+	matched := -1
+	for prefix, h := range db.handlers {
+		if strings.HasPrefix(query, prefix) && len(prefix) > matched {
+			handler, matched = h, len(prefix)
+		}
+	}
+	if handler == nil {
+		return Result{}, fmt.Errorf("unexpected statement %q", query)
+	}
+
+	s := &Statement{Query: query, Args: args, conn: c}
+	result, err := handler(s)
+	if err != nil {
+		return Result{}, err
+	}
+	switch {
+	case strings.HasPrefix(query, `INSERT INTO "audit_logs"`):
+		action := s.Arg(4).(string)
+		s.OnCommit(func() { db.committed = append(db.committed, action) })
+	case !isRead(query):
+		s.OnCommit(func() { db.committed = append(db.committed, query) })
+	}
+	return result, nil
+}
+
+// isRead reports statements that change no data
+func isRead(query string) bool {
+	for _, prefix := range []string{"SELECT", "SAVEPOINT", "RELEASE SAVEPOINT", "ROLLBACK TO SAVEPOINT"} {
+		if strings.HasPrefix(query, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rows) Columns() []string { return r.columns }
+
+func (r *rows) Close() error { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
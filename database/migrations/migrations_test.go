@@ -0,0 +1,220 @@
+package migrations
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"gambler/backend/database/dbtest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: want version %d, versions must be contiguous", m.Version, m.Name, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has an empty up or down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int64
+		failOn  string
+		want    []int64
+		wantErr bool
+		stored  []int64
+	}{
+		{name: "fresh database", want: []int64{1, 2, 3}, stored: []int64{1, 2, 3}},
+		{name: "partly applied", applied: []int64{1}, want: []int64{2, 3}, stored: []int64{1, 2, 3}},
+		{name: "up to date", applied: []int64{1, 2, 3}, want: []int64{}, stored: []int64{1, 2, 3}},
+		{name: "failure stops", failOn: "up 2", want: []int64{1}, wantErr: true, stored: []int64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, fake := newFakeMigrator(t, tt.applied, tt.failOn)
+			applied, err := migrator.Up(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Up() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := versions(applied); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Up() applied %v, want %v", got, tt.want)
+			}
+			if got := fake.versions(); !reflect.DeepEqual(got, tt.stored) {
+				t.Errorf("schema_migrations holds %v, want %v", got, tt.stored)
+			}
+			fake.checkUnlocked(t)
+		})
+	}
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	migrator, fake := newFakeMigrator(t, nil, "up 2")
+	if _, err := migrator.Up(context.Background()); err == nil {
+		t.Fatal("Up() succeeded, want the error of migration 2")
+	}
+	if got, want := fake.committed(), []string{"up 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("committed %v, want %v", got, want)
+	}
+}
+
+func TestDown(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int64
+		steps   int
+		want    []int64
+		stored  []int64
+	}{
+		{name: "one step", applied: []int64{1, 2, 3}, steps: 1, want: []int64{3}, stored: []int64{1, 2}},
+		{name: "newest first", applied: []int64{1, 2, 3}, steps: 2, want: []int64{3, 2}, stored: []int64{1}},
+		{name: "skips pending", applied: []int64{1, 2}, steps: 1, want: []int64{2}, stored: []int64{1}},
+		{name: "more steps than applied", applied: []int64{1}, steps: 5, want: []int64{1}, stored: []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, fake := newFakeMigrator(t, tt.applied, "")
+			reverted, err := migrator.Down(context.Background(), tt.steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions(reverted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Down() reverted %v, want %v", got, tt.want)
+			}
+			if got := fake.versions(); !reflect.DeepEqual(got, tt.stored) {
+				t.Errorf("schema_migrations holds %v, want %v", got, tt.stored)
+			}
+			fake.checkUnlocked(t)
+		})
+	}
+}
+
+func TestPending(t *testing.T) {
+	migrator, _ := newFakeMigrator(t, []int64{1, 3}, "")
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 || pending[0].Applied {
+		t.Errorf("Pending() = %+v, want only migration 2", pending)
+	}
+}
+
+func versions(migrations []Migration) []int64 {
+	out := []int64{}
+	for _, m := range migrations {
+		out = append(out, m.Version)
+	}
+	return out
+}
+
+// fakeDB keeps schema_migrations of the fake database and the advisory
+// locks held, enough to follow the Migrator through its steps
+
+type fakeDB struct {
+	db      *dbtest.DB
+	applied map[int64]time.Time
+	locks   int
+}
+
+func newFakeMigrator(t *testing.T, applied []int64, failOn string) (*Migrator, *fakeDB) {
+	fake := &fakeDB{db: dbtest.New(t), applied: map[int64]time.Time{}}
+	for _, v := range applied {
+		fake.applied[v] = time.Now()
+	}
+	fake.db.Handle("SELECT pg_advisory_lock", func(*dbtest.Statement) (dbtest.Result, error) {
+		fake.locks++
+		return dbtest.Result{}, nil
+	})
+	fake.db.Handle("SELECT pg_advisory_unlock", func(*dbtest.Statement) (dbtest.Result, error) {
+		fake.locks--
+		return dbtest.Result{}, nil
+	})
+	fake.db.Answer(createVersionTable, dbtest.Result{})
+	fake.db.Handle("SELECT version, applied_at FROM schema_migrations", func(*dbtest.Statement) (dbtest.Result, error) {
+		result := dbtest.Result{Columns: []string{"version", "applied_at"}}
+		for _, v := range fake.versions() {
+			result.Rows = append(result.Rows, []driver.Value{v, fake.applied[v]})
+		}
+		return result, nil
+	})
+	fake.db.Handle("INSERT INTO schema_migrations", func(s *dbtest.Statement) (dbtest.Result, error) {
+		version := s.Arg(1).(int64)
+		s.OnCommit(func() { fake.applied[version] = time.Now() })
+		return inTransaction(s)
+	})
+	fake.db.Handle("DELETE FROM schema_migrations", func(s *dbtest.Statement) (dbtest.Result, error) {
+		version := s.Arg(1).(int64)
+		s.OnCommit(func() { delete(fake.applied, version) })
+		return inTransaction(s)
+	})
+	// The SQL of the migrations
+	fake.db.Handle("", func(s *dbtest.Statement) (dbtest.Result, error) {
+		if s.Query == failOn {
+			return dbtest.Result{}, errors.New("syntax error")
+		}
+		return inTransaction(s)
+	})
+
+	migrations := []Migration{}
+	for v := int64(1); v <= 3; v++ {
+		migrations = append(migrations, Migration{
+			Version: v,
+			Name:    fmt.Sprintf("step_%d", v),
+			Up:      fmt.Sprintf("up %d", v),
+			Down:    fmt.Sprintf("down %d", v),
+		})
+	}
+	return &Migrator{db: fake.db.SQL(t), migrations: migrations}, fake
+}
+
+func inTransaction(s *dbtest.Statement) (dbtest.Result, error) {
+	if !s.InTx() {
+		return dbtest.Result{}, fmt.Errorf("%q ran outside of a transaction", s.Query)
+	}
+	return dbtest.Result{Affected: 1}, nil
+}
+
+// versions returns the applied versions in order. The handlers run one at
+// a time, the test calls it once the Migrator returned.
+func (db *fakeDB) versions() []int64 {
+	out := []int64{}
+	for v := int64(1); v <= 3; v++ {
+		if _, ok := db.applied[v]; ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// committed returns the SQL of the migrations committed
+func (db *fakeDB) committed() []string {
+	out := []string{}
+	for _, statement := range db.db.Committed() {
+		if strings.HasPrefix(statement, "up ") || strings.HasPrefix(statement, "down ") {
+			out = append(out, statement)
+		}
+	}
+	return out
+}
+
+func (db *fakeDB) checkUnlocked(t *testing.T) {
+	t.Helper()
+	if db.locks != 0 {
+		t.Errorf("advisory lock held %d times after the call", db.locks)
+	}
+}
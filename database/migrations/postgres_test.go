@@ -0,0 +1,65 @@
+//go:build integration
+
+package migrations
+
+import (
+	"context"
+	"gambler/backend/database/dbtest"
+	"sync"
+	"testing"
+)
+
+// TestUpConcurrent starts two replicas at once: the advisory lock lets one
+// of them apply every migration and the other find nothing to do
+func TestUpConcurrent(t *testing.T) {
+	db := dbtest.Postgres(t)
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	applied := make([][]Migration, 2)
+	errs := make([]error, 2)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			applied[i], errs[i] = migrator.Up(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total := len(applied[0]) + len(applied[1]); total != len(migrator.migrations) {
+		t.Errorf("applied %d migrations, want each of the %d once", total, len(migrator.migrations))
+	}
+}
+
+// TestDownUp reverts every migration and applies them again, which fails
+// when a down file leaves something behind
+func TestDownUp(t *testing.T) {
+	db := dbtest.Postgres(t)
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := migrator.Down(ctx, len(migrator.migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(migrator.migrations) {
+		t.Errorf("reverted %d migrations, want %d", len(reverted), len(migrator.migrations))
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+}
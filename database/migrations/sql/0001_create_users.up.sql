@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS users (
+    id                    BIGSERIAL PRIMARY KEY,
+    created_at            TIMESTAMPTZ,
+    updated_at            TIMESTAMPTZ,
+    deleted_at            TIMESTAMPTZ,
+    name                  TEXT,
+    username              TEXT NOT NULL,
+    password              TEXT NOT NULL,
+    email                 TEXT NOT NULL,
+    balance               NUMERIC NOT NULL DEFAULT 0,
+    refresh_token_version BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
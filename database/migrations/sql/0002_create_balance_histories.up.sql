@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS balance_histories (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    amount     NUMERIC NOT NULL DEFAULT 0,
+    reason     TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_balance_histories_user_id ON balance_histories (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_balance_histories_deleted_at ON balance_histories (deleted_at);
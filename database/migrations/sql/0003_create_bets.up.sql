@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS bets (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    name        TEXT NOT NULL,
+    description TEXT,
+    bet_options TEXT[] NOT NULL DEFAULT '{}',
+    status      TEXT NOT NULL DEFAULT 'Open',
+    ends_at     TIMESTAMPTZ NOT NULL,
+    author      BIGINT REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bets_name ON bets (name);
+CREATE INDEX IF NOT EXISTS idx_bets_status ON bets (status);
+CREATE INDEX IF NOT EXISTS idx_bets_ends_at ON bets (ends_at);
+CREATE INDEX IF NOT EXISTS idx_bets_author ON bets (author);
+CREATE INDEX IF NOT EXISTS idx_bets_deleted_at ON bets (deleted_at);
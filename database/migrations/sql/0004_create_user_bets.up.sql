@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS user_bets (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    bet_id     BIGINT NOT NULL REFERENCES bets (id) ON DELETE CASCADE,
+    amount     NUMERIC NOT NULL,
+    bet_option TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_bets_user_id ON user_bets (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_bets_bet_id ON user_bets (bet_id);
+CREATE INDEX IF NOT EXISTS idx_user_bets_deleted_at ON user_bets (deleted_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_bets_search_vector;
+DROP TRIGGER IF EXISTS bets_search_vector_trigger ON bets;
+DROP FUNCTION IF EXISTS bets_search_vector_update();
+ALTER TABLE bets DROP COLUMN IF EXISTS search_vector;
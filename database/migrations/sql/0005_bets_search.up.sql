@@ -0,0 +1,21 @@
+ALTER TABLE bets ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+CREATE OR REPLACE FUNCTION bets_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(array_to_string(NEW.bet_options, ' '), '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS bets_search_vector_trigger ON bets;
+CREATE TRIGGER bets_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF name, description, bet_options ON bets
+    FOR EACH ROW EXECUTE FUNCTION bets_search_vector_update();
+
+-- Backfill rows created before the trigger existed
+UPDATE bets SET name = name WHERE search_vector IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_bets_search_vector ON bets USING GIN (search_vector);
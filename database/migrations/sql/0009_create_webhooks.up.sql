@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    owner_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    url         TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    events      TEXT[] NOT NULL,
+    secret      TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner_id ON webhooks (owner_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_events ON webhooks USING GIN (events) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ NOT NULL,
+    webhook_id      BIGINT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id        TEXT NOT NULL,
+    event           TEXT NOT NULL,
+    -- JSON rather than JSONB keeps the bytes the signature is computed over
+    payload         JSON NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_attempt_at TIMESTAMPTZ,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    delivered_at    TIMESTAMPTZ,
+    redelivery_of   BIGINT REFERENCES webhook_deliveries (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id               TEXT PRIMARY KEY,
+    created_at       TIMESTAMPTZ NOT NULL,
+    user_id          BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token_id TEXT NOT NULL,
+    user_agent       TEXT NOT NULL DEFAULT '',
+    ip               TEXT NOT NULL DEFAULT '',
+    last_used_at     TIMESTAMPTZ NOT NULL,
+    expires_at       TIMESTAMPTZ NOT NULL,
+    revoked_at       TIMESTAMPTZ,
+    revoked_reason   TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_active ON sessions (user_id, last_used_at DESC) WHERE revoked_at IS NULL;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id          TEXT PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL,
+    algorithm   TEXT NOT NULL,
+    private_key BYTEA NOT NULL,
+    expires_at  TIMESTAMPTZ
+);
@@ -0,0 +1,4 @@
+-- Users created by OIDC without an email store '', only real addresses are
+-- unique
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email) WHERE email <> '';
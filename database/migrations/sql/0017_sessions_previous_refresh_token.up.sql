@@ -0,0 +1,4 @@
+-- The refresh token replaced by the last rotation, concurrent refreshes of
+-- the same token within a few seconds are not taken for reuse
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS previous_refresh_token_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMPTZ;
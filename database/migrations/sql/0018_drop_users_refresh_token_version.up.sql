@@ -0,0 +1,3 @@
+-- Refresh tokens are ended through their session, the version was no longer
+-- read or written
+ALTER TABLE users DROP COLUMN IF EXISTS refresh_token_version;
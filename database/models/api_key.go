@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Scopes an API key can be granted
+const (
+	ScopeBetsRead   = "bets:read"
+	ScopeBetsPlace  = "bets:place"
+	ScopeBetsCreate = "bets:create"
+	ScopeAdmin      = "admin"
+)
+
+var APIKeyScopes = []string{ScopeBetsRead, ScopeBetsPlace, ScopeBetsCreate, ScopeAdmin}
+
+// APIKey lets a bot act as its user on the routes of its scopes. Only the
+// SHA-256 of the key is stored, the key itself is shown once when created.
+type APIKey struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id"`
+	Name      string    `json:"name"`
+	// Prefix is the start of the key, it tells keys apart in lists
+	Prefix     string         `json:"prefix"`
+	KeyHash    string         `json:"-"`
+	Scopes     pq.StringArray `json:"scopes" gorm:"type:text[]"`
+	ExpiresAt  *time.Time     `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at"`
+}
+
+// HasScope reports whether the key was granted the scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"gambler/backend/database/models/customTypes"
+	"time"
+)
+
+// AuditLog is an entry of the append only audit log. Every entry carries the
+// hash of the previous one, so removing or editing entries breaks the chain.
+type AuditLog struct {
+	ID         uint             `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time        `json:"created_at"`
+	ActorType  string           `json:"actor_type"`
+	ActorID    *uint            `json:"actor_id"`
+	Action     string           `json:"action"`
+	TargetType string           `json:"target_type"`
+	TargetID   string           `json:"target_id"`
+	Before     customTypes.JSON `json:"before"`
+	After      customTypes.JSON `json:"after"`
+	IP         string           `json:"ip"`
+	RequestID  string           `json:"request_id"`
+	PrevHash   string           `json:"prev_hash"`
+	Hash       string           `json:"hash"`
+}
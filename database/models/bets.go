@@ -15,8 +15,10 @@ type Bet struct {
 	UserBets    []UserBet             `json:"user_bets" gorm:"foreignKey:BetID"`
 	BetOptions  pq.StringArray        `json:"bet_options" gorm:"type:text[]"`
 	Status      customTypes.BetStatus `json:"status"`
+	Result      string                `json:"result,omitempty"`
 	EndsAt      time.Time             `json:"ends_at"`
-	Author      uint                  `json:"author,string"`
+	// Author is nil once the account of the author was deleted
+	Author *uint `json:"author,string"`
 }
 
 func (b Bet) MarshalBinary() ([]byte, error) {
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // Define the BetStatus type and its constants
@@ -34,3 +35,14 @@ func (bs BetStatus) Value() (driver.Value, error) {
 	// Return the int representation of the BetStatus
 	return string(bs), nil
 }
+
+// ParseBetStatus converts a user supplied status name into a BetStatus,
+// ignoring the case of the input
+func ParseBetStatus(s string) (BetStatus, bool) {
+	for _, status := range []BetStatus{Open, Pending, Closed, Cancelled} {
+		if strings.EqualFold(string(status), s) {
+			return status, true
+		}
+	}
+	return "", false
+}
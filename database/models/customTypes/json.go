@@ -0,0 +1,46 @@
+package customTypes
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// JSON is a raw JSON document stored as is, without the re-encoding JSONB
+// columns apply
+type JSON []byte
+
+// Implement the sql.Scanner interface for JSON
+func (j *JSON) Scan(value interface{}) error {
+	switch val := value.(type) {
+	case nil:
+		*j = nil
+	case string:
+		*j = JSON(val)
+	case []byte:
+		*j = append(JSON(nil), val...)
+	default:
+		return errors.New(fmt.Sprint("Failed to scan JSON value:", value))
+	}
+	return nil
+}
+
+// Implement the driver.Valuer interface for JSON
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[:0], data...)
+	return nil
+}
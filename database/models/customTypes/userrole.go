@@ -0,0 +1,33 @@
+package customTypes
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+type UserRole string
+
+const (
+	RoleUser  UserRole = "user"
+	RoleAdmin UserRole = "admin"
+)
+
+// Implement the sql.Scanner interface for UserRole
+func (ur *UserRole) Scan(value interface{}) error {
+	val, ok := value.(string)
+	if !ok {
+		return errors.New(fmt.Sprint("Failed to scan UserRole value:", value))
+	}
+
+	*ur = UserRole(val)
+	return nil
+}
+
+// Implement the driver.Valuer interface for UserRole
+func (ur UserRole) Value() (driver.Value, error) {
+	if ur == "" {
+		return string(RoleUser), nil
+	}
+	return string(ur), nil
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RecoveryCode signs a user in once without their authenticator app. Only
+// the keyed hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Session is a signed in device. Its id is the family id carried by every
+// refresh token issued to the device, only the latest one of the family is
+// accepted, so a refresh token used twice reveals that it was stolen.
+type Session struct {
+	ID             string    `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time `json:"created_at"`
+	UserID         uint      `json:"user_id"`
+	RefreshTokenID string    `json:"-"`
+	// PreviousRefreshTokenID was replaced at RotatedAt, it is still accepted
+	// for a few seconds from requests that refreshed concurrently
+	PreviousRefreshTokenID string     `json:"-"`
+	RotatedAt              *time.Time `json:"-"`
+	UserAgent              string     `json:"user_agent"`
+	IP                     string     `json:"ip"`
+	LastUsedAt             time.Time  `json:"last_used_at"`
+	ExpiresAt              time.Time  `json:"expires_at"`
+	RevokedAt              *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason          string     `json:"revoked_reason,omitempty"`
+}
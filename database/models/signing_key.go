@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SigningKey is a key pair the tokens are signed with. The private key is
+// stored encrypted, see package keyring.
+type SigningKey struct {
+	ID         string `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	Algorithm  string
+	PrivateKey []byte
+	// ExpiresAt is set once a newer key took over, the key verifies the
+	// tokens it signed until then
+	ExpiresAt *time.Time
+}
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"log/slog"
+	"time"
+
+	"gambler/backend/database/models/customTypes"
+
 	"gorm.io/gorm"
 )
 
@@ -10,14 +15,22 @@ type CustomModel struct {
 
 type User struct {
 	CustomModel
-	Name                string           `json:"name"`
-	Username            string           `json:"username" gorm:"unique"`
-	Password            string           `json:"password"`
-	Email               string           `json:"email" gorm:"unique"`
-	Balance             float64          `json:"balance"`
-	BalanceHistory      []BalanceHistory `json:"balance_history" gorm:"foreignKey:UserID"`
-	UserBet             []UserBet        `json:"user_bet" gorm:"foreignKey:UserID"`
-	RefreshTokenVersion int              `json:"refresh_token_version"`
+	Name            string               `json:"name"`
+	Username        string               `json:"username" gorm:"unique"`
+	Password        string               `json:"password"`
+	Email           string               `json:"email" gorm:"uniqueIndex:idx_users_email,where:email <> ''"`
+	EmailVerifiedAt *time.Time           `json:"email_verified_at"`
+	Balance         float64              `json:"balance"`
+	BalanceHistory  []BalanceHistory     `json:"balance_history" gorm:"foreignKey:UserID"`
+	UserBet         []UserBet            `json:"user_bet" gorm:"foreignKey:UserID"`
+	Role            customTypes.UserRole `json:"role"`
+	// TOTPSecret is set when enrollment starts, two-factor sign in is only
+	// required once TOTPEnabledAt is set by confirming a code
+	TOTPSecret    string     `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at" gorm:"column:totp_enabled_at"`
+	// TOTPLastCounter is the period of the last accepted code, codes of
+	// earlier periods are rejected so a code works once
+	TOTPLastCounter int64 `json:"-" gorm:"column:totp_last_counter"`
 }
 
 type BalanceHistory struct {
@@ -26,3 +39,12 @@ type BalanceHistory struct {
 	Amount float64 `json:"amount"`
 	Reason string  `json:"reason"`
 }
+
+// LogValue keeps the password hash, email and TOTP secret out of logs
+func (u User) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("id", uint64(u.ID)),
+		slog.String("username", u.Username),
+		slog.String("role", string(u.Role)),
+	)
+}
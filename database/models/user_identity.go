@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserIdentity links an account of an OpenID Connect identity provider to
+// a user. The subject is stable at the issuer, unlike the email address.
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      uint       `json:"user_id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Purposes of a UserToken
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// UserToken is a link sent by email. Only the SHA-256 of the token is
+// stored, a token can be used once and only the newest of a purpose works.
+type UserToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	TokenHash string    `json:"-"`
+	// Email is the address the token was sent to, a verification only
+	// counts for it
+	Email     string     `json:"email"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"gambler/backend/database/models/customTypes"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Webhook subscribes a URL to bet lifecycle events. The secret signs every
+// delivery and is only shown once, when the webhook is created.
+type Webhook struct {
+	CustomModel
+	OwnerID     uint           `json:"owner_id"`
+	URL         string         `json:"url"`
+	Description string         `json:"description"`
+	Events      pq.StringArray `json:"events" gorm:"type:text[]"`
+	Secret      string         `json:"-"`
+}
+
+// WebhookDelivery is one event sent to one webhook with the outcome of its
+// latest attempt. Pending deliveries are the queue of the webhook worker.
+type WebhookDelivery struct {
+	ID             uint             `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time        `json:"created_at"`
+	WebhookID      uint             `json:"webhook_id"`
+	EventID        string           `json:"event_id"`
+	Event          string           `json:"event"`
+	Payload        customTypes.JSON `json:"payload"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time       `json:"last_attempt_at"`
+	ResponseStatus int              `json:"response_status"`
+	LastError      string           `json:"last_error"`
+	DeliveredAt    *time.Time       `json:"delivered_at"`
+	RedeliveryOf   *uint            `json:"redelivery_of"`
+}
@@ -0,0 +1,190 @@
+// Package redistest is an in-memory Redis server for the tests of the cache
+// code. It speaks enough RESP for strings with an expiry: PING, SET, GET,
+// EXISTS and DEL. Other commands are answered with an error.
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gambler/backend/config"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// Server is a fake Redis listening on a local port until the test ends
+	Server struct {
+		listener net.Listener
+
+		mu     sync.Mutex
+		values map[string]value
+	}
+
+	value struct {
+		data string
+		// expires is zero for keys without expiry
+		expires time.Time
+	}
+)
+
+// New starts a server that is closed with the test
+func New(t *testing.T) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{listener: listener, values: map[string]value{}}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// Config returns the connection settings of the server
+func (s *Server) Config() config.RedisConfig {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return config.RedisConfig{Host: addr.IP.String(), Port: addr.Port}
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, s.run(args)); err != nil {
+			return
+		}
+	}
+}
+
+// run executes a command and returns its encoded reply
+func (s *Server) run(args []string) string {
+	if len(args) == 0 {
+		return "-ERR empty command\r\n"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SET":
+		if len(args) < 3 {
+			return "-ERR wrong number of arguments for 'set' command\r\n"
+		}
+		v := value{data: args[2]}
+		for i := 3; i+1 < len(args); i += 2 {
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return "-ERR value is not an integer or out of range\r\n"
+			}
+			switch strings.ToUpper(args[i]) {
+			case "EX":
+				v.expires = time.Now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				v.expires = time.Now().Add(time.Duration(n) * time.Millisecond)
+			default:
+				return "-ERR syntax error\r\n"
+			}
+		}
+		s.values[args[1]] = v
+		return "+OK\r\n"
+	case "GET":
+		if len(args) != 2 {
+			return "-ERR wrong number of arguments for 'get' command\r\n"
+		}
+		v, ok := s.get(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v.data), v.data)
+	case "EXISTS", "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := s.get(key); ok {
+				n++
+				if strings.EqualFold(args[0], "DEL") {
+					delete(s.values, key)
+				}
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+// get returns a key that has not expired, s.mu is held
+func (s *Server) get(key string) (value, bool) {
+	v, ok := s.values[key]
+	if ok && !v.expires.IsZero() && !time.Now().Before(v.expires) {
+		delete(s.values, key)
+		return value{}, false
+	}
+	return v, ok
+}
+
+// readCommand reads an array of bulk strings, the form clients send
+// commands in
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected an array, got %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected a bulk string, got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("line does not end with CRLF")
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,7 @@
+package database
+
+// SearchConfig is the Postgres text search configuration used for bets.
+// "simple" is used on purpose: bet names are written in several languages,
+// so language specific stemming would do more harm than good. It has to
+// match the configuration used by the bets_search_vector_update trigger.
+const SearchConfig = "simple"
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// apiKeyTouchInterval bounds how often last_used_at of a key is written
+const apiKeyTouchInterval = time.Minute
+
+// CreateAPIKey stores a new key unless the user already has limit of them,
+// zero disables the limit
+func (h DBHandler) CreateAPIKey(key *models.APIKey, limit int) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Serializes concurrent creations of the same user
+		var owner models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&owner, key.UserID).Error; err != nil {
+			return err
+		}
+		if limit > 0 {
+			var count int64
+			if err := tx.Model(&models.APIKey{}).Where("user_id = ?", key.UserID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= int64(limit) {
+				return apperr.ErrAPIKeyLimit
+			}
+		}
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionAPIKeyCreate, audit.TargetAPIKey, key.ID, nil, map[string]interface{}{
+			"user_id":    key.UserID,
+			"name":       key.Name,
+			"scopes":     key.Scopes,
+			"expires_at": key.ExpiresAt,
+		})
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// ListAPIKeys returns the keys of a user, expired ones included
+func (h DBHandler) ListAPIKeys(userID uint) (*[]models.APIKey, error) {
+	keys := []models.APIKey{}
+	if res := h.DB.Where("user_id = ?", userID).Order("id").Find(&keys); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &keys, nil
+}
+
+// DeleteAPIKey revokes a key of the user, keys of other users are reported
+// as not found
+func (h DBHandler) DeleteAPIKey(userID uint, id uint) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var key models.APIKey
+		if err := tx.Where("user_id = ?", userID).First(&key, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&key).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionAPIKeyDelete, audit.TargetAPIKey, key.ID, map[string]interface{}{
+			"user_id": key.UserID,
+			"name":    key.Name,
+			"scopes":  key.Scopes,
+		}, nil)
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// UseAPIKey looks a key up by its hash and records that it was used. It
+// returns the key together with its owner, ErrTokenInvalid for unknown keys
+// and keys of deleted users and ErrTokenExpired for expired ones.
+func (h DBHandler) UseAPIKey(keyHash string) (*models.APIKey, *models.User, error) {
+	var key models.APIKey
+	res := h.DB.Where("key_hash = ?", keyHash).Limit(1).Find(&key)
+	if res.Error != nil {
+		return nil, nil, dbHandleError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil, apperr.ErrTokenInvalid
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		return nil, nil, apperr.ErrTokenExpired
+	}
+
+	// The key outlives neither its owner nor the role it was granted under
+	var owner models.User
+	res = h.DB.Select("id", "role").Where("id = ?", key.UserID).Limit(1).Find(&owner)
+	if res.Error != nil {
+		return nil, nil, dbHandleError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil, apperr.ErrTokenInvalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := h.DB.Model(&key).Update("last_used_at", now).Error; err != nil {
+			// Only the bookkeeping failed, the key is valid
+			dbLog.WarnContext(h.ctx(), "failed to record API key use", "api_key_id", key.ID, "error", err)
+		}
+	}
+	return &key, &owner, nil
+}
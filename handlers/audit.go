@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"gambler/backend/database/models/customTypes"
+	"gambler/backend/logging"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	AuditQuery struct {
+		ActorID    *uint
+		Action     string
+		TargetType string
+		TargetID   string
+		From       *time.Time
+		To         *time.Time
+		Limit      int
+		Offset     int
+	}
+
+	AuditPage struct {
+		Entries []models.AuditLog `json:"entries"`
+		Total   int64             `json:"total"`
+	}
+
+	AuditVerification struct {
+		Valid    bool   `json:"valid"`
+		Checked  int    `json:"checked"`
+		BrokenAt *uint  `json:"broken_at,omitempty"`
+		Reason   string `json:"reason,omitempty"`
+	}
+)
+
+// auditLockKey serializes appends so every entry links to its predecessor
+const auditLockKey = 0x6175646974
+
+// RecordAudit appends an entry outside of any other transaction, e.g. for
+// logins
+func (h DBHandler) RecordAudit(action string, targetType string, targetID interface{}, before interface{}, after interface{}) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return h.appendAudit(tx, action, targetType, targetID, before, after)
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// appendAudit writes an entry within tx, so it is only kept when the audited
+// change is committed. The actor, IP and request id come from the context of
+// the handler.
+func (h DBHandler) appendAudit(tx *gorm.DB, action string, targetType string, targetID interface{}, before interface{}, after interface{}) error {
+	ctx := h.ctx()
+	actor := audit.ActorFrom(ctx)
+
+	entry := models.AuditLog{
+		CreatedAt:  audit.Timestamp(time.Now()),
+		ActorType:  actor.Type,
+		ActorID:    actor.ID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   toString(targetID),
+		IP:         actor.IP,
+		RequestID:  logging.RequestID(ctx),
+	}
+	var err error
+	if entry.Before, err = toJSON(before); err != nil {
+		return err
+	}
+	if entry.After, err = toJSON(after); err != nil {
+		return err
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLockKey).Error; err != nil {
+		return err
+	}
+	var last []string
+	if err := tx.Model(&models.AuditLog{}).Order("id DESC").Limit(1).Pluck("hash", &last).Error; err != nil {
+		return err
+	}
+	if len(last) > 0 {
+		entry.PrevHash = last[0]
+	}
+	entry.Hash = audit.Hash(entry)
+
+	if err := tx.Create(&entry).Error; err != nil {
+		dbLog.ErrorContext(ctx, "failed to write audit log", "action", action, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ListAuditLogs returns the newest entries matching q
+func (h DBHandler) ListAuditLogs(q AuditQuery) (*AuditPage, error) {
+	query := h.DB.Model(&models.AuditLog{})
+	if q.ActorID != nil {
+		query = query.Where("actor_id = ?", *q.ActorID)
+	}
+	if q.Action != "" {
+		query = query.Where("action = ?", q.Action)
+	}
+	if q.TargetType != "" {
+		query = query.Where("target_type = ?", q.TargetType)
+	}
+	if q.TargetID != "" {
+		query = query.Where("target_id = ?", q.TargetID)
+	}
+	if q.From != nil {
+		query = query.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		query = query.Where("created_at < ?", *q.To)
+	}
+
+	page := AuditPage{Entries: []models.AuditLog{}}
+	if res := query.Count(&page.Total); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	if res := query.Order("id DESC").Limit(q.Limit).Offset(q.Offset).Find(&page.Entries); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &page, nil
+}
+
+// VerifyAuditChain recomputes the hash of every entry in order and reports
+// the first one that does not match its content or predecessor
+func (h DBHandler) VerifyAuditChain() (*AuditVerification, error) {
+	result := AuditVerification{Valid: true}
+	prev := ""
+	var lastID uint
+
+	for {
+		var batch []models.AuditLog
+		res := h.DB.Where("id > ?", lastID).Order("id").Limit(500).Find(&batch)
+		if res.Error != nil {
+			return nil, dbHandleError(res.Error)
+		}
+		if len(batch) == 0 {
+			return &result, nil
+		}
+
+		for _, entry := range batch {
+			result.Checked++
+			if reason := audit.Check(prev, entry); reason != "" {
+				id := entry.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				result.Reason = reason
+				return &result, nil
+			}
+			prev = entry.Hash
+			lastID = entry.ID
+		}
+	}
+}
+
+func toJSON(value interface{}) (customTypes.JSON, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.New("failed to encode audit value: " + err.Error())
+	}
+	return data, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
@@ -1,35 +1,109 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/config"
 	"gambler/backend/database"
 	"gambler/backend/database/models"
 	"gambler/backend/database/models/customTypes"
+	"gambler/backend/logging"
+	"gambler/backend/metrics"
 	"gambler/backend/tools"
+	"gambler/backend/webhook"
+	"math"
 	"runtime"
+	"sort"
 
-	"github.com/gofiber/fiber/v2/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type DBHandler struct {
-	DB *gorm.DB
-}
+type (
+	DBHandler struct {
+		DB *gorm.DB
+	}
+
+	BetSearchQuery struct {
+		Query    string
+		Statuses []customTypes.BetStatus
+		Limit    int
+		Offset   int
+	}
+
+	BetSearchHit struct {
+		models.Bet
+		Rank      float64      `json:"rank"`
+		Highlight BetHighlight `json:"highlight" gorm:"embedded;embeddedPrefix:hl_"`
+	}
+
+	// BetHighlight holds the HTML escaped text of a hit with the matches
+	// wrapped in <mark>, it can be rendered as HTML as is
+	BetHighlight struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		BetOptions  string `json:"bet_options"`
+	}
+
+	BetSearchResult struct {
+		Hits  []BetSearchHit `json:"hits"`
+		Total int64          `json:"total"`
+	}
+
+	LedgerDiscrepancy struct {
+		UserID      uint    `json:"user_id"`
+		Username    string  `json:"username"`
+		Balance     float64 `json:"balance"`
+		LedgerTotal float64 `json:"ledger_total"`
+	}
+)
 
 var (
 	DB DBHandler
+
+	dbLog = logging.For("database")
 )
 
-func NewDB() DBHandler {
-	db := database.InitDatabase()
+func NewDB(cfg config.DatabaseConfig) DBHandler {
+	db := database.InitDatabase(cfg)
 	DB = DBHandler{db}
 	return DB
 }
 
+// WithContext returns a handler whose queries run with ctx, so they are
+// canceled with the request and logged with its request id
+func (h DBHandler) WithContext(ctx context.Context) DBHandler {
+	return DBHandler{h.DB.WithContext(ctx)}
+}
+
+func (h DBHandler) ctx() context.Context {
+	return h.DB.Statement.Context
+}
+
+// Ping checks that a connection to Postgres can be used
+func (h DBHandler) Ping(ctx context.Context) error {
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the underlying connection pool
+func (h DBHandler) Close() error {
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // User methods
 
-func (h DBHandler) CreateUser(user models.User) int {
+func (h DBHandler) CreateUser(user models.User) error {
 	tx := h.DB.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -40,14 +114,14 @@ func (h DBHandler) CreateUser(user models.User) int {
 	// Create the user
 	if err := tx.Create(&user).Error; err != nil {
 		tx.Rollback()
-		log.Errorf("Error creating user: %v", err)
+		dbLog.ErrorContext(h.ctx(), "failed to create user", "error", err)
 		return dbHandleError(err)
 	}
 
 	// Ensure the user ID is populated
 	if user.ID == 0 {
 		tx.Rollback()
-		log.Error("User ID not populated after creation")
+		dbLog.ErrorContext(h.ctx(), "user id not populated after creation")
 		return dbHandleError(errors.New("user ID not populated after creation"))
 	}
 
@@ -60,37 +134,59 @@ func (h DBHandler) CreateUser(user models.User) int {
 
 	if err := tx.Create(&initialBalanceHistory).Error; err != nil {
 		tx.Rollback()
-		log.Errorf("Error creating balance history: %v", err)
+		dbLog.ErrorContext(h.ctx(), "failed to create balance history", "user_id", user.ID, "error", err)
 		return dbHandleError(err)
 	}
 
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("Error committing transaction: %v", err)
+		dbLog.ErrorContext(h.ctx(), "failed to commit transaction", "error", err)
 		return dbHandleError(err)
 	}
 
-	return -1
+	return nil
 }
 
-func (h DBHandler) UpdateUser(user models.User) (*models.User, int) {
+// CreateAdmin creates an admin with the initial balance history and records
+// the role in the audit log, in one transaction
+func (h DBHandler) CreateAdmin(user models.User) (*models.User, error) {
+	user.Role = customTypes.RoleAdmin
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.BalanceHistory{UserID: user.ID, Amount: 0, Reason: "Initial balance"}).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionUserRole, audit.TargetUser, user.ID,
+			nil,
+			map[string]interface{}{"role": customTypes.RoleAdmin},
+		)
+	})
+	if err != nil {
+		return nil, dbHandleError(err)
+	}
+	return &user, nil
+}
+
+func (h DBHandler) UpdateUser(user models.User) (*models.User, error) {
 	res := h.DB.Save(&user)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &user, -1
+	return &user, nil
 }
 
-func (h DBHandler) GetUserByID(id uint) (*models.User, int) {
+func (h DBHandler) GetUserByID(id uint) (*models.User, error) {
 	var user models.User
 	res := h.DB.First(&user, id)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &user, -1
+	return &user, nil
 }
 
-func (h DBHandler) GetUserByUsername(username string) (*models.User, int) {
+func (h DBHandler) GetUserByUsername(username string) (*models.User, error) {
 	var user models.User
 	res := h.DB.Preload("BalanceHistory", func(db *gorm.DB) *gorm.DB {
 		return db.Order("created_at desc").Limit(1)
@@ -99,20 +195,54 @@ func (h DBHandler) GetUserByUsername(username string) (*models.User, int) {
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &user, -1
+	return &user, nil
 }
 
-func (h DBHandler) DeleteUserByID(id uint) int {
+// UpdatePasswordHash replaces the password hash of a user with a new hash of
+// the same password. It only applies while the old hash is stored, so a
+// password changed meanwhile is not overwritten.
+func (h DBHandler) UpdatePasswordHash(userID uint, oldHash string, newHash string) error {
+	res := h.DB.Model(&models.User{}).Where("id = ? AND password = ?", userID, oldHash).Update("password", newHash)
+	if res.Error != nil {
+		return dbHandleError(res.Error)
+	}
+	return nil
+}
+
+// SetUserRole changes the role of a user and records the change in the
+// audit log
+func (h DBHandler) SetUserRole(userID uint, role customTypes.UserRole) (*models.User, error) {
+	var user models.User
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		before := user.Role
+		if err := tx.Model(&user).Update("role", role).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionUserRole, audit.TargetUser, user.ID,
+			map[string]interface{}{"role": before},
+			map[string]interface{}{"role": role},
+		)
+	})
+	if err != nil {
+		return nil, dbHandleError(err)
+	}
+	return &user, nil
+}
+
+func (h DBHandler) DeleteUserByID(id uint) error {
 	res := h.DB.Delete(&models.User{}, id)
 	if res.Error != nil {
 		return dbHandleError(res.Error)
 	}
-	return -1
+	return nil
 }
 
 // BalanceHistory methods
 
-func (h DBHandler) UpdateUserBalance(amount float64, user models.User, reason string) int {
+func (h DBHandler) UpdateUserBalance(amount float64, user models.User, reason string) error {
 	user.Balance += amount
 	res := h.DB.Save(&user)
 	if res.Error != nil {
@@ -123,48 +253,132 @@ func (h DBHandler) UpdateUserBalance(amount float64, user models.User, reason st
 		Amount: amount,
 		Reason: reason,
 	}, user.ID)
-	if err != -1 {
+	if err != nil {
 		return err
 	}
-	return -1
+	return nil
 }
 
-func (h DBHandler) CreateBalanceHistory(balance models.BalanceHistory) int {
+// AdjustUserBalance credits (or with a negative amount debits) a user on
+// behalf of an operator, together with its balance history and audit entry
+func (h DBHandler) AdjustUserBalance(userID uint, amount float64, reason string) (*models.User, error) {
+	user, _, err := h.bookBalance(userID, func(balance float64) float64 { return balance + amount }, reason)
+	return user, err
+}
+
+// SetUserBalance sets the balance of a user on behalf of an operator and
+// books the difference like AdjustUserBalance. It returns the user and the
+// balance before.
+func (h DBHandler) SetUserBalance(userID uint, balance float64, reason string) (*models.User, float64, error) {
+	return h.bookBalance(userID, func(float64) float64 { return balance }, reason)
+}
+
+// bookBalance changes the balance of a locked user to the result of change
+// and records the difference in the balance history and the audit log, all
+// in one transaction
+func (h DBHandler) bookBalance(userID uint, change func(balance float64) float64, reason string) (*models.User, float64, error) {
+	var user models.User
+	var before float64
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		before = user.Balance
+		user.Balance = math.Round(change(before)*100) / 100
+		amount := math.Round((user.Balance-before)*100) / 100
+		if err := tx.Model(&user).Update("balance", user.Balance).Error; err != nil {
+			return err
+		}
+		history := models.BalanceHistory{
+			UserID: user.ID,
+			Amount: amount,
+			Reason: reason,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionBalanceAdjust, audit.TargetUser, user.ID,
+			map[string]interface{}{"balance": before},
+			map[string]interface{}{"balance": user.Balance, "amount": amount, "reason": reason},
+		)
+	})
+	if err != nil {
+		return nil, 0, dbHandleError(err)
+	}
+	return &user, before, nil
+}
+
+// ReconcileBalance books the difference between the balance of a user and
+// the sum of their history as a history entry, with an audit entry, and
+// returns the amount booked. The balance itself is left alone.
+func (h DBHandler) ReconcileBalance(userID uint, reason string) (float64, error) {
+	var diff float64
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Keeps bets from changing the balance while the history is summed
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		var total float64
+		err := tx.Model(&models.BalanceHistory{}).Where("user_id = ?", userID).
+			Select("COALESCE(SUM(amount), 0)").Scan(&total).Error
+		if err != nil {
+			return err
+		}
+		diff = math.Round((user.Balance-total)*100) / 100
+		if diff == 0 {
+			return nil
+		}
+		if err := tx.Create(&models.BalanceHistory{UserID: userID, Amount: diff, Reason: reason}).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionLedgerFix, audit.TargetUser, userID,
+			map[string]interface{}{"balance": user.Balance, "history_total": total},
+			map[string]interface{}{"balance": user.Balance, "history_total": total + diff, "amount": diff, "reason": reason},
+		)
+	})
+	if err != nil {
+		return 0, dbHandleError(err)
+	}
+	return diff, nil
+}
+
+func (h DBHandler) CreateBalanceHistory(balance models.BalanceHistory) error {
 	res := h.DB.Create(&balance)
 	if res.Error != nil {
 		return dbHandleError(res.Error)
 	}
-	return -1
+	return nil
 }
 
-func (h DBHandler) FindBalanceHistoryByUser(userId uint) (*[]models.BalanceHistory, int) {
+func (h DBHandler) FindBalanceHistoryByUser(userId uint) (*[]models.BalanceHistory, error) {
 	var balance []models.BalanceHistory
 	user, err := h.GetUserByID(userId)
-	if err != -1 {
+	if err != nil {
 		return nil, err
 	}
 	res := h.DB.Model(&user).Association("BalanceHistory").Find(&balance)
 	if res != nil {
 		return nil, dbHandleError(res)
 	}
-	return &balance, -1
+	return &balance, nil
 }
 
-func (h DBHandler) AddBalanceHistory(balance models.BalanceHistory, userId uint) int {
+func (h DBHandler) AddBalanceHistory(balance models.BalanceHistory, userId uint) error {
 	user, err := h.GetUserByID(userId)
-	if err != -1 {
+	if err != nil {
 		return err
 	}
 	res := h.DB.Model(&user).Association("BalanceHistory").Append(&balance)
 	if res != nil {
 		return dbHandleError(res)
 	}
-	return -1
+	return nil
 }
 
 // Bet methods
 
-func (h DBHandler) CreateBet(bet models.Bet, userId uint, betOption string, amount float64) int {
+func (h DBHandler) CreateBet(bet models.Bet, userId uint, betOption string, amount float64) error {
 	tx := h.DB.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -175,13 +389,13 @@ func (h DBHandler) CreateBet(bet models.Bet, userId uint, betOption string, amou
 	// Create the user
 	if err := tx.Create(&bet).Error; err != nil {
 		tx.Rollback()
-		log.Errorf("Error creating user: %v", err)
+		dbLog.ErrorContext(h.ctx(), "failed to create bet", "error", err)
 		return dbHandleError(err)
 	}
 
 	// Get the user ID
 	user, err := h.GetUserByID(userId)
-	if err != -1 {
+	if err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -189,7 +403,7 @@ func (h DBHandler) CreateBet(bet models.Bet, userId uint, betOption string, amou
 	// Ensure the user ID is populated
 	if bet.ID == 0 {
 		tx.Rollback()
-		log.Error("Bet ID not populated after creation")
+		dbLog.ErrorContext(h.ctx(), "bet id not populated after creation")
 		return dbHandleError(errors.New("bet ID not populated after creation"))
 	}
 
@@ -203,7 +417,7 @@ func (h DBHandler) CreateBet(bet models.Bet, userId uint, betOption string, amou
 
 	if err := tx.Create(&initialBet).Error; err != nil {
 		tx.Rollback()
-		log.Errorf("Error creating balance history: %v", err)
+		dbLog.ErrorContext(h.ctx(), "failed to create user bet", "bet_id", bet.ID, "error", err)
 		return dbHandleError(err)
 	}
 
@@ -211,83 +425,112 @@ func (h DBHandler) CreateBet(bet models.Bet, userId uint, betOption string, amou
 	res := tx.Save(&user)
 	if res.Error != nil {
 		tx.Rollback()
-		log.Errorf("Error updating user balance: %v", res.Error)
+		dbLog.ErrorContext(h.ctx(), "failed to update user balance", "user_id", user.ID, "error", res.Error)
 		return dbHandleError(res.Error)
 	}
 
 	balance := models.BalanceHistory{
 		UserID: user.ID,
-		Amount: amount,
+		Amount: -amount,
 		Reason: fmt.Sprintf("Bet on: %s", bet.Name),
 	}
 
 	bRes := tx.Model(&user).Association("BalanceHistory").Append(&balance)
 	if bRes != nil {
+		tx.Rollback()
 		return dbHandleError(bRes)
 	}
 
+	if err := h.appendAudit(tx, audit.ActionBetCreate, audit.TargetBet, bet.ID, nil, map[string]interface{}{
+		"name":    bet.Name,
+		"options": bet.BetOptions,
+		"ends_at": bet.EndsAt,
+		"author":  user.ID,
+		"option":  betOption,
+		"amount":  amount,
+	}); err != nil {
+		tx.Rollback()
+		return dbHandleError(err)
+	}
+
+	if err := h.enqueueWebhooks(tx, webhook.EventBetCreated, webhook.Bet(bet, nil)); err != nil {
+		tx.Rollback()
+		return dbHandleError(err)
+	}
+
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("Error committing transaction: %v", err)
+		dbLog.ErrorContext(h.ctx(), "failed to commit transaction", "error", err)
 		return dbHandleError(err)
 	}
+	metrics.ObserveBetPlacement(amount)
 
-	err = Cache.UpdateBet(bet.ID)
-	if err != -1 {
+	err = Cache.WithContext(h.ctx()).UpdateBet(bet.ID)
+	if err != nil {
 		return err
 	}
 
-	return -1
+	return nil
 }
 
-func (h DBHandler) FindBet(betID int) (*models.Bet, int) {
+func (h DBHandler) FindBet(betID int) (*models.Bet, error) {
 	var bet models.Bet
 	res := h.DB.Preload("UserBets").Where("deleted_at IS NULL").First(&bet, betID)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &bet, -1
+	return &bet, nil
 }
 
-func (h DBHandler) GetAllBetsByStatus(s customTypes.BetStatus) (*[]models.Bet, int) {
+func (h DBHandler) GetAllBetsByStatus(s customTypes.BetStatus) (*[]models.Bet, error) {
 	var bets []models.Bet
 	res := h.DB.Where("status = ?", s).Find(&bets)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &bets, -1
+	return &bets, nil
 }
 
-func (h DBHandler) UpdateBet(bet models.Bet) int {
+func (h DBHandler) UpdateBet(bet models.Bet) error {
 	res := h.DB.Save(&bet)
 	if res.Error != nil {
 		return dbHandleError(res.Error)
 	}
-	return -1
+	return nil
 }
 
-func (h DBHandler) UpdateBetStatus(betID uint, status customTypes.BetStatus) (*models.Bet, int) {
+// UpdateBetStatus changes the status of a bet, moving it to pending closes
+// it for new stakes and is announced to the webhooks as bet.closed
+func (h DBHandler) UpdateBetStatus(betID uint, status customTypes.BetStatus) (*models.Bet, error) {
 	bet, err := h.FindBet(int(betID))
-	if err != -1 {
+	if err != nil {
 		return nil, err
 	}
 	bet.Status = status
-	res := h.DB.Save(&bet)
-	if res.Error != nil {
-		return nil, dbHandleError(res.Error)
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(bet).Error; err != nil {
+			return err
+		}
+		if status == customTypes.Pending {
+			return h.enqueueWebhooks(tx, webhook.EventBetClosed, webhook.Bet(*bet, nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, dbHandleError(err)
 	}
-	return bet, -1
+	return bet, nil
 }
 
-func (h DBHandler) DeleteBet(betID int) int {
+func (h DBHandler) DeleteBet(betID int) error {
 	res := h.DB.Delete(&models.Bet{}, betID)
 	if res.Error != nil {
 		return dbHandleError(res.Error)
 	}
-	return -1
+	return nil
 }
 
-func (h DBHandler) GetUserBet(userId uint) (*[]models.UserBet, int) {
+func (h DBHandler) GetUserBet(userId uint) (*[]models.UserBet, error) {
 	var user models.User
 	res := h.DB.Where("ID = ?", userId).First(&user)
 	if res.Error != nil {
@@ -300,83 +543,88 @@ func (h DBHandler) GetUserBet(userId uint) (*[]models.UserBet, int) {
 		return nil, dbHandleError(res.Error)
 	}
 
-	return &bets, -1
+	return &bets, nil
 }
 
-func (h DBHandler) GetUserBetByID(id uint) (*models.UserBet, int) {
-	log.Info(id)
+func (h DBHandler) GetUserBetByID(id uint) (*models.UserBet, error) {
 	var bet models.UserBet
 	res := h.DB.Where("ID = ?", id).First(&bet)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &bet, -1
+	return &bet, nil
 }
 
-func (h DBHandler) GetUserBetByBetID(betID uint, userId uint) (*models.UserBet, int) {
+func (h DBHandler) GetUserBetByBetID(betID uint, userId uint) (*models.UserBet, error) {
 	var bet models.UserBet
 	res := h.DB.Preload("UserBets").Where("user_id = ? AND bet_id = ? AND deleted_at IS NULL", userId, betID).First(&bet)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
 
-	return &bet, -1
+	return &bet, nil
 }
 
-func (h DBHandler) GetBetsByBetID(betID uint) (*[]models.UserBet, int) {
+func (h DBHandler) GetBetsByBetID(betID uint) (*[]models.UserBet, error) {
 	var bets []models.UserBet
 	res := h.DB.Preload("UserBets").Where("bet_id = ? AND deleted_at IS NULL", betID).Find(&bets)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &bets, -1
+	return &bets, nil
 }
 
-func (h DBHandler) GetBetByID(id uint) (*models.Bet, int) {
+func (h DBHandler) GetBetByID(id uint) (*models.Bet, error) {
 	var bet models.Bet
 	res := h.DB.Preload("UserBets").First(&bet, id)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &bet, -1
+	return &bet, nil
 }
 
-func (h DBHandler) GetBetByBetName(name string) (*models.Bet, int) {
+func (h DBHandler) GetBetByBetName(name string) (*models.Bet, error) {
 	var bet models.Bet
 	res := h.DB.Preload("UserBets").Where("name = ?", name).First(&bet)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &bet, -1
+	return &bet, nil
 }
 
-func (h DBHandler) PlaceBet(userBet models.UserBet) int {
-	res := h.DB.Create(&userBet)
-	if res.Error != nil {
-		return dbHandleError(res.Error)
+func (h DBHandler) PlaceBet(userBet models.UserBet) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&userBet).Error; err != nil {
+			return err
+		}
+		return h.enqueueWebhooks(tx, webhook.EventBetPlaced, webhook.Placement(userBet))
+	})
+	if err != nil {
+		return dbHandleError(err)
 	}
-	return -1
+	metrics.ObserveBetPlacement(userBet.Amount)
+	return nil
 }
 
-func (h DBHandler) CancelBet(userBet models.UserBet, user models.User) int {
+func (h DBHandler) CancelBet(userBet models.UserBet, user models.User) error {
 	res := h.DB.Delete(&models.UserBet{}, userBet.ID)
 	if res.Error != nil {
 		return dbHandleError(res.Error)
 	}
 
-	return -1
+	return nil
 }
 
-func (h DBHandler) GetAllBets() (*[]models.Bet, int) {
+func (h DBHandler) GetAllBets() (*[]models.Bet, error) {
 	var bet []models.Bet
 	res := h.DB.Preload("UserBets").Find(&bet)
 	if res.Error != nil {
 		return nil, dbHandleError(res.Error)
 	}
-	return &bet, -1
+	return &bet, nil
 }
 
-func (h DBHandler) GetAllActiveBets() (*[]models.Bet, int) {
+func (h DBHandler) GetAllActiveBets() (*[]models.Bet, error) {
 	var bets []models.Bet
 
 	// Use Preload to also load associated UserBets for each Bet
@@ -385,14 +633,13 @@ func (h DBHandler) GetAllActiveBets() (*[]models.Bet, int) {
 		Find(&bets)
 
 	if res.Error != nil {
-		log.Info(res.Error)
 		return nil, dbHandleError(res.Error)
 	}
 
-	return &bets, -1
+	return &bets, nil
 }
 
-func (h DBHandler) GetAllClosedBets() (*[]models.Bet, int) {
+func (h DBHandler) GetAllClosedBets() (*[]models.Bet, error) {
 	var bets []models.Bet
 
 	// Use Preload to also load associated UserBets for each Bet
@@ -404,24 +651,293 @@ func (h DBHandler) GetAllClosedBets() (*[]models.Bet, int) {
 		return nil, dbHandleError(res.Error)
 	}
 
-	return &bets, -1
+	return &bets, nil
+}
+
+// ResolveBet closes a bet with the given winning option and splits the pot
+// between everyone who picked it, proportional to their stake. When nobody
+// picked the winning option every stake is refunded instead.
+func (h DBHandler) ResolveBet(betID uint, option string) (*models.Bet, error) {
+	return h.settleBet(betID, audit.ActionBetResolve, webhook.EventBetSettled, func(bet *models.Bet) (map[uint]float64, string, error) {
+		if !tools.Contains(bet.BetOptions, option) {
+			return nil, "", apperr.ErrBetOptionNotFound
+		}
+
+		pot, winning := 0.0, 0.0
+		for _, userBet := range bet.UserBets {
+			pot += userBet.Amount
+			if userBet.BetOption == option {
+				winning += userBet.Amount
+			}
+		}
+
+		payouts := map[uint]float64{}
+		for _, userBet := range bet.UserBets {
+			if winning == 0 {
+				payouts[userBet.UserID] += userBet.Amount
+			} else if userBet.BetOption == option {
+				payouts[userBet.UserID] += userBet.Amount * pot / winning
+			}
+		}
+
+		bet.Status = customTypes.Closed
+		bet.Result = option
+		if winning == 0 {
+			return payouts, fmt.Sprintf("Refund for: %s", bet.Name), nil
+		}
+		return payouts, fmt.Sprintf("Won bet: %s", bet.Name), nil
+	})
+}
+
+// CancelBetByID cancels a bet that has not been resolved yet and refunds
+// every stake placed on it
+func (h DBHandler) CancelBetByID(betID uint) (*models.Bet, error) {
+	return h.settleBet(betID, audit.ActionBetCancel, webhook.EventBetCancelled, func(bet *models.Bet) (map[uint]float64, string, error) {
+		refunds := map[uint]float64{}
+		for _, userBet := range bet.UserBets {
+			refunds[userBet.UserID] += userBet.Amount
+		}
+
+		bet.Status = customTypes.Cancelled
+		return refunds, fmt.Sprintf("Bet cancelled: %s", bet.Name), nil
+	})
+}
+
+// settleBet locks an open or pending bet, calls decide to compute its new
+// state and the amount credited to each user, then applies both atomically
+// and records them in the audit log under action. The webhooks are notified
+// with event.
+func (h DBHandler) settleBet(betID uint, action string, event string, decide func(bet *models.Bet) (map[uint]float64, string, error)) (*models.Bet, error) {
+	tx := h.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var bet models.Bet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("UserBets").First(&bet, betID).Error; err != nil {
+		tx.Rollback()
+		return nil, dbHandleError(err)
+	}
+
+	if bet.Status != customTypes.Open && bet.Status != customTypes.Pending {
+		tx.Rollback()
+		return nil, apperr.ErrBetNotActive
+	}
+
+	before := map[string]interface{}{"status": bet.Status}
+	credits, reason, err := decide(&bet)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Credit users in a stable order so concurrent settlements cannot deadlock
+	userIDs := make([]uint, 0, len(credits))
+	for userID := range credits {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	applied := map[uint]float64{}
+	for _, userID := range userIDs {
+		amount := math.Round(credits[userID]*100) / 100
+		if amount == 0 {
+			continue
+		}
+		applied[userID] = amount
+		res := tx.Model(&models.User{}).Where("id = ?", userID).Update("balance", gorm.Expr("balance + ?", amount))
+		if res.Error != nil {
+			tx.Rollback()
+			dbLog.ErrorContext(h.ctx(), "failed to credit user", "user_id", userID, "error", res.Error)
+			return nil, dbHandleError(res.Error)
+		}
+		history := models.BalanceHistory{
+			UserID: userID,
+			Amount: amount,
+			Reason: reason,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			tx.Rollback()
+			dbLog.ErrorContext(h.ctx(), "failed to create balance history", "user_id", userID, "error", err)
+			return nil, dbHandleError(err)
+		}
+	}
+
+	res := tx.Model(&models.Bet{}).Where("id = ?", bet.ID).Updates(map[string]interface{}{
+		"status": bet.Status,
+		"result": bet.Result,
+	})
+	if res.Error != nil {
+		tx.Rollback()
+		dbLog.ErrorContext(h.ctx(), "failed to update bet status", "bet_id", betID, "error", res.Error)
+		return nil, dbHandleError(res.Error)
+	}
+
+	if err := h.appendAudit(tx, action, audit.TargetBet, bet.ID, before, map[string]interface{}{
+		"status":  bet.Status,
+		"result":  bet.Result,
+		"credits": applied,
+	}); err != nil {
+		tx.Rollback()
+		return nil, dbHandleError(err)
+	}
+
+	if err := h.enqueueWebhooks(tx, event, webhook.Bet(bet, applied)); err != nil {
+		tx.Rollback()
+		return nil, dbHandleError(err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		dbLog.ErrorContext(h.ctx(), "failed to commit transaction", "error", err)
+		return nil, dbHandleError(err)
+	}
+
+	return &bet, nil
+}
+
+// GetBetStats counts the bets and the amount staked on them per status
+func (h DBHandler) GetBetStats() (*[]metrics.BetStat, error) {
+	stats := []metrics.BetStat{}
+	res := h.DB.Raw(`
+		SELECT bets.status, COUNT(DISTINCT bets.id) AS count,
+			COALESCE(SUM(user_bets.amount), 0) AS volume
+		FROM bets
+		LEFT JOIN user_bets
+			ON user_bets.bet_id = bets.id AND user_bets.deleted_at IS NULL
+		WHERE bets.deleted_at IS NULL
+		GROUP BY bets.status`).Scan(&stats)
+	if res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &stats, nil
+}
+
+// Ledger methods
+
+// FindLedgerDiscrepancies lists every user whose balance does not match the
+// sum of their balance history
+func (h DBHandler) FindLedgerDiscrepancies() (*[]LedgerDiscrepancy, error) {
+	discrepancies := []LedgerDiscrepancy{}
+	res := h.DB.Raw(`
+		SELECT users.id AS user_id, users.username, users.balance,
+			COALESCE(SUM(balance_histories.amount), 0) AS ledger_total
+		FROM users
+		LEFT JOIN balance_histories
+			ON balance_histories.user_id = users.id AND balance_histories.deleted_at IS NULL
+		WHERE users.deleted_at IS NULL
+		GROUP BY users.id
+		HAVING abs(users.balance - COALESCE(SUM(balance_histories.amount), 0)) >= 0.01
+		ORDER BY users.id`).Scan(&discrepancies)
+	if res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &discrepancies, nil
+}
+
+// Search methods
+
+// ts_headline marks the matches with control characters, which are
+// replaced by <mark> once the text is escaped. Bet text cannot contain them,
+// they are removed before the text is highlighted.
+const (
+	searchStartSel = "chr(2)"
+	searchStopSel  = "chr(3)"
+
+	searchHeadlineOptions = "'StartSel=' || " + searchStartSel + " || ', StopSel=' || " + searchStopSel + " || ', HighlightAll=true'"
+)
+
+// SearchBets runs a ranked full-text search over the name, description and
+// options of every bet, optionally restricted to the given statuses
+func (h DBHandler) SearchBets(q BetSearchQuery) (*BetSearchResult, error) {
+	tsQuery := fmt.Sprintf("websearch_to_tsquery('%s', ?)", database.SearchConfig)
+
+	filter := h.DB.Table("bets").
+		Where("bets.deleted_at IS NULL").
+		Where("bets.search_vector @@ "+tsQuery, q.Query)
+	if len(q.Statuses) > 0 {
+		filter = filter.Where("bets.status IN ?", q.Statuses)
+	}
+
+	var total int64
+	if err := filter.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, dbHandleError(err)
+	}
+
+	hits := []BetSearchHit{}
+	if total == 0 {
+		return &BetSearchResult{Hits: hits, Total: 0}, nil
+	}
+
+	headline := func(column string) string {
+		return searchHeadline(column, tsQuery)
+	}
+	res := filter.Session(&gorm.Session{}).
+		Select(
+			"bets.*, ts_rank(bets.search_vector, "+tsQuery+") AS rank, "+
+				headline("bets.name")+" AS hl_name, "+
+				headline("bets.description")+" AS hl_description, "+
+				headline("array_to_string(bets.bet_options, ', ')")+" AS hl_bet_options",
+			q.Query, q.Query, q.Query, q.Query,
+		).
+		Order("rank DESC, bets.id DESC").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Scan(&hits)
+	if res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+
+	return &BetSearchResult{Hits: hits, Total: total}, nil
 }
 
 // Helper functions
 
-func dbHandleError(e error) int {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Info(fmt.Sprintf("Called from %s, line %d", file, line))
+// searchHeadline highlights the matches of tsQuery in the SQL text expression
+// column. The matches are marked before the text is escaped, so a query for
+// "lt" or "amp" does not highlight inside the entities and the only markup
+// in a headline is the <mark> around the matches.
+func searchHeadline(column, tsQuery string) string {
+	text := fmt.Sprintf("translate(%s, %s || %s, '')", column, searchStartSel, searchStopSel)
+	marked := fmt.Sprintf("ts_headline('%s', %s, %s, %s)", database.SearchConfig, text, tsQuery, searchHeadlineOptions)
+	return fmt.Sprintf("replace(replace(%s, %s, '<mark>'), %s, '</mark>')", escapeHTML(marked), searchStartSel, searchStopSel)
+}
+
+// htmlEntities are replaced by escapeHTML, & first so the entities it adds
+// are not escaped again. The characters are SQL string literals.
+var htmlEntities = [][2]string{
+	{"&", "&amp;"},
+	{"<", "&lt;"},
+	{">", "&gt;"},
+	{`"`, "&#34;"},
+	{"''", "&#39;"},
+}
+
+// escapeHTML wraps a SQL text expression so it evaluates to the HTML escaped
+// text, like html.EscapeString
+func escapeHTML(expr string) string {
+	for _, entity := range htmlEntities {
+		expr = fmt.Sprintf("replace(%s, '%s', '%s')", expr, entity[0], entity[1])
+	}
+	return expr
+}
+
+func dbHandleError(e error) error {
+	var res *apperr.Error
+	if errors.As(e, &res) {
+		// Returned by a transaction, e.g. a failed precondition
+		return e
 	}
-	var res int
 	if errors.Is(e, gorm.ErrDuplicatedKey) {
-		res = tools.DB_DUP_KEY
+		res = apperr.ErrDuplicateKey.Wrap(e)
 	} else if errors.Is(e, gorm.ErrRecordNotFound) {
-		res = tools.DB_REC_NOTFOUND
+		res = apperr.ErrRecordNotFound.Wrap(e)
 	} else {
-		res = tools.DB_UNKNOWN_ERR
+		res = apperr.ErrDatabase.Wrap(e)
+	}
+	if _, file, line, ok := runtime.Caller(1); ok {
+		dbLog.Debug("database error", "caller", fmt.Sprintf("%s:%d", file, line), "code", res.Code, "error", e)
 	}
-	log.Info("DB Error: ", e.Error(), res)
 	return res
 }
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"time"
+)
+
+// Access tokens are not looked up on every request, so signing out only
+// ends them early by listing them here until they would have expired.
+// A token is denied by its jti or by the session it belongs to.
+
+// DenyToken rejects the access token with the given jti until it expires
+func (c *CacheHandler) DenyToken(tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := c.Redis.Conn().Set(c.Context, "deny-jti-"+tokenID, 1, ttl).Err(); err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to deny token", "jti", tokenID, "error", err)
+		return HandleRedisError(err)
+	}
+	return nil
+}
+
+// DenySessions rejects every access token issued to the sessions. A revoked
+// session gets no new tokens, so ttl is the lifetime of an access token.
+func (c *CacheHandler) DenySessions(ids []string, ttl time.Duration) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	pipe := c.Redis.Conn().Pipeline()
+	for _, id := range ids {
+		pipe.Set(c.Context, "deny-sid-"+id, 1, ttl)
+	}
+	if _, err := pipe.Exec(c.Context); err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to deny sessions", "sessions", ids, "error", err)
+		return HandleRedisError(err)
+	}
+	return nil
+}
+
+// IsTokenDenied reports whether the token or its session was denied, tokens
+// without a session pass an empty sessionID
+func (c *CacheHandler) IsTokenDenied(tokenID string, sessionID string) (bool, error) {
+	keys := []string{"deny-jti-" + tokenID}
+	if sessionID != "" {
+		keys = append(keys, "deny-sid-"+sessionID)
+	}
+	n, err := c.Redis.Conn().Exists(c.Context, keys...).Result()
+	if err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to check the denylist", "jti", tokenID, "error", err)
+		return false, HandleRedisError(err)
+	}
+	return n > 0, nil
+}
+
+// CountChallengeAttempt counts the codes entered for the MFA challenge with
+// the given jti, the count is forgotten when the challenge expires
+func (c *CacheHandler) CountChallengeAttempt(tokenID string, expiresAt time.Time) (int64, error) {
+	key := "mfa-attempts-" + tokenID
+	pipe := c.Redis.Conn().TxPipeline()
+	count := pipe.Incr(c.Context, key)
+	pipe.ExpireAt(c.Context, key, expiresAt)
+	if _, err := pipe.Exec(c.Context); err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to count challenge attempt", "jti", tokenID, "error", err)
+		return 0, HandleRedisError(err)
+	}
+	return count.Val(), nil
+}
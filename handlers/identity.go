@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxUsername is the longest username accepted by the registration
+const maxUsername = 20
+
+// SignInWithIdentity returns the user linked to an identity of the identity
+// provider. An unknown identity is linked to the user with its email address
+// when linkByEmail is set and both the provider and the user verified the
+// address, otherwise to a new user created from profile when create is set.
+// Users with two-factor authentication are never linked by email, signing
+// in through the provider would skip their second factor.
+func (h DBHandler) SignInWithIdentity(identity models.UserIdentity, profile models.User, linkByEmail bool, create bool) (*models.User, error) {
+	var user models.User
+	now := time.Now()
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var linked models.UserIdentity
+		res := tx.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Limit(1).Find(&linked)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			if err := tx.Model(&linked).Updates(map[string]interface{}{"email": identity.Email, "last_login_at": now}).Error; err != nil {
+				return err
+			}
+			if err := tx.First(&user, linked.UserID).Error; err != nil {
+				// The user was deleted
+				return apperr.ErrOIDCNoAccount.Wrap(err)
+			}
+			return nil
+		}
+
+		found := int64(0)
+		if linkByEmail && profile.EmailVerifiedAt != nil && profile.Email != "" {
+			res := tx.Where("lower(email) = ? AND email_verified_at IS NOT NULL AND totp_enabled_at IS NULL", strings.ToLower(profile.Email)).Limit(1).Find(&user)
+			if res.Error != nil {
+				return res.Error
+			}
+			found = res.RowsAffected
+		}
+		if found == 0 {
+			if !create {
+				return apperr.ErrOIDCNoAccount
+			}
+			username, err := uniqueUsername(tx, profile.Username)
+			if err != nil {
+				return err
+			}
+			user = profile
+			user.Username = username
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.BalanceHistory{UserID: user.ID, Amount: 0, Reason: "Initial balance"}).Error; err != nil {
+				return err
+			}
+		}
+
+		identity.UserID = user.ID
+		identity.LastLoginAt = &now
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionIdentityLink, audit.TargetUser, user.ID, nil, map[string]interface{}{
+			"issuer":  identity.Issuer,
+			"subject": identity.Subject,
+			"created": found == 0,
+		})
+	})
+	if err != nil {
+		return nil, dbHandleError(err)
+	}
+	return &user, nil
+}
+
+// uniqueUsername returns base, or base with the lowest number appended that
+// is not taken. Deleted users keep their names.
+func uniqueUsername(tx *gorm.DB, base string) (string, error) {
+	for i := 1; i < 1000; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprintf("%d", i)
+			if len(candidate)+len(suffix) > maxUsername {
+				candidate = candidate[:maxUsername-len(suffix)]
+			}
+			candidate += suffix
+		}
+		var count int64
+		if err := tx.Model(&models.User{}).Unscoped().Where("lower(username) = ?", strings.ToLower(candidate)).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
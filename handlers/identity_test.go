@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/database/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignInWithIdentityLinksByEmail only links a new identity to a user
+// whose address both sides verified and who has no second factor to skip
+func TestSignInWithIdentityLinksByEmail(t *testing.T) {
+	now := time.Now()
+	verified := models.User{Email: "Ann@example.com", EmailVerifiedAt: &now}
+
+	tests := []struct {
+		name string
+		// provider is whether the identity provider verified the address
+		provider bool
+		user     models.User
+		err      *apperr.Error
+	}{
+		{name: "verified by both", provider: true, user: verified},
+		{name: "not verified by the provider", user: verified, err: apperr.ErrOIDCNoAccount},
+		{name: "not verified by the user", provider: true, user: models.User{Email: "ann@example.com"}, err: apperr.ErrOIDCNoAccount},
+		{name: "two-factor authentication", provider: true, user: models.User{Email: "ann@example.com", EmailVerifiedAt: &now, TOTPEnabledAt: &now}, err: apperr.ErrOIDCNoAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			db.Answer(`SELECT * FROM "user_identities"`, dbtest.Result{})
+			db.Handle(`SELECT * FROM "users" WHERE`, func(s *dbtest.Statement) (dbtest.Result, error) {
+				result := dbtest.Result{Columns: []string{"id", "email"}}
+				switch {
+				case s.Arg(1) != strings.ToLower(tt.user.Email):
+				case strings.Contains(s.Query, "email_verified_at IS NOT NULL") == (tt.user.EmailVerifiedAt == nil):
+				case strings.Contains(s.Query, "totp_enabled_at IS NULL") == (tt.user.TOTPEnabledAt != nil):
+				default:
+					result.Rows = [][]driver.Value{{int64(7), tt.user.Email}}
+				}
+				return result, nil
+			})
+			db.Answer(`INSERT INTO "user_identities"`, dbtest.Result{Rows: [][]driver.Value{{int64(1)}}})
+			h := DBHandler{db.Gorm(t).WithContext(context.Background())}
+
+			profile := models.User{Username: "ann", Email: "ann@example.com"}
+			if tt.provider {
+				profile.EmailVerifiedAt = &now
+			}
+			user, err := h.SignInWithIdentity(models.UserIdentity{Issuer: "https://idp.example.com", Subject: "ann"}, profile, true, false)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user.ID != 7 {
+				t.Errorf("linked to user %d, want 7", user.ID)
+			}
+			if got := db.Audited(); strings.Join(got, ",") != audit.ActionIdentityLink {
+				t.Errorf("audited %v, want %s", got, audit.ActionIdentityLink)
+			}
+		})
+	}
+}
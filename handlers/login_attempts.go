@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"gambler/backend/config"
+	"strings"
+	"time"
+
+	r "github.com/redis/go-redis/v9"
+)
+
+// Failed sign ins are counted by the submitted username, whether or not it
+// exists, so locked and unknown accounts cannot be told apart. Each failure
+// past cfg.LoginDelayAfter makes the account wait twice as long before the
+// next attempt, cfg.LockoutThreshold failures lock it. Client addresses are
+// only locked, they share the failures of every account they try.
+
+func loginKeys(username string, ip string) (fails string, wait string, lock string, ipFails string, ipLock string) {
+	username = strings.ToLower(username)
+	return "login-fail-u-" + username, "login-wait-u-" + username, "login-lock-u-" + username,
+		"login-fail-ip-" + ip, "login-lock-ip-" + ip
+}
+
+// LoginBlocked returns how long sign ins of the username from ip are
+// refused, zero when they are allowed
+func (c *CacheHandler) LoginBlocked(username string, ip string) (time.Duration, error) {
+	_, wait, lock, _, ipLock := loginKeys(username, ip)
+	pipe := c.Redis.Conn().Pipeline()
+	ttls := []*r.DurationCmd{
+		pipe.PTTL(c.Context, wait),
+		pipe.PTTL(c.Context, lock),
+		pipe.PTTL(c.Context, ipLock),
+	}
+	if _, err := pipe.Exec(c.Context); err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to check login lock", "error", err)
+		return 0, HandleRedisError(err)
+	}
+	var blocked time.Duration
+	// PTTL is negative for missing keys
+	for _, ttl := range ttls {
+		if ttl.Val() > blocked {
+			blocked = ttl.Val()
+		}
+	}
+	return blocked, nil
+}
+
+// RecordLoginFailure counts a failed sign in and applies the delays and
+// locks of cfg
+func (c *CacheHandler) RecordLoginFailure(cfg config.AuthConfig, username string, ip string) error {
+	fails, wait, lock, ipFails, ipLock := loginKeys(username, ip)
+	pipe := c.Redis.Conn().TxPipeline()
+	count := pipe.Incr(c.Context, fails)
+	pipe.Expire(c.Context, fails, cfg.LoginFailureWindow)
+	ipCount := pipe.Incr(c.Context, ipFails)
+	pipe.Expire(c.Context, ipFails, cfg.LoginFailureWindow)
+	if _, err := pipe.Exec(c.Context); err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to count login failure", "error", err)
+		return HandleRedisError(err)
+	}
+
+	pipe = c.Redis.Conn().TxPipeline()
+	switch n := int(count.Val()); {
+	case n >= cfg.LockoutThreshold:
+		pipe.Set(c.Context, lock, 1, cfg.LockoutDuration)
+		pipe.Del(c.Context, fails, wait)
+		cacheLog.WarnContext(c.Context, "account locked after failed sign ins", "username", username, "failures", n)
+	case n > cfg.LoginDelayAfter:
+		pipe.Set(c.Context, wait, 1, loginDelay(cfg, n))
+	}
+	if int(ipCount.Val()) >= cfg.IPLockoutThreshold {
+		pipe.Set(c.Context, ipLock, 1, cfg.LockoutDuration)
+		pipe.Del(c.Context, ipFails)
+		cacheLog.WarnContext(c.Context, "address locked after failed sign ins", "ip", ip, "failures", ipCount.Val())
+	}
+	if _, err := pipe.Exec(c.Context); err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to lock login", "error", err)
+		return HandleRedisError(err)
+	}
+	return nil
+}
+
+// ClearLoginFailures forgets the failures of an account after it signed in,
+// the failures of the address still count
+func (c *CacheHandler) ClearLoginFailures(username string) error {
+	fails, wait, _, _, _ := loginKeys(username, "")
+	if err := c.Redis.Conn().Del(c.Context, fails, wait).Err(); err != nil {
+		return HandleRedisError(err)
+	}
+	return nil
+}
+
+// UnlockLogin lifts the lock and the failures of an account and reports
+// whether it was locked
+func (c *CacheHandler) UnlockLogin(username string) (bool, error) {
+	fails, wait, lock, _, _ := loginKeys(username, "")
+	pipe := c.Redis.Conn().TxPipeline()
+	locked := pipe.Del(c.Context, lock)
+	pipe.Del(c.Context, fails, wait)
+	if _, err := pipe.Exec(c.Context); err != nil {
+		return false, HandleRedisError(err)
+	}
+	return locked.Val() > 0, nil
+}
+
+// loginDelay doubles cfg.LoginDelay for every failure past
+// cfg.LoginDelayAfter, up to the lockout duration
+func loginDelay(cfg config.AuthConfig, failures int) time.Duration {
+	delay := cfg.LoginDelay
+	for i := cfg.LoginDelayAfter + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= cfg.LockoutDuration {
+			return cfg.LockoutDuration
+		}
+	}
+	return delay
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StartTOTP stores the secret of an enrollment, replacing one that was not
+// confirmed
+func (h DBHandler) StartTOTP(userID uint, secret string) error {
+	res := h.DB.Model(&models.User{}).Where("id = ? AND totp_enabled_at IS NULL", userID).Updates(map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	})
+	if res.Error != nil {
+		return dbHandleError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return apperr.ErrMFAEnabled
+	}
+	return nil
+}
+
+// EnableTOTP confirms the enrollment with the counter of the first code and
+// stores the recovery codes
+func (h DBHandler) EnableTOTP(userID uint, counter int64, codeHashes []string) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).Where("id = ? AND totp_enabled_at IS NULL AND totp_secret <> ''", userID).Updates(map[string]interface{}{
+			"totp_enabled_at":   time.Now(),
+			"totp_last_counter": counter,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return apperr.ErrMFANotStarted
+		}
+		if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionMFAEnable, audit.TargetUser, userID, nil, nil)
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// DisableTOTP removes the secret and the recovery codes of the user
+func (h DBHandler) DisableTOTP(userID uint) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).Where("id = ? AND totp_enabled_at IS NOT NULL", userID).Updates(map[string]interface{}{
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"totp_last_counter": 0,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return apperr.ErrMFANotEnabled
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionMFADisable, audit.TargetUser, userID, nil, nil)
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes issues new recovery codes, the old ones stop working
+func (h DBHandler) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionRecoveryCodes, audit.TargetUser, userID, nil, nil)
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// UseTOTPCounter records the counter of an accepted code, it reports false
+// when a code of the same or a later period was used already
+func (h DBHandler) UseTOTPCounter(userID uint, counter int64) (bool, error) {
+	res := h.DB.Model(&models.User{}).
+		Where("id = ? AND totp_enabled_at IS NOT NULL AND totp_last_counter < ?", userID, counter).
+		Update("totp_last_counter", counter)
+	if res.Error != nil {
+		return false, dbHandleError(res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used, it
+// reports false for unknown and used codes
+func (h DBHandler) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	res := h.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, dbHandleError(res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// CountRecoveryCodes returns how many recovery codes the user has left
+func (h DBHandler) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	res := h.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	if res.Error != nil {
+		return 0, dbHandleError(res.Error)
+	}
+	return count, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{CreatedAt: time.Now(), UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&codes).Error
+}
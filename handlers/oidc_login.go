@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"gambler/backend/apperr"
+	"time"
+
+	r "github.com/redis/go-redis/v9"
+)
+
+// OIDCLogin holds the secrets of a sign in at the identity provider until
+// its callback, keyed by the state sent along
+type OIDCLogin struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// SaveOIDCLogin stores a started sign in for ttl
+func (c *CacheHandler) SaveOIDCLogin(state string, login OIDCLogin, ttl time.Duration) error {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return HandleRedisError(err)
+	}
+	if err := c.Redis.Conn().Set(c.Context, "oidc-state-"+state, data, ttl).Err(); err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to store sign in state", "error", err)
+		return HandleRedisError(err)
+	}
+	return nil
+}
+
+// TakeOIDCLogin returns and forgets the sign in of a state, so a callback
+// cannot be replayed. Unknown and expired states are ErrOIDCState.
+func (c *CacheHandler) TakeOIDCLogin(state string) (*OIDCLogin, error) {
+	data, err := c.Redis.Conn().GetDel(c.Context, "oidc-state-"+state).Bytes()
+	if err == r.Nil {
+		return nil, apperr.ErrOIDCState.Wrap(err)
+	}
+	if err != nil {
+		cacheLog.ErrorContext(c.Context, "failed to load sign in state", "error", err)
+		return nil, HandleRedisError(err)
+	}
+	var login OIDCLogin
+	if err := json.Unmarshal(data, &login); err != nil {
+		return nil, apperr.ErrOIDCState.Wrap(err)
+	}
+	return &login, nil
+}
@@ -0,0 +1,118 @@
+//go:build integration
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/database/migrations"
+	"gambler/backend/database/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// postgresHandler migrates a new schema of the test database
+func postgresHandler(t *testing.T) DBHandler {
+	t.Helper()
+	db := dbtest.Postgres(t)
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return DBHandler{db.WithContext(context.Background())}
+}
+
+func createTestUser(t *testing.T, h DBHandler, username string) models.User {
+	t.Helper()
+	err := h.CreateUser(models.User{Username: username, Name: username, Email: username + "@example.com", Password: "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := h.GetUserByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *user
+}
+
+// TestAuditChainConcurrent appends from many transactions at once, the
+// advisory lock keeps every entry linked to its predecessor
+func TestAuditChainConcurrent(t *testing.T) {
+	h := postgresHandler(t)
+	const writers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- h.RecordAudit(audit.ActionUserUnlock, audit.TargetUser, i, nil, map[string]interface{}{"writer": i})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := h.VerifyAuditChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Checked != writers {
+		t.Errorf("chain valid %v after %d entries (%s), want %d valid entries", result.Valid, result.Checked, result.Reason, writers)
+	}
+}
+
+// TestRotateSessionLocks rotates the same refresh token from many requests
+// at once, the row lock lets them see each other's rotation so all of them
+// hand out the token of the first one
+func TestRotateSessionLocks(t *testing.T) {
+	h := postgresHandler(t)
+	user := createTestUser(t, h, "rotator")
+	now := time.Now()
+	err := h.CreateSession(models.Session{ID: "s1", UserID: user.ID, RefreshTokenID: "t1", LastUsedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 5
+	var wg sync.WaitGroup
+	ids := make(chan string, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, _, err := h.RotateSession("s1", user.ID, "t1", fmt.Sprintf("t2-%d", i), now.Add(time.Hour))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			ids <- id
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	handedOut := map[string]bool{}
+	for id := range ids {
+		handedOut[id] = true
+	}
+	if len(handedOut) != 1 {
+		t.Errorf("requests handed out %v, want a single token", handedOut)
+	}
+	// A token older than the replaced one is still reuse
+	if _, _, err := h.RotateSession("s1", user.ID, "t0", "t3", now.Add(time.Hour)); !errors.Is(err, apperr.ErrTokenReused) {
+		t.Errorf("error = %v, want %v", err, apperr.ErrTokenReused)
+	}
+}
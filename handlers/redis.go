@@ -4,16 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
 	"gambler/backend/database/models"
+	"gambler/backend/logging"
+	"gambler/backend/metrics"
 	"gambler/backend/tools"
+	"gambler/backend/tracing"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/gofiber/fiber/v2/middleware/cache"
 	"github.com/gofiber/storage/redis/v3"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	r "github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -23,27 +29,45 @@ type (
 	}
 )
 
-var Cache CacheHandler
+var (
+	Cache CacheHandler
 
-func NewCache(app *fiber.App) *CacheHandler {
-	if tools.HOST_REDIS == "" || tools.PSW_REDIS == "" {
-		log.Fatal("[CACHE] Redis connection details not found in .env")
-		tools.SendWebHook("[CACHE] Redis connection details not found in .env")
-		panic("Redis connection details not found in .env")
-	}
+	cacheLog = logging.For("cache")
+)
+
+func NewCache(cfg config.RedisConfig) *CacheHandler {
 	Cache = CacheHandler{
 		Redis: redis.New(redis.Config{
-			Host:     tools.HOST_REDIS,
-			Port:     6379,
-			Password: tools.PSW_REDIS,
-			Database: 0,
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+			Password: cfg.Password,
+			Database: cfg.DB,
 		}),
 		Context: context.Background(),
 	}
-	log.Info("[CACHE] Connected to Redis")
+	if err := redisotel.InstrumentTracing(Cache.Redis.Conn()); err != nil {
+		cacheLog.Warn("failed to instrument redis client", "error", err)
+	}
+	cacheLog.Info("connected to redis", "host", cfg.Host, "db", cfg.DB)
 	return &Cache
 }
 
+// WithContext returns a handler whose commands run with ctx, so they show up
+// in the trace of the request
+func (c *CacheHandler) WithContext(ctx context.Context) *CacheHandler {
+	return &CacheHandler{Redis: c.Redis, Context: ctx}
+}
+
+// Ping checks that Redis answers
+func (c *CacheHandler) Ping(ctx context.Context) error {
+	return c.Redis.Conn().Ping(ctx).Err()
+}
+
+// Close closes the Redis connection pool
+func (c *CacheHandler) Close() error {
+	return c.Redis.Close()
+}
+
 func AddCache(exp time.Duration) fiber.Handler {
 	return cache.New(cache.Config{
 		Expiration:   exp,
@@ -53,7 +77,7 @@ func AddCache(exp time.Duration) fiber.Handler {
 }
 
 // Bets
-func (c *CacheHandler) SetBet(bet models.Bet) int {
+func (c *CacheHandler) SetBet(bet models.Bet) error {
 	betData, err := json.Marshal(bet)
 	if err != nil {
 		return HandleRedisError(err)
@@ -61,22 +85,52 @@ func (c *CacheHandler) SetBet(bet models.Bet) int {
 	// Save the JSON string to Redis with a key prefix
 	res := c.Redis.Conn().Set(c.Context, "b-"+fmt.Sprintf("%d", bet.ID), betData, time.Until(bet.EndsAt)).Err()
 	if res != nil {
-		log.Error(res)
+		cacheLog.Error("failed to store bet", "bet_id", bet.ID, "error", res)
 		return HandleRedisError(res)
 	}
-	return -1
+	c.setTraceContext(fmt.Sprintf("b-%d", bet.ID), time.Until(bet.EndsAt)+time.Hour)
+	return nil
 }
 
-func (c *CacheHandler) RemoveBet(betID uint) int {
+// setTraceContext remembers the trace that scheduled the expiry of key, the
+// first one wins so the expiry continues the trace that created the bet
+func (c *CacheHandler) setTraceContext(key string, ttl time.Duration) {
+	if !trace.SpanContextFromContext(c.Context).IsValid() {
+		return
+	}
+	data, err := json.Marshal(tracing.Inject(c.Context))
+	if err != nil {
+		return
+	}
+	if err := c.Redis.Conn().SetNX(c.Context, "trace-"+key, data, ttl).Err(); err != nil {
+		cacheLog.DebugContext(c.Context, "failed to store trace context", "key", key, "error", err)
+	}
+}
+
+// TraceContext returns ctx joined to the trace stored for key by SetBet and
+// forgets it, ctx is returned unchanged when none was stored
+func (c *CacheHandler) TraceContext(ctx context.Context, key string) context.Context {
+	data, err := c.Redis.Conn().GetDel(ctx, "trace-"+key).Bytes()
+	if err != nil {
+		return ctx
+	}
+	carrier := map[string]string{}
+	if err := json.Unmarshal(data, &carrier); err != nil {
+		return ctx
+	}
+	return tracing.Extract(ctx, carrier)
+}
+
+func (c *CacheHandler) RemoveBet(betID uint) error {
 	// Remove the bet from Redis
 	res := c.Redis.Conn().Del(c.Context, "b-"+fmt.Sprintf("%d", betID)).Err()
 	if res != nil {
 		return HandleRedisError(res)
 	}
-	return -1
+	return nil
 }
 
-func (c *CacheHandler) GetBetById(betID uint) (*models.Bet, int) {
+func (c *CacheHandler) GetBetById(betID uint) (*models.Bet, error) {
 	var bet models.Bet
 
 	key := fmt.Sprintf("b-%d", betID)
@@ -85,36 +139,38 @@ func (c *CacheHandler) GetBetById(betID uint) (*models.Bet, int) {
 	res := c.Redis.Conn().Get(c.Context, key)
 	err := res.Err()
 	if err != nil {
-		log.Error(err, key)
 		if err == r.Nil {
-			return nil, tools.RD_KEY_NOT_FOUND
+			metrics.CacheLookups.WithLabelValues("bet", "miss").Inc()
+			return nil, apperr.ErrCacheNotFound
 		}
+		metrics.CacheLookups.WithLabelValues("bet", "error").Inc()
+		cacheLog.Error("failed to read bet", "key", key, "error", err)
 		return nil, HandleRedisError(err)
 	}
+	metrics.CacheLookups.WithLabelValues("bet", "hit").Inc()
 
 	// Unmarshal the JSON string into the models.Bet struct
 	data, err := res.Bytes()
 	if err != nil {
-		log.Error("Failed to get bytes from Redis:", err)
+		cacheLog.Error("failed to read bet", "key", key, "error", err)
 		return nil, HandleRedisError(err)
 	}
 
 	err = json.Unmarshal(data, &bet)
 	if err != nil {
-		log.Error("Failed to unmarshal JSON into Bet struct:", err)
+		cacheLog.Error("failed to decode cached bet", "key", key, "error", err)
 		return nil, HandleRedisError(err)
 	}
 
-	return &bet, -1
+	return &bet, nil
 }
 
-func (c *CacheHandler) GetAllBet() (*[]models.Bet, int) {
+func (c *CacheHandler) GetAllBet() (*[]models.Bet, error) {
 	// Retrieve all keys from Redis
 	keys, err := c.Redis.Keys()
 	if err != nil {
 		return nil, HandleRedisError(err)
 	}
-	log.Info(keys)
 
 	bets := []models.Bet{}
 	for _, key := range keys {
@@ -123,23 +179,22 @@ func (c *CacheHandler) GetAllBet() (*[]models.Bet, int) {
 		if !strings.HasPrefix(key, "b-") {
 			continue
 		}
-		log.Info(key)
 		// Retrieve the bet by ID
 		bet, err := c.GetBetById(tools.ConvertKeyToBetID(key))
-		if err != -1 {
-			if err == tools.RD_KEY_NOT_FOUND {
+		if err != nil {
+			if err == apperr.ErrCacheNotFound {
 				continue
 			}
 			return nil, err
 		}
 		bets = append(bets, *bet)
 	}
-	return &bets, -1
+	return &bets, nil
 }
 
-func (c *CacheHandler) GetAllBetByAmount(amount int) (*[]models.Bet, int) {
+func (c *CacheHandler) GetAllBetByAmount(amount int) (*[]models.Bet, error) {
 	bets, err := c.GetAllBet()
-	if err != -1 {
+	if err != nil {
 		return nil, err
 	}
 	filteredBets := []models.Bet{}
@@ -148,43 +203,41 @@ func (c *CacheHandler) GetAllBetByAmount(amount int) (*[]models.Bet, int) {
 			filteredBets = append(filteredBets, bet)
 		}
 	}
-	return &filteredBets, -1
+	return &filteredBets, nil
 }
 
-func (c *CacheHandler) UpdateBet(betID uint) int {
-	bet, err := DB.GetBetByID(betID)
-	if err != -1 {
+func (c *CacheHandler) UpdateBet(betID uint) error {
+	bet, err := DB.WithContext(c.Context).GetBetByID(betID)
+	if err != nil {
 		return err
 	}
 
 	err = c.SetBet(*bet)
-	if err != -1 {
+	if err != nil {
 		return err
 	}
-	return -1
+	return nil
 }
 
-func (c *CacheHandler) LoadDatabaseBets() int {
-	bets, err := DB.GetAllActiveBets()
-	if err != -1 {
+func (c *CacheHandler) LoadDatabaseBets() error {
+	bets, err := DB.WithContext(c.Context).GetAllActiveBets()
+	if err != nil {
 		return err
 	}
 	for _, bet := range *bets {
-		log.Info("Loaded bet", bet.ID)
-		log.Info(fmt.Sprintf("%v", bet))
 		err := c.SetBet(bet)
-		if err != -1 {
-			log.Error(err)
+		if err != nil {
+			cacheLog.Error("failed to load bet", "bet_id", bet.ID, "error", err)
 			return err
 		}
+		cacheLog.Debug("loaded bet", "bet_id", bet.ID)
 	}
-	return -1
+	return nil
 }
 
-func HandleRedisError(e error) int {
+func HandleRedisError(e error) error {
 	if e == r.Nil {
-		return tools.RD_KEY_NOT_FOUND
-	} else {
-		return tools.RD_UNKNOWN
+		return apperr.ErrCacheNotFound.Wrap(e)
 	}
+	return apperr.ErrCache.Wrap(e)
 }
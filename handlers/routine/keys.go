@@ -0,0 +1,55 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"gambler/backend/keyring"
+	"gambler/backend/logging"
+	"time"
+)
+
+var keyringLog = logging.For("keyring")
+
+// KeyRotation rotates the signing keys when they are due and picks up the
+// keys created by other replicas
+type KeyRotation struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartKeyRotation refreshes ring every keyring.RefreshInterval until it is
+// stopped, the ring has to be loaded already
+func StartKeyRotation(ring *keyring.Keyring) *KeyRotation {
+	ctx, cancel := context.WithCancel(context.Background())
+	rotation := &KeyRotation{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(rotation.done)
+		ticker := time.NewTicker(keyring.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// Failures keep the loaded keys, the next tick tries again
+			if err := ring.Refresh(ctx); err != nil && !errors.Is(ctx.Err(), context.Canceled) {
+				keyringLog.Error("failed to refresh the signing keys", "error", err)
+			}
+		}
+	}()
+
+	return rotation
+}
+
+// Stop waits for the refresh in flight
+func (k *KeyRotation) Stop(ctx context.Context) error {
+	k.cancel()
+	select {
+	case <-k.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,85 +1,186 @@
 package routine
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"gambler/backend/apperr"
 	"gambler/backend/database/models/customTypes"
 	"gambler/backend/handlers"
 	"gambler/backend/handlers/websocket"
+	"gambler/backend/logging"
+	"gambler/backend/metrics"
+	"gambler/backend/notifier"
 	"gambler/backend/tools"
+	"gambler/backend/tracing"
+	"net"
 	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/gofiber/fiber/v2/log"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// ListenForExpiredKeys listens for expired keys in Redis and handles them
-func ListenForExpiredKeys() {
+var expiryLog = logging.For("expiry")
+
+// heartbeatInterval is how long the subscriber waits for an event before it
+// pings Redis, every event or pong counts as a heartbeat
+const heartbeatInterval = 15 * time.Second
+
+// ExpiryListener is the background subscriber started by ListenForExpiredKeys
+type ExpiryListener struct {
+	pubsub    *redis.PubSub
+	cancel    context.CancelFunc
+	done      chan struct{}
+	heartbeat atomic.Int64
+}
+
+// ListenForExpiredKeys listens for expired keys in the given Redis database and handles them
+func ListenForExpiredKeys(redisDB int) *ExpiryListener {
+	ctx, cancel := context.WithCancel(handlers.Cache.Context)
+
 	// Subscribe to the Redis expired events
-	pubsub := handlers.Cache.Redis.Conn().Subscribe(handlers.Cache.Context, "__keyevent@0__:expired") // Replace 0 with your Redis DB index if different
+	pubsub := handlers.Cache.Redis.Conn().Subscribe(ctx, fmt.Sprintf("__keyevent@%d__:expired", redisDB))
+
+	listener := &ExpiryListener{
+		pubsub: pubsub,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
 
 	// Handle messages in a separate goroutine
 	go func() {
+		defer close(listener.done)
 		for {
-			msg, err := pubsub.ReceiveMessage(handlers.Cache.Context)
+			received, err := pubsub.ReceiveTimeout(ctx, heartbeatInterval)
+			if ctx.Err() != nil {
+				return
+			}
 			if err != nil {
-				log.Error("Failed to receive message from Redis:", err)
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					// Nothing expired, make sure the connection is still alive
+					if err := pubsub.Ping(ctx); err != nil {
+						expiryLog.Error("failed to ping redis", "error", err)
+					}
+					continue
+				}
+				expiryLog.Error("failed to receive expired key event", "error", err)
+				time.Sleep(time.Second)
 				continue
 			}
+			listener.beat()
 
-			log.Info("Received expired key event:", msg.Payload)
+			msg, ok := received.(*redis.Message)
+			if !ok {
+				continue
+			}
+			expiryLog.Debug("received expired key event", "key", msg.Payload)
 
 			// Handle the expired key event (msg.Payload contains the expired key name)
-			HandleExpiredKey(msg.Payload)
+			HandleExpiredKey(ctx, msg.Payload)
 		}
 	}()
+
+	return listener
+}
+
+func (l *ExpiryListener) beat() {
+	l.heartbeat.Store(time.Now().UnixNano())
 }
 
-// HandleExpiredKey processes the expired key event
-func HandleExpiredKey(key string) {
+// Alive reports an error once the subscriber goroutine has exited
+func (l *ExpiryListener) Alive(ctx context.Context) error {
+	select {
+	case <-l.done:
+		return errors.New("expired key subscriber stopped")
+	default:
+		return nil
+	}
+}
+
+// Heartbeat reports an error when the subscriber has neither received an
+// event nor a pong for a while, e.g. because it is stuck or Redis is gone
+func (l *ExpiryListener) Heartbeat(ctx context.Context) error {
+	last := l.heartbeat.Load()
+	if last == 0 {
+		return errors.New("expired key subscriber not subscribed yet")
+	}
+	if since := time.Since(time.Unix(0, last)); since > 3*heartbeatInterval {
+		return fmt.Errorf("last heartbeat %s ago", since.Round(time.Second))
+	}
+	return nil
+}
+
+// Stop unsubscribes and waits for the expired key currently being handled
+func (l *ExpiryListener) Stop(ctx context.Context) error {
+	l.cancel()
+	defer l.pubsub.Close()
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HandleExpiredKey processes the expired key event. The work is traced as
+// part of the request that created the bet, when its trace was recorded.
+func HandleExpiredKey(ctx context.Context, key string) {
 	// Add your logic to handle expired keys here
 	if strings.HasPrefix(key, "b-") {
-		log.Info("Bet expired:", key)
+		ctx, span := tracing.Start(handlers.Cache.TraceContext(ctx, key), "expiry.HandleExpiredKey",
+			attribute.String("redis.key", key),
+		)
+		defer span.End()
+
+		expiryLog.InfoContext(ctx, "bet expired", "key", key)
 		// You can add additional logic to handle the expiration of a bet, e.g., update the database, notify users, etc.
 		betID := tools.ConvertKeyToBetID(key)
-		bet, err := handlers.DB.UpdateBetStatus(betID, customTypes.Pending)
-		if err != -1 {
-			log.Error("Failed to update bet status:", err)
-			tools.SendWebHook(fmt.Sprintf("Failed to update bet status: %d", betID))
+		bet, err := handlers.DB.WithContext(ctx).UpdateBetStatus(betID, customTypes.Pending)
+		if err != nil {
+			tracing.Fail(span, string(apperr.CodeOf(err)))
+			expiryLog.ErrorContext(ctx, "failed to update bet status", "bet_id", betID, "error", err)
+			notifier.Notify(notifier.Error, "Failed to update bet status: %d", betID)
+			return
 		}
-		log.Info("Updated bet status to Pending:", bet.ID)
-		err = handlers.Cache.UpdateBet(bet.ID)
-		if err != -1 {
-			log.Error("Failed to update bet in cache:", err)
-			tools.SendWebHook(fmt.Sprintf("Failed to update bet in cache: %d", betID))
+		expiryLog.DebugContext(ctx, "updated bet status to pending", "bet_id", bet.ID)
+		metrics.ExpirySchedulerLag.Observe(time.Since(bet.EndsAt).Seconds())
+		err = handlers.Cache.WithContext(ctx).UpdateBet(bet.ID)
+		if err != nil {
+			tracing.Fail(span, string(apperr.CodeOf(err)))
+			expiryLog.ErrorContext(ctx, "failed to update bet in cache", "bet_id", betID, "error", err)
+			notifier.Notify(notifier.Error, "Failed to update bet in cache: %d", betID)
 		}
-		log.Info("Updated bet in cache:", bet.ID)
-		websocket.WebSocket.UpdateBet(betID)
+		websocket.WebSocket.UpdateBet(ctx, betID)
 	}
 }
 
-func updateBetStatusOnInit() int {
+func updateBetStatusOnInit() error {
 	bets, err := handlers.DB.GetAllBetsByStatus(customTypes.Open)
-	if err != -1 {
-		log.Error("Failed to get open bets:", err)
-		tools.SendWebHook(fmt.Sprintf("Error when find all bets: %s", tools.GetErrorString(err)))
+	if err != nil {
+		expiryLog.Error("failed to get open bets", "error", err)
+		notifier.Notify(notifier.Error, "Error when find all bets: %s", apperr.CodeOf(err))
 		return err
 	}
 
 	for _, bet := range *bets {
 		_, err = handlers.DB.UpdateBetStatus(bet.ID, customTypes.Pending)
-		if err != -1 {
-			log.Error("Failed to update bet status:", err)
-			tools.SendWebHook(fmt.Sprintf("Failed to update bet status: %d", bet.ID))
+		if err != nil {
+			expiryLog.Error("failed to update bet status", "bet_id", bet.ID, "error", err)
+			notifier.Notify(notifier.Error, "Failed to update bet status: %d", bet.ID)
 			return err
 		}
-		log.Info("Updated bet status to Pending:", bet.ID)
+		expiryLog.Debug("updated bet status to pending", "bet_id", bet.ID)
 		err = handlers.Cache.UpdateBet(bet.ID)
-		if err != -1 {
-			log.Error("Failed to update bet in cache:", err)
-			tools.SendWebHook(fmt.Sprintf("Failed to update bet in cache: %d", bet.ID))
+		if err != nil {
+			expiryLog.Error("failed to update bet in cache", "bet_id", bet.ID, "error", err)
+			notifier.Notify(notifier.Error, "Failed to update bet in cache: %d", bet.ID)
 			return err
 		}
-		log.Info("Updated bet in cache:", bet.ID)
-		websocket.WebSocket.UpdateBet(bet.ID)
+		websocket.WebSocket.UpdateBet(context.Background(), bet.ID)
 	}
-	return -1
+	return nil
 }
@@ -0,0 +1,150 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/handlers"
+	"gambler/backend/logging"
+	"gambler/backend/metrics"
+	"gambler/backend/tracing"
+	"gambler/backend/webhook"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var webhookLog = logging.For("webhooks")
+
+// WebhookWorker sends the queued webhook deliveries in the background
+type WebhookWorker struct {
+	cfg    config.WebhookConfig
+	sender *webhook.Sender
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartWebhookWorker polls the delivery queue until it is stopped. Several
+// replicas can run it at the same time, every delivery is claimed by one.
+func StartWebhookWorker(cfg config.WebhookConfig) *WebhookWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	worker := &WebhookWorker{
+		cfg:    cfg,
+		sender: webhook.NewSender(cfg.Timeout, cfg.AllowPrivateNetworks),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(worker.done)
+		ticker := time.NewTicker(cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			worker.drain(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return worker
+}
+
+// drain sends batches until no delivery is due
+func (w *WebhookWorker) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		// The lease outlasts the attempts of a whole batch
+		lease := w.cfg.Timeout*time.Duration(w.cfg.BatchSize) + time.Minute
+		claimed, err := handlers.DB.WithContext(ctx).ClaimWebhookDeliveries(w.cfg.BatchSize, lease)
+		if err != nil {
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				webhookLog.Error("failed to claim webhook deliveries", "error", err)
+			}
+			return
+		}
+		for _, delivery := range *claimed {
+			if ctx.Err() != nil {
+				// The rest is picked up again once the lease expires
+				return
+			}
+			// Not canceled by Stop, the attempt is bounded by the timeout
+			w.deliver(context.WithoutCancel(ctx), delivery)
+		}
+		if len(*claimed) < w.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+func (w *WebhookWorker) deliver(ctx context.Context, claimed handlers.ClaimedDelivery) {
+	ctx, span := tracing.Start(ctx, "webhook.deliver",
+		attribute.Int64("webhook.id", int64(claimed.WebhookID)),
+		attribute.Int64("webhook.delivery_id", int64(claimed.ID)),
+		attribute.String("webhook.event", claimed.Event),
+	)
+	defer span.End()
+
+	delivery := claimed.WebhookDelivery
+	status, err := w.sender.Send(ctx, claimed.URL, claimed.Secret, delivery.Event, delivery.ID, delivery.Payload)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+
+	result := "delivered"
+	switch {
+	case err == nil:
+		delivery.Status = webhook.StatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= w.cfg.MaxAttempts:
+		result = "failed"
+		delivery.Status = webhook.StatusFailed
+		delivery.LastError = truncate(err.Error(), 500)
+		webhookLog.WarnContext(ctx, "webhook delivery failed, giving up", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "attempts", delivery.Attempts, "error", err)
+	default:
+		result = "retry"
+		delivery.NextAttemptAt = now.Add(webhook.Backoff(w.cfg.RetryBackoff, delivery.Attempts))
+		delivery.LastError = truncate(err.Error(), 500)
+		webhookLog.DebugContext(ctx, "webhook delivery failed, retrying", "delivery_id", delivery.ID, "next_attempt_at", delivery.NextAttemptAt, "error", err)
+	}
+	if err != nil {
+		tracing.Fail(span, result)
+	}
+	metrics.WebhookDeliveries.WithLabelValues(delivery.Event, result).Inc()
+
+	if err := handlers.DB.WithContext(ctx).SaveWebhookAttempt(delivery); err != nil {
+		webhookLog.ErrorContext(ctx, "failed to save webhook attempt", "delivery_id", delivery.ID, "code", apperr.CodeOf(err), "error", err)
+	}
+}
+
+// Alive reports an error once the worker goroutine has exited
+func (w *WebhookWorker) Alive(ctx context.Context) error {
+	select {
+	case <-w.done:
+		return errors.New("webhook worker stopped")
+	default:
+		return nil
+	}
+}
+
+// Stop lets the delivery in flight finish and waits for the worker
+func (w *WebhookWorker) Stop(ctx context.Context) error {
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
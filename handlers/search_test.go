@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"html"
+	"strings"
+	"testing"
+)
+
+// The replacements escapeHTML nests in SQL have to escape like the standard
+// library, in the same order
+func TestEscapeHTMLEntities(t *testing.T) {
+	tests := []string{
+		"Who wins the final?",
+		`<script>alert("x")</script>`,
+		"Tom & Jerry's <b>bet</b>",
+		"&lt; already escaped",
+		"",
+	}
+	for _, text := range tests {
+		got := text
+		for _, entity := range htmlEntities {
+			got = strings.ReplaceAll(got, strings.ReplaceAll(entity[0], "''", "'"), entity[1])
+		}
+		if want := html.EscapeString(text); got != want {
+			t.Errorf("escaping %q = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestEscapeHTMLExpression(t *testing.T) {
+	got := escapeHTML("bets.name")
+	if !strings.HasPrefix(got, "replace(replace(replace(replace(replace(bets.name, '&', '&amp;')") {
+		t.Errorf("& has to be replaced first, got %s", got)
+	}
+	if !strings.HasSuffix(got, "'''', '&#39;')") {
+		t.Errorf("quote is not escaped as a SQL literal, got %s", got)
+	}
+}
+
+// TestSearchHeadline checks the order of the expression: the sentinels are
+// removed from the text, the matches marked, the headline escaped and the
+// sentinels turned into <mark> last
+func TestSearchHeadline(t *testing.T) {
+	got := searchHeadline("bets.name", "websearch_to_tsquery('english', ?)")
+
+	order := []string{
+		"replace(replace(",
+		"ts_headline('",
+		"translate(bets.name, chr(2) || chr(3), '')",
+		"'StartSel=' || chr(2) || ', StopSel=' || chr(3)",
+		"'&', '&amp;'",
+		"'''', '&#39;')",
+		"chr(2), '<mark>'), chr(3), '</mark>')",
+	}
+	rest := got
+	for _, part := range order {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			t.Fatalf("%q missing or out of order in %s", part, got)
+		}
+		rest = rest[i+len(part):]
+	}
+	if rest != "" {
+		t.Errorf("expression ends with %q, want the </mark> replacement last", rest)
+	}
+	if strings.Contains(got, "<mark>, ") || strings.Contains(got, "StartSel=<") {
+		t.Errorf("ts_headline adds the markup before escaping: %s", got)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons a session was revoked for
+const (
+	RevokedByUser      = "revoked"
+	RevokedLogout      = "logout"
+	RevokedLogoutAll   = "logout_all"
+	RevokedByOperator  = "operator"
+	RevokedReset       = "password_reset"
+	RevokedTokenReused = "refresh_token_reused"
+)
+
+func (h DBHandler) CreateSession(session models.Session) error {
+	if res := h.DB.Create(&session); res.Error != nil {
+		return dbHandleError(res.Error)
+	}
+	return nil
+}
+
+// refreshGrace is how long the refresh token replaced by a rotation is still
+// accepted. Requests of the same device that refresh at once present the same
+// token, only the first one rotates it.
+const refreshGrace = 10 * time.Second
+
+// RotateSession replaces the refresh token of a session and returns the id
+// and expiry of the refresh token to hand out. Presenting the token replaced
+// by the last rotation within refreshGrace returns the latest token of the
+// session instead of rotating again. Presenting any other than the latest
+// refresh token means it was copied, the whole session is revoked then and
+// the caller has to sign in again.
+func (h DBHandler) RotateSession(sessionID string, userID uint, tokenID string, newTokenID string, expiresAt time.Time) (string, time.Time, error) {
+	var reused bool
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&session, "id = ?", sessionID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperr.ErrTokenInvalid.Wrap(err)
+		}
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil {
+			return apperr.ErrSessionRevoked
+		}
+		if session.ExpiresAt.Before(time.Now()) {
+			return apperr.ErrTokenExpired
+		}
+
+		if session.RefreshTokenID != tokenID {
+			if tokenID == session.PreviousRefreshTokenID && session.RotatedAt != nil && time.Since(*session.RotatedAt) < refreshGrace {
+				newTokenID, expiresAt = session.RefreshTokenID, session.ExpiresAt
+				return nil
+			}
+			reused = true
+			return h.revokeSessions(tx, userID, []string{session.ID}, RevokedTokenReused)
+		}
+
+		now := time.Now()
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"refresh_token_id":          newTokenID,
+			"previous_refresh_token_id": tokenID,
+			"rotated_at":                now,
+			"last_used_at":              now,
+			"expires_at":                expiresAt,
+		}).Error
+	})
+	if err != nil {
+		return "", time.Time{}, dbHandleError(err)
+	}
+	if reused {
+		dbLog.WarnContext(h.ctx(), "refresh token reused, session revoked", "session_id", sessionID, "user_id", userID)
+		return "", time.Time{}, apperr.ErrTokenReused
+	}
+	return newTokenID, expiresAt, nil
+}
+
+// ListSessions returns the active sessions of a user, most recently used
+// first
+func (h DBHandler) ListSessions(userID uint) (*[]models.Session, error) {
+	sessions := []models.Session{}
+	res := h.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions)
+	if res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &sessions, nil
+}
+
+// RevokeSession ends an active session of the user
+func (h DBHandler) RevokeSession(userID uint, sessionID string, reason string) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return apperr.ErrRecordNotFound
+		}
+		return h.revokeSessions(tx, userID, []string{sessionID}, reason)
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// RevokeAllSessions ends every active session of the user and returns their
+// ids
+func (h DBHandler) RevokeAllSessions(userID uint, reason string) ([]string, error) {
+	var ids []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return h.revokeSessions(tx, userID, ids, reason)
+	})
+	if err != nil {
+		return nil, dbHandleError(err)
+	}
+	return ids, nil
+}
+
+func (h DBHandler) revokeSessions(tx *gorm.DB, userID uint, ids []string, reason string) error {
+	res := tx.Model(&models.Session{}).Where("id IN ? AND revoked_at IS NULL", ids).Updates(map[string]interface{}{
+		"revoked_at":     time.Now(),
+		"revoked_reason": reason,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	return h.appendAudit(tx, audit.ActionTokenRevoke, audit.TargetUser, userID, nil, map[string]interface{}{
+		"sessions": ids,
+		"reason":   reason,
+	})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/database/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotateSession(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Hour)
+	active := models.Session{ID: "s1", UserID: 7, RefreshTokenID: "t1", ExpiresAt: now.Add(time.Hour)}
+	rotated := func(at time.Time) models.Session {
+		return models.Session{ID: "s1", UserID: 7, RefreshTokenID: "t1", PreviousRefreshTokenID: "t0", RotatedAt: &at, ExpiresAt: now.Add(time.Hour)}
+	}
+
+	tests := []struct {
+		name       string
+		session    models.Session
+		userID     uint
+		tokenID    string
+		err        *apperr.Error
+		tokenAfter string
+		handedOut  string
+		revoked    string
+	}{
+		{name: "latest token", session: active, userID: 7, tokenID: "t1", tokenAfter: "t2", handedOut: "t2"},
+		{name: "reused token", session: active, userID: 7, tokenID: "t0", err: apperr.ErrTokenReused, tokenAfter: "t1", revoked: RevokedTokenReused},
+		{name: "previous token within grace", session: rotated(now.Add(-time.Second)), userID: 7, tokenID: "t0", tokenAfter: "t1", handedOut: "t1"},
+		{name: "previous token after grace", session: rotated(now.Add(-refreshGrace)), userID: 7, tokenID: "t0", err: apperr.ErrTokenReused, tokenAfter: "t1", revoked: RevokedTokenReused},
+		{name: "other user", session: active, userID: 8, tokenID: "t1", err: apperr.ErrTokenInvalid, tokenAfter: "t1"},
+		{name: "unknown session", session: models.Session{ID: "s9", UserID: 7, RefreshTokenID: "t1", ExpiresAt: now.Add(time.Hour)}, userID: 7, tokenID: "t1", err: apperr.ErrTokenInvalid, tokenAfter: "t1"},
+		{name: "revoked session", session: models.Session{ID: "s1", UserID: 7, RefreshTokenID: "t1", ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt, RevokedReason: RevokedLogout}, userID: 7, tokenID: "t1", err: apperr.ErrSessionRevoked, tokenAfter: "t1", revoked: RevokedLogout},
+		{name: "expired session", session: models.Session{ID: "s1", UserID: 7, RefreshTokenID: "t1", ExpiresAt: now.Add(-time.Minute)}, userID: 7, tokenID: "t1", err: apperr.ErrTokenExpired, tokenAfter: "t1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store := newSessionStore(t, tt.session)
+			expiresAt := now.Add(24 * time.Hour).Truncate(time.Second)
+
+			handedOut, _, err := h.RotateSession("s1", tt.userID, tt.tokenID, "t2", expiresAt)
+			if tt.err == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if handedOut != tt.handedOut {
+				t.Errorf("handed out %q, want %q", handedOut, tt.handedOut)
+			}
+
+			session := store.session(tt.session.ID)
+			if session.RefreshTokenID != tt.tokenAfter {
+				t.Errorf("refresh token = %s, want %s", session.RefreshTokenID, tt.tokenAfter)
+			}
+			if session.RevokedReason != tt.revoked || (session.RevokedAt != nil) != (tt.revoked != "") {
+				t.Errorf("revoked %v for %q, want %q", session.RevokedAt, session.RevokedReason, tt.revoked)
+			}
+			if tt.tokenAfter == "t2" && !session.ExpiresAt.Equal(expiresAt) {
+				t.Errorf("expires at %s, want %s", session.ExpiresAt, expiresAt)
+			}
+
+			wantAudit := []string{}
+			if tt.err == apperr.ErrTokenReused {
+				wantAudit = []string{audit.ActionTokenRevoke}
+			}
+			if got := store.audited(); strings.Join(got, ",") != strings.Join(wantAudit, ",") {
+				t.Errorf("audited %v, want %v", got, wantAudit)
+			}
+		})
+	}
+}
+
+// TestRotateSessionFamily follows a stolen refresh token: once either copy
+// is used after the other, the session is over for both
+func TestRotateSessionFamily(t *testing.T) {
+	h, store := newSessionStore(t, models.Session{ID: "s1", UserID: 7, RefreshTokenID: "t1", ExpiresAt: time.Now().Add(time.Hour)})
+	expiresAt := time.Now().Add(time.Hour)
+
+	steps := []struct {
+		presented string
+		issued    string
+		// later is past the grace of the previous rotation
+		later bool
+		err   *apperr.Error
+	}{
+		{"t1", "t2", false, nil},
+		{"t2", "t3", false, nil},
+		// The attacker replays the copy taken before the last refresh
+		{"t2", "t4", true, apperr.ErrTokenReused},
+		// The owner's latest token no longer works either
+		{"t3", "t5", false, apperr.ErrSessionRevoked},
+	}
+	for i, step := range steps {
+		if step.later {
+			session := store.sessions["s1"]
+			rotatedAt := session.RotatedAt.Add(-refreshGrace)
+			session.RotatedAt = &rotatedAt
+			store.sessions["s1"] = session
+		}
+		_, _, err := h.RotateSession("s1", 7, step.presented, step.issued, expiresAt)
+		if step.err == nil && err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i+1, err)
+		}
+		if step.err != nil && !errors.Is(err, step.err) {
+			t.Fatalf("step %d: error = %v, want %v", i+1, err, step.err)
+		}
+	}
+	if session := store.session("s1"); session.RevokedReason != RevokedTokenReused {
+		t.Errorf("session revoked for %q, want %q", session.RevokedReason, RevokedTokenReused)
+	}
+}
+
+// TestRotateSessionConcurrent refreshes the same token from two requests of
+// the device at once, both get the token of the one that rotated first
+func TestRotateSessionConcurrent(t *testing.T) {
+	h, store := newSessionStore(t, models.Session{ID: "s1", UserID: 7, RefreshTokenID: "t1", ExpiresAt: time.Now().Add(time.Hour)})
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	type rotation struct {
+		id        string
+		expiresAt time.Time
+		err       error
+	}
+	results := make(chan rotation, 2)
+	var wg sync.WaitGroup
+	for _, issued := range []string{"t2a", "t2b"} {
+		wg.Add(1)
+		go func(issued string) {
+			defer wg.Done()
+			id, exp, err := h.RotateSession("s1", 7, "t1", issued, expiresAt)
+			results <- rotation{id, exp, err}
+		}(issued)
+	}
+	wg.Wait()
+	close(results)
+
+	session := store.session("s1")
+	for r := range results {
+		if r.err != nil {
+			t.Fatalf("unexpected error: %v", r.err)
+		}
+		if r.id != session.RefreshTokenID || !r.expiresAt.Equal(expiresAt) {
+			t.Errorf("handed out %s until %s, want %s until %s", r.id, r.expiresAt, session.RefreshTokenID, expiresAt)
+		}
+	}
+	if session.RevokedAt != nil {
+		t.Errorf("session revoked for %q", session.RevokedReason)
+	}
+	if got := store.audited(); len(got) != 0 {
+		t.Errorf("audited %v, want nothing", got)
+	}
+
+	// The token handed out to both keeps working
+	if _, _, err := h.RotateSession("s1", 7, session.RefreshTokenID, "t3", expiresAt); err != nil {
+		t.Errorf("rotating the handed out token: %v", err)
+	}
+}
+
+// sessionTable keeps the sessions of the fake database and answers the
+// statements RotateSession and the revocations send
+
+var (
+	assignmentPattern = regexp.MustCompile(`"(\w+)"=\$(\d+)`)
+	wherePattern      = regexp.MustCompile(`WHERE (?:"id" = |id IN \()\$(\d+)`)
+)
+
+type sessionTable struct {
+	db       *dbtest.DB
+	sessions map[string]models.Session
+}
+
+func newSessionStore(t *testing.T, sessions ...models.Session) (DBHandler, *sessionTable) {
+	table := &sessionTable{db: dbtest.New(t), sessions: map[string]models.Session{}}
+	for _, s := range sessions {
+		table.sessions[s.ID] = s
+	}
+	table.db.Handle(`SELECT * FROM "sessions" WHERE user_id = $1 AND id = $2`, table.selectSession)
+	table.db.Handle(`UPDATE "sessions" SET`, table.updateSession)
+	return DBHandler{table.db.Gorm(t).WithContext(context.Background())}, table
+}
+
+func (table *sessionTable) session(id string) models.Session {
+	return table.sessions[id]
+}
+
+func (table *sessionTable) audited() []string {
+	return table.db.Audited()
+}
+
+func (table *sessionTable) selectSession(s *dbtest.Statement) (dbtest.Result, error) {
+	if !s.InTx() {
+		return dbtest.Result{}, fmt.Errorf("%q ran outside of a transaction", s.Query)
+	}
+	result := dbtest.Result{Columns: []string{"id", "user_id", "refresh_token_id", "previous_refresh_token_id", "rotated_at", "expires_at", "revoked_at", "revoked_reason"}}
+	session, ok := table.sessions[s.Arg(2).(string)]
+	if ok && int64(session.UserID) == s.Arg(1).(int64) {
+		var rotatedAt, revokedAt driver.Value
+		if session.RotatedAt != nil {
+			rotatedAt = *session.RotatedAt
+		}
+		if session.RevokedAt != nil {
+			revokedAt = *session.RevokedAt
+		}
+		result.Rows = append(result.Rows, []driver.Value{session.ID, int64(session.UserID), session.RefreshTokenID, session.PreviousRefreshTokenID, rotatedAt, session.ExpiresAt, revokedAt, session.RevokedReason})
+	}
+	return result, nil
+}
+
+func (table *sessionTable) updateSession(s *dbtest.Statement) (dbtest.Result, error) {
+	if !s.InTx() {
+		return dbtest.Result{}, fmt.Errorf("%q ran outside of a transaction", s.Query)
+	}
+	where := wherePattern.FindStringSubmatch(s.Query)
+	if where == nil {
+		return dbtest.Result{}, fmt.Errorf("unexpected update %q", s.Query)
+	}
+	id := s.Arg(atoi(where[1])).(string)
+	session, ok := table.sessions[id]
+	if !ok || (strings.Contains(s.Query, "revoked_at IS NULL") && session.RevokedAt != nil) {
+		return dbtest.Result{}, nil
+	}
+	for _, m := range assignmentPattern.FindAllStringSubmatch(s.Query, -1) {
+		value := s.Arg(atoi(m[2]))
+		switch m[1] {
+		case "refresh_token_id":
+			session.RefreshTokenID = value.(string)
+		case "previous_refresh_token_id":
+			session.PreviousRefreshTokenID = value.(string)
+		case "rotated_at":
+			at := value.(time.Time)
+			session.RotatedAt = &at
+		case "last_used_at":
+			session.LastUsedAt = value.(time.Time)
+		case "expires_at":
+			session.ExpiresAt = value.(time.Time)
+		case "revoked_at":
+			at := value.(time.Time)
+			session.RevokedAt = &at
+		case "revoked_reason":
+			session.RevokedReason = value.(string)
+		default:
+			return dbtest.Result{}, fmt.Errorf("unexpected column %s", m[1])
+		}
+	}
+	s.OnCommit(func() { table.sessions[id] = session })
+	return dbtest.Result{Affected: 1}, nil
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
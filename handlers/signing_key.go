@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// signingKeyLockKey serializes rotations, so replicas reaching the rotation
+// time together create a single key
+const signingKeyLockKey = 0x6b657973
+
+// ListSigningKeys returns the keys that still verify tokens, newest first
+func (h DBHandler) ListSigningKeys() ([]models.SigningKey, error) {
+	keys := []models.SigningKey{}
+	res := h.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&keys)
+	if res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return keys, nil
+}
+
+// RotateSigningKey stores key as the signing key of its algorithm unless
+// another replica stored one after due, and reports whether it did. The
+// keys it replaces, and those of other algorithms created before due, keep
+// verifying for retireAfter. Expired keys are deleted.
+func (h DBHandler) RotateSigningKey(key models.SigningKey, due time.Time, retireAfter time.Duration) (bool, error) {
+	var rotated bool
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyLockKey).Error; err != nil {
+			return err
+		}
+		var fresh int64
+		err := tx.Model(&models.SigningKey{}).
+			Where("algorithm = ? AND expires_at IS NULL AND created_at > ?", key.Algorithm, due).
+			Count(&fresh).Error
+		if err != nil || fresh > 0 {
+			return err
+		}
+
+		now := time.Now()
+		var retired []string
+		err = tx.Model(&models.SigningKey{}).
+			Where("expires_at IS NULL AND (algorithm = ? OR created_at <= ?)", key.Algorithm, due).
+			Pluck("id", &retired).Error
+		if err != nil {
+			return err
+		}
+		if len(retired) > 0 {
+			if err := tx.Model(&models.SigningKey{}).Where("id IN ?", retired).Update("expires_at", now.Add(retireAfter)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("expires_at <= ?", now).Delete(&models.SigningKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&key).Error; err != nil {
+			return err
+		}
+		rotated = true
+		return h.appendAudit(tx, audit.ActionKeyRotate, audit.TargetKey, key.ID, nil, map[string]interface{}{
+			"algorithm": key.Algorithm,
+			"retired":   retired,
+		})
+	})
+	if err != nil {
+		return false, dbHandleError(err)
+	}
+	return rotated, nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/database/models"
+	"strings"
+	"testing"
+)
+
+func TestSetUserBalance(t *testing.T) {
+	db := dbtest.New(t)
+	var history []driver.Value
+	db.Handle(`SELECT * FROM "users"`, func(s *dbtest.Statement) (dbtest.Result, error) {
+		if !s.InTx() || !strings.Contains(s.Query, "FOR UPDATE") {
+			t.Errorf("balance read without locking the user: %s", s.Query)
+		}
+		return dbtest.Result{Columns: []string{"id", "username", "balance"}, Rows: [][]driver.Value{{int64(7), "jane", 30.25}}}, nil
+	})
+	db.Answer(`UPDATE "users" SET "balance"`, dbtest.Result{Affected: 1})
+	db.Handle(`INSERT INTO "balance_histories"`, func(s *dbtest.Statement) (dbtest.Result, error) {
+		for _, arg := range s.Args {
+			if amount, ok := arg.Value.(float64); ok {
+				history = append(history, amount)
+			}
+		}
+		return dbtest.Result{Rows: [][]driver.Value{{int64(1)}}}, nil
+	})
+
+	user, previous, err := DBHandler{db.Gorm(t)}.SetUserBalance(7, 100, "Balance set by operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != 30.25 || user.Balance != 100 {
+		t.Errorf("balance changed from %.2f to %.2f, want 30.25 to 100", previous, user.Balance)
+	}
+	if len(history) != 1 || history[0] != 69.75 {
+		t.Errorf("history amounts %v, want the difference 69.75", history)
+	}
+	want := []string{`UPDATE "users" SET "balance"`, `INSERT INTO "balance_histories"`, audit.ActionBalanceAdjust}
+	checkCommitted(t, db, want)
+}
+
+func TestCreateAdmin(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      string
+		committed []string
+	}{
+		{name: "created", committed: []string{`INSERT INTO "users"`, `INSERT INTO "balance_histories"`, audit.ActionUserRole}},
+		{name: "no admin without audit entry", fail: `INSERT INTO "audit_logs"`},
+		{name: "no admin without balance history", fail: `INSERT INTO "balance_histories"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			db.Answer(`INSERT INTO "users"`, dbtest.Result{Rows: [][]driver.Value{{int64(7)}}})
+			db.Answer(`INSERT INTO "balance_histories"`, dbtest.Result{Rows: [][]driver.Value{{int64(1)}}})
+			if tt.fail != "" {
+				db.Fail(tt.fail, errors.New("connection reset"))
+			}
+
+			user, err := DBHandler{db.Gorm(t)}.CreateAdmin(models.User{Username: "root", Email: "root@example.com"})
+			if tt.fail == "" && (err != nil || user.ID != 7) {
+				t.Fatalf("CreateAdmin = %v, %v, want user 7", user, err)
+			}
+			if tt.fail != "" && !errors.Is(err, apperr.ErrDatabase) {
+				t.Fatalf("error = %v, want %v", err, apperr.ErrDatabase)
+			}
+			checkCommitted(t, db, tt.committed)
+		})
+	}
+}
+
+// checkCommitted compares the committed statements by their start
+func checkCommitted(t *testing.T, db *dbtest.DB, want []string) {
+	t.Helper()
+	committed := db.Committed()
+	if len(committed) != len(want) {
+		t.Fatalf("committed %d statements, want %d:\n%s", len(committed), len(want), strings.Join(committed, "\n"))
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(committed[i], prefix) {
+			t.Errorf("statement %d = %q, want %q", i+1, committed[i], prefix)
+		}
+	}
+}
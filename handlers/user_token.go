@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetUserByEmail looks a user up by email address, ignoring case
+func (h DBHandler) GetUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	res := h.DB.Where("lower(email) = ?", strings.ToLower(email)).First(&user)
+	if res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &user, nil
+}
+
+// CreateUserToken stores the hash of a new email link. The unused links of
+// the same purpose sent before stop working.
+func (h DBHandler) CreateUserToken(token models.UserToken) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Delete(&models.UserToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&token).Error
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// VerifyEmail marks the address a verification link was sent to as
+// verified, as long as it is still the address of the user
+func (h DBHandler) VerifyEmail(tokenHash string) (*models.User, error) {
+	var user models.User
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, models.TokenVerifyEmail, tokenHash)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return err
+		}
+		if !strings.EqualFold(user.Email, token.Email) {
+			return apperr.ErrLinkInvalid
+		}
+		if user.EmailVerifiedAt != nil {
+			return apperr.ErrEmailVerified
+		}
+
+		now := time.Now()
+		if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+		user.EmailVerifiedAt = &now
+		return h.appendAudit(tx, audit.ActionEmailVerify, audit.TargetUser, user.ID, nil, map[string]interface{}{
+			"email": user.Email,
+		})
+	})
+	if err != nil {
+		return nil, dbHandleError(err)
+	}
+	return &user, nil
+}
+
+// ResetPassword sets the password of the user a reset link was sent to,
+// ends all of their sessions, whose ids are returned, and deletes their API
+// keys. Whoever knew the old password may have created either.
+func (h DBHandler) ResetPassword(tokenHash string, hashedPassword string) ([]string, error) {
+	var ids []string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, models.TokenResetPassword, tokenHash)
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&models.User{}).Where("id = ?", token.UserID).Update("password", hashedPassword)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return apperr.ErrLinkInvalid
+		}
+
+		if err := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", token.UserID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := h.revokeSessions(tx, token.UserID, ids, RevokedReset); err != nil {
+				return err
+			}
+		}
+
+		var keys []models.APIKey
+		if err := tx.Clauses(clause.Returning{}).Where("user_id = ?", token.UserID).Delete(&keys).Error; err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err := h.appendAudit(tx, audit.ActionAPIKeyDelete, audit.TargetAPIKey, key.ID, map[string]interface{}{
+				"user_id": key.UserID,
+				"name":    key.Name,
+				"scopes":  key.Scopes,
+			}, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return h.appendAudit(tx, audit.ActionPasswordReset, audit.TargetUser, token.UserID, nil, nil)
+	})
+	if err != nil {
+		return nil, dbHandleError(err)
+	}
+	return ids, nil
+}
+
+// consumeUserToken marks a link as used, so two requests with the same link
+// cannot both succeed
+func consumeUserToken(tx *gorm.DB, purpose string, tokenHash string) (*models.UserToken, error) {
+	var tokens []models.UserToken
+	res := tx.Model(&tokens).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", tokenHash, purpose, time.Now()).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(tokens) == 0 {
+		return nil, apperr.ErrLinkInvalid.Wrap(errors.New("unknown, used or expired link"))
+	}
+	return &tokens[0], nil
+}
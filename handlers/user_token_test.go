@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/dbtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResetPassword(t *testing.T) {
+	token := []driver.Value{int64(1), int64(7), "reset_password", time.Now().Add(time.Hour)}
+	tests := []struct {
+		name      string
+		answers   map[string]dbtest.Result
+		fail      map[string]error
+		err       *apperr.Error
+		committed []string
+		revoked   []string
+	}{
+		{
+			name: "signs out and deletes the API keys",
+			answers: map[string]dbtest.Result{
+				`UPDATE "user_tokens"`:        {Columns: []string{"id", "user_id", "purpose", "expires_at"}, Rows: [][]driver.Value{token}},
+				`UPDATE "users"`:              {Affected: 1},
+				`SELECT "id" FROM "sessions"`: {Columns: []string{"id"}, Rows: [][]driver.Value{{"s1"}, {"s2"}}},
+				`DELETE FROM "api_keys"`: {Columns: []string{"id", "user_id", "name", "scopes"}, Rows: [][]driver.Value{
+					{int64(3), int64(7), "bot", "{bets:read}"},
+					{int64(4), int64(7), "admin bot", "{admin}"},
+				}},
+			},
+			committed: []string{
+				`UPDATE "users" SET "password"`,
+				`UPDATE "sessions" SET "revoked_at"`,
+				audit.ActionTokenRevoke,
+				`DELETE FROM "api_keys" WHERE user_id`,
+				audit.ActionAPIKeyDelete,
+				audit.ActionAPIKeyDelete,
+				audit.ActionPasswordReset,
+			},
+			revoked: []string{"s1", "s2"},
+		},
+		{
+			name: "without sessions or keys",
+			answers: map[string]dbtest.Result{
+				`UPDATE "user_tokens"`: {Columns: []string{"id", "user_id", "purpose", "expires_at"}, Rows: [][]driver.Value{token}},
+				`UPDATE "users"`:       {Affected: 1},
+			},
+			committed: []string{
+				`UPDATE "users" SET "password"`,
+				`DELETE FROM "api_keys" WHERE user_id`,
+				audit.ActionPasswordReset,
+			},
+		},
+		{
+			name: "the old password is kept when the keys cannot be deleted",
+			answers: map[string]dbtest.Result{
+				`UPDATE "user_tokens"`: {Columns: []string{"id", "user_id", "purpose", "expires_at"}, Rows: [][]driver.Value{token}},
+				`UPDATE "users"`:       {Affected: 1},
+			},
+			fail: map[string]error{`DELETE FROM "api_keys"`: errors.New("connection reset")},
+			err:  apperr.ErrDatabase,
+		},
+		{
+			name: "unknown link",
+			err:  apperr.ErrLinkInvalid,
+		},
+		{
+			name: "deleted user",
+			answers: map[string]dbtest.Result{
+				`UPDATE "user_tokens"`: {Columns: []string{"id", "user_id", "purpose", "expires_at"}, Rows: [][]driver.Value{token}},
+			},
+			err: apperr.ErrLinkInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			// Unanswered statements find and change nothing
+			db.Answer("", dbtest.Result{})
+			for prefix, result := range tt.answers {
+				db.Answer(prefix, result)
+			}
+			for prefix, err := range tt.fail {
+				db.Fail(prefix, err)
+			}
+			h := DBHandler{db.Gorm(t)}
+
+			revoked, err := h.ResetPassword("hash", "$argon2id$new")
+			if tt.err == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if strings.Join(revoked, ",") != strings.Join(tt.revoked, ",") {
+				t.Errorf("revoked sessions %v, want %v", revoked, tt.revoked)
+			}
+
+			committed := []string{}
+			for _, statement := range db.Committed() {
+				if !strings.HasPrefix(statement, `UPDATE "user_tokens"`) {
+					committed = append(committed, statement)
+				}
+			}
+			if len(committed) != len(tt.committed) {
+				t.Fatalf("committed %d statements, want %d:\n%s", len(committed), len(tt.committed), strings.Join(committed, "\n"))
+			}
+			for i, want := range tt.committed {
+				if !strings.HasPrefix(committed[i], want) {
+					t.Errorf("statement %d = %q, want %q", i+1, committed[i], want)
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
-	"fmt"
+	"gambler/backend/apperr"
+	"log/slog"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
 )
 
 type (
@@ -26,7 +28,7 @@ var (
 func NewValidator() ValidatorHandler {
 	v := validator.New()
 	VHandler = ValidatorHandler{validator: v}
-	fmt.Println("[HANDLER] Validator Handler Initialized")
+	slog.Debug("validator initialized")
 	return VHandler
 }
 
@@ -51,3 +53,27 @@ func (h ValidatorHandler) Validate(data interface{}) []ErrorResponse {
 
 	return validationsError
 }
+
+// Check validates data and returns the failed fields as a validation error
+func (h ValidatorHandler) Check(data interface{}) error {
+	if errs := h.Validate(data); len(errs) > 0 && errs[0].Error {
+		return apperr.ErrValidation.WithDetails(errs)
+	}
+	return nil
+}
+
+// ParseBody decodes the request body into out and validates it
+func ParseBody(c *fiber.Ctx, out interface{}) error {
+	if err := c.BodyParser(out); err != nil {
+		return apperr.ErrBadRequest.Wrap(err)
+	}
+	return VHandler.Check(out)
+}
+
+// ParseQuery decodes the query string into out and validates it
+func ParseQuery(c *fiber.Ctx, out interface{}) error {
+	if err := c.QueryParser(out); err != nil {
+		return apperr.ErrBadRequest.Wrap(err)
+	}
+	return VHandler.Check(out)
+}
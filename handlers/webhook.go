@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"gambler/backend/database/models/customTypes"
+	"gambler/backend/webhook"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	WebhookDeliveryQuery struct {
+		WebhookID uint
+		Status    string
+		Limit     int
+		Offset    int
+	}
+
+	WebhookDeliveryPage struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+		Total      int64                    `json:"total"`
+	}
+
+	// ClaimedDelivery is a due delivery together with the endpoint it goes to
+	ClaimedDelivery struct {
+		models.WebhookDelivery
+		URL    string
+		Secret string
+	}
+)
+
+// CreateWebhook stores a new subscription unless the owner already has
+// limit of them, zero disables the limit
+func (h DBHandler) CreateWebhook(hook *models.Webhook, limit int) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Serializes concurrent creations of the same owner
+		var owner models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&owner, hook.OwnerID).Error; err != nil {
+			return err
+		}
+		if limit > 0 {
+			var count int64
+			if err := tx.Model(&models.Webhook{}).Where("owner_id = ?", hook.OwnerID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= int64(limit) {
+				return apperr.ErrWebhookLimit
+			}
+		}
+		if err := tx.Create(hook).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionWebhookCreate, audit.TargetWebhook, hook.ID, nil, map[string]interface{}{
+			"owner_id": hook.OwnerID,
+			"url":      hook.URL,
+			"events":   hook.Events,
+		})
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// ListWebhooks returns the webhooks of a user, or every webhook when ownerID
+// is nil
+func (h DBHandler) ListWebhooks(ownerID *uint) (*[]models.Webhook, error) {
+	hooks := []models.Webhook{}
+	query := h.DB.Order("id")
+	if ownerID != nil {
+		query = query.Where("owner_id = ?", *ownerID)
+	}
+	if res := query.Find(&hooks); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &hooks, nil
+}
+
+func (h DBHandler) GetWebhook(id uint) (*models.Webhook, error) {
+	var hook models.Webhook
+	if res := h.DB.First(&hook, id); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &hook, nil
+}
+
+// DeleteWebhook removes a subscription, its pending deliveries are marked
+// failed so the worker stops retrying them. The delivery log is kept.
+func (h DBHandler) DeleteWebhook(hook models.Webhook) error {
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WebhookDelivery{}).
+			Where("webhook_id = ? AND status = ?", hook.ID, webhook.StatusPending).
+			Updates(map[string]interface{}{"status": webhook.StatusFailed, "last_error": "webhook deleted"}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Webhook{}, hook.ID).Error; err != nil {
+			return err
+		}
+		return h.appendAudit(tx, audit.ActionWebhookDelete, audit.TargetWebhook, hook.ID, map[string]interface{}{
+			"owner_id": hook.OwnerID,
+			"url":      hook.URL,
+			"events":   hook.Events,
+		}, nil)
+	})
+	if err != nil {
+		return dbHandleError(err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the newest deliveries of a webhook
+func (h DBHandler) ListWebhookDeliveries(q WebhookDeliveryQuery) (*WebhookDeliveryPage, error) {
+	query := h.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", q.WebhookID)
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+
+	page := WebhookDeliveryPage{Deliveries: []models.WebhookDelivery{}}
+	if res := query.Count(&page.Total); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	if res := query.Order("id DESC").Limit(q.Limit).Offset(q.Offset).Find(&page.Deliveries); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &page, nil
+}
+
+// RedeliverWebhook queues the payload of a finished delivery again as a new
+// delivery, it keeps the event id so receivers can recognize the duplicate
+func (h DBHandler) RedeliverWebhook(webhookID uint, deliveryID uint) (*models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if res := h.DB.Where("webhook_id = ?", webhookID).First(&original, deliveryID); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	if original.Status == webhook.StatusPending {
+		return nil, apperr.ErrWebhookPending
+	}
+
+	delivery := models.WebhookDelivery{
+		CreatedAt:     time.Now(),
+		WebhookID:     original.WebhookID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        webhook.StatusPending,
+		NextAttemptAt: time.Now(),
+		RedeliveryOf:  &original.ID,
+	}
+	if res := h.DB.Create(&delivery); res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &delivery, nil
+}
+
+// enqueueWebhooks adds a delivery of the event for every webhook subscribed
+// to it within tx, so the event is only sent when the change is committed.
+// Webhooks of users who are not admins get the data scoped to their owner.
+func (h DBHandler) enqueueWebhooks(tx *gorm.DB, event string, data interface{}) error {
+	var hooks []struct {
+		ID      uint
+		OwnerID uint
+		Role    customTypes.UserRole
+	}
+	err := tx.Model(&models.Webhook{}).
+		Select("webhooks.id, webhooks.owner_id, users.role").
+		Joins("JOIN users ON users.id = webhooks.owner_id AND users.deleted_at IS NULL").
+		Where("? = ANY(webhooks.events)", event).
+		Scan(&hooks).Error
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	payload := webhook.NewPayload(event)
+	full, err := payload.Encode(data)
+	if err != nil {
+		return err
+	}
+	scoped, _ := data.(webhook.Scoped)
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, 0, len(hooks))
+	for _, hook := range hooks {
+		body := full
+		if scoped != nil && hook.Role != customTypes.RoleAdmin {
+			own, ok := scoped.ForUser(hook.OwnerID)
+			if !ok {
+				continue
+			}
+			if body, err = payload.Encode(own); err != nil {
+				return err
+			}
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			CreatedAt:     now,
+			WebhookID:     hook.ID,
+			EventID:       payload.ID,
+			Event:         event,
+			Payload:       body,
+			Status:        webhook.StatusPending,
+			NextAttemptAt: now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := tx.Create(&deliveries).Error; err != nil {
+		dbLog.ErrorContext(h.ctx(), "failed to queue webhook deliveries", "event", event, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries picks up to limit due deliveries and moves their
+// next attempt lease into the future, so other replicas skip them while they
+// are sent. A delivery whose worker dies is retried once the lease expires.
+func (h DBHandler) ClaimWebhookDeliveries(limit int, lease time.Duration) (*[]ClaimedDelivery, error) {
+	claimed := []ClaimedDelivery{}
+	res := h.DB.Raw(`
+		WITH due AS (
+			SELECT d.id FROM webhook_deliveries d
+			WHERE d.status = ? AND d.next_attempt_at <= now()
+			ORDER BY d.next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + make_interval(secs => ?)
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.*, w.url, w.secret`,
+		webhook.StatusPending, limit, lease.Seconds(),
+	).Scan(&claimed)
+	if res.Error != nil {
+		return nil, dbHandleError(res.Error)
+	}
+	return &claimed, nil
+}
+
+// SaveWebhookAttempt stores the outcome of an attempt
+func (h DBHandler) SaveWebhookAttempt(delivery models.WebhookDelivery) error {
+	res := h.DB.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_attempt_at": delivery.LastAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"last_error":      delivery.LastError,
+		"delivered_at":    delivery.DeliveredAt,
+	})
+	if res.Error != nil {
+		return dbHandleError(res.Error)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/webhook"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// TestEnqueueWebhooksScopes sends the events about single users only to
+// the webhooks of admins and of the user
+func TestEnqueueWebhooksScopes(t *testing.T) {
+	author := uint(9)
+	tests := []struct {
+		name  string
+		event string
+		data  interface{}
+		// want maps the webhook ids delivered to the user ids in the data
+		want map[int64]string
+	}{
+		{"placement", webhook.EventBetPlaced, webhook.PlacementData{BetID: 1, UserID: 7, Option: "yes", Amount: 5},
+			map[int64]string{1: "7", 3: "7"}},
+		{"payouts", webhook.EventBetSettled, webhook.BetData{ID: 1, Author: &author, Payouts: map[uint]float64{7: 10, 8: 20}},
+			map[int64]string{1: "7", 2: "8", 3: "7,8"}},
+		{"bet without payouts", webhook.EventBetCreated, webhook.BetData{ID: 1, Author: &author},
+			map[int64]string{1: "", 2: "", 3: ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			db.Answer("SELECT webhooks.id, webhooks.owner_id, users.role", dbtest.Result{
+				Columns: []string{"id", "owner_id", "role"},
+				Rows: [][]driver.Value{
+					{int64(1), int64(7), "user"},
+					{int64(2), int64(8), "user"},
+					{int64(3), int64(1), "admin"},
+				},
+			})
+			got := map[int64]string{}
+			db.Handle(`INSERT INTO "webhook_deliveries"`, func(s *dbtest.Statement) (dbtest.Result, error) {
+				columns := strings.Split(s.Query[strings.Index(s.Query, "(")+1:strings.Index(s.Query, ")")], ",")
+				result := dbtest.Result{}
+				for row := 0; row < len(s.Args)/len(columns); row++ {
+					values := map[string]driver.Value{}
+					for i, column := range columns {
+						values[strings.Trim(column, `" `)] = s.Arg(row*len(columns) + i + 1)
+					}
+					var payload struct {
+						Data struct {
+							UserID  *uint            `json:"user_id"`
+							Payouts map[uint]float64 `json:"payouts"`
+						} `json:"data"`
+					}
+					if err := json.Unmarshal(payloadBytes(values["payload"]), &payload); err != nil {
+						t.Fatal(err)
+					}
+					users := []string{}
+					if payload.Data.UserID != nil {
+						users = append(users, strconv.FormatUint(uint64(*payload.Data.UserID), 10))
+					}
+					for _, id := range []uint{7, 8} {
+						if _, ok := payload.Data.Payouts[id]; ok {
+							users = append(users, strconv.FormatUint(uint64(id), 10))
+						}
+					}
+					got[values["webhook_id"].(int64)] = strings.Join(users, ",")
+					result.Rows = append(result.Rows, []driver.Value{int64(row + 1)})
+				}
+				return result, nil
+			})
+
+			err := db.Gorm(t).Transaction(func(tx *gorm.DB) error {
+				return DBHandler{tx}.enqueueWebhooks(tx, tt.event, tt.data)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("delivered to %v, want %v", got, tt.want)
+			}
+			for id, users := range tt.want {
+				if got[id] != users {
+					t.Errorf("webhook %d got the data of users %q, want %q", id, got[id], users)
+				}
+			}
+		})
+	}
+}
+
+func payloadBytes(v driver.Value) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
@@ -1,79 +1,84 @@
 package websocket
 
 import (
+	"context"
 	"fmt"
+	"gambler/backend/apperr"
 	"gambler/backend/calculator"
 	"gambler/backend/handlers"
+	"gambler/backend/metrics"
 	"gambler/backend/tools"
+	"gambler/backend/tracing"
 	"math"
 
-	"github.com/gofiber/fiber/v2/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func HandleMessageEvent(wsh *WebSocketHandler, uuid string, event int, data []byte) {
+func HandleMessageEvent(ctx context.Context, wsh *WebSocketHandler, uuid string, event int, data []byte) {
 	var res []byte
-	var err int
+	var err error
 	var resp = false
-	log.Info("Handling message event:", event, uuid)
+	ctx, span := tracing.Start(ctx, "websocket."+tools.GetEventName(event),
+		attribute.String("websocket.user_id", uuid),
+	)
+	defer span.End()
+
+	wsLog.DebugContext(ctx, "handling message event", "user_id", uuid, "event", tools.GetEventName(event))
+	metrics.WebSocketMessages.WithLabelValues("inbound", tools.GetEventName(event)).Inc()
 	switch event {
 	case tools.BET_INFO:
 		// Handle bet info event
-		res, err = betInfoEventHandler(data, uuid)
+		res, err = betInfoEventHandler(ctx, wsh, data, uuid)
 		resp = true
 	case tools.PING:
 		// Handle ping event
-		res = []byte{tools.PONG, tools.WEBSOCKET_VERSION}
-		err = -1
+		res = []byte{tools.PONG, wsh.Version}
 		resp = true
 	default:
-		res, err = nil, tools.WS_COMMAND_NOTFOUND
+		res, err = nil, apperr.ErrWSUnknownEvent
 		resp = true
 	}
 
-	if err != -1 {
-		wsh.SendErrorMessage(uuid, err, tools.GetErrorString(err))
+	if err != nil {
+		tracing.Fail(span, string(apperr.CodeOf(err)))
+		wsh.SendErrorMessage(ctx, uuid, err)
+		return
 	}
 
-	var wsErr int
 	if resp {
-		wsErr = wsh.SendMessageToUser(uuid, res)
-	}
-	log.Info(fmt.Sprintf("%v", res))
-	if wsErr != -1 {
-		wsh.SendErrorMessage(uuid, wsErr, tools.GetErrorString(wsErr))
+		if wsErr := wsh.SendMessageToUser(uuid, res); wsErr != nil {
+			wsh.SendErrorMessage(ctx, uuid, wsErr)
+		}
 	}
 }
 
-func betInfoEventHandler(data []byte, uuid string) ([]byte, int) {
+func betInfoEventHandler(ctx context.Context, wsh *WebSocketHandler, data []byte, uuid string) ([]byte, error) {
 	betID := data[0]
 	input := int(data[1])
 	amount := combineToFloat64(int(data[2]), int(data[3]))
 
-	log.Info(betID, input)
-	user, err := handlers.DB.GetUserByID(tools.ParseUInt(uuid))
-	if err != -1 {
+	user, err := handlers.DB.WithContext(ctx).GetUserByID(tools.ParseUInt(uuid))
+	if err != nil {
 		return []byte{}, err
 	}
 
 	// Calculate winning amount
-	winAmount, err := calculator.CalculateWinningAmount(uint(betID), user.ID, input, amount)
-	if err != -1 {
-		log.Info(err, tools.GetErrorString(err))
+	winAmount, err := calculator.CalculateWinningAmount(ctx, uint(betID), user.ID, input, amount)
+	if err != nil {
 		return []byte{}, err
 	}
 
 	intPart, fracPart := math.Modf(winAmount)
 
-	log.Info(betID, intPart, fracPart)
 	betIDChunks := tools.ChunkBigNumber(int(betID))
 	intPartChunks := tools.ChunkBigNumber(int(intPart))
 	fracPartChunks := tools.ChunkBigNumber(int(fracPart * 100))
 
-	result := []byte{tools.BET_INFO_RES, tools.WEBSOCKET_VERSION, byte(len(betIDChunks)), byte(len(intPartChunks)), byte(len(fracPartChunks))}
+	result := []byte{tools.BET_INFO_RES, wsh.Version, byte(len(betIDChunks)), byte(len(intPartChunks)), byte(len(fracPartChunks))}
 	result = append(result, betIDChunks...)
 	result = append(result, intPartChunks...)
 	result = append(result, fracPartChunks...)
-	return result, -1
+	return result, nil
 }
 
 func combineToFloat64(before, after int) float64 {
@@ -1,61 +1,77 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
 	"gambler/backend/handlers"
+	"gambler/backend/logging"
+	"gambler/backend/metrics"
 	"gambler/backend/tools"
+	"gambler/backend/tracing"
 	"runtime"
+	"sync"
+	"time"
 
 	"github.com/gofiber/contrib/websocket"
-	"github.com/gofiber/fiber/v2/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type WebSocketHandler struct {
 	Cache             *handlers.CacheHandler
 	ActiveConnections map[string]*websocket.Conn
+	Version           byte
+	mu                sync.RWMutex
+	closing           bool
+	sessions          sync.WaitGroup
 }
 
 var (
 	WebSocket WebSocketHandler
+
+	wsLog = logging.For("websocket")
 )
 
 // NewWebSocketHandler initializes a new WebSocketHandler
-func NewWebSocketHandler(cache *handlers.CacheHandler) *WebSocketHandler {
+func NewWebSocketHandler(cache *handlers.CacheHandler, cfg config.WebSocketConfig) *WebSocketHandler {
 	WebSocket = WebSocketHandler{
 		Cache:             cache,
 		ActiveConnections: make(map[string]*websocket.Conn),
+		Version:           byte(cfg.Version),
 	}
 	return &WebSocket
 }
 
-// ErrorMessage defines the format for error messages sent to clients
+// ErrorMessage defines the format for error messages sent to clients, Code
+// is the same stable code HTTP error responses carry
 type ErrorMessage struct {
-	Type    string `json:"type"`
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Type    string      `json:"type"`
+	Code    apperr.Code `json:"code"`
+	Message string      `json:"message"`
 }
 
-// sendErrorMessage sends an error message to the WebSocket client
-func (wsh *WebSocketHandler) SendErrorMessage(uuid string, code int, errMessage string) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Info(fmt.Sprintf("Called from %s, line %d", file, line))
+// SendErrorMessage sends err to the WebSocket client in a WS_ERR frame
+func (wsh *WebSocketHandler) SendErrorMessage(ctx context.Context, uuid string, err error) {
+	e := apperr.From(err)
+	if _, file, line, ok := runtime.Caller(1); ok {
+		wsLog.DebugContext(ctx, "sending error message", "user_id", uuid, "code", e.Code, "error", err, "caller", fmt.Sprintf("%s:%d", file, line))
+	}
+	if e.Status >= 500 {
+		wsLog.ErrorContext(ctx, "websocket event failed", "user_id", uuid, "code", e.Code, "error", err)
 	}
-	log.Info("Called from", file, line)
-	log.Info("Sending error message to user:", uuid, code, errMessage)
 	errorMsg := ErrorMessage{
 		Type:    "error",
-		Code:    code,
-		Message: errMessage,
+		Code:    e.Code,
+		Message: e.Message,
 	}
 	msg, _ := json.Marshal(errorMsg)
 	msgAsByte := []byte(msg)
-	headers := []byte{tools.WS_ERR, tools.WEBSOCKET_VERSION}
+	headers := []byte{tools.WS_ERR, wsh.Version}
 	headers = append(headers, msgAsByte...)
-	err := wsh.SendMessageToUser(uuid, headers)
-	if err != -1 {
-		log.Error(tools.GetErrorString(err))
+	if sendErr := wsh.SendMessageToUser(uuid, headers); sendErr != nil {
+		wsLog.WarnContext(ctx, "failed to send error message", "user_id", uuid, "error", sendErr)
 	}
 }
 
@@ -63,77 +79,177 @@ func (wsh *WebSocketHandler) SendErrorMessage(uuid string, code int, errMessage
 func (wsh *WebSocketHandler) HandleWebSocketConnection(c *websocket.Conn) {
 	// Get unique connection ID (UUID) from WebSocket connection (or use other unique ID)
 	uuid := c.Params("id")
+	// Logs of the session carry the id of the upgrade request
+	requestID, _ := c.Locals(logging.RequestIDLocal).(string)
+	ctx := logging.WithRequestID(context.Background(), requestID)
 
 	// Store the connection in the activeConnections map for in-memory access
+	wsh.mu.Lock()
+	if wsh.closing {
+		wsh.mu.Unlock()
+		c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "server shutting down"), time.Now().Add(time.Second))
+		c.Close()
+		return
+	}
 	wsh.ActiveConnections[uuid] = c
+	wsh.sessions.Add(1)
+	wsh.mu.Unlock()
+	metrics.WebSocketConnections.Inc()
 
 	// Ensure the connection is removed from Redis and the map when the user disconnects
 	defer func() {
-		delete(wsh.ActiveConnections, uuid)
+		wsh.mu.Lock()
+		if wsh.ActiveConnections[uuid] == c {
+			delete(wsh.ActiveConnections, uuid)
+		}
+		wsh.mu.Unlock()
 		c.Close()
+		metrics.WebSocketConnections.Dec()
+		wsh.sessions.Done()
 	}()
 
-	log.Info(fmt.Sprintf("User %s connected to WebSocket", uuid))
+	wsLog.InfoContext(ctx, "client connected", "user_id", uuid)
+	defer wsLog.InfoContext(ctx, "client disconnected", "user_id", uuid)
 
-	wsh.SendMessageToUser(uuid, []byte{0, tools.WEBSOCKET_VERSION, 0})
+	wsh.SendMessageToUser(uuid, []byte{0, wsh.Version, 0})
 
 	// Main loop to handle incoming WebSocket messages
 	// go func() {
 	for {
-		msgType, msg, err := c.ReadMessage()
+		_, msg, err := c.ReadMessage()
 		if err != nil {
-			log.Info("Message type ", msgType, msg)
-			log.Info(err.Error())
-			wsh.SendErrorMessage(uuid, tools.WS_INVALID_CONN, "Error reading WebSocket message")
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				wsLog.WarnContext(ctx, "failed to read message", "user_id", uuid, "error", err)
+				wsh.SendErrorMessage(ctx, uuid, apperr.ErrWSInvalidConn.Wrap(err))
+			}
 			break
 		}
-		log.Info(fmt.Sprintf("Received message from user %s: %v", uuid, msg))
-		HandleMessageEvent(wsh, uuid, int(msg[0]), msg[2:])
+		wsLog.DebugContext(ctx, "received message", "user_id", uuid, "size", len(msg))
+		HandleMessageEvent(ctx, wsh, uuid, int(msg[0]), msg[2:])
 	}
 	// }()
 }
 
 // SendMessageToUser sends a message to a specific user based on their UUID
-func (wsh *WebSocketHandler) SendMessageToUser(uuid string, message []byte) int {
+func (wsh *WebSocketHandler) SendMessageToUser(uuid string, message []byte) error {
 	// Get the WebSocket connection from the activeConnections map
+	wsh.mu.RLock()
 	conn, exists := wsh.ActiveConnections[uuid]
+	wsh.mu.RUnlock()
 	if !exists {
-		return tools.WS_UUID_NOTFOUND
+		return apperr.ErrWSNotConnected
 	}
 
 	// Send the message over the WebSocket connection
 	if err := conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
-		return tools.WS_UNKNOWN_ERR
+		return apperr.ErrWSSend.Wrap(err)
 	}
-	return -1
+	observeOutbound(message)
+	return nil
 }
 
-func (wsh *WebSocketHandler) SendMessageToAll(message []byte) int {
-	for _, conn := range wsh.ActiveConnections {
+func (wsh *WebSocketHandler) SendMessageToAll(ctx context.Context, message []byte) error {
+	conns := wsh.connections()
+	ctx, span := tracing.Start(ctx, "websocket.SendMessageToAll",
+		attribute.String("websocket.event", eventName(message)),
+		attribute.Int("websocket.connections", len(conns)),
+	)
+	defer span.End()
+
+	failed := 0
+	for _, conn := range conns {
 		if err := conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
-			log.Info(err)
+			wsLog.DebugContext(ctx, "failed to broadcast message", "user_id", conn.Params("id"), "error", err)
+			failed++
 			continue
 		}
-		log.Info(fmt.Sprintf("Sent message to user %v", conn.Params("id")))
+		observeOutbound(message)
+	}
+	span.SetAttributes(attribute.Int("websocket.failed", failed))
+	return nil
+}
+
+func observeOutbound(message []byte) {
+	if len(message) == 0 {
+		return
+	}
+	metrics.WebSocketMessages.WithLabelValues("outbound", eventName(message)).Inc()
+}
+
+func eventName(message []byte) string {
+	if len(message) == 0 {
+		return ""
+	}
+	return tools.GetEventName(int(message[0]))
+}
+
+// connections returns a snapshot of the active connections so writes do not
+// happen while holding the lock
+func (wsh *WebSocketHandler) connections() []*websocket.Conn {
+	wsh.mu.RLock()
+	defer wsh.mu.RUnlock()
+	conns := make([]*websocket.Conn, 0, len(wsh.ActiveConnections))
+	for _, conn := range wsh.ActiveConnections {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// CloseAll refuses new sessions, sends a close frame to every connected
+// client and waits for their handlers to return
+func (wsh *WebSocketHandler) CloseAll(ctx context.Context) error {
+	wsh.mu.Lock()
+	wsh.closing = true
+	wsh.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	// Give clients a moment to answer the close frame before ReadMessage
+	// in the session handlers is unblocked
+	readDeadline := time.Now().Add(2 * time.Second)
+	if deadline.Before(readDeadline) {
+		readDeadline = deadline
+	}
+
+	closeFrame := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, conn := range wsh.connections() {
+		if err := conn.WriteControl(websocket.CloseMessage, closeFrame, deadline); err != nil {
+			wsLog.Debug("failed to send close frame", "user_id", conn.Params("id"), "error", err)
+		}
+		conn.SetReadDeadline(readDeadline)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wsh.sessions.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return -1
 }
 
-func (wsh *WebSocketHandler) UpdateBet(betID uint) int {
-	result := []byte{tools.BET_UPDATE, tools.WEBSOCKET_VERSION}
+func (wsh *WebSocketHandler) UpdateBet(ctx context.Context, betID uint) error {
+	result := []byte{tools.BET_UPDATE, wsh.Version}
 	betIdChunks := tools.ChunkBigNumber(int(betID))
 	result = append(result, betIdChunks...)
-	err := wsh.SendMessageToAll(result)
-	if err != -1 {
+	err := wsh.SendMessageToAll(ctx, result)
+	if err != nil {
 		return err
 	}
-	return -1
+	return nil
 }
 
-func (wsh *WebSocketHandler) UpdateUser(uuid string) int {
-	err := wsh.SendMessageToUser(uuid, []byte{tools.USER_UPDATE, tools.WEBSOCKET_VERSION})
-	if err != -1 {
+func (wsh *WebSocketHandler) UpdateUser(uuid string) error {
+	err := wsh.SendMessageToUser(uuid, []byte{tools.USER_UPDATE, wsh.Version})
+	if err != nil {
 		return err
 	}
-	return -1
+	return nil
 }
@@ -0,0 +1,206 @@
+package health
+
+import (
+	"context"
+	"gambler/backend/logging"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	// Check reports whether a dependency of the service works. Checks run
+	// on every probe with a timeout, in parallel.
+	Check struct {
+		Name string
+		Run  func(ctx context.Context) error
+		// Liveness marks checks whose failure is only fixed by restarting
+		// the process, e.g. a background goroutine that died. Unavailable
+		// dependencies only make the service unready.
+		Liveness bool
+		// CacheFor reuses a successful result for the given period, for
+		// checks too expensive to run on every probe
+		CacheFor time.Duration
+	}
+
+	// Result is public, the reason of a failure is only logged
+	Result struct {
+		Status    string  `json:"status"`
+		LatencyMS float64 `json:"latency_ms"`
+	}
+
+	Report struct {
+		Status string            `json:"status"`
+		Checks map[string]Result `json:"checks"`
+	}
+
+	Registry struct {
+		Timeout time.Duration
+
+		mu       sync.RWMutex
+		checks   []Check
+		passed   map[string]time.Time
+		draining <-chan struct{}
+	}
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "shutting down"
+)
+
+var (
+	// Checks holds the checks registered by the components of the server
+	Checks = NewRegistry(2 * time.Second)
+
+	healthLog = logging.For("health")
+)
+
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{
+		Timeout: timeout,
+		passed:  map[string]time.Time{},
+	}
+}
+
+// Register adds a check, a check with the same name is replaced
+func (r *Registry) Register(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, c := range r.checks {
+		if c.Name == check.Name {
+			r.checks[i] = check
+			delete(r.passed, check.Name)
+			return
+		}
+	}
+	r.checks = append(r.checks, check)
+}
+
+// DrainOn makes readiness fail once the channel is closed, so load
+// balancers stop routing requests while the server shuts down
+func (r *Registry) DrainOn(stopping <-chan struct{}) {
+	r.mu.Lock()
+	r.draining = stopping
+	r.mu.Unlock()
+}
+
+// Draining reports whether the shutdown has begun
+func (r *Registry) Draining() bool {
+	r.mu.RLock()
+	draining := r.draining
+	r.mu.RUnlock()
+	if draining == nil {
+		return false
+	}
+	select {
+	case <-draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Liveness runs the liveness checks only
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.run(ctx, func(c Check) bool { return c.Liveness })
+}
+
+// Readiness runs every check and fails while the server shuts down
+func (r *Registry) Readiness(ctx context.Context) Report {
+	report := r.run(ctx, func(Check) bool { return true })
+	if r.Draining() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, include func(Check) bool) Report {
+	r.mu.RLock()
+	checks := []Check{}
+	for _, c := range r.checks {
+		if include(c) {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = r.runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, c := range checks {
+		report.Checks[c.Name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+func (r *Registry) runCheck(ctx context.Context, c Check) Result {
+	if c.CacheFor > 0 {
+		r.mu.RLock()
+		at, ok := r.passed[c.Name]
+		r.mu.RUnlock()
+		if ok && time.Since(at) < c.CacheFor {
+			return Result{Status: StatusOK}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Run(ctx)
+	result := Result{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		healthLog.WarnContext(ctx, "health check failed", "check", c.Name, "error", err)
+		return result
+	}
+
+	if c.CacheFor > 0 {
+		r.mu.Lock()
+		r.passed[c.Name] = time.Now()
+		r.mu.Unlock()
+	}
+	return result
+}
+
+// LivenessHandler serves the liveness report, 503 when a check fails
+func (r *Registry) LivenessHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return send(c, r.Liveness(c.UserContext()))
+	}
+}
+
+// ReadinessHandler serves the readiness report, 503 when a check fails or
+// the server is shutting down
+func (r *Registry) ReadinessHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return send(c, r.Readiness(c.UserContext()))
+	}
+}
+
+func send(c *fiber.Ctx, report Report) error {
+	status := fiber.StatusOK
+	if report.Status != StatusOK {
+		status = fiber.StatusServiceUnavailable
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(report)
+}
@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHandlers(t *testing.T) {
+	secret := "dial tcp 10.0.3.7:5432: password authentication failed for user gambler"
+	failing := func(context.Context) error { return errors.New(secret) }
+	passing := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name   string
+		path   string
+		checks []Check
+		drain  bool
+		status int
+		want   Report
+	}{
+		{
+			name:   "ready",
+			path:   "/readyz",
+			checks: []Check{{Name: "postgres", Run: passing}, {Name: "redis", Run: passing}},
+			status: fiber.StatusOK,
+			want:   Report{Status: StatusOK, Checks: map[string]Result{"postgres": {Status: StatusOK}, "redis": {Status: StatusOK}}},
+		},
+		{
+			name:   "dependency down",
+			path:   "/readyz",
+			checks: []Check{{Name: "postgres", Run: failing}, {Name: "redis", Run: passing}},
+			status: fiber.StatusServiceUnavailable,
+			want:   Report{Status: StatusFailing, Checks: map[string]Result{"postgres": {Status: StatusFailing}, "redis": {Status: StatusOK}}},
+		},
+		{
+			name:   "liveness ignores dependencies",
+			path:   "/livez",
+			checks: []Check{{Name: "postgres", Run: failing}, {Name: "subscriber", Run: passing, Liveness: true}},
+			status: fiber.StatusOK,
+			want:   Report{Status: StatusOK, Checks: map[string]Result{"subscriber": {Status: StatusOK}}},
+		},
+		{
+			name:   "draining",
+			path:   "/readyz",
+			checks: []Check{{Name: "postgres", Run: passing}},
+			drain:  true,
+			status: fiber.StatusServiceUnavailable,
+			want:   Report{Status: StatusDraining, Checks: map[string]Result{"postgres": {Status: StatusOK}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(time.Second)
+			for _, c := range tt.checks {
+				r.Register(c)
+			}
+			if tt.drain {
+				stopping := make(chan struct{})
+				close(stopping)
+				r.DrainOn(stopping)
+			}
+			app := fiber.New()
+			app.Get("/livez", r.LivenessHandler())
+			app.Get("/readyz", r.ReadinessHandler())
+
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if strings.Contains(string(body), "10.0.3.7") || strings.Contains(string(body), "password") {
+				t.Errorf("body leaks the failure: %s", body)
+			}
+
+			var got Report
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.want.Status || len(got.Checks) != len(tt.want.Checks) {
+				t.Fatalf("report = %+v, want %+v", got, tt.want)
+			}
+			for name, result := range tt.want.Checks {
+				if got.Checks[name].Status != result.Status {
+					t.Errorf("check %s = %s, want %s", name, got.Checks[name].Status, result.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheFor(t *testing.T) {
+	runs := 0
+	r := NewRegistry(time.Second)
+	r.Register(Check{Name: "migrations", CacheFor: time.Hour, Run: func(context.Context) error {
+		runs++
+		return nil
+	}})
+
+	for i := 0; i < 3; i++ {
+		if report := r.Readiness(context.Background()); report.Status != StatusOK {
+			t.Fatalf("status = %s, want ok", report.Status)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("check ran %d times, want 1", runs)
+	}
+}
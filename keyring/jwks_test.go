@@ -0,0 +1,101 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// publicKey rebuilds the key of a JWK the way a consumer of the JWKS would
+func publicKey(t *testing.T, jwk JWK) interface{} {
+	t.Helper()
+	decode := func(value string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			t.Fatalf("malformed parameter %q: %v", value, err)
+		}
+		return b
+	}
+	switch jwk.Kty {
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			t.Fatalf("curve %s, want Ed25519", jwk.Crv)
+		}
+		return ed25519.PublicKey(decode(jwk.X))
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	}
+	t.Fatalf("unexpected key type %s", jwk.Kty)
+	return nil
+}
+
+func TestJWKS(t *testing.T) {
+	r := newRing(t, EdDSA)
+	var keys []*Key
+	for i, algorithm := range []string{RS256, EdDSA, EdDSA} {
+		key, err := generate(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.CreatedAt = time.Now().Add(-time.Duration(i) * time.Hour)
+		r.keys[key.ID] = key
+		keys = append(keys, key)
+	}
+
+	body, err := json.Marshal(r.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set JWKS
+	if err := json.Unmarshal(body, &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != len(keys) {
+		t.Fatalf("%d keys published, want %d", len(set.Keys), len(keys))
+	}
+
+	for i, jwk := range set.Keys {
+		key := keys[i]
+		if jwk.Kid != key.ID || jwk.Alg != key.Algorithm || jwk.Use != "sig" {
+			t.Errorf("key %d = %s %s %s, want %s %s sig, newest first", i, jwk.Kid, jwk.Alg, jwk.Use, key.ID, key.Algorithm)
+			continue
+		}
+		token := jwt.NewWithClaims(key.Method(), jwt.MapClaims{"sub": "7"})
+		token.Header["kid"] = key.ID
+		signed, err := token.SignedString(key.Private())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return publicKey(t, jwk), nil },
+			jwt.WithValidMethods([]string{jwk.Alg}))
+		if err != nil {
+			t.Errorf("token of %s does not verify with the published key: %v", key.ID, err)
+		}
+	}
+
+	var raw map[string][]map[string]interface{}
+	json.Unmarshal(body, &raw)
+	for _, jwk := range raw["keys"] {
+		for _, private := range []string{"d", "p", "q", "dp", "dq", "qi"} {
+			if _, ok := jwk[private]; ok {
+				t.Errorf("key %v publishes the private parameter %s", jwk["kid"], private)
+			}
+		}
+	}
+}
+
+func TestJWKSEmpty(t *testing.T) {
+	body, err := json.Marshal(newRing(t, EdDSA).JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"keys":[]}` {
+		t.Errorf("JWKS = %s, want an empty key list", body)
+	}
+}
@@ -0,0 +1,328 @@
+// Package keyring holds the asymmetric keys the tokens are signed with.
+// Keys live in signing_keys with the private half sealed under JWT_SECRET,
+// so every replica signs with the same key and verifies the tokens of the
+// others. A new key takes over every JWT_KEY_ROTATION, the previous one
+// keeps verifying until the last refresh token it signed expired, and all
+// of them are published as a JWKS for other services.
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	"gambler/backend/logging"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithms of the signing keys
+const (
+	EdDSA = "EdDSA"
+	RS256 = "RS256"
+)
+
+var Algorithms = []string{EdDSA, RS256}
+
+const (
+	// RefreshInterval is how often replicas load the keys again to pick up
+	// the rotations of the others
+	RefreshInterval = time.Minute
+	// minReload bounds how often an unknown kid loads the keys, so tokens
+	// with made up kids cannot flood the database
+	minReload = 5 * time.Second
+	rsaBits   = 2048
+)
+
+// Ring is the keyring of the server, set up by the signing keys component
+var Ring *Keyring
+
+var keyLog = logging.For("keyring")
+
+type (
+	// Keyring signs with the newest key of the configured algorithm and
+	// verifies with any key that has not expired
+	Keyring struct {
+		cfg  config.AuthConfig
+		seal []byte
+
+		mu       sync.RWMutex
+		keys     map[string]*Key
+		current  *Key
+		loadedAt time.Time
+		// reloading is closed when the load started for an unknown kid
+		// is done, concurrent lookups wait for it instead of loading too
+		reloading chan struct{}
+	}
+
+	// Key is a signing key pair identified by the kid header of its tokens
+	Key struct {
+		ID        string
+		Algorithm string
+		CreatedAt time.Time
+		private   crypto.Signer
+	}
+)
+
+// New creates an empty keyring, Refresh loads the keys
+func New(cfg config.AuthConfig) (*Keyring, error) {
+	seal, err := sealingKey(cfg.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{cfg: cfg, seal: seal, keys: map[string]*Key{}}, nil
+}
+
+// Method is the JWT signing method of the key
+func (k *Key) Method() jwt.SigningMethod {
+	if k.Algorithm == RS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// Private returns the key tokens are signed with
+func (k *Key) Private() crypto.Signer {
+	return k.private
+}
+
+// Public returns the key tokens are verified with
+func (k *Key) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// Refresh loads the keys stored by every replica and creates a key when
+// the current one is due for rotation or the configured algorithm changed
+func (r *Keyring) Refresh(ctx context.Context) error {
+	unreadable, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	current := r.current
+	r.mu.RUnlock()
+
+	due := time.Now().Add(-r.cfg.JWTKeyRotation)
+	if current != nil && current.CreatedAt.After(due) {
+		return nil
+	}
+	if current == nil && unreadable {
+		// The key was sealed under another JWT_SECRET, it is replaced
+		// right away instead of when it is due
+		due = time.Now()
+	}
+	if err := r.rotate(ctx, due); err != nil {
+		return fmt.Errorf("failed to rotate the signing key: %w", err)
+	}
+	_, err = r.load(ctx)
+	return err
+}
+
+func (r *Keyring) rotate(ctx context.Context, due time.Time) error {
+	key, err := generate(r.cfg.JWTAlgorithm)
+	if err != nil {
+		return err
+	}
+	sealed, err := r.sealKey(key)
+	if err != nil {
+		return err
+	}
+	// Tokens are signed with a replaced key until the replicas load the
+	// keys again, so it verifies a little longer than a refresh token lives
+	retireAfter := r.cfg.RefreshTokenTTL + 2*RefreshInterval
+	rotated, err := handlers.DB.WithContext(ctx).RotateSigningKey(models.SigningKey{
+		ID:         key.ID,
+		CreatedAt:  key.CreatedAt,
+		Algorithm:  key.Algorithm,
+		PrivateKey: sealed,
+	}, due, retireAfter)
+	if err != nil {
+		return err
+	}
+	if rotated {
+		keyLog.InfoContext(ctx, "rotated the signing key", "kid", key.ID, "algorithm", key.Algorithm)
+	}
+	return nil
+}
+
+// load replaces the keys with the stored ones and picks the newest key of
+// the configured algorithm to sign with. A key that cannot be opened was
+// sealed under another JWT_SECRET, it is skipped and reported as
+// unreadable if it would have been the current key.
+func (r *Keyring) load(ctx context.Context) (bool, error) {
+	records, err := handlers.DB.WithContext(ctx).ListSigningKeys()
+	if err != nil {
+		return false, err
+	}
+
+	keys := make(map[string]*Key, len(records))
+	var current *Key
+	var unreadable bool
+	for _, record := range records {
+		candidate := record.ExpiresAt == nil && record.Algorithm == r.cfg.JWTAlgorithm
+		key, err := r.openKey(record)
+		if err != nil {
+			keyLog.WarnContext(ctx, "skipping signing key", "kid", record.ID, "error", err)
+			unreadable = unreadable || (candidate && current == nil)
+			continue
+		}
+		keys[key.ID] = key
+		if candidate && current == nil {
+			current = key
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = keys
+	r.loadedAt = time.Now()
+	// Until a key of the configured algorithm exists the previous one keeps
+	// signing, the caller rotates
+	if current != nil || (r.current != nil && keys[r.current.ID] == nil) {
+		r.current = current
+	}
+	return unreadable, nil
+}
+
+// Signing returns the key new tokens are signed with
+func (r *Keyring) Signing() (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.current == nil {
+		return nil, errors.New("no signing key loaded")
+	}
+	return r.current, nil
+}
+
+// Verifying returns the key a token names in its kid header. The key may
+// have been created by another replica since the last load, so an unknown
+// kid loads the keys again.
+func (r *Keyring) Verifying(kid string) (*Key, error) {
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	r.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if r.reload() {
+		r.mu.RLock()
+		key, ok = r.keys[kid]
+		r.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// reload loads the keys for an unknown kid unless they were loaded less than
+// minReload ago. Lookups arriving during the load wait for it, so only one
+// of them queries the database. It reports whether the keys were loaded.
+func (r *Keyring) reload() bool {
+	r.mu.Lock()
+	if wait := r.reloading; wait != nil {
+		r.mu.Unlock()
+		<-wait
+		return true
+	}
+	if time.Since(r.loadedAt) < minReload {
+		r.mu.Unlock()
+		return false
+	}
+	wait := make(chan struct{})
+	r.reloading = wait
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.load(ctx); err != nil {
+		keyLog.Warn("failed to load the signing keys", "error", err)
+		// A failed load waits as long as a successful one
+		r.mu.Lock()
+		r.loadedAt = time.Now()
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	r.reloading = nil
+	r.mu.Unlock()
+	close(wait)
+	return true
+}
+
+func generate(algorithm string) (*Key, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Key{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Algorithm: algorithm,
+		CreatedAt: time.Now(),
+		private:   private,
+	}, nil
+}
+
+func (r *Keyring) sealKey(key *Key) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return nil, err
+	}
+	return seal(r.seal, der, key.ID)
+}
+
+func (r *Keyring) openKey(record models.SigningKey) (*Key, error) {
+	der, err := open(r.seal, record.PrivateKey, record.ID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: record.ID, Algorithm: record.Algorithm, CreatedAt: record.CreatedAt}
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		if record.Algorithm != EdDSA {
+			return nil, fmt.Errorf("ed25519 key stored for %s", record.Algorithm)
+		}
+		key.private = private
+	case *rsa.PrivateKey:
+		if record.Algorithm != RS256 {
+			return nil, fmt.Errorf("rsa key stored for %s", record.Algorithm)
+		}
+		key.private = private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
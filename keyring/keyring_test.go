@@ -0,0 +1,289 @@
+package keyring
+
+import (
+	"context"
+	"database/sql/driver"
+	"gambler/backend/config"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newRing(t *testing.T, algorithm string) *Keyring {
+	t.Helper()
+	r, err := New(config.AuthConfig{JWTSecret: "jwt-secret", JWTAlgorithm: algorithm, JWTKeyRotation: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// stored generates a key and returns the row Refresh would have stored
+func stored(t *testing.T, r *Keyring, algorithm string, age time.Duration) models.SigningKey {
+	t.Helper()
+	key, err := generate(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.CreatedAt = time.Now().Add(-age)
+	sealed, err := r.sealKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.SigningKey{ID: key.ID, CreatedAt: key.CreatedAt, Algorithm: algorithm, PrivateKey: sealed}
+}
+
+func TestGenerateSignsTokens(t *testing.T) {
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := generate(algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Algorithm != algorithm || len(key.ID) != 16 {
+				t.Errorf("key %s of %s, want a 16 character kid of %s", key.ID, key.Algorithm, algorithm)
+			}
+			if key.Method().Alg() != algorithm {
+				t.Errorf("method %s, want %s", key.Method().Alg(), algorithm)
+			}
+
+			token := jwt.NewWithClaims(key.Method(), jwt.MapClaims{"sub": "7"})
+			signed, err := token.SignedString(key.Private())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return key.Public(), nil },
+				jwt.WithValidMethods([]string{algorithm}))
+			if err != nil {
+				t.Errorf("token does not verify with the public key: %v", err)
+			}
+		})
+	}
+
+	if _, err := generate("HS256"); err == nil {
+		t.Error("generated a key of HS256")
+	}
+}
+
+func TestOpenKey(t *testing.T) {
+	r := newRing(t, EdDSA)
+	edKey := stored(t, r, EdDSA, 0)
+	rsaKey := stored(t, r, RS256, 0)
+	other := newRing(t, EdDSA)
+	other.seal, _ = sealingKey("other-secret")
+
+	tests := []struct {
+		name   string
+		ring   *Keyring
+		record func() models.SigningKey
+		ok     bool
+	}{
+		{"ed25519", r, func() models.SigningKey { return edKey }, true},
+		{"rsa", r, func() models.SigningKey { return rsaKey }, true},
+		{"other JWT_SECRET", other, func() models.SigningKey { return edKey }, false},
+		{"kid changed", r, func() models.SigningKey { k := edKey; k.ID = rsaKey.ID; return k }, false},
+		{"ed25519 stored as RS256", r, func() models.SigningKey { k := edKey; k.Algorithm = RS256; return k }, false},
+		{"rsa stored as EdDSA", r, func() models.SigningKey { k := rsaKey; k.Algorithm = EdDSA; return k }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tt.record()
+			key, err := tt.ring.openKey(record)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatalf("openKey = %+v, want an error", key)
+			}
+			if tt.ok && (key.ID != record.ID || key.Algorithm != record.Algorithm || !key.CreatedAt.Equal(record.CreatedAt)) {
+				t.Errorf("key %s %s %s, want %s %s %s", key.ID, key.Algorithm, key.CreatedAt, record.ID, record.Algorithm, record.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	r := newRing(t, EdDSA)
+	newest := stored(t, r, EdDSA, time.Minute)
+	older := stored(t, r, EdDSA, time.Hour)
+	rsaKey := stored(t, r, RS256, 0)
+	retired := stored(t, r, EdDSA, 0)
+	expiresAt := time.Now().Add(time.Hour)
+	retired.ExpiresAt = &expiresAt
+	foreign := newRing(t, EdDSA)
+	foreign.seal, _ = sealingKey("other-secret")
+	unreadable := stored(t, foreign, EdDSA, 0)
+
+	tests := []struct {
+		name       string
+		algorithm  string
+		records    []models.SigningKey
+		current    string
+		verifying  []string
+		unreadable bool
+	}{
+		{"newest key signs", EdDSA, []models.SigningKey{retired, rsaKey, newest, older}, newest.ID, []string{retired.ID, rsaKey.ID, newest.ID, older.ID}, false},
+		{"key of the configured algorithm", RS256, []models.SigningKey{retired, rsaKey, newest}, rsaKey.ID, []string{retired.ID, rsaKey.ID, newest.ID}, false},
+		{"retired keys do not sign", EdDSA, []models.SigningKey{retired, rsaKey}, "", []string{retired.ID, rsaKey.ID}, false},
+		{"key of another JWT_SECRET", EdDSA, []models.SigningKey{unreadable, newest}, newest.ID, []string{newest.ID}, true},
+		{"unreadable older key", EdDSA, []models.SigningKey{newest, unreadable}, newest.ID, []string{newest.ID}, false},
+		{"no keys", EdDSA, nil, "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.cfg.JWTAlgorithm = tt.algorithm
+			r.current = nil
+			useKeys(t, tt.records)
+
+			got, err := r.load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.unreadable {
+				t.Errorf("unreadable = %v, want %v", got, tt.unreadable)
+			}
+			key, err := r.Signing()
+			if tt.current == "" && err == nil {
+				t.Errorf("signs with %s, want no key", key.ID)
+			}
+			if tt.current != "" && (err != nil || key.ID != tt.current) {
+				t.Errorf("signs with %v (%v), want %s", key, err, tt.current)
+			}
+			if len(r.keys) != len(tt.verifying) {
+				t.Errorf("%d keys verify, want %d", len(r.keys), len(tt.verifying))
+			}
+			for _, kid := range tt.verifying {
+				if _, err := r.Verifying(kid); err != nil {
+					t.Errorf("Verifying(%s): %v", kid, err)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadKeepsSigning covers a changed JWT_ALGORITHM: the previous key
+// signs until the caller rotated a key of the new algorithm in
+func TestLoadKeepsSigning(t *testing.T) {
+	r := newRing(t, EdDSA)
+	edKey := stored(t, r, EdDSA, 0)
+	useKeys(t, []models.SigningKey{edKey})
+	if _, err := r.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r.cfg.JWTAlgorithm = RS256
+	if _, err := r.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := r.Signing(); err != nil || key.ID != edKey.ID {
+		t.Fatalf("signs with %v (%v), want the previous key", key, err)
+	}
+
+	// Once the key is gone it stops signing
+	useKeys(t, nil)
+	if _, err := r.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := r.Signing(); err == nil {
+		t.Errorf("signs with the deleted key %s", key.ID)
+	}
+}
+
+func TestVerifyingReloads(t *testing.T) {
+	r := newRing(t, EdDSA)
+	first := stored(t, r, EdDSA, time.Hour)
+	useKeys(t, []models.SigningKey{first})
+	if _, err := r.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another replica rotated the key
+	second := stored(t, r, EdDSA, 0)
+	useKeys(t, []models.SigningKey{second, first})
+	if _, err := r.Verifying(second.ID); err == nil {
+		t.Fatal("unknown kid loaded the keys again right after a load")
+	}
+	r.mu.Lock()
+	r.loadedAt = time.Now().Add(-minReload)
+	r.mu.Unlock()
+	if _, err := r.Verifying(second.ID); err != nil {
+		t.Fatalf("key of another replica: %v", err)
+	}
+	if _, err := r.Verifying(""); err == nil {
+		t.Error("a token without kid verified")
+	}
+}
+
+// TestVerifyingReloadsOnce looks up a new kid from many requests at once,
+// they share a single load of the keys
+func TestVerifyingReloadsOnce(t *testing.T) {
+	r := newRing(t, EdDSA)
+	first := stored(t, r, EdDSA, time.Hour)
+	useKeys(t, []models.SigningKey{first})
+	if _, err := r.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	r.loadedAt = time.Now().Add(-minReload)
+	r.mu.Unlock()
+
+	second := stored(t, r, EdDSA, 0)
+	loads := useKeys(t, []models.SigningKey{second, first})
+	const requests = 10
+	errs := make(chan error, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Verifying(second.ID)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("key of another replica: %v", err)
+		}
+	}
+	if got := loads(); got != 1 {
+		t.Errorf("loaded the keys %d times, want once", got)
+	}
+}
+
+// useKeys answers the query of ListSigningKeys with records and returns the
+// number of queries answered so far. Each query takes a moment, so lookups
+// started together overlap.
+func useKeys(t *testing.T, records []models.SigningKey) func() int {
+	db := dbtest.New(t)
+	var mu sync.Mutex
+	var queries int
+	db.Handle(`SELECT * FROM "signing_keys" WHERE expires_at IS NULL OR expires_at >`, func(*dbtest.Statement) (dbtest.Result, error) {
+		mu.Lock()
+		queries++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		result := dbtest.Result{Columns: []string{"id", "created_at", "algorithm", "private_key", "expires_at"}}
+		for _, key := range records {
+			var expiresAt driver.Value
+			if key.ExpiresAt != nil {
+				expiresAt = *key.ExpiresAt
+			}
+			result.Rows = append(result.Rows, []driver.Value{key.ID, key.CreatedAt, key.Algorithm, key.PrivateKey, expiresAt})
+		}
+		return result, nil
+	})
+	handlers.DB = handlers.DBHandler{DB: db.Gorm(t)}
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
@@ -0,0 +1,75 @@
+package keyring
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSeal(t *testing.T) {
+	key, err := sealingKey("jwt-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := sealingKey("other-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("private key")
+	sealed, err := seal(key, plaintext, "kid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("sealed key contains the plaintext")
+	}
+	again, err := seal(key, plaintext, "kid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice gave the same ciphertext")
+	}
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+		kid    string
+		ok     bool
+	}{
+		{"same key and kid", key, sealed, "kid-1", true},
+		{"moved to another row", key, sealed, "kid-2", false},
+		{"other JWT_SECRET", otherKey, sealed, "kid-1", false},
+		{"tampered", key, flipped, "kid-1", false},
+		{"truncated", key, sealed[:8], "kid-1", false},
+		{"empty", key, nil, "kid-1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, err := open(tt.key, tt.sealed, tt.kid)
+			if tt.ok && (err != nil || !bytes.Equal(opened, plaintext)) {
+				t.Fatalf("open = %q, %v, want the plaintext", opened, err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatalf("open = %q, want an error", opened)
+			}
+		})
+	}
+}
+
+func TestSealingKey(t *testing.T) {
+	first, _ := sealingKey("jwt-secret")
+	second, _ := sealingKey("jwt-secret")
+	other, _ := sealingKey("jwt-secret2")
+	if len(first) != 32 {
+		t.Errorf("sealing key has %d bytes, want 32", len(first))
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("the same secret derived different keys")
+	}
+	if bytes.Equal(first, other) {
+		t.Error("different secrets derived the same key")
+	}
+}
@@ -0,0 +1,124 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"gambler/backend/logging"
+)
+
+type (
+	// Component is a part of the service with an optional start and stop
+	// hook. Start must not block: long running work belongs in a goroutine
+	// that reports unexpected exits through Manager.Fail.
+	Component struct {
+		Name  string
+		Start func(ctx context.Context) error
+		Stop  func(ctx context.Context) error
+	}
+
+	// Manager starts components in the order they were added and stops the
+	// started ones in reverse order once the process is asked to terminate
+	Manager struct {
+		components      []Component
+		started         []Component
+		shutdownTimeout time.Duration
+		failed          chan error
+		stopping        chan struct{}
+	}
+)
+
+var lifecycleLog = logging.For("lifecycle")
+
+func New(shutdownTimeout time.Duration) *Manager {
+	return &Manager{
+		shutdownTimeout: shutdownTimeout,
+		failed:          make(chan error, 1),
+		stopping:        make(chan struct{}),
+	}
+}
+
+// Add registers a component, the order of the calls is the start order
+func (m *Manager) Add(c Component) {
+	m.components = append(m.components, c)
+}
+
+// Fail reports that a running component stopped unexpectedly, which makes
+// Run shut everything down
+func (m *Manager) Fail(err error) {
+	select {
+	case m.failed <- err:
+	default:
+	}
+}
+
+// Stopping is closed as soon as the shutdown begins
+func (m *Manager) Stopping() <-chan struct{} {
+	return m.stopping
+}
+
+// Run starts every component, blocks until SIGINT/SIGTERM, ctx cancellation
+// or a component failure, then shuts the started components down within the
+// shutdown timeout
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var runErr error
+	for _, c := range m.components {
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				runErr = fmt.Errorf("failed to start %s: %w", c.Name, err)
+				break
+			}
+		}
+		m.started = append(m.started, c)
+		lifecycleLog.Info("started component", "name", c.Name)
+	}
+
+	if runErr == nil {
+		select {
+		case <-ctx.Done():
+			lifecycleLog.Info("shutdown requested")
+		case err := <-m.failed:
+			runErr = err
+			lifecycleLog.Error("component failed", "error", err)
+		}
+	}
+
+	if err := m.shutdown(); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
+}
+
+func (m *Manager) shutdown() error {
+	close(m.stopping)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+
+	failures := []string{}
+	for i := len(m.started) - 1; i >= 0; i-- {
+		c := m.started[i]
+		if c.Stop == nil {
+			continue
+		}
+		if err := c.Stop(ctx); err != nil {
+			lifecycleLog.Error("failed to stop component", "name", c.Name, "error", err)
+			failures = append(failures, fmt.Sprintf("%s: %v", c.Name, err))
+			continue
+		}
+		lifecycleLog.Info("stopped component", "name", c.Name)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("unclean shutdown: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder adds components that append their start and stop to events
+type recorder struct {
+	m      *Manager
+	events []string
+}
+
+func (r *recorder) add(name string, startErr error, stopErr error) {
+	r.m.Add(Component{
+		Name: name,
+		Start: func(context.Context) error {
+			r.events = append(r.events, "start "+name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			r.events = append(r.events, "stop "+name)
+			return stopErr
+		},
+	})
+}
+
+func TestRunStopsInReverseOrder(t *testing.T) {
+	r := &recorder{m: New(time.Second)}
+	r.add("database", nil, nil)
+	r.add("cache", nil, nil)
+	r.add("http", nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.m.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "start database,start cache,start http,stop http,stop cache,stop database"
+	if got := strings.Join(r.events, ","); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+	select {
+	case <-r.m.Stopping():
+	default:
+		t.Error("Stopping is not closed after the shutdown")
+	}
+}
+
+// TestRunStopsStartedOnly fails to start a component, only the ones started
+// before it are stopped
+func TestRunStopsStartedOnly(t *testing.T) {
+	r := &recorder{m: New(time.Second)}
+	r.add("database", nil, nil)
+	r.add("cache", errors.New("connection refused"), nil)
+	r.add("http", nil, nil)
+
+	err := r.m.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed to start cache") {
+		t.Fatalf("error = %v, want the start failure of cache", err)
+	}
+
+	want := "start database,start cache,stop database"
+	if got := strings.Join(r.events, ","); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
+
+// TestRunFail shuts down on a component failure and keeps stopping the
+// other components when one of them fails to stop
+func TestRunFail(t *testing.T) {
+	r := &recorder{m: New(time.Second)}
+	r.add("database", nil, nil)
+	r.add("cache", nil, errors.New("timeout"))
+	r.add("http", nil, nil)
+
+	failure := errors.New("listener closed")
+	r.m.Fail(failure)
+	if err := r.m.Run(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("error = %v, want %v", err, failure)
+	}
+
+	want := "start database,start cache,start http,stop http,stop cache,stop database"
+	if got := strings.Join(r.events, ","); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
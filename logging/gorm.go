@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+var (
+	dbLog              = For("database")
+	slowQueryThreshold atomic.Int64
+)
+
+func init() {
+	slowQueryThreshold.Store(int64(500 * time.Millisecond))
+}
+
+// GormLogger routes GORM's logs through the database component logger.
+// Statements are logged at debug level with their placeholders only, so
+// hashes and balances never reach the log, slow statements as warnings.
+type GormLogger struct{}
+
+var _ gormlogger.Interface = GormLogger{}
+var _ gorm.ParamsFilter = GormLogger{}
+
+// LogMode is a no-op, levels are configured through the logging section
+func (l GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	dbLog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	dbLog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	dbLog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	slow := time.Duration(slowQueryThreshold.Load())
+
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		dbLog.ErrorContext(ctx, "query failed", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds(), "error", err)
+	case elapsed > slow:
+		sql, rows := fc()
+		dbLog.WarnContext(ctx, "slow query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds(), "threshold_ms", slow.Milliseconds())
+	case dbLog.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		dbLog.DebugContext(ctx, "query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	}
+}
+
+// ParamsFilter drops the bound values from logged statements
+func (GormLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"context"
+	"gambler/backend/config"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// base holds the handler every component logger writes through. It is
+// swapped by Init so loggers created at package init time pick up the
+// configuration once it is loaded.
+var (
+	base         atomic.Pointer[slog.Handler]
+	defaultLevel = new(slog.LevelVar)
+
+	levelsMu sync.RWMutex
+	levels   = map[string]slog.Level{}
+)
+
+func init() {
+	setOutput(os.Stdout, "json")
+	slog.SetDefault(For("app"))
+}
+
+// Init configures output format, the default level and the per component
+// overrides. It may be called again, e.g. after reloading the config.
+func Init(cfg config.LoggingConfig) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	overrides := map[string]slog.Level{}
+	for _, entry := range cfg.Components {
+		component, value, _ := strings.Cut(entry, "=")
+		l, err := ParseLevel(value)
+		if err != nil {
+			return err
+		}
+		overrides[strings.ToLower(strings.TrimSpace(component))] = l
+	}
+
+	defaultLevel.Set(level)
+	levelsMu.Lock()
+	levels = overrides
+	levelsMu.Unlock()
+
+	setOutput(os.Stdout, strings.ToLower(cfg.Format))
+	slowQueryThreshold.Store(int64(cfg.SlowQueryThreshold))
+	return nil
+}
+
+// ParseLevel converts debug, info, warn or error into a slog.Level
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "warning") {
+		s = "warn"
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// For returns the logger of a component. Its records carry the component
+// name and the request id of the context they are logged with, and are
+// dropped below the level configured for the component.
+func For(component string) *slog.Logger {
+	return slog.New(&handler{component: component})
+}
+
+func setOutput(w io.Writer, format string) {
+	opts := &slog.HandlerOptions{
+		// Filtering happens per component in handler.Enabled
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redact,
+	}
+
+	var h slog.Handler
+	if format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	base.Store(&h)
+}
+
+func levelFor(component string) slog.Level {
+	levelsMu.RLock()
+	defer levelsMu.RUnlock()
+	if l, ok := levels[component]; ok {
+		return l
+	}
+	return defaultLevel.Level()
+}
+
+// handler defers to the current base handler on every record so it keeps
+// working across calls to Init. Attributes and groups added with WithAttrs
+// and WithGroup are replayed on top of it.
+type handler struct {
+	component string
+	ops       []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levelFor(h.component)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	next := (*base.Load()).WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	if id := RequestID(ctx); id != "" {
+		next = next.WithAttrs([]slog.Attr{slog.String("request_id", id)})
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		next = next.WithAttrs([]slog.Attr{
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		})
+	}
+	for _, op := range h.ops {
+		next = op(next)
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &handler{component: h.component, ops: append(ops, op)}
+}
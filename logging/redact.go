@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case insensitively against attribute keys,
+// any attribute whose key contains one of them is replaced as a whole
+var sensitiveKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"authorization",
+	"cookie",
+	"email",
+	"dsn",
+	"api_key",
+	"api-key",
+	"apikey",
+}
+
+var (
+	// Values are scrubbed as well, so tokens and addresses leaking into a
+	// message or an error string are not written out either
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	bcryptPattern = regexp.MustCompile(`\$2[aby]?\$\d{2}\$[./A-Za-z0-9]{53}`)
+	// PHC strings like $argon2id$v=19$m=19456,t=2,p=1,keyid=k1$<salt>$<hash>
+	argon2Pattern = regexp.MustCompile(`\$argon2(?:id|i|d)\$v=\d+\$[^$\s]+\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+`)
+	apiKeyPattern = regexp.MustCompile(`\bgbk_[A-Za-z0-9_-]{8,}`)
+)
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error()))
+		}
+	}
+	return a
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scrub masks tokens, API keys, credentials, password hashes and email
+// addresses in s
+func Scrub(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = bearerPattern.ReplaceAllString(s, "$1 "+redacted)
+	s = bcryptPattern.ReplaceAllString(s, redacted)
+	s = argon2Pattern.ReplaceAllString(s, redacted)
+	s = apiKeyPattern.ReplaceAllString(s, redacted)
+	return emailPattern.ReplaceAllString(s, redacted)
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"context"
+	"gambler/backend/apperr"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+type requestIDKey struct{}
+
+// RequestIDLocal is the fiber.Ctx local holding the id of the request
+const RequestIDLocal = "requestid"
+
+var httpLog = For("http")
+
+// validRequestID is the form of the request ids taken from a proxy, other
+// values are replaced so they cannot smuggle anything into the logs and
+// the audit trail
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// maxClientRequestID bounds the rejected id logged next to the new one
+const maxClientRequestID = 128
+
+// probes are polled by the orchestrator and scraper, their successful
+// requests are only logged at debug level
+var probes = map[string]bool{
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// WithRequestID returns a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Middleware assigns every request an id, echoed in the X-Request-ID
+// header, stores it in the user context so handlers and the database layer
+// log it, and writes one access log line per request. An id sent by a proxy
+// in front of the server is kept if it is up to 64 letters, digits and
+// dashes, otherwise the access log line carries it as client_request_id.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		var clientID string
+		if !validRequestID.MatchString(id) {
+			clientID = id
+			if len(clientID) > maxClientRequestID {
+				clientID = clientID[:maxClientRequestID]
+			}
+			id = utils.UUIDv4()
+		}
+		c.Set(fiber.HeaderXRequestID, id)
+		c.Locals(RequestIDLocal, id)
+		ctx := WithRequestID(c.UserContext(), id)
+		c.SetUserContext(ctx)
+
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = apperr.Status(err)
+		}
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		} else if probes[c.Path()] && status < fiber.StatusBadRequest {
+			level = slog.LevelDebug
+		}
+		attrs := []interface{}{
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"ip", c.IP(),
+		}
+		if clientID != "" {
+			attrs = append(attrs, "client_request_id", clientID)
+		}
+		httpLog.Log(ctx, level, "request", attrs...)
+		return err
+	}
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMiddlewareRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		// kept is whether the id of the header is used
+		kept bool
+		// client is the client_request_id logged for a replaced id
+		client string
+	}{
+		{name: "without id"},
+		{name: "uuid", header: "0b6f3c4e-8a51-4d7e-9f0a-2c1d5e6f7a8b", kept: true},
+		{name: "letters and digits", header: "abcXYZ019", kept: true},
+		{name: "longest id", header: strings.Repeat("a", 64), kept: true},
+		{name: "too long", header: strings.Repeat("a", 65), client: strings.Repeat("a", 65)},
+		{name: "log injection", header: `x" level=ERROR msg="forged`, client: `x" level=ERROR msg="forged`},
+		{name: "rejected id is cut", header: strings.Repeat("b", 300), client: strings.Repeat("b", maxClientRequestID)},
+		{name: "rejected id is redacted", header: "jane@example.com", client: redacted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			setOutput(&out, "json")
+			t.Cleanup(func() { setOutput(os.Stdout, "json") })
+
+			app := fiber.New()
+			app.Use(Middleware())
+			var seen string
+			app.Get("/bets", func(c *fiber.Ctx) error {
+				seen = RequestID(c.UserContext())
+				return c.SendStatus(fiber.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/bets", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderXRequestID, tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id := resp.Header.Get(fiber.HeaderXRequestID)
+			if !validRequestID.MatchString(id) || id != seen {
+				t.Fatalf("echoed id %q and handler id %q, want the same valid id", id, seen)
+			}
+			if (id == tt.header) != tt.kept {
+				t.Errorf("id = %q for header %q, kept: %v", id, tt.header, tt.kept)
+			}
+
+			var line struct {
+				RequestID string `json:"request_id"`
+				Client    string `json:"client_request_id"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+				t.Fatalf("access log %q: %v", out.String(), err)
+			}
+			if line.RequestID != id || line.Client != tt.client {
+				t.Errorf("logged request_id %q and client_request_id %q, want %q and %q", line.RequestID, line.Client, id, tt.client)
+			}
+		})
+	}
+}
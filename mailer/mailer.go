@@ -0,0 +1,160 @@
+// Package mailer sends the account emails, the links to verify an address
+// and to reset a password. Emails are sent in the background so a slow mail
+// server does not hold up the request, and so the answer to a reset request
+// takes as long whether the address is registered or not.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/logging"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// Message is a plain text email
+	Message struct {
+		To      string
+		Subject string
+		Text    string
+	}
+
+	// Sender delivers one email
+	Sender interface {
+		Name() string
+		Send(ctx context.Context, from string, msg Message) error
+	}
+
+	// Mailer sends emails in the background through a Sender
+	Mailer struct {
+		sender  Sender
+		from    string
+		timeout time.Duration
+		closer  io.Closer
+
+		mu      sync.Mutex
+		closed  bool
+		sending sync.WaitGroup
+	}
+)
+
+var (
+	Mail *Mailer
+
+	mailLog = logging.For("mail")
+)
+
+// New creates the Mailer of the configured transport
+func New(cfg config.MailConfig) (*Mailer, error) {
+	m := &Mailer{from: cfg.From, timeout: cfg.Timeout}
+	switch strings.ToLower(cfg.Transport) {
+	case "smtp":
+		m.sender = &SMTPSender{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	case "file":
+		if cfg.File == "stdout" {
+			m.sender = &WriterSender{Target: "stdout", W: os.Stdout}
+			break
+		}
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open mail file: %w", err)
+		}
+		m.sender = &WriterSender{Target: "file", W: file}
+		m.closer = file
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Transport)
+	}
+	return m, nil
+}
+
+// Deliver sends msg in the background, a failure is only logged. The
+// context keeps the request id for the logs but not its cancellation.
+func (m *Mailer) Deliver(ctx context.Context, msg Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		mailLog.WarnContext(ctx, "mailer closed, dropping email", "subject", msg.Subject)
+		return
+	}
+
+	m.sending.Add(1)
+	go func() {
+		defer m.sending.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.timeout)
+		defer cancel()
+		if err := m.sender.Send(ctx, m.from, msg); err != nil {
+			mailLog.ErrorContext(ctx, "failed to send email", "transport", m.sender.Name(), "subject", msg.Subject, "error", err)
+			return
+		}
+		mailLog.InfoContext(ctx, "sent email", "transport", m.sender.Name(), "subject", msg.Subject)
+	}()
+}
+
+// Close waits for the emails being sent
+func (m *Mailer) Close(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.sending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if m.closer != nil {
+		return m.closer.Close()
+	}
+	return nil
+}
+
+// encode renders msg with its headers as sent over SMTP
+func encode(from string, msg Message, now time.Time) ([]byte, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	recipient, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	// The subject is the only header taken as is, a line break in it would
+	// add headers
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, errors.New("line break in subject")
+	}
+
+	domain := sender.Address[strings.LastIndex(sender.Address, "@")+1:]
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", sender.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", uuid.NewString(), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	// Lines starting with a dot are escaped by the SMTP client
+	buf.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPSender sends emails through a mail server. STARTTLS is used when the
+// server offers it and required before the password is sent.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPSender) Send(ctx context.Context, from string, msg Message) error {
+	data, err := encode(from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	sender, _ := mail.ParseAddress(from)
+	recipient, _ := mail.ParseAddress(msg.To)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)))
+	if err != nil {
+		return err
+	}
+	// net/smtp does not take a context, the deadline bounds the whole
+	// conversation instead
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if s.Username != "" {
+		// PlainAuth refuses to send the password without TLS, except to
+		// localhost
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VerifyEmail asks the user to confirm their address
+func VerifyEmail(to string, name string, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Confirm your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nplease confirm your email address by opening this link:\n\n%s\n\n"+
+			"The link works for %s. If you did not create an account, ignore this email.\n",
+			name, link, duration(ttl)),
+	}
+}
+
+// ResetPassword sends the link to choose a new password
+func ResetPassword(to string, name string, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset the password of your account. Choose a new one here:\n\n%s\n\n"+
+			"The link works once and for %s. Resetting signs you out on every device. "+
+			"If it was not you, ignore this email, your password stays the same.\n",
+			name, link, duration(ttl)),
+	}
+}
+
+// Link returns the frontend page at path with the token in its query
+func Link(baseURL string, path string, token string) string {
+	return strings.TrimSuffix(baseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func duration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if hours := int(d / time.Hour); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d minutes", int(d/time.Minute))
+}
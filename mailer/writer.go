@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// WriterSender writes every email to a file or stdout instead of sending
+// it, used during local development to click the links
+type WriterSender struct {
+	Target string
+	W      io.Writer
+	mu     sync.Mutex
+}
+
+func (s *WriterSender) Name() string {
+	return s.Target
+}
+
+func (s *WriterSender) Send(ctx context.Context, from string, msg Message) error {
+	data, err := encode(from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.W.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(s.W, "\r\n\r\n")
+	return err
+}
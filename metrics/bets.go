@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type BetStat struct {
+	Status string
+	Count  int64
+	Volume float64
+}
+
+// betStatsTTL is how long the bet stats are reused, so frequent scrapes do
+// not run the aggregate on every request
+const betStatsTTL = 30 * time.Second
+
+// betCollector reads the number of bets and their staked volume per status
+// at scrape time, at most once per betStatsTTL
+type betCollector struct {
+	stats  func() ([]BetStat, error)
+	ttl    time.Duration
+	count  *prometheus.Desc
+	volume *prometheus.Desc
+
+	mu       sync.Mutex
+	cached   []BetStat
+	err      error
+	cachedAt time.Time
+}
+
+// RegisterBetCollector exposes the bets returned by stats on scrapes
+func RegisterBetCollector(stats func() ([]BetStat, error)) {
+	Registry.MustRegister(newBetCollector(stats, betStatsTTL))
+}
+
+func newBetCollector(stats func() ([]BetStat, error), ttl time.Duration) *betCollector {
+	return &betCollector{
+		stats: stats,
+		ttl:   ttl,
+		count: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "bets"),
+			"Bets by status.",
+			[]string{"status"}, nil,
+		),
+		volume: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "bets_volume"),
+			"Amount staked on bets by status.",
+			[]string{"status"}, nil,
+		),
+	}
+}
+
+func (c *betCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.count
+	ch <- c.volume
+}
+
+// read returns the stats of the last read while it is younger than the
+// TTL, a failed read is reused as well to spare a struggling database
+func (c *betCollector) read() ([]BetStat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cachedAt.IsZero() || time.Since(c.cachedAt) >= c.ttl {
+		c.cached, c.err = c.stats()
+		c.cachedAt = time.Now()
+	}
+	return c.cached, c.err
+}
+
+func (c *betCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.read()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.count, err)
+		return
+	}
+	for _, stat := range stats {
+		ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, float64(stat.Count), stat.Status)
+		ch <- prometheus.MustNewConstMetric(c.volume, prometheus.GaugeValue, stat.Volume, stat.Status)
+	}
+}
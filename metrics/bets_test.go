@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func collect(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 16)
+	c.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func TestBetCollectorCaches(t *testing.T) {
+	reads := 0
+	var fail error
+	c := newBetCollector(func() ([]BetStat, error) {
+		reads++
+		return []BetStat{{Status: "active", Count: 2, Volume: 30}}, fail
+	}, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if n := collect(c); n != 2 {
+			t.Fatalf("collected %d metrics, want 2", n)
+		}
+	}
+	if reads != 1 {
+		t.Fatalf("read the stats %d times within the TTL, want 1", reads)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	fail = errors.New("database down")
+	collect(c)
+	collect(c)
+	if reads != 2 {
+		t.Fatalf("read the stats %d times, want 2 after the TTL", reads)
+	}
+	if _, err := c.read(); err == nil {
+		t.Error("the failed read was not reused")
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const startKey = "metrics:start"
+
+// GormPlugin records the latency of every query run through gorm
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "metrics"
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("metrics:before_create", before); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("metrics:after_create", after("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("metrics:before_query", before); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("metrics:after_query", after("query")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("metrics:before_update", before); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("metrics:after_update", after("update")); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("metrics:before_delete", before); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("metrics:after_delete", after("delete")); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("metrics:before_row", before); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("metrics:after_row", after("row")); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("gorm:raw").Register("metrics:before_raw", before); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("metrics:after_raw", after("raw"))
+}
+
+func before(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func after(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		status := "ok"
+		if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+			status = "error"
+		}
+		DBQueryDuration.WithLabelValues(operation, table, status).Observe(time.Since(start).Seconds())
+	}
+}
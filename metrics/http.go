@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"gambler/backend/apiversion"
+	"gambler/backend/apperr"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Middleware records the count and latency of every request, labelled with
+// the API version and the route template (e.g. /v1/bets/:id<int>) to keep the
+// cardinality bounded
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = apperr.Status(err)
+		}
+
+		route := c.Route().Path
+		if status == fiber.StatusNotFound && route == "/" && c.Path() != "/" {
+			route = "unmatched"
+		}
+
+		labels := []string{apiversion.Label(c), c.Method(), route, strconv.Itoa(status)}
+		HTTPRequests.WithLabelValues(labels...).Inc()
+		HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Handler serves the registry in the Prometheus text format to requests
+// with the bearer token. Without a token the metrics are not served at all.
+func Handler(token string) fiber.Handler {
+	serve := adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return apperr.ErrNotFound
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Get(fiber.HeaderAuthorization)), []byte("Bearer "+token)) != 1 {
+			return apperr.ErrUnauthorized
+		}
+		return serve(c)
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"gambler/backend/apiversion"
+	"gambler/backend/apperr"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHandlerToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		status        int
+	}{
+		{"disabled without a token", "", "", fiber.StatusNotFound},
+		{"disabled even with a header", "", "Bearer ", fiber.StatusNotFound},
+		{"missing header", "secret", "", fiber.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", fiber.StatusUnauthorized},
+		{"token without scheme", "secret", "secret", fiber.StatusUnauthorized},
+		{"right token", "secret", "Bearer secret", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+				return c.SendStatus(apperr.Status(err))
+			}})
+			app.Get("/metrics", Handler(tt.token))
+
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.authorization)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+// TestMiddlewareVersionLabel counts the same route of every version apart
+func TestMiddlewareVersionLabel(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware())
+	v2 := &apiversion.Version{Name: "v2", Prefix: "/v2"}
+	routes := func(router fiber.Router) {
+		router.Get("/bets", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	}
+	apiversion.V1.Mount(app, routes)
+	v2.Mount(app, routes)
+	apiversion.Legacy(time.Now(), time.Time{}).Mount(app, routes)
+
+	requests := map[string]string{"/v1/bets": "v1", "/v2/bets": "v2", "/bets": "legacy"}
+	before := map[string]float64{}
+	for path, version := range requests {
+		before[version] = testutil.ToFloat64(HTTPRequests.WithLabelValues(version, "GET", path, "200"))
+	}
+	for path := range requests {
+		if _, err := app.Test(httptest.NewRequest("GET", path, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, version := range requests {
+		if got := testutil.ToFloat64(HTTPRequests.WithLabelValues(version, "GET", path, "200")) - before[version]; got != 1 {
+			t.Errorf("%s counted %v times as %s, want once", path, got, version)
+		}
+	}
+}
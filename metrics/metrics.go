@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "gambler"
+
+var (
+	// Registry holds every collector exposed on /metrics
+	Registry = prometheus.NewRegistry()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by API version, method, route and status code.",
+	}, []string{"version", "method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by API version, method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"version", "method", "route", "status"})
+
+	WebSocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Currently open websocket sessions.",
+	})
+
+	WebSocketMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_total",
+		Help:      "Websocket frames by direction and event type.",
+	}, []string{"direction", "event"})
+
+	BetPlacements = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bet_placements_total",
+		Help:      "Stakes placed on bets, including the stake of the creator.",
+	})
+
+	BetPlacementVolume = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bet_placement_volume_total",
+		Help:      "Sum of the amounts placed on bets.",
+	})
+
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Redis cache lookups by cache and result (hit, miss, error).",
+	}, []string{"cache", "result"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation and table.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "table", "status"})
+
+	ExpirySchedulerLag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "expiry_scheduler_lag_seconds",
+		Help:      "Delay between a bet ending and the expiry scheduler closing it.",
+		Buckets:   []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	})
+
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_attempts_total",
+		Help:      "Webhook delivery attempts by event and result (delivered, retry, failed).",
+	}, []string{"event", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		WebSocketConnections,
+		WebSocketMessages,
+		BetPlacements,
+		BetPlacementVolume,
+		CacheLookups,
+		DBQueryDuration,
+		ExpirySchedulerLag,
+		WebhookDeliveries,
+	)
+}
+
+// ObserveBetPlacement records a stake placed on a bet
+func ObserveBetPlacement(amount float64) {
+	BetPlacements.Inc()
+	BetPlacementVolume.Add(amount)
+}
@@ -0,0 +1,51 @@
+package mfa
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodes {
+		t.Fatalf("%d codes, want %d", len(codes), RecoveryCodes)
+	}
+	format := regexp.MustCompile(`^[` + recoveryAlphabet + `]{5}-[` + recoveryAlphabet + `]{5}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q does not look like k7m2p-x9q4r", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q issued twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("secret", "k7m2p-x9q4r")
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		same   bool
+	}{
+		{"same code", "secret", "k7m2p-x9q4r", true},
+		{"without dash", "secret", "k7m2px9q4r", true},
+		{"uppercase", "secret", "K7M2P-X9Q4R", true},
+		{"with spaces", "secret", " k7m2p x9q4r", true},
+		{"other code", "secret", "k7m2p-x9q4s", false},
+		{"other secret", "other", "k7m2p-x9q4r", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashRecoveryCode(tt.secret, tt.code); (got == want) != tt.same {
+				t.Errorf("hash of %q equal to the original: %v, want %v", tt.code, got == want, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package mfa implements the second factor of a sign in: time-based one
+// time passwords (RFC 6238) as shown by authenticator apps, and recovery
+// codes for when the device is lost.
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters every common authenticator app supports, they are not part of
+// the URI so apps use their defaults
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// skew accepts the code of the previous and the next period, clocks of
+	// phones are rarely exact
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret generates a secret of 160 bits, the size of an HMAC-SHA1 key
+func NewSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+// URI returns the otpauth URI of a secret, the content of the QR code
+// scanned by authenticator apps
+func URI(issuer string, account string, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Code returns the code of the period t falls into
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %w", err)
+	}
+	return hotp(key, counter(t)), nil
+}
+
+// Validate checks a code around t and returns the counter of the period it
+// belongs to. Callers store the counter and reject codes of counters up to
+// it, so a code cannot be used twice.
+func Validate(secret string, code string, t time.Time) (int64, bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+	now := counter(t)
+	for c := now - skew; c <= now+skew; c++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, c)), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// IsCode reports whether input looks like a TOTP code rather than a
+// recovery code
+func IsCode(input string) bool {
+	if len(input) != Digits {
+		return false
+	}
+	for _, r := range input {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// hotp is the HMAC-based one time password of RFC 4226
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
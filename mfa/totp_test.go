@@ -0,0 +1,133 @@
+package mfa
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the key of the test vectors in RFC 4226 and RFC 6238,
+// "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp([]byte("12345678901234567890"), int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	// The SHA-1 vectors of RFC 6238 cut to six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	codeAt := func(t *testing.T, at time.Time) string {
+		code, err := Code(rfcSecret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		code    func(t *testing.T) string
+		counter int64
+		ok      bool
+	}{
+		{"current period", rfcSecret, func(t *testing.T) string { return codeAt(t, now) }, counter(now), true},
+		{"lowercase secret", strings.ToLower(rfcSecret), func(t *testing.T) string { return codeAt(t, now) }, counter(now), true},
+		{"previous period", rfcSecret, func(t *testing.T) string { return codeAt(t, now.Add(-Period)) }, counter(now) - 1, true},
+		{"next period", rfcSecret, func(t *testing.T) string { return codeAt(t, now.Add(Period)) }, counter(now) + 1, true},
+		{"two periods ago", rfcSecret, func(t *testing.T) string { return codeAt(t, now.Add(-2*Period)) }, 0, false},
+		{"two periods ahead", rfcSecret, func(t *testing.T) string { return codeAt(t, now.Add(2*Period)) }, 0, false},
+		{"wrong code", rfcSecret, func(t *testing.T) string { return "000000" }, 0, false},
+		{"too short", rfcSecret, func(t *testing.T) string { return codeAt(t, now)[1:] }, 0, false},
+		{"invalid secret", "not base32!", func(t *testing.T) string { return codeAt(t, now) }, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(tt.secret, tt.code(t), now)
+			if ok != tt.ok || got != tt.counter {
+				t.Errorf("Validate = %d, %v, want %d, %v", got, ok, tt.counter, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsCode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"123456", true},
+		{"000000", true},
+		{"12345", false},
+		{"1234567", false},
+		{"12345a", false},
+		{"k7m2p-x9q4r", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsCode(tt.input); got != tt.want {
+			t.Errorf("IsCode(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+	if other, _ := NewSecret(); other == secret {
+		t.Error("NewSecret returned the same secret twice")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Gambler Dev", "ann@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Gambler Dev:ann@example.com" {
+		t.Errorf("URI = %s, want the totp label issuer:account", uri)
+	}
+	if q := uri.Query(); q.Get("secret") != rfcSecret || q.Get("issuer") != "Gambler Dev" {
+		t.Errorf("query = %v, want the secret and issuer", q)
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"database/sql/driver"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	"gambler/backend/tools"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	const key = "gbk_abcdefgh12345678"
+
+	tests := []struct {
+		name   string
+		scopes string
+		userID int64
+		// owner is the role of the key's user, empty once the user is deleted
+		owner  string
+		route  string
+		status int
+	}{
+		{name: "granted scope", scopes: "{bets:read}", userID: 7, owner: "user", route: "/bets", status: 200},
+		{name: "missing scope", scopes: "{bets:read}", userID: 7, owner: "user", route: "/bets/create", status: 403},
+		{name: "route without scope", scopes: "{bets:read,admin}", userID: 7, owner: "admin", route: "/sessions", status: 403},
+		{name: "admin scope of an admin", scopes: "{admin}", userID: 7, owner: "admin", route: "/admin", status: 200},
+		{name: "admin scope of a demoted admin", scopes: "{admin}", userID: 7, owner: "user", route: "/admin", status: 403},
+		{name: "admin scope of a master", scopes: "{admin}", userID: 1, owner: "user", route: "/admin", status: 200},
+		{name: "deleted owner", scopes: "{bets:read}", userID: 7, route: "/bets", status: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			db.Answer(`SELECT * FROM "api_keys" WHERE key_hash = $1`, dbtest.Result{
+				Columns: []string{"id", "user_id", "key_hash", "scopes"},
+				Rows:    [][]driver.Value{{int64(3), tt.userID, tools.HashAPIKey(key), tt.scopes}},
+			})
+			users := dbtest.Result{Columns: []string{"id", "role"}}
+			if tt.owner != "" {
+				users.Rows = [][]driver.Value{{tt.userID, tt.owner}}
+			}
+			db.Answer(`SELECT "id","role" FROM "users"`, users)
+			db.Answer(`UPDATE "api_keys" SET "last_used_at"`, dbtest.Result{Affected: 1})
+			handlers.DB = handlers.DBHandler{DB: db.Gorm(t)}
+
+			guards := NewAuth(config.AuthConfig{MasterIDs: []string{"1"}}, tools.NewCookies(config.CookieConfig{}))
+			app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+				return c.SendStatus(apperr.Status(err))
+			}})
+			ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+			app.Get("/bets", guards.Scoped(models.ScopeBetsRead), ok)
+			app.Get("/bets/create", guards.Scoped(models.ScopeBetsCreate), ok)
+			app.Get("/sessions", guards.JwtGuardHandler, ok)
+			app.Get("/admin", guards.Scoped(models.ScopeAdmin), ok)
+
+			req := httptest.NewRequest(http.MethodGet, tt.route, nil)
+			req.Header.Set("Authorization", "Bearer "+key)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
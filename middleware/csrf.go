@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"gambler/backend/apperr"
+	"gambler/backend/tools"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CSRF protects the cookie authenticated routes with signed double submit
+// tokens. Responses to requests without a valid csrf_token cookie set one,
+// and POST, PUT, PATCH and DELETE requests have to repeat it in the
+// X-CSRF-Token header. Other sites can make the browser send the cookie
+// but cannot read it. The token is signed with COOKIE_SECRET together with
+// the session of the refresh token cookie, session returns its id, so a
+// token planted from a sibling domain or taken from another session is
+// refused too. A response starting or ending a session sets the token of
+// the new one. Requests with an API key are exempt, browsers never add the
+// Authorization header on their own.
+func CSRF(secret string, cookies *tools.Cookies, session func(refreshToken string) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sessionID := session(cookies.Get(c, tools.RefreshTokenCookie))
+		cookie := cookies.Get(c, tools.CSRFCookie)
+		valid := validCSRFToken(secret, sessionID, cookie)
+		if !valid {
+			if err := setCSRFToken(c, secret, cookies, sessionID); err != nil {
+				return err
+			}
+		}
+
+		err := checkCSRF(c, valid, cookie)
+		if refreshToken, ok := cookies.Sent(c, tools.RefreshTokenCookie); ok {
+			if next := session(refreshToken); next != sessionID {
+				if setErr := setCSRFToken(c, secret, cookies, next); setErr != nil {
+					return setErr
+				}
+			}
+		}
+		return err
+	}
+}
+
+// checkCSRF runs the next handler unless the request changes state without
+// repeating a valid token
+func checkCSRF(c *fiber.Ctx, valid bool, cookie string) error {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+		return c.Next()
+	}
+	if tools.HeaderParser(c) != "" {
+		return c.Next()
+	}
+	header := c.Get(tools.CSRFHeader)
+	if !valid || subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 {
+		return apperr.ErrCSRF
+	}
+	return c.Next()
+}
+
+func setCSRFToken(c *fiber.Ctx, secret string, cookies *tools.Cookies, sessionID string) error {
+	token, err := newCSRFToken(secret, sessionID)
+	if err != nil {
+		return err
+	}
+	// Readable by the frontend, it has to copy it into the header
+	cookies.Set(c, &fiber.Cookie{Name: tools.CSRFCookie, Value: token})
+	return nil
+}
+
+// newCSRFToken returns <nonce>.<signature>, both base64url encoded
+func newCSRFToken(secret string, sessionID string) (string, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(nonce)
+	return encoded + "." + csrfSignature(secret, sessionID, encoded), nil
+}
+
+func validCSRFToken(secret string, sessionID string, token string) bool {
+	nonce, signature, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(csrfSignature(secret, sessionID, nonce)))
+}
+
+// csrfSignature signs the nonce for a session, requests without a session
+// sign it for the empty id
+func csrfSignature(secret string, sessionID string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf:"))
+	mac.Write([]byte(sessionID))
+	mac.Write([]byte(":"))
+	mac.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,133 +1,350 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"gambler/backend/apiversion"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/config"
+	"gambler/backend/database/models/customTypes"
 	"gambler/backend/handlers"
+	"gambler/backend/keyring"
+	"gambler/backend/logging"
 	"gambler/backend/tools"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-type Jwt struct {
-	AccessToken         string    `json:"accessToken"`
-	RefreshToken        string    `json:"refreshToken"`
-	AccessTokenExpDate  time.Time `json:"accessTokenExpDate"`
-	RefreshTokenExpDate time.Time `json:"refreshTokenExpDate"`
-}
-
-func Sign(userId uint) (*Jwt, int) {
-	user, dbErr := handlers.DB.GetUserByID(userId)
-	if dbErr != -1 {
-		return nil, dbErr
-	}
-	accessTokenExpDate := time.Minute * 15
-	refreshTokenExpDate := 24 * 7 * time.Hour
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenExpDate)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "Gambler Backend Service",
-		Subject:   fmt.Sprintf("%d", user.ID),
-	})
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(refreshTokenExpDate)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    fmt.Sprintf("%d Version", user.RefreshTokenVersion),
-		Subject:   fmt.Sprintf("%d", user.ID),
-	})
-	AccessToken, err := accessToken.SignedString(tools.JWT_SECRET)
+type (
+	Jwt struct {
+		AccessToken         string    `json:"accessToken"`
+		RefreshToken        string    `json:"refreshToken"`
+		AccessTokenExpDate  time.Time `json:"accessTokenExpDate"`
+		RefreshTokenExpDate time.Time `json:"refreshTokenExpDate"`
+		// RefreshTokenID is the jti of the refresh token, the session only
+		// accepts this one on the next refresh
+		RefreshTokenID string `json:"-"`
+	}
+
+	// tokenClaims are the claims of both tokens. sid is the session, the
+	// family every refresh token of a device belongs to.
+	tokenClaims struct {
+		jwt.RegisteredClaims
+		SessionID string `json:"sid,omitempty"`
+		Type      string `json:"typ"`
+	}
+)
+
+// Token types, an access token cannot be used to refresh and vice versa
+const (
+	accessToken  = "access"
+	refreshToken = "refresh"
+	// challengeToken proves the password of a user with two-factor
+	// authentication, it only opens /auth/login/mfa
+	challengeToken = "mfa"
+)
+
+var authLog = logging.For("auth")
+
+// Auth signs and checks the tokens of the users and guards the routes with
+// them. The keys come from keyring.Ring.
+type Auth struct {
+	cfg     config.AuthConfig
+	cookies *tools.Cookies
+}
+
+// NewAuth uses the issuer, audience and token lifetimes of cfg, the access
+// token is read from the cookies
+func NewAuth(cfg config.AuthConfig, cookies *tools.Cookies) *Auth {
+	return &Auth{cfg: cfg, cookies: cookies}
+}
+
+// Sign issues an access and a refresh token for a session of the user
+func (a *Auth) Sign(userId uint, sessionID string) (*Jwt, error) {
+	return a.Reissue(userId, sessionID, uuid.NewString(), time.Now().Add(a.cfg.RefreshTokenTTL))
+}
+
+// Reissue issues a new access token together with the refresh token of the
+// given id. A session rotated by a concurrent refresh hands out its latest
+// refresh token again instead of a new one.
+func (a *Auth) Reissue(userId uint, sessionID string, refreshTokenID string, refreshTokenExpDate time.Time) (*Jwt, error) {
+	now := time.Now()
+	accessTokenExpDate := now.Add(a.cfg.AccessTokenTTL)
+
+	AccessToken, err := a.sign(userId, sessionID, accessToken, uuid.NewString(), now, accessTokenExpDate)
 	if err != nil {
-		return nil, tools.JWT_FAILED_TO_SIGN
+		return nil, apperr.ErrTokenSign.Wrap(err)
 	}
-	RefreshToken, err := refreshToken.SignedString(tools.JWT_SECRET)
+	RefreshToken, err := a.sign(userId, sessionID, refreshToken, refreshTokenID, now, refreshTokenExpDate)
 	if err != nil {
-		return nil, tools.JWT_FAILED_TO_SIGN
+		return nil, apperr.ErrTokenSign.Wrap(err)
 	}
 	return &Jwt{
 		AccessToken:         AccessToken,
 		RefreshToken:        RefreshToken,
-		AccessTokenExpDate:  time.Now().Add(accessTokenExpDate),
-		RefreshTokenExpDate: time.Now().Add(refreshTokenExpDate),
-	}, -1
+		AccessTokenExpDate:  accessTokenExpDate,
+		RefreshTokenExpDate: refreshTokenExpDate,
+		RefreshTokenID:      refreshTokenID,
+	}, nil
 }
 
-func Decode(token string, isRefresh bool) (jwt.Claims, int) {
-	t, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return tools.JWT_SECRET, nil
+func (a *Auth) sign(userId uint, sessionID string, tokenType string, id string, now time.Time, expires time.Time) (string, error) {
+	key, err := keyring.Ring.Signing()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method(), tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expires),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    a.cfg.JWTIssuer,
+			Subject:   fmt.Sprintf("%d", userId),
+			Audience:  jwt.ClaimStrings{a.audience(tokenType)},
+			ID:        id,
+		},
+		SessionID: sessionID,
+		Type:      tokenType,
 	})
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private())
+}
+
+// audience is the aud of a token type. Only access tokens are meant for
+// other services, the rest is addressed to the issuer itself so services
+// verifying with the JWKS cannot mistake them for access tokens.
+func (a *Auth) audience(tokenType string) string {
+	if tokenType == accessToken {
+		return a.cfg.JWTAudience
+	}
+	return a.cfg.JWTIssuer
+}
+
+// SignChallenge issues the token returned by the first step of a two-factor
+// sign in, it is exchanged for a session together with the second factor
+func (a *Auth) SignChallenge(userId uint) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(a.cfg.MFAChallengeTTL)
+	token, err := a.sign(userId, "", challengeToken, uuid.NewString(), now, expires)
 	if err != nil {
-		log.Info(err)
-		return nil, tools.JWT_FAILED_TO_DECODE
+		return "", time.Time{}, apperr.ErrTokenSign.Wrap(err)
+	}
+	return token, expires, nil
+}
+
+// Decode verifies a token and returns its claims. Whether a refresh token
+// is still the current one of its session is checked when it is rotated.
+func (a *Auth) Decode(token string, isRefresh bool) (jwt.Claims, error) {
+	want := accessToken
+	if isRefresh {
+		want = refreshToken
+	}
+	claims, err := a.parse(token, want)
+	if err != nil {
+		return nil, err
+	}
+	if SessionID(claims) == "" {
+		// Also rejects the tokens issued before sessions were introduced
+		return nil, apperr.ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+// RefreshSession returns the session of a valid refresh token, the empty
+// string for anything else
+func (a *Auth) RefreshSession(token string) string {
+	if token == "" {
+		return ""
+	}
+	claims, err := a.Decode(token, true)
+	if err != nil {
+		return ""
+	}
+	return SessionID(claims)
+}
+
+// DecodeChallenge verifies the token of the first step of a two-factor sign
+// in
+func (a *Auth) DecodeChallenge(token string) (jwt.Claims, error) {
+	return a.parse(token, challengeToken)
+}
+
+func (a *Auth) parse(token string, tokenType string) (jwt.Claims, error) {
+	t, err := jwt.Parse(token, verificationKey,
+		jwt.WithValidMethods(keyring.Algorithms),
+		jwt.WithIssuer(a.cfg.JWTIssuer),
+		jwt.WithAudience(a.audience(tokenType)),
+		jwt.WithExpirationRequired(),
+	)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, apperr.ErrTokenExpired.Wrap(err)
+	}
+	if err != nil {
+		authLog.Debug("failed to decode token", "error", err)
+		return nil, apperr.ErrTokenDecode.Wrap(err)
 	}
 	if !t.Valid {
-		rawExpireIn := t.Claims.(jwt.MapClaims)["exp"]
-		expireIn := time.Now().Unix() - rawExpireIn.(int64)
-		if expireIn > 0 {
-			return nil, tools.JWT_EXPIRED
-		} else {
-			return nil, tools.JWT_INVALID
-		}
+		return nil, apperr.ErrTokenInvalid
 	}
 
-	if isRefresh {
-		issuer, jwtErr := t.Claims.GetIssuer()
-		if jwtErr != nil {
-			return nil, tools.JWT_FAILED_TO_DECODE
-		}
-		if !strings.Contains(issuer, "Version") {
-			return nil, tools.JWT_INVALID
-		}
-		ver, err := strconv.ParseInt(strings.Split(issuer, " ")[0], 10, 0)
-		if err != nil {
-			return nil, tools.JWT_INVALID
-		}
-		userId, jwtErr := t.Claims.GetSubject()
-		if jwtErr != nil {
-			return nil, tools.JWT_FAILED_TO_DECODE
-		}
+	if claim(t.Claims, "typ") != tokenType || TokenID(t.Claims) == "" {
+		return nil, apperr.ErrTokenInvalid
+	}
+	return t.Claims, nil
+}
 
-		user, dbErr := handlers.DB.GetUserByID(tools.ParseUInt(userId))
-		if dbErr != -1 {
-			return nil, dbErr
-		}
+// verificationKey returns the public key named by the kid header. The
+// algorithm is pinned to the one of the key, so a token cannot choose how
+// it is verified.
+func verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, err := keyring.Ring.Verifying(kid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token signed with %s, key %s is %s", t.Method.Alg(), kid, key.Algorithm)
+	}
+	return key.Public(), nil
+}
 
-		if user.RefreshTokenVersion != int(ver) {
-			return nil, tools.JWT_INVALID
-		}
+// Authenticate verifies an access token and checks that it was not revoked
+// by signing out since it was issued
+func (a *Auth) Authenticate(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, err := a.Decode(token, false)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := handlers.Cache.WithContext(ctx).IsTokenDenied(TokenID(claims), SessionID(claims))
+	if err != nil {
+		return nil, err
 	}
+	if denied {
+		return nil, apperr.ErrTokenRevoked
+	}
+	return claims, nil
+}
 
-	return t.Claims, -1
+// SessionID returns the session a token belongs to
+func SessionID(claims jwt.Claims) string {
+	return claim(claims, "sid")
 }
 
-func JwtGuardHandler(c *fiber.Ctx) error {
-	log.Info("Connected")
-	// Check if the request is authorized
-	// If not, return an error
-	token := c.Cookies("access_token")
-	log.Info("Token", token)
+// TokenID returns the jti of a token
+func TokenID(claims jwt.Claims) string {
+	return claim(claims, "jti")
+}
+
+func claim(claims jwt.Claims, name string) string {
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	value, _ := mapClaims[name].(string)
+	return value
+}
+
+// JwtGuardHandler lets requests with the access token cookie through, API
+// keys only pass the routes guarded with Scoped
+func (a *Auth) JwtGuardHandler(c *fiber.Ctx) error {
+	return a.guard(c, "")
+}
+
+func (a *Auth) guard(c *fiber.Ctx, scope string) error {
+	if key := tools.HeaderParser(c); key != "" {
+		if err := a.authenticateKey(c, key, scope); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+
+	token := a.cookies.Get(c, tools.AccessTokenCookie)
 	if token == "" {
-		refresh_token := c.Cookies("refresh_token")
+		refresh_token := a.cookies.Get(c, tools.RefreshTokenCookie)
 		if refresh_token == "" {
-			return tools.ReturnData(c, 401, nil, tools.JWT_NO_KEY)
+			return apperr.ErrNoToken
 		}
-		return c.Redirect("/auth/refresh", 307)
+		return c.Redirect(apiversion.Prefix(c)+"/auth/refresh", 307)
 	}
-	claims, err := Decode(token, false)
-	if err != -1 {
-		log.Info("Failed to decode token ", err)
-		return tools.ReturnData(c, 401, nil, err)
+	claims, err := a.Authenticate(c.UserContext(), token)
+	if err != nil {
+		return err
 	}
 
-	log.Info(claims)
-
 	c.Locals("claims", claims)
 	c.Locals("isAuthorized", true)
+	if userId, jwtErr := claims.GetSubject(); jwtErr == nil {
+		c.SetUserContext(audit.WithActor(c.UserContext(), audit.UserActor(c, tools.ParseUInt(userId))))
+	}
 
 	return c.Next()
 }
+
+// AdminGuardHandler only lets admins and the users listed in MASTER_IDS
+// through, it has to run after JwtGuardHandler
+func (a *Auth) AdminGuardHandler(c *fiber.Ctx) error {
+	admin, err := a.IsAdmin(c)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return apperr.ErrForbidden
+	}
+	if a.cfg.AdminRequireMFA {
+		if err := requireMFA(c); err != nil {
+			return err
+		}
+	}
+	return c.Next()
+}
+
+// requireMFA denies the request unless the signed in user enabled
+// two-factor authentication
+func requireMFA(c *fiber.Ctx) error {
+	userId, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(userId))
+	if errors.Is(err, apperr.ErrRecordNotFound) {
+		return apperr.ErrTokenInvalid.Wrap(err)
+	}
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return apperr.ErrMFARequired
+	}
+	return nil
+}
+
+// IsAdmin reports whether the signed in user is an admin or listed in
+// MASTER_IDS, it has to run after JwtGuardHandler
+func (a *Auth) IsAdmin(c *fiber.Ctx) (bool, error) {
+	claims, ok := c.Locals("claims").(jwt.Claims)
+	if !ok {
+		return false, apperr.ErrTokenInvalid
+	}
+	userId, jwtErr := claims.GetSubject()
+	if jwtErr != nil {
+		return false, apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+
+	if a.cfg.IsMaster(userId) {
+		return true, nil
+	}
+
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(userId))
+	if errors.Is(err, apperr.ErrRecordNotFound) {
+		return false, apperr.ErrTokenInvalid.Wrap(err)
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.Role == customTypes.RoleAdmin, nil
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/database/dbtest"
+	"gambler/backend/database/redistest"
+	"gambler/backend/handlers"
+	"gambler/backend/keyring"
+	"gambler/backend/tools"
+	"testing"
+	"time"
+)
+
+var testAuthConfig = config.AuthConfig{
+	JWTSecret:       "jwt-secret",
+	JWTAlgorithm:    keyring.EdDSA,
+	JWTKeyRotation:  time.Hour,
+	JWTIssuer:       "gambler",
+	JWTAudience:     "gambler-api",
+	AccessTokenTTL:  time.Minute,
+	RefreshTokenTTL: time.Hour,
+}
+
+// TestAuthenticateDenylist signs out a token and a session, their access
+// tokens are refused while the others still pass
+func TestAuthenticateDenylist(t *testing.T) {
+	useSigningKey(t)
+	handlers.NewCache(redistest.New(t).Config())
+	auth := NewAuth(testAuthConfig, tools.NewCookies(config.CookieConfig{}))
+
+	sign := func(sessionID string) (string, string) {
+		tokens, err := auth.Sign(7, sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := auth.Decode(tokens.AccessToken, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens.AccessToken, TokenID(claims)
+	}
+	loggedOut, loggedOutID := sign("s1")
+	sameSession, _ := sign("s1")
+	revoked, _ := sign("s2")
+	active, _ := sign("s3")
+
+	if err := handlers.Cache.DenyToken(loggedOutID, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := handlers.Cache.DenySessions([]string{"s2"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   *apperr.Error
+	}{
+		{"denied jti", loggedOut, apperr.ErrTokenRevoked},
+		{"other token of the session", sameSession, nil},
+		{"denied session", revoked, apperr.ErrTokenRevoked},
+		{"active session", active, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.Authenticate(context.Background(), tt.token)
+			if tt.err == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// useSigningKey sets up keyring.Ring with a key stored in a fake database
+func useSigningKey(t *testing.T) {
+	t.Helper()
+	db := dbtest.New(t)
+	var rows [][]driver.Value
+	db.Handle(`SELECT * FROM "signing_keys"`, func(*dbtest.Statement) (dbtest.Result, error) {
+		return dbtest.Result{Columns: []string{"id", "created_at", "algorithm", "private_key", "expires_at"}, Rows: rows}, nil
+	})
+	db.Answer(`SELECT count(*) FROM "signing_keys"`, dbtest.Result{Columns: []string{"count"}, Rows: [][]driver.Value{{int64(0)}}})
+	db.Answer(`SELECT "id" FROM "signing_keys"`, dbtest.Result{})
+	db.Answer(`DELETE FROM "signing_keys"`, dbtest.Result{})
+	db.Handle(`INSERT INTO "signing_keys"`, func(s *dbtest.Statement) (dbtest.Result, error) {
+		row := []driver.Value{s.Arg(1), s.Arg(2), s.Arg(3), s.Arg(4), nil}
+		s.OnCommit(func() { rows = append(rows, row) })
+		return dbtest.Result{Affected: 1}, nil
+	})
+	handlers.DB = handlers.DBHandler{DB: db.Gorm(t)}
+
+	ring, err := keyring.New(testAuthConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	keyring.Ring = ring
+}
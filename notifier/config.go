@@ -0,0 +1,55 @@
+package notifier
+
+import (
+	"fmt"
+	"gambler/backend/config"
+	"os"
+)
+
+// New builds a dispatcher for every destination set in the configuration
+func New(cfg config.AlertingConfig) (*Dispatcher, error) {
+	minSeverity, ok := ParseSeverity(cfg.MinSeverity)
+	if !ok {
+		return nil, fmt.Errorf("unknown severity %q", cfg.MinSeverity)
+	}
+
+	notifiers := []Notifier{}
+	closers := []*os.File{}
+	if cfg.DiscordWebhookURL != "" {
+		notifiers = append(notifiers, DiscordNotifier{WebhookURL: cfg.DiscordWebhookURL})
+	}
+	if cfg.SlackWebhookURL != "" {
+		notifiers = append(notifiers, SlackNotifier{WebhookURL: cfg.SlackWebhookURL})
+	}
+	if cfg.HTTPURL != "" {
+		headers := map[string]string{}
+		if cfg.HTTPAuthorization != "" {
+			headers["Authorization"] = cfg.HTTPAuthorization
+		}
+		notifiers = append(notifiers, HTTPNotifier{URL: cfg.HTTPURL, Headers: headers})
+	}
+	switch cfg.File {
+	case "":
+	case "stdout":
+		notifiers = append(notifiers, &WriterNotifier{Target: "stdout", W: os.Stdout})
+	default:
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open alert file: %w", err)
+		}
+		closers = append(closers, file)
+		notifiers = append(notifiers, &WriterNotifier{Target: "file", W: file})
+	}
+
+	d := NewDispatcher(DispatcherConfig{
+		MinSeverity:  minSeverity,
+		QueueSize:    cfg.QueueSize,
+		MaxRetries:   cfg.MaxRetries,
+		RetryBackoff: cfg.RetryBackoff,
+		DedupWindow:  cfg.DedupWindow,
+	}, notifiers...)
+	for _, c := range closers {
+		d.closers = append(d.closers, c)
+	}
+	return d, nil
+}
@@ -0,0 +1,38 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// discordLimit is the maximum length of a Discord message
+const discordLimit = 2000
+
+// DiscordNotifier posts alerts to a Discord channel webhook
+type DiscordNotifier struct {
+	WebhookURL string
+}
+
+func (n DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (n DiscordNotifier) Notify(ctx context.Context, alert Alert) error {
+	content := fmt.Sprintf("----\n**%s:** %s\n**Source:** %s", capitalize(alert.Severity.String()), alert.Message, alert.Source)
+	if alert.Repeated > 0 {
+		content += fmt.Sprintf("\n**Repeated:** %d more times", alert.Repeated)
+	}
+	if len(content) > discordLimit {
+		content = content[:discordLimit]
+	}
+
+	return postJSON(ctx, n.WebhookURL, map[string]string{"content": content}, nil)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,244 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+type (
+	DispatcherConfig struct {
+		// MinSeverity drops alerts below this level
+		MinSeverity Severity
+		// QueueSize is the number of alerts buffered before new ones are dropped
+		QueueSize int
+		// MaxRetries is the number of extra attempts per notifier
+		MaxRetries int
+		// RetryBackoff is the delay before the first retry, doubled each time
+		RetryBackoff time.Duration
+		// DedupWindow is the period in which identical alerts are only
+		// delivered once, the suppressed ones are counted instead
+		DedupWindow time.Duration
+	}
+
+	// Dispatcher delivers alerts asynchronously to every notifier, so
+	// callers on the request path never wait for a webhook. Every notifier
+	// has a queue and worker of its own, a destination that is down does
+	// not hold up the others.
+	Dispatcher struct {
+		cfg       DispatcherConfig
+		notifiers []Notifier
+		queue     chan Alert
+		outboxes  []chan Alert
+		done      chan struct{}
+		closers   []io.Closer
+
+		// ctx is canceled when a flush runs out of time, which ends the
+		// pending deliveries and retries
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		mu     sync.Mutex
+		closed bool
+		seen   map[string]*seenAlert
+	}
+
+	seenAlert struct {
+		alert      Alert
+		suppressed int
+	}
+)
+
+const maxBackoff = time.Minute
+
+func NewDispatcher(cfg DispatcherConfig, notifiers ...Notifier) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		cfg:       cfg,
+		notifiers: notifiers,
+		queue:     make(chan Alert, cfg.QueueSize),
+		done:      make(chan struct{}),
+		seen:      map[string]*seenAlert{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	for range notifiers {
+		d.outboxes = append(d.outboxes, make(chan Alert, cfg.QueueSize))
+	}
+	return d
+}
+
+// Start runs the dispatching and a delivery worker per notifier in the
+// background
+func (d *Dispatcher) Start() {
+	var workers sync.WaitGroup
+	for i, n := range d.notifiers {
+		workers.Add(1)
+		go func(n Notifier, outbox <-chan Alert) {
+			defer workers.Done()
+			for alert := range outbox {
+				d.deliver(n, alert)
+			}
+		}(n, d.outboxes[i])
+	}
+
+	go func() {
+		defer close(d.done)
+		d.work()
+		for _, outbox := range d.outboxes {
+			close(outbox)
+		}
+		workers.Wait()
+		for _, c := range d.closers {
+			c.Close()
+		}
+	}()
+}
+
+// Enqueue accepts an alert for delivery without blocking
+func (d *Dispatcher) Enqueue(alert Alert) {
+	if alert.Severity < d.cfg.MinSeverity {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		notifierLog.Warn("dispatcher closed, dropping alert", "message", alert.Message)
+		return
+	}
+	d.evict(alert.Time, false)
+	if !d.admit(alert) {
+		return
+	}
+	d.push(alert)
+}
+
+// push queues an alert, it has to be called with mu held while the
+// dispatcher is open
+func (d *Dispatcher) push(alert Alert) {
+	select {
+	case d.queue <- alert:
+	default:
+		notifierLog.Warn("queue full, dropping alert", "message", alert.Message)
+	}
+}
+
+// admit applies deduplication, it has to be called with mu held
+func (d *Dispatcher) admit(alert Alert) bool {
+	key := alert.Severity.String() + "|" + alert.Source + "|" + alert.Message
+	if seen, ok := d.seen[key]; ok {
+		seen.suppressed++
+		return false
+	}
+	d.seen[key] = &seenAlert{alert: alert}
+	return true
+}
+
+// evict forgets the alerts whose window has passed at now, or all of them
+// with force, so the map does not grow forever. Alerts that were suppressed
+// in the meantime are delivered once more with the number of repeats. It
+// has to be called with mu held while the dispatcher is open.
+func (d *Dispatcher) evict(now time.Time, force bool) {
+	for key, seen := range d.seen {
+		if !force && now.Sub(seen.alert.Time) < d.cfg.DedupWindow {
+			continue
+		}
+		delete(d.seen, key)
+		if seen.suppressed > 0 {
+			repeat := seen.alert
+			repeat.Time = now
+			repeat.Repeated = seen.suppressed
+			d.push(repeat)
+		}
+	}
+}
+
+// work deduplicates the queued alerts and hands them to the notifiers
+// until the queue is closed
+func (d *Dispatcher) work() {
+	// Repeat counts are also delivered while no new alerts come in
+	var tick <-chan time.Time
+	if d.cfg.DedupWindow > 0 {
+		ticker := time.NewTicker(d.cfg.DedupWindow)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case alert, ok := <-d.queue:
+			if !ok {
+				return
+			}
+			for i, outbox := range d.outboxes {
+				select {
+				case outbox <- alert:
+				default:
+					notifierLog.Warn("notifier queue full, dropping alert", "notifier", d.notifiers[i].Name(), "message", alert.Message)
+				}
+			}
+		case now := <-tick:
+			d.mu.Lock()
+			if !d.closed {
+				d.evict(now, false)
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(n Notifier, alert Alert) {
+	backoff := d.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(d.ctx, 15*time.Second)
+		err := n.Notify(ctx, alert)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		var permanent permanentError
+		if errors.As(err, &permanent) || attempt >= d.cfg.MaxRetries || d.ctx.Err() != nil {
+			notifierLog.Error("failed to deliver alert", "notifier", n.Name(), "error", err)
+			return
+		}
+
+		notifierLog.Warn("alert delivery failed, retrying", "notifier", n.Name(), "backoff", backoff.String(), "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			notifierLog.Error("dispatcher stopped, dropping alert", "notifier", n.Name(), "message", alert.Message)
+			return
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Flush stops accepting alerts and waits until the queued ones and the
+// pending repeat counts are delivered. When ctx expires first, the pending
+// deliveries are abandoned.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.evict(time.Now(), true)
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return ctx.Err()
+	}
+}
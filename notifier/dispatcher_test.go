@@ -0,0 +1,228 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endpoint is an alert receiver answering with the queued status codes,
+// 200 once they are used up
+type endpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	times    []time.Time
+	alerts   []Alert
+}
+
+func newEndpoint(t *testing.T, statuses ...int) (*endpoint, HTTPNotifier) {
+	e := &endpoint{statuses: statuses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Message  string `json:"message"`
+			Source   string `json:"source"`
+			Repeated int    `json:"repeated"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.times = append(e.times, time.Now())
+		e.alerts = append(e.alerts, Alert{Message: body.Message, Source: body.Source, Repeated: body.Repeated})
+		status := http.StatusOK
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return e, HTTPNotifier{URL: server.URL}
+}
+
+func (e *endpoint) received() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Alert(nil), e.alerts...)
+}
+
+func flush(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{"delivered", nil, 1},
+		{"server error is retried", []int{500, 502}, 3},
+		{"rate limit is retried", []int{429}, 2},
+		{"client error is permanent", []int{400}, 1},
+		{"gives up after the retries", []int{500, 500, 500, 500, 500}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, n := newEndpoint(t, tt.statuses...)
+			d := NewDispatcher(DispatcherConfig{QueueSize: 1, MaxRetries: 3, RetryBackoff: time.Millisecond}, n)
+
+			d.deliver(n, Alert{Message: "db down", Time: time.Now()})
+			if got := len(e.received()); got != tt.attempts {
+				t.Fatalf("attempts = %d, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestDeliverBackoffDoubles(t *testing.T) {
+	e, n := newEndpoint(t, 500, 500, 500)
+	backoff := 20 * time.Millisecond
+	d := NewDispatcher(DispatcherConfig{QueueSize: 1, MaxRetries: 3, RetryBackoff: backoff}, n)
+
+	d.deliver(n, Alert{Message: "db down", Time: time.Now()})
+	if len(e.times) != 4 {
+		t.Fatalf("attempts = %d, want 4", len(e.times))
+	}
+	for i := 1; i < len(e.times); i++ {
+		if gap := e.times[i].Sub(e.times[i-1]); gap < backoff {
+			t.Errorf("gap before attempt %d = %s, want at least %s", i+1, gap, backoff)
+		}
+		backoff *= 2
+	}
+}
+
+func TestDedup(t *testing.T) {
+	e, n := newEndpoint(t)
+	d := NewDispatcher(DispatcherConfig{QueueSize: 10, DedupWindow: time.Minute}, n)
+	d.Start()
+
+	start := time.Now()
+	alert := func(message string, after time.Duration) Alert {
+		return Alert{Severity: Error, Message: message, Source: "test", Time: start.Add(after)}
+	}
+	d.Enqueue(alert("db down", 0))
+	d.Enqueue(alert("db down", time.Second))
+	d.Enqueue(alert("db down", 2*time.Second))
+	d.Enqueue(alert("cache down", 3*time.Second))
+	// Leaves the window of both, db down is summed up and forgotten
+	d.Enqueue(alert("disk full", 2*time.Minute))
+
+	d.mu.Lock()
+	seen := len(d.seen)
+	d.mu.Unlock()
+	if seen != 1 {
+		t.Errorf("%d alerts remembered, want 1", seen)
+	}
+	flush(t, d)
+
+	want := []Alert{
+		{Message: "db down"},
+		{Message: "cache down"},
+		{Message: "db down", Repeated: 2},
+		{Message: "disk full"},
+	}
+	got := e.received()
+	if len(got) != len(want) {
+		t.Fatalf("received %d alerts, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Message != want[i].Message || got[i].Repeated != want[i].Repeated {
+			t.Errorf("alert %d = %q repeated %d, want %q repeated %d", i, got[i].Message, got[i].Repeated, want[i].Message, want[i].Repeated)
+		}
+	}
+}
+
+func TestFlushDeliversRepeatCounts(t *testing.T) {
+	e, n := newEndpoint(t)
+	d := NewDispatcher(DispatcherConfig{QueueSize: 10, DedupWindow: time.Hour}, n)
+	d.Start()
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		d.Enqueue(Alert{Severity: Error, Message: "db down", Time: now.Add(time.Duration(i) * time.Second)})
+	}
+	flush(t, d)
+
+	got := e.received()
+	if len(got) != 2 || got[1].Repeated != 3 {
+		t.Fatalf("received %+v, want the alert and a repeat count of 3", got)
+	}
+}
+
+func TestEnqueueDrops(t *testing.T) {
+	_, n := newEndpoint(t)
+	d := NewDispatcher(DispatcherConfig{MinSeverity: Warning, QueueSize: 2}, n)
+
+	now := time.Now()
+	d.Enqueue(Alert{Severity: Info, Message: "below the minimum", Time: now})
+	for _, message := range []string{"one", "two", "three"} {
+		d.Enqueue(Alert{Severity: Error, Message: message, Time: now})
+	}
+	if len(d.queue) != 2 {
+		t.Fatalf("queued %d alerts, want 2", len(d.queue))
+	}
+	if alert := <-d.queue; alert.Message != "one" {
+		t.Errorf("first queued alert = %q, want one", alert.Message)
+	}
+}
+
+// TestSlowNotifierDoesNotBlock keeps one destination retrying while the
+// other gets the alerts
+func TestSlowNotifierDoesNotBlock(t *testing.T) {
+	_, down := newEndpoint(t, 500, 500, 500, 500)
+	up, healthy := newEndpoint(t)
+	d := NewDispatcher(DispatcherConfig{QueueSize: 10, MaxRetries: 3, RetryBackoff: time.Hour}, down, healthy)
+	d.Start()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		d.Flush(ctx)
+	}()
+
+	d.Enqueue(Alert{Severity: Error, Message: "db down", Time: time.Now()})
+	d.Enqueue(Alert{Severity: Error, Message: "cache down", Time: time.Now()})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(up.received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := up.received(); len(got) != 2 {
+		t.Fatalf("healthy notifier received %+v while the other retried, want both alerts", got)
+	}
+}
+
+// TestFlushAbortsBackoff gives up on the retries when the flush runs out of
+// time, the workers do not sleep through the shutdown
+func TestFlushAbortsBackoff(t *testing.T) {
+	e, n := newEndpoint(t, 500, 500, 500, 500)
+	d := NewDispatcher(DispatcherConfig{QueueSize: 1, MaxRetries: 3, RetryBackoff: time.Hour}, n)
+	d.Start()
+	d.Enqueue(Alert{Severity: Error, Message: "db down", Time: time.Now()})
+	for len(e.received()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Flush(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("flush = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-d.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("workers still waiting for the retry after the flush")
+	}
+	if got := len(e.received()); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
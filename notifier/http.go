@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// permanentError marks a delivery failure that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON sends payload to url, treating 4xx answers other than 429 as
+// permanent failures
+func postJSON(ctx context.Context, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return permanentError{err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+// HTTPNotifier posts the alert as JSON to any endpoint
+type HTTPNotifier struct {
+	URL     string
+	Headers map[string]string
+}
+
+func (n HTTPNotifier) Name() string {
+	return "http"
+}
+
+func (n HTTPNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.URL, struct {
+		Alert
+		Severity string `json:"severity"`
+		Text     string `json:"text"`
+	}{alert, alert.Severity.String(), alert.Text()}, n.Headers)
+}
@@ -0,0 +1,100 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"gambler/backend/logging"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+	Critical
+)
+
+var severityNames = map[Severity]string{
+	Info:     "info",
+	Warning:  "warning",
+	Error:    "error",
+	Critical: "critical",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseSeverity converts a severity name such as "warning" into a Severity
+func ParseSeverity(s string) (Severity, bool) {
+	for severity, name := range severityNames {
+		if strings.EqualFold(name, s) {
+			return severity, true
+		}
+	}
+	return Info, false
+}
+
+type (
+	// Alert is a single operational event worth telling a human about
+	Alert struct {
+		Severity Severity  `json:"severity"`
+		Message  string    `json:"message"`
+		Source   string    `json:"source"`
+		Time     time.Time `json:"time"`
+		// Repeated is the number of identical alerts suppressed since the
+		// last time this one was delivered
+		Repeated int `json:"repeated,omitempty"`
+	}
+
+	// Notifier delivers alerts to one destination
+	Notifier interface {
+		Name() string
+		Notify(ctx context.Context, alert Alert) error
+	}
+)
+
+// Text renders the alert as a short human readable message
+func (a Alert) Text() string {
+	text := fmt.Sprintf("[%s] %s\nSource: %s", strings.ToUpper(a.Severity.String()), a.Message, a.Source)
+	if a.Repeated > 0 {
+		text += fmt.Sprintf("\nRepeated %d more times", a.Repeated)
+	}
+	return text
+}
+
+var (
+	Alerts *Dispatcher
+
+	notifierLog = logging.For("notifier")
+)
+
+// Notify queues an alert on the global dispatcher, recording the caller as
+// its source. Without a dispatcher the alert is only logged.
+func Notify(severity Severity, format string, a ...interface{}) {
+	source := "unknown"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		source = fmt.Sprintf("%s:%d", file, line)
+	}
+
+	alert := Alert{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, a...),
+		Source:   source,
+		Time:     time.Now(),
+	}
+
+	if Alerts == nil {
+		notifierLog.Warn("no dispatcher configured, dropping alert", "message", alert.Message)
+		return
+	}
+	Alerts.Enqueue(alert)
+}
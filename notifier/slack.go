@@ -0,0 +1,24 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+)
+
+// SlackNotifier posts alerts to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+}
+
+func (n SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (n SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	text := fmt.Sprintf("*%s*: %s\n_Source: %s_", alert.Severity, alert.Message, alert.Source)
+	if alert.Repeated > 0 {
+		text += fmt.Sprintf("\n_Repeated %d more times_", alert.Repeated)
+	}
+
+	return postJSON(ctx, n.WebhookURL, map[string]string{"text": text}, nil)
+}
@@ -0,0 +1,35 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// WriterNotifier writes every alert as a JSON line, used for stdout and
+// files during local development
+type WriterNotifier struct {
+	Target string
+	W      io.Writer
+	mu     sync.Mutex
+}
+
+func (n *WriterNotifier) Name() string {
+	return n.Target
+}
+
+func (n *WriterNotifier) Notify(ctx context.Context, alert Alert) error {
+	line, err := json.Marshal(struct {
+		Alert
+		Severity string `json:"severity"`
+	}{alert, alert.Severity.String()})
+	if err != nil {
+		return permanentError{err}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.W.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,152 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+type (
+	// keySet holds the signing keys published by the provider by kid
+	keySet struct {
+		keys      map[string]interface{}
+		fetchedAt time.Time
+	}
+
+	jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+)
+
+// minKeyRefresh bounds how often an unknown kid makes the keys load again,
+// so tokens with made up kids cannot flood the provider
+const minKeyRefresh = time.Minute
+
+// key returns the public key an ID token names. Providers rotate keys, so an
+// unknown kid loads the set again.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil {
+		if key, ok := p.keys.lookup(kid); ok {
+			return key, nil
+		}
+		if time.Since(p.keys.fetchedAt) < minKeyRefresh {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := p.do(req, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("loading the signing keys failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("signing keys answered %d", status)
+	}
+
+	set := &keySet{keys: map[string]interface{}{}, fetchedAt: time.Now()}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			oidcLog.WarnContext(ctx, "skipping signing key", "kid", k.Kid, "error", err)
+			continue
+		}
+		set.keys[k.Kid] = key
+	}
+	p.keys = set
+
+	if key, ok := set.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds the key of a kid, a token without kid is accepted when the
+// provider publishes a single key
+func (s *keySet) lookup(kid string) (interface{}, bool) {
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("unsupported RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("malformed key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
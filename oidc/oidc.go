@@ -0,0 +1,261 @@
+// Package oidc signs users in with an OpenID Connect identity provider using
+// the authorization code flow with PKCE. It discovers the endpoints of the
+// provider and checks ID tokens against its published keys, so nothing but
+// the issuer URL and the client has to be configured.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gambler/backend/config"
+	"gambler/backend/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type (
+	// Provider is the identity provider of the configuration
+	Provider struct {
+		cfg    config.OIDCConfig
+		client *http.Client
+
+		mu       sync.Mutex
+		metadata *metadata
+		keys     *keySet
+	}
+
+	// metadata is the part of the discovery document the login needs
+	metadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	// Identity is the user described by a verified ID token
+	Identity struct {
+		Issuer            string
+		Subject           string
+		Email             string
+		EmailVerified     bool
+		Name              string
+		PreferredUsername string
+		Groups            []string
+	}
+
+	tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+)
+
+// signingMethods are the algorithms accepted for ID tokens. HS256 is left
+// out on purpose, it would make the client secret a signing key.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// maxResponse bounds the documents read from the provider
+const maxResponse = 1 << 20
+
+var oidcLog = logging.For("oidc")
+
+// New creates the provider of the configuration. The endpoints are
+// discovered on the first sign in, so the service starts while the provider
+// is unreachable.
+func New(cfg config.OIDCConfig) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// AuthCodeURL returns the URL of the provider the browser is sent to. state
+// ties the callback to this browser, nonce the ID token to this sign in.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("malformed authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems the code of the callback and returns the identity of its
+// verified ID token
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (*Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.cfg.ClientSecret == "" {
+		// A public client only names itself, PKCE proves the sign in
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic, both parts are form encoded first
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens tokenResponse
+	status, err := p.do(req, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	if status != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint answered %d: %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return p.verify(ctx, meta, tokens.IDToken, nonce)
+}
+
+// verify checks the signature, issuer, audience, lifetime and nonce of an
+// ID token
+func (p *Provider) verify(ctx context.Context, meta *metadata, raw string, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	// With several audiences the token must be meant for this client
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, errors.New("id token was issued to another client")
+		}
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	identity := &Identity{Issuer: meta.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		// Some providers send the boolean as a string
+		identity.EmailVerified = verified == "true"
+	}
+	if p.cfg.GroupsClaim != "" {
+		identity.Groups = stringList(claims[p.cfg.GroupsClaim])
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return identity, nil
+}
+
+// discover loads the discovery document once. A failure is not cached, the
+// next sign in tries again.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	status, err := p.do(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery answered %d", status)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document is for the issuer %q", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery document misses endpoints")
+	}
+	oidcLog.InfoContext(ctx, "discovered identity provider", "issuer", meta.Issuer)
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// do sends a request and decodes the JSON answer whatever its status
+func (p *Provider) do(req *http.Request, out interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, out); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("malformed answer: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// stringList reads a claim holding a list of strings or a single string
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,482 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gambler/backend/config"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	clientID    = "gambler"
+	redirectURL = "http://localhost:8080/v1/auth/oidc/callback"
+)
+
+type (
+	// issuer is an identity provider that authorizes every request and
+	// checks the token requests like a real one would
+	issuer struct {
+		*httptest.Server
+		secret string
+		key    *rsa.PrivateKey
+		kid    string
+
+		mu     sync.Mutex
+		grants map[string]grant
+	}
+
+	grant struct {
+		challenge   string
+		nonce       string
+		redirectURI string
+	}
+)
+
+func newIssuer(t *testing.T, secret string) *issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &issuer{secret: secret, key: key, kid: "k1", grants: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 i.URL,
+			"authorization_endpoint": i.URL + "/authorize",
+			"token_endpoint":         i.URL + "/token",
+			"jwks_uri":               i.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": i.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", i.authorize)
+	mux.HandleFunc("/token", i.token)
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+	return i
+}
+
+func (i *issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != clientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	i.mu.Lock()
+	code := fmt.Sprintf("code-%d", len(i.grants)+1)
+	i.grants[code] = grant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri")}
+	i.mu.Unlock()
+
+	callback, _ := url.Parse(q.Get("redirect_uri"))
+	callback.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (i *issuer) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(reason string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": reason})
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		fail("malformed request")
+		return
+	}
+	if i.secret != "" {
+		id, secret, _ := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if id != clientID || secret != i.secret {
+			fail("client authentication failed")
+			return
+		}
+	} else if r.PostForm.Get("client_id") != clientID {
+		fail("unknown client")
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.grants[r.PostForm.Get("code")]
+	delete(i.grants, r.PostForm.Get("code"))
+	i.mu.Unlock()
+	if !ok {
+		fail("unknown or used code")
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != g.redirectURI {
+		fail("redirect_uri differs")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		fail("code_verifier does not match the challenge")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": i.idToken(g.nonce)})
+}
+
+// claims are the claims of an ID token for the nonce
+func (i *issuer) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                i.URL,
+		"aud":                clientID,
+		"sub":                "248289761001",
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              nonce,
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"name":               "Jane Doe",
+		"preferred_username": "jane",
+		"groups":             []string{"staff", "gambler-admins"},
+	}
+}
+
+func (i *issuer) idToken(nonce string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, i.claims(nonce))
+	i.mu.Lock()
+	token.Header["kid"] = i.kid
+	key := i.key
+	i.mu.Unlock()
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (i *issuer) provider(secret string) *Provider {
+	return New(config.OIDCConfig{
+		Issuer:       i.URL + "/",
+		ClientID:     clientID,
+		ClientSecret: secret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "profile", "email"},
+		GroupsClaim:  "groups",
+		Timeout:      5 * time.Second,
+	})
+}
+
+// signIn starts a sign in and follows the browser to the callback, it
+// returns the code and the state of the callback
+func (i *issuer) signIn(t *testing.T, p *Provider, state, nonce, verifier string) (string, string) {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := browser.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization answered %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(callback.String(), redirectURL+"?") {
+		t.Fatalf("callback %s, want %s", callback, redirectURL)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	i := newIssuer(t, "")
+	authURL, err := i.provider("").AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != i.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s, want the discovered one", got)
+	}
+	sum := sha256.Sum256([]byte("the-verifier"))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"redirect_uri":          redirectURL,
+		"scope":                 "openid profile email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if u.Query().Has("code_verifier") {
+		t.Error("the verifier is sent to the browser")
+	}
+}
+
+func TestSignIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"public client", ""},
+		{"confidential client", "s3cr+t/="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newIssuer(t, tt.secret)
+			p := i.provider(tt.secret)
+
+			code, state := i.signIn(t, p, "the-state", "the-nonce", "the-verifier")
+			if state != "the-state" {
+				t.Errorf("callback state = %q, want the-state", state)
+			}
+			identity, err := p.Exchange(context.Background(), code, "the-verifier", "the-nonce")
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			want := Identity{
+				Issuer:            i.URL,
+				Subject:           "248289761001",
+				Email:             "jane@example.com",
+				EmailVerified:     true,
+				Name:              "Jane Doe",
+				PreferredUsername: "jane",
+				Groups:            []string{"staff", "gambler-admins"},
+			}
+			if fmt.Sprint(*identity) != fmt.Sprint(want) {
+				t.Errorf("identity = %+v, want %+v", *identity, want)
+			}
+
+			// Codes work once
+			if _, err := p.Exchange(context.Background(), code, "the-verifier", "the-nonce"); err == nil {
+				t.Error("a used code was exchanged again")
+			}
+		})
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		verifier string
+		nonce    string
+		code     string
+	}{
+		{name: "verifier of another sign in", verifier: "other-verifier", nonce: "the-nonce"},
+		{name: "nonce of another sign in", verifier: "the-verifier", nonce: "other-nonce"},
+		{name: "unknown code", verifier: "the-verifier", nonce: "the-nonce", code: "made-up"},
+		{name: "wrong client secret", secret: "wrong", verifier: "the-verifier", nonce: "the-nonce"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newIssuer(t, "s3cret")
+			secret := "s3cret"
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+			p := i.provider(secret)
+
+			code, _ := i.signIn(t, p, "the-state", "the-nonce", "the-verifier")
+			if tt.code != "" {
+				code = tt.code
+			}
+			if identity, err := p.Exchange(context.Background(), code, tt.verifier, tt.nonce); err == nil {
+				t.Fatalf("Exchange = %+v, want an error", identity)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	i := newIssuer(t, "")
+	p := i.provider("")
+	meta, err := p.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name string
+		// edit changes the claims, token signs them differently
+		edit  func(jwt.MapClaims)
+		token func(jwt.MapClaims) string
+		check func(*Identity) bool
+		ok    bool
+	}{
+		{name: "valid", ok: true},
+		{name: "expired", edit: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }},
+		{name: "without expiry", edit: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "issued in the future", edit: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "other issuer", edit: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "other audience", edit: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "several audiences without azp", edit: func(c jwt.MapClaims) { c["aud"] = []string{clientID, "other-client"} }},
+		{name: "several audiences for this client", ok: true, edit: func(c jwt.MapClaims) {
+			c["aud"] = []string{clientID, "other-client"}
+			c["azp"] = clientID
+		}},
+		{name: "several audiences for another client", edit: func(c jwt.MapClaims) {
+			c["aud"] = []string{clientID, "other-client"}
+			c["azp"] = "other-client"
+		}},
+		{name: "without nonce", edit: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "without subject", edit: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "signed with the client id as HMAC key", token: func(c jwt.MapClaims) string {
+			return sign(jwt.SigningMethodHS256, []byte(clientID), i.kid, c)
+		}},
+		{name: "signed by another key", token: func(c jwt.MapClaims) string {
+			return sign(jwt.SigningMethodES256, ecKey, i.kid, c)
+		}},
+		{name: "unknown kid", token: func(c jwt.MapClaims) string {
+			return sign(jwt.SigningMethodRS256, i.key, "k9", c)
+		}},
+		{name: "unsigned", token: func(c jwt.MapClaims) string {
+			return sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, i.kid, c)
+		}},
+		{name: "email_verified as a string", ok: true,
+			edit:  func(c jwt.MapClaims) { c["email_verified"] = "true" },
+			check: func(id *Identity) bool { return id.EmailVerified }},
+		{name: "unverified email", ok: true,
+			edit:  func(c jwt.MapClaims) { c["email_verified"] = false },
+			check: func(id *Identity) bool { return !id.EmailVerified }},
+		{name: "single group", ok: true,
+			edit:  func(c jwt.MapClaims) { c["groups"] = "gambler-admins" },
+			check: func(id *Identity) bool { return fmt.Sprint(id.Groups) == "[gambler-admins]" }},
+		{name: "without groups", ok: true,
+			edit:  func(c jwt.MapClaims) { delete(c, "groups") },
+			check: func(id *Identity) bool { return id.Groups == nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := i.claims("the-nonce")
+			if tt.edit != nil {
+				tt.edit(claims)
+			}
+			raw := sign(jwt.SigningMethodRS256, i.key, i.kid, claims)
+			if tt.token != nil {
+				raw = tt.token(claims)
+			}
+
+			identity, err := p.verify(context.Background(), meta, raw, "the-nonce")
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatalf("verify = %+v, want an error", identity)
+			}
+			if tt.check != nil && !tt.check(identity) {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	i := newIssuer(t, "")
+	p := i.provider("")
+	meta, err := p.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.verify(context.Background(), meta, i.idToken("n"), "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mu.Lock()
+	i.key, i.kid = key, "k2"
+	i.mu.Unlock()
+
+	// Right after loading the keys an unknown kid does not load them again
+	if _, err := p.verify(context.Background(), meta, i.idToken("n"), "n"); err == nil {
+		t.Fatal("token of an unknown kid verified before the keys were reloaded")
+	}
+	p.mu.Lock()
+	p.keys.fetchedAt = time.Now().Add(-minKeyRefresh)
+	p.mu.Unlock()
+	if _, err := p.verify(context.Background(), meta, i.idToken("n"), "n"); err != nil {
+		t.Fatalf("token of the rotated key: %v", err)
+	}
+}
+
+func TestDiscoverRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  func(url string) map[string]string
+	}{
+		{"document of another issuer", func(url string) map[string]string {
+			return map[string]string{"issuer": "https://evil.example.com", "authorization_endpoint": url + "/a", "token_endpoint": url + "/t", "jwks_uri": url + "/k"}
+		}},
+		{"missing endpoints", func(url string) map[string]string {
+			return map[string]string{"issuer": url, "authorization_endpoint": url + "/a"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(tt.doc(server.URL))
+			}))
+			defer server.Close()
+
+			p := New(config.OIDCConfig{Issuer: server.URL, ClientID: clientID, Timeout: time.Second})
+			if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+				t.Fatal("discovery accepted the document")
+			}
+		})
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// The example of RFC 7636 appendix B
+	if got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Challenge = %s, want the RFC 7636 example", got)
+	}
+}
@@ -0,0 +1,131 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"gambler/backend/apiversion"
+	"gambler/backend/apperr"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// docsPage renders the document with the Swagger UI assets embedded in the
+// binary, the page loads nothing from other origins
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Gambler API</title>
+	<link rel="stylesheet" href="/docs/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="/docs/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui", withCredentials: true });
+	</script>
+</body>
+</html>`
+
+// docsAssets are the files of swagger-ui-dist the page uses, by their
+// content type
+var docsAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": fiber.MIMETextJavaScriptCharsetUTF8,
+}
+
+// Handler serves the document as JSON
+func Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(Spec())
+	}
+}
+
+// DocsHandler serves the interactive documentation
+func DocsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Type("html", "utf-8")
+		return c.SendString(docsPage)
+	}
+}
+
+// DocsAssetHandler serves the Swagger UI files of the documentation page
+func DocsAssetHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("file")
+		contentType, ok := docsAssets[name]
+		if !ok {
+			return apperr.ErrNotFound
+		}
+		data, err := fs.ReadFile(swaggerFiles.FS, name)
+		if err != nil {
+			return apperr.ErrInternal.Wrap(err)
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+		return c.Send(data)
+	}
+}
+
+// JSON returns the indented document
+func JSON() ([]byte, error) {
+	return json.MarshalIndent(Spec(), "", "  ")
+}
+
+// Check compares the routes of app with the document and returns one line
+// per route that only one of them knows, sorted. An empty result means the
+// document is in sync.
+func Check(app *fiber.App) []string {
+	documented := map[string]bool{}
+	for path, item := range Spec().Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	ignored := map[string]bool{}
+	for _, r := range undocumented {
+		ignored[r] = true
+	}
+
+	registered := map[string]bool{}
+	for _, r := range app.GetRoutes(true) {
+		// Fiber answers HEAD for every GET route
+		if r.Method == fiber.MethodHead {
+			continue
+		}
+		path, _ := convertPath(unversioned(r.Path))
+		key := r.Method + " " + path
+		if !ignored[key] {
+			registered[key] = true
+		}
+	}
+
+	drift := []string{}
+	for key := range registered {
+		if !documented[key] {
+			drift = append(drift, fmt.Sprintf("%s is routed but not documented", key))
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			drift = append(drift, fmt.Sprintf("%s is documented but not routed", key))
+		}
+	}
+	sort.Strings(drift)
+	return drift
+}
+
+// unversioned strips the version prefix, the legacy routes have none and
+// share the keys of version 1
+func unversioned(path string) string {
+	for _, v := range apiversion.Versions {
+		if path == v.Prefix || strings.HasPrefix(path, v.Prefix+"/") {
+			return "/" + strings.TrimLeft(strings.TrimPrefix(path, v.Prefix), "/")
+		}
+	}
+	return path
+}
@@ -0,0 +1,435 @@
+package openapi
+
+import (
+	"gambler/backend/apperr"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	apikeysService "gambler/backend/routes/apikeys/service"
+	authService "gambler/backend/routes/auth/service"
+	betsService "gambler/backend/routes/bets/service"
+	rootService "gambler/backend/routes/root/service"
+	webhooksService "gambler/backend/routes/webhooks/service"
+	"net/http"
+)
+
+type access int
+
+const (
+	authNone access = iota
+	authUser
+	authAdmin
+)
+
+// route documents one route of the router. Body, Query and Response hold a
+// zero value of the type the handler decodes or returns.
+type route struct {
+	Method      string
+	Path        string
+	ID          string
+	Tag         string
+	Summary     string
+	Description string
+	Auth        access
+	// Scope is the scope an API key needs, routes without one refuse keys
+	Scope    string
+	Body     interface{}
+	Query    interface{}
+	Response interface{}
+	Errors   []*apperr.Error
+	Upgrade  bool
+	// Redirect describes the Location a successful request is sent to
+	Redirect string
+}
+
+var tags = []Tag{
+	{Name: "auth", Description: "Sign in and session cookies"},
+	{Name: "user", Description: "The signed in user and public profiles"},
+	{Name: "bets", Description: "Creating, searching and placing bets"},
+	{Name: "webhooks", Description: "Subscriptions to bet lifecycle events"},
+	{Name: "api-keys", Description: "Keys that let bots use the API without signing in"},
+	{Name: "admin", Description: "Operator endpoints, admins only"},
+	{Name: "websocket", Description: "Live bet updates"},
+}
+
+// undocumented lists the routes that are not part of the public API
+var undocumented = []string{
+	"GET /",
+	"GET /metrics",
+	"GET /livez",
+	"GET /readyz",
+	"GET /openapi.json",
+	"GET /docs",
+	"GET /docs/{file}",
+	"GET /.well-known/jwks.json",
+}
+
+var routes = []route{
+	{
+		Method: http.MethodPost, Path: "/auth/login", ID: "login", Tag: "auth",
+		Summary: "Sign in",
+		Description: "Sets the access_token, refresh_token and user_id cookies. Users with two-factor authentication " +
+			"get an `mfa_token` instead, /auth/login/mfa takes it with a code.",
+		Body:     authService.LoginReq{},
+		Response: authService.LoginRes{},
+		Errors:   []*apperr.Error{apperr.ErrInvalidCredentials, apperr.ErrLoginThrottled},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/login/mfa", ID: "loginMFA", Tag: "auth",
+		Summary: "Sign in with the second factor",
+		Description: "Takes the `mfa_token` of /auth/login and a code of the authenticator app or a recovery code, " +
+			"then sets the cookies like /auth/login. A token allows five codes.",
+		Body:     authService.LoginMFAReq{},
+		Response: authService.LoginRes{},
+		Errors: []*apperr.Error{
+			apperr.ErrTokenDecode, apperr.ErrTokenInvalid, apperr.ErrTokenExpired, apperr.ErrMFAInvalid, apperr.ErrMFAAttempts,
+			apperr.ErrLoginThrottled,
+		},
+	},
+	{
+		Method: http.MethodPut, Path: "/auth/register", ID: "register", Tag: "auth",
+		Summary:  "Create an account",
+		Body:     authService.RegisterReq{},
+		Response: authService.LoginRes{},
+		Errors:   []*apperr.Error{apperr.ErrDuplicateKey},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/refresh", ID: "refresh", Tag: "auth",
+		Summary: "Renew the session cookies",
+		Description: "Reads the refresh_token cookie, access routes redirect here once the access token is gone. " +
+			"Every refresh token can be used once, presenting an old one again ends the session.",
+		Response: authService.LoginRes{},
+		Errors: []*apperr.Error{
+			apperr.ErrTokenDecode, apperr.ErrTokenInvalid, apperr.ErrTokenExpired, apperr.ErrTokenReused, apperr.ErrSessionRevoked,
+		},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/logout", ID: "logout", Tag: "auth",
+		Summary: "Sign out",
+		Description: "Ends the session of the cookies and clears them. The access token is rejected from now on, " +
+			"an expired one is not needed. Answers true without a session too.",
+		Response: true,
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/oidc/login", ID: "oidcLogin", Tag: "auth",
+		Summary: "Sign in with the identity provider",
+		Description: "Starts single sign-on with the authorization code flow and PKCE. Open it in the browser, " +
+			"the identity provider sends it back to /auth/oidc/callback.",
+		Redirect: "the authorization endpoint of the identity provider",
+		Errors:   []*apperr.Error{apperr.ErrOIDCDisabled, apperr.ErrOIDCFailed},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/oidc/callback", ID: "oidcCallback", Tag: "auth",
+		Summary: "Finish signing in with the identity provider",
+		Description: "Called by the identity provider with `code` and `state`. Links the identity to an account, " +
+			"sets the cookies like /auth/login and sends the browser to the frontend.",
+		Redirect: "OIDC_POST_LOGIN_URL",
+		Errors: []*apperr.Error{
+			apperr.ErrOIDCDisabled, apperr.ErrOIDCState, apperr.ErrOIDCFailed, apperr.ErrOIDCNoAccount, apperr.ErrDuplicateKey,
+		},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/verify-email", ID: "verifyEmail", Tag: "auth",
+		Summary:     "Confirm the email address",
+		Description: "Takes the token of the link sent after registering. A link works once.",
+		Body:        authService.VerifyEmailReq{},
+		Response:    models.User{},
+		Errors:      []*apperr.Error{apperr.ErrLinkInvalid, apperr.ErrEmailVerified},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/verify-email/request", ID: "requestVerification", Tag: "auth",
+		Summary:     "Send a new verification link",
+		Description: "Links sent before stop working.",
+		Auth:        authUser,
+		Response:    true,
+		Errors:      []*apperr.Error{apperr.ErrEmailVerified},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/password-reset", ID: "resetPassword", Tag: "auth",
+		Summary:     "Choose a new password",
+		Description: "Takes the token of a reset link. Ends every session of the user and clears the cookies.",
+		Body:        authService.PasswordResetReq{},
+		Response:    true,
+		Errors:      []*apperr.Error{apperr.ErrLinkInvalid},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/password-reset/request", ID: "requestPasswordReset", Tag: "auth",
+		Summary:     "Send a password reset link",
+		Description: "Answers true whether or not the address belongs to an account.",
+		Body:        authService.PasswordResetRequestReq{},
+		Response:    true,
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/ping", ID: "ping", Tag: "auth",
+		Summary:  "Check the session",
+		Auth:     authUser,
+		Response: "",
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/sessions", ID: "listSessions", Tag: "auth",
+		Summary:  "Devices the user is signed in on",
+		Auth:     authUser,
+		Response: []authService.SessionRes{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/auth/sessions", ID: "revokeAllSessions", Tag: "auth",
+		Summary:     "Sign out everywhere",
+		Description: "Ends every session including the current one and clears the cookies.",
+		Auth:        authUser,
+		Response:    authService.RevokeSessionsRes{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/auth/sessions/:id", ID: "revokeSession", Tag: "auth",
+		Summary:     "Sign out a device",
+		Description: "The refresh and access tokens of the session stop working.",
+		Auth:        authUser,
+		Response:    true,
+		Errors:      []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/mfa", ID: "getMFAStatus", Tag: "auth",
+		Summary:  "Two-factor authentication of the user",
+		Auth:     authUser,
+		Response: authService.MFAStatusRes{},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/mfa/totp", ID: "startTOTP", Tag: "auth",
+		Summary:     "Set up an authenticator app",
+		Description: "Returns the secret and the otpauth URI to show as a QR code. Sign ins need a code once it is confirmed.",
+		Auth:        authUser,
+		Response:    authService.TOTPEnrollmentRes{},
+		Errors:      []*apperr.Error{apperr.ErrMFAEnabled},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/mfa/totp/confirm", ID: "confirmTOTP", Tag: "auth",
+		Summary:     "Enable two-factor authentication",
+		Description: "Takes the first code of the app and returns the recovery codes, which are not shown again.",
+		Auth:        authUser,
+		Body:        authService.MFACodeReq{},
+		Response:    authService.RecoveryCodesRes{},
+		Errors:      []*apperr.Error{apperr.ErrMFAInvalid, apperr.ErrMFAEnabled, apperr.ErrMFANotStarted},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/mfa/totp/disable", ID: "disableTOTP", Tag: "auth",
+		Summary:     "Disable two-factor authentication",
+		Description: "Takes a code of the app or a recovery code.",
+		Auth:        authUser,
+		Body:        authService.MFACodeReq{},
+		Response:    true,
+		Errors:      []*apperr.Error{apperr.ErrMFAInvalid, apperr.ErrMFANotEnabled},
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/mfa/recovery-codes", ID: "regenerateRecoveryCodes", Tag: "auth",
+		Summary:     "Replace the recovery codes",
+		Description: "Takes a code of the app or a recovery code, the previous recovery codes stop working.",
+		Auth:        authUser,
+		Body:        authService.MFACodeReq{},
+		Response:    authService.RecoveryCodesRes{},
+		Errors:      []*apperr.Error{apperr.ErrMFAInvalid, apperr.ErrMFANotEnabled},
+	},
+	{
+		Method: http.MethodGet, Path: "/user/@me", ID: "getSelf", Tag: "user",
+		Summary:  "The signed in user and the open bets",
+		Auth:     authUser,
+		Scope:    models.ScopeBetsRead,
+		Response: authService.LoginRes{},
+	},
+	{
+		Method: http.MethodGet, Path: "/user/balance", ID: "getBalanceHistory", Tag: "user",
+		Summary:  "Balance history of the signed in user",
+		Auth:     authUser,
+		Scope:    models.ScopeBetsRead,
+		Response: []models.BalanceHistory{},
+	},
+	{
+		Method: http.MethodGet, Path: "/user/bets", ID: "getUserBets", Tag: "user",
+		Summary:  "Stakes of the signed in user",
+		Auth:     authUser,
+		Scope:    models.ScopeBetsRead,
+		Response: []models.UserBet{},
+		Errors:   []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/user/:name", ID: "getUser", Tag: "user",
+		Summary:     "Public profile of a user",
+		Description: "`name` is the id of the user. The password and email are left empty.",
+		Auth:        authUser,
+		Scope:       models.ScopeBetsRead,
+		Response:    models.User{},
+		Errors:      []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/bets/", ID: "listBets", Tag: "bets",
+		Summary:     "Bets by status",
+		Description: "`type` selects the status: 0 open (default), 1 pending, 2 closed, 3 cancelled.",
+		Auth:        authUser,
+		Scope:       models.ScopeBetsRead,
+		Query: struct {
+			Type int `query:"type"`
+		}{},
+		Response: []models.Bet{},
+	},
+	{
+		Method: http.MethodGet, Path: "/bets/search", ID: "searchBets", Tag: "bets",
+		Summary:     "Full-text search over bets",
+		Description: "`status` is a comma separated list of statuses.",
+		Auth:        authUser,
+		Scope:       models.ScopeBetsRead,
+		Query:       betsService.SearchBetsReq{},
+		Response:    betsService.SearchBetsRes{},
+		Errors:      []*apperr.Error{apperr.ErrBetInvalidStatus},
+	},
+	{
+		Method: http.MethodPost, Path: "/bets/create", ID: "createBet", Tag: "bets",
+		Summary:     "Create a bet",
+		Description: "The author places the first stake on inputOption. endsAt is an RFC 3339 time.",
+		Auth:        authUser,
+		Scope:       models.ScopeBetsCreate,
+		Body:        betsService.CreateBetReq{},
+		Response:    models.Bet{},
+		Errors:      []*apperr.Error{apperr.ErrDuplicateKey},
+	},
+	{
+		Method: http.MethodGet, Path: "/bets/:id<int>", ID: "getBet", Tag: "bets",
+		Summary:  "A bet with its stakes",
+		Auth:     authUser,
+		Scope:    models.ScopeBetsRead,
+		Response: models.Bet{},
+		Errors:   []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodPut, Path: "/bets/place/:id<int>", ID: "placeBet", Tag: "bets",
+		Summary:  "Place a stake",
+		Auth:     authUser,
+		Scope:    models.ScopeBetsPlace,
+		Body:     betsService.PlaceBetReq{},
+		Response: true,
+		Errors:   []*apperr.Error{apperr.ErrBetNotActive, apperr.ErrBetOptionNotFound, apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodPut, Path: "/bets/remove/:id<int>", ID: "removeBet", Tag: "bets",
+		Summary:     "Remove a stake",
+		Description: "Currently handled like placing a stake.",
+		Auth:        authUser,
+		Scope:       models.ScopeBetsPlace,
+		Body:        betsService.PlaceBetReq{},
+		Response:    true,
+		Errors:      []*apperr.Error{apperr.ErrBetNotActive, apperr.ErrBetOptionNotFound, apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodPut, Path: "/s/user/balance", ID: "adjustBalance", Tag: "admin",
+		Summary:     "Credit or debit a user",
+		Description: "Books a balance history entry and an audit log entry.",
+		Auth:        authAdmin,
+		Scope:       models.ScopeAdmin,
+		Body:        rootService.AddBalanceReq{},
+		Response:    rootService.AddBalanceRes{},
+		Errors:      []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodPost, Path: "/s/user/unlock", ID: "unlockUser", Tag: "admin",
+		Summary:     "Unlock an account after failed sign ins",
+		Description: "Clears the lock and the counted failures of the account and records an audit log entry.",
+		Auth:        authAdmin,
+		Scope:       models.ScopeAdmin,
+		Body:        rootService.UnlockUserReq{},
+		Response:    rootService.UnlockUserRes{},
+		Errors:      []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/s/audit", ID: "listAuditLogs", Tag: "admin",
+		Summary:  "Query the audit log, newest first",
+		Auth:     authAdmin,
+		Scope:    models.ScopeAdmin,
+		Query:    rootService.ListAuditReq{},
+		Response: rootService.ListAuditRes{},
+	},
+	{
+		Method: http.MethodGet, Path: "/s/audit/verify", ID: "verifyAuditLog", Tag: "admin",
+		Summary:  "Check the hash chain of the audit log",
+		Auth:     authAdmin,
+		Scope:    models.ScopeAdmin,
+		Response: handlers.AuditVerification{},
+	},
+	{
+		Method: http.MethodGet, Path: "/s/webhooks", ID: "listAllWebhooks", Tag: "admin",
+		Summary:  "Webhooks of every user",
+		Auth:     authAdmin,
+		Scope:    models.ScopeAdmin,
+		Response: []models.Webhook{},
+	},
+	{
+		Method: http.MethodGet, Path: "/webhooks/", ID: "listWebhooks", Tag: "webhooks",
+		Summary:  "Webhooks of the signed in user",
+		Auth:     authUser,
+		Response: []models.Webhook{},
+	},
+	{
+		Method: http.MethodPost, Path: "/webhooks/", ID: "createWebhook", Tag: "webhooks",
+		Summary: "Subscribe a URL to bet events",
+		Description: "The response contains the signing secret, it is not shown again. Every delivery is a POST with the " +
+			"headers X-Gambler-Event, X-Gambler-Delivery and X-Gambler-Signature: `t=<unix time>,v1=<hex HMAC-SHA256 of \"<t>.<body>\">`.",
+		Auth:     authUser,
+		Body:     webhooksService.CreateWebhookReq{},
+		Response: webhooksService.CreateWebhookRes{},
+		Errors:   []*apperr.Error{apperr.ErrWebhookLimit},
+	},
+	{
+		Method: http.MethodDelete, Path: "/webhooks/:id<int>", ID: "deleteWebhook", Tag: "webhooks",
+		Summary:     "Unsubscribe",
+		Description: "Pending deliveries are marked failed, the delivery log is kept.",
+		Auth:        authUser,
+		Response:    true,
+		Errors:      []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/webhooks/:id<int>/deliveries", ID: "listWebhookDeliveries", Tag: "webhooks",
+		Summary:  "Delivery log of a webhook, newest first",
+		Auth:     authUser,
+		Query:    webhooksService.ListDeliveriesReq{},
+		Response: webhooksService.ListDeliveriesRes{},
+		Errors:   []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodPost, Path: "/webhooks/:id<int>/deliveries/:delivery<int>/redeliver", ID: "redeliverWebhook", Tag: "webhooks",
+		Summary:     "Send a finished delivery again",
+		Description: "Queues a new delivery with the same payload and event id.",
+		Auth:        authUser,
+		Response:    models.WebhookDelivery{},
+		Errors:      []*apperr.Error{apperr.ErrRecordNotFound, apperr.ErrWebhookPending},
+	},
+	{
+		Method: http.MethodGet, Path: "/api-keys/", ID: "listAPIKeys", Tag: "api-keys",
+		Summary:     "API keys of the signed in user",
+		Description: "Expired keys are listed until they are deleted.",
+		Auth:        authUser,
+		Response:    []models.APIKey{},
+	},
+	{
+		Method: http.MethodPost, Path: "/api-keys/", ID: "createAPIKey", Tag: "api-keys",
+		Summary: "Create an API key",
+		Description: "The response contains the key, it is not shown again. Bots send it as `Authorization: Bearer <key>`. " +
+			"Only admins can grant the `admin` scope.",
+		Auth:     authUser,
+		Body:     apikeysService.CreateAPIKeyReq{},
+		Response: apikeysService.CreateAPIKeyRes{},
+		Errors:   []*apperr.Error{apperr.ErrAPIKeyLimit, apperr.ErrForbidden},
+	},
+	{
+		Method: http.MethodDelete, Path: "/api-keys/:id<int>", ID: "deleteAPIKey", Tag: "api-keys",
+		Summary:     "Revoke an API key",
+		Description: "Requests with the key fail from now on.",
+		Auth:        authUser,
+		Response:    true,
+		Errors:      []*apperr.Error{apperr.ErrRecordNotFound},
+	},
+	{
+		Method: http.MethodGet, Path: "/ws/:id", ID: "websocket", Tag: "websocket",
+		Summary: "Open the websocket session of a user",
+		Description: "`id` is the id of the user. Frames are binary: the event, the protocol version " +
+			"and the payload. Errors are sent as WS_ERR frames with a JSON payload of `type`, `code` and `message`. " +
+			"The handshake needs the access_token cookie of the same user.",
+		Auth:    authUser,
+		Upgrade: true,
+		Errors:  []*apperr.Error{apperr.ErrUpgradeRequired, apperr.ErrForbidden},
+	},
+}
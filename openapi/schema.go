@@ -0,0 +1,332 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gambler/backend/database/models/customTypes"
+
+	"gorm.io/gorm"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object the generator emits
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+	// Validate keeps the original validator tag, so rules without an
+	// OpenAPI equivalent are still visible
+	Validate string `json:"x-validate,omitempty"`
+}
+
+// enums lists the values of the string types stored as Postgres enums
+var enums = map[reflect.Type][]string{
+	reflect.TypeOf(customTypes.BetStatus("")): {
+		string(customTypes.Open), string(customTypes.Pending), string(customTypes.Closed), string(customTypes.Cancelled),
+	},
+	reflect.TypeOf(customTypes.UserRole("")): {
+		string(customTypes.RoleUser), string(customTypes.RoleAdmin),
+	},
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	deletedAtType  = reflect.TypeOf(gorm.DeletedAt{})
+	rawJSONType    = reflect.TypeOf(json.RawMessage{})
+	customJSONType = reflect.TypeOf(customTypes.JSON{})
+)
+
+// generator derives schemas from Go types the way encoding/json encodes
+// them and the validator checks them. Named structs become components.
+type generator struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{
+		components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+// schemaOf returns the schema of the value's type, nil for a nil value
+func (g *generator) schemaOf(value interface{}) *Schema {
+	if value == nil {
+		return nil
+	}
+	return g.schema(reflect.TypeOf(value))
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case deletedAtType:
+		return &Schema{Type: "string", Format: "date-time", Nullable: true}
+	case rawJSONType, customJSONType:
+		return &Schema{Description: "Any JSON value"}
+	}
+	if values, ok := enums[t]; ok {
+		return &Schema{Type: "string", Enum: values}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: float(0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t)}
+	}
+	// Interfaces and anything else can hold any value
+	return &Schema{}
+}
+
+// component registers the schema of a named struct once and returns its name
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.components[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	g.names[t] = name
+	// Reserve the name before descending, the type may refer to itself
+	g.components[name] = &Schema{}
+	*g.components[name] = *g.object(t)
+	return name
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	return s
+}
+
+// fields adds the JSON fields of struct t to s, flattening embedded structs
+// like encoding/json does
+func (g *generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := parseTag(f.Tag.Get("json"))
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && embedded != timeType {
+				g.fields(embedded, s)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field := g.schema(f.Type)
+		if opts["string"] {
+			field = &Schema{Type: "string"}
+		}
+		if rules := f.Tag.Get("validate"); rules != "" {
+			field = withRules(field, rules)
+			if hasRule(rules, "required") {
+				s.Required = append(s.Required, name)
+			}
+		}
+		s.Properties[name] = field
+	}
+}
+
+// parameters describes the fields of a struct decoded by QueryParser
+func (g *generator) parameters(value interface{}) []Parameter {
+	if value == nil {
+		return nil
+	}
+	t := reflect.TypeOf(value)
+	params := []Parameter{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("query")
+		if name == "" || name == "-" {
+			continue
+		}
+		rules := f.Tag.Get("validate")
+		schema := g.schema(f.Type)
+		if rules != "" {
+			schema = withRules(schema, rules)
+		}
+		params = append(params, Parameter{
+			Name:     name,
+			In:       "query",
+			Required: hasRule(rules, "required"),
+			Schema:   schema,
+		})
+	}
+	return params
+}
+
+// validated reports whether a query struct has validator rules
+func validated(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	t := reflect.TypeOf(value)
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("validate") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// withRules maps validator rules onto the schema. Rules after `dive` apply
+// to the items of a slice.
+func withRules(s *Schema, tag string) *Schema {
+	if s.Ref != "" {
+		return s
+	}
+	c := *s
+	c.Validate = tag
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		if rule == "dive" && c.Items != nil {
+			items := withRules(c.Items, strings.Join(rules[i+1:], ","))
+			items.Validate = ""
+			c.Items = items
+			break
+		}
+		applyRule(&c, rule)
+	}
+	return &c
+}
+
+func applyRule(s *Schema, rule string) {
+	name, param, _ := strings.Cut(rule, "=")
+	switch name {
+	case "min", "max":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+		switch s.Type {
+		case "string":
+			if name == "min" {
+				s.MinLength = integer(n)
+			} else {
+				s.MaxLength = integer(n)
+			}
+		case "array":
+			if name == "min" {
+				s.MinItems = integer(n)
+			} else {
+				s.MaxItems = integer(n)
+			}
+		case "integer", "number":
+			if name == "min" {
+				s.Minimum = float(n)
+			} else {
+				s.Maximum = float(n)
+			}
+		}
+	case "email":
+		s.Format = "email"
+	case "url", "http_url":
+		s.Format = "uri"
+	case "oneof":
+		s.Enum = strings.Fields(param)
+	case "alphanum":
+		s.Pattern = "^[a-zA-Z0-9]*$"
+	case "numeric":
+		s.Pattern = `^[-+]?[0-9]+(?:\.[0-9]+)?$`
+	case "ascii":
+		if s.Pattern == "" {
+			s.Pattern = `^[\x00-\x7F]*$`
+		}
+	case "excludes":
+		s.Not = &Schema{Pattern: regexp.QuoteMeta(param)}
+	case "datetime":
+		if param == time.RFC3339 {
+			s.Format = "date-time"
+		} else {
+			s.Description = fmt.Sprintf("Time in the layout %s", param)
+		}
+	}
+}
+
+func hasRule(tag string, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == "dive" {
+			return false
+		}
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTag(tag string) (string, map[string]bool) {
+	parts := strings.Split(tag, ",")
+	opts := map[string]bool{}
+	for _, opt := range parts[1:] {
+		opts[opt] = true
+	}
+	return parts[0], opts
+}
+
+func integer(n float64) *int {
+	i := int(n)
+	return &i
+}
+
+func float(n float64) *float64 {
+	return &n
+}
@@ -0,0 +1,287 @@
+// Package openapi describes version 1 of the HTTP API as an OpenAPI 3
+// document. Request and response schemas are generated from the structs the
+// services decode and return, including their validator rules, so the
+// document cannot fall behind a change of those structs. The routes are listed in operations.go
+// and compared with the router by Check.
+package openapi
+
+import (
+	"fmt"
+	"gambler/backend/apiversion"
+	"gambler/backend/apperr"
+	"gambler/backend/tools"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	Document struct {
+		OpenAPI    string              `json:"openapi"`
+		Info       Info                `json:"info"`
+		Servers    []Server            `json:"servers"`
+		Tags       []Tag               `json:"tags,omitempty"`
+		Paths      map[string]PathItem `json:"paths"`
+		Components Components          `json:"components"`
+	}
+
+	Info struct {
+		Title       string `json:"title"`
+		Description string `json:"description,omitempty"`
+		Version     string `json:"version"`
+	}
+
+	Server struct {
+		URL         string `json:"url"`
+		Description string `json:"description,omitempty"`
+	}
+
+	Tag struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+	}
+
+	// PathItem maps lower case HTTP methods to their operation
+	PathItem map[string]*Operation
+
+	Operation struct {
+		Tags        []string              `json:"tags,omitempty"`
+		Summary     string                `json:"summary,omitempty"`
+		Description string                `json:"description,omitempty"`
+		OperationID string                `json:"operationId"`
+		Parameters  []Parameter           `json:"parameters,omitempty"`
+		RequestBody *RequestBody          `json:"requestBody,omitempty"`
+		Responses   map[string]Response   `json:"responses"`
+		Security    []map[string][]string `json:"security,omitempty"`
+	}
+
+	Parameter struct {
+		Name        string  `json:"name"`
+		In          string  `json:"in"`
+		Description string  `json:"description,omitempty"`
+		Required    bool    `json:"required,omitempty"`
+		Schema      *Schema `json:"schema"`
+	}
+
+	RequestBody struct {
+		Required bool                 `json:"required"`
+		Content  map[string]MediaType `json:"content"`
+	}
+
+	MediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+
+	Response struct {
+		Description string               `json:"description"`
+		Content     map[string]MediaType `json:"content,omitempty"`
+	}
+
+	Components struct {
+		Schemas         map[string]*Schema        `json:"schemas"`
+		SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+	}
+
+	SecurityScheme struct {
+		Type        string `json:"type"`
+		In          string `json:"in,omitempty"`
+		Name        string `json:"name,omitempty"`
+		Scheme      string `json:"scheme,omitempty"`
+		Description string `json:"description,omitempty"`
+	}
+)
+
+const jsonMime = "application/json"
+
+var (
+	document     *Document
+	documentOnce sync.Once
+
+	pathParam = regexp.MustCompile(`:(\w+)(<(\w+)>)?`)
+)
+
+// Spec returns the document, it is built once from the route table
+func Spec() *Document {
+	documentOnce.Do(func() {
+		document = build(routes)
+	})
+	return document
+}
+
+func build(routes []route) *Document {
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title: "Gambler API",
+			Description: "Every response is wrapped in an envelope with `success`, `message` and `code`. Failed requests carry a stable `error` code. " +
+				"The same routes are still served without the version prefix, those answers carry the `Deprecation` header.",
+			Version: "1",
+		},
+		Servers: []Server{{URL: apiversion.V1.Prefix, Description: "Version 1"}},
+		Tags:    tags,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: g.components,
+			SecuritySchemes: map[string]SecurityScheme{
+				"cookieAuth": {
+					Type:        "apiKey",
+					In:          "cookie",
+					Name:        "access_token",
+					Description: "Set by /auth/login, renewed by /auth/refresh with the refresh_token cookie. Named __Host-access_token when the server prefixes its cookies.",
+				},
+				"bearerAuth": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "An API key created with /api-keys, only accepted by the routes that name the scope it needs",
+				},
+			},
+		},
+	}
+	g.components["Error"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"success": {Type: "boolean"},
+			"message": {Type: "string", Description: "Message that can be shown to users"},
+			"code":    {Type: "integer", Description: "HTTP status"},
+			"error":   {Type: "string", Description: "Stable error code, e.g. DB_REC_NOTFOUND"},
+			"body":    {Description: "Details, e.g. the fields that failed validation"},
+		},
+		Required: []string{"success", "message", "code", "error"},
+	}
+
+	for _, r := range routes {
+		path, params := convertPath(r.Path)
+		op := &Operation{
+			Tags:        []string{r.Tag},
+			Summary:     r.Summary,
+			Description: r.Description,
+			OperationID: r.ID,
+			Parameters:  append(params, g.parameters(r.Query)...),
+			Responses:   map[string]Response{},
+		}
+		if r.Body != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{jsonMime: {Schema: g.schemaOf(r.Body)}},
+			}
+		}
+
+		if r.Upgrade {
+			op.Responses["101"] = Response{Description: "Switching to the websocket protocol"}
+		} else if r.Redirect != "" {
+			op.Responses["302"] = Response{Description: "Redirect to " + r.Redirect}
+		} else {
+			op.Responses["200"] = Response{
+				Description: "Success",
+				Content:     map[string]MediaType{jsonMime: {Schema: envelope(g.schemaOf(r.Response))}},
+			}
+		}
+
+		errs := append([]*apperr.Error{}, r.Errors...)
+		if changesState(r.Method) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        tools.CSRFHeader,
+				In:          "header",
+				Description: "Value of the csrf_token cookie, not needed with an API key",
+				Schema:      &Schema{Type: "string"},
+			})
+			errs = append(errs, apperr.ErrCSRF)
+		}
+		if r.Auth >= authUser {
+			op.Security = []map[string][]string{{"cookieAuth": {}}}
+			errs = append(errs, apperr.ErrNoToken, apperr.ErrTokenInvalid, apperr.ErrTokenExpired, apperr.ErrTokenRevoked)
+			if !r.Upgrade {
+				errs = append(errs, apperr.ErrAPIKeyScope)
+			}
+		}
+		if r.Scope != "" {
+			op.Security = append(op.Security, map[string][]string{"bearerAuth": {}})
+			op.Description = strings.TrimSpace(op.Description + " API keys need the `" + r.Scope + "` scope.")
+		}
+		if r.Auth == authAdmin {
+			errs = append(errs, apperr.ErrForbidden, apperr.ErrMFARequired)
+		}
+		if r.Body != nil || validated(r.Query) {
+			errs = append(errs, apperr.ErrBadRequest, apperr.ErrValidation)
+		}
+		for status, desc := range errorResponses(errs) {
+			op.Responses[status] = desc
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	return doc
+}
+
+// changesState reports whether the CSRF middleware checks requests of the
+// method
+func changesState(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+func envelope(body *Schema) *Schema {
+	s := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"success": {Type: "boolean"},
+			"message": {Type: "string"},
+			"code":    {Type: "integer"},
+		},
+		Required: []string{"success", "message", "code"},
+	}
+	if body != nil {
+		s.Properties["body"] = body
+	}
+	return s
+}
+
+// errorResponses groups the errors an operation can return by status
+func errorResponses(errs []*apperr.Error) map[string]Response {
+	codes := map[int][]string{}
+	for _, e := range errs {
+		code := string(e.Code)
+		if !tools.Contains(codes[e.Status], code) {
+			codes[e.Status] = append(codes[e.Status], code)
+		}
+	}
+	responses := map[string]Response{}
+	for status, list := range codes {
+		sort.Strings(list)
+		responses[strconv.Itoa(status)] = Response{
+			Description: fmt.Sprintf("%s: %s", http.StatusText(status), strings.Join(list, ", ")),
+			Content: map[string]MediaType{jsonMime: {
+				Schema: &Schema{Ref: "#/components/schemas/Error"},
+			}},
+		}
+	}
+	return responses
+}
+
+// convertPath turns a fiber path like /bets/:id<int> into /bets/{id} and
+// describes its parameters
+func convertPath(path string) (string, []Parameter) {
+	params := []Parameter{}
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		schema := &Schema{Type: "string"}
+		if m[3] == "int" {
+			schema = &Schema{Type: "integer", Minimum: float(0)}
+		}
+		params = append(params, Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	path = pathParam.ReplaceAllString(path, "{$1}")
+	if len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+	return path, params
+}
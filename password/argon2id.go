@@ -0,0 +1,162 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"gambler/backend/config"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+// argon2id hashes in the PHC string format, e.g.
+// $argon2id$v=19$m=19456,t=2,p=1,keyid=k1$<salt>$<hash>. With a pepper the
+// password is first keyed with HMAC-SHA256, keyid names the pepper so it
+// can be rotated while hashes of the previous one still verify.
+type argon2id struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	pepper  string
+	peppers map[string]string
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	keyID   string
+	salt    []byte
+	key     []byte
+}
+
+func newArgon2id(cfg config.AuthConfig) *argon2id {
+	return &argon2id{
+		memory:  uint32(cfg.Argon2Memory),
+		time:    uint32(cfg.Argon2Time),
+		threads: uint8(cfg.Argon2Threads),
+		pepper:  cfg.PasswordPepper,
+		peppers: cfg.Peppers(),
+	}
+}
+
+func (a *argon2id) Name() string {
+	return "argon2id"
+}
+
+func (a *argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a *argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	input, err := a.input(a.pepper, password)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(input, salt, a.time, a.memory, a.threads, argon2KeyLength)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", a.memory, a.time, a.threads)
+	if a.pepper != "" {
+		params += ",keyid=" + a.pepper
+	}
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a *argon2id) Verify(encoded string, password string) (bool, error) {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	input, err := a.input(p.keyID, password)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey(input, p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return false, ErrMismatch
+	}
+	rehash := p.memory != a.memory || p.time != a.time || p.threads != a.threads ||
+		p.keyID != a.pepper || len(p.key) != argon2KeyLength
+	return rehash, nil
+}
+
+// input keys the password with the pepper of the id, an empty id means no
+// pepper
+func (a *argon2id) input(keyID string, password string) ([]byte, error) {
+	if keyID == "" {
+		return []byte(password), nil
+	}
+	pepper, ok := a.peppers[keyID]
+	if !ok {
+		return nil, fmt.Errorf("password hash uses the unknown pepper %q", keyID)
+	}
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+	return mac.Sum(nil), nil
+}
+
+func parseArgon2id(encoded string) (*argon2Params, error) {
+	// "", "argon2id", "v=19", params, salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("malformed argon2id hash")
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, fmt.Errorf("unsupported argon2id version %s", parts[2])
+	}
+
+	p := &argon2Params{}
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "m", "t", "p":
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("malformed argon2id parameter %s", param)
+			}
+			switch name {
+			case "m":
+				p.memory = uint32(n)
+			case "t":
+				p.time = uint32(n)
+			case "p":
+				if n > 255 {
+					return nil, fmt.Errorf("malformed argon2id parameter %s", param)
+				}
+				p.threads = uint8(n)
+			}
+		case "keyid":
+			p.keyID = value
+		default:
+			return nil, fmt.Errorf("unknown argon2id parameter %s", name)
+		}
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return nil, fmt.Errorf("argon2id hash misses parameters")
+	}
+
+	var err error
+	if p.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if p.key, err = b64.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return nil, fmt.Errorf("malformed argon2id hash value")
+	}
+	return p, nil
+}
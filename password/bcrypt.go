@@ -0,0 +1,51 @@
+package password
+
+import (
+	"errors"
+	"gambler/backend/config"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptScheme is how passwords were hashed before argon2id: bcrypt of the
+// HashSecret, a colon and the password
+type bcryptScheme struct {
+	secret string
+	cost   int
+}
+
+func newBcrypt(cfg config.AuthConfig) *bcryptScheme {
+	return &bcryptScheme{secret: cfg.HashSecret, cost: cfg.BcryptCost}
+}
+
+func (b *bcryptScheme) Name() string {
+	return "bcrypt"
+}
+
+func (b *bcryptScheme) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b *bcryptScheme) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(b.secret+":"+password), b.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (b *bcryptScheme) Verify(encoded string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(b.secret+":"+password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, err
+	}
+	return cost != b.cost, nil
+}
@@ -0,0 +1,75 @@
+// Package password hashes and verifies the passwords of users. New hashes
+// use the configured scheme, hashes of the other schemes are still verified
+// and reported for a rehash, so they are upgraded on the next sign in.
+package password
+
+import (
+	"errors"
+	"gambler/backend/config"
+)
+
+// ErrMismatch is returned when a password does not match its hash
+var ErrMismatch = errors.New("password does not match")
+
+// errUnknownScheme is returned for hashes no scheme recognizes
+var errUnknownScheme = errors.New("unrecognized password hash")
+
+// Scheme is a way of hashing passwords
+type Scheme interface {
+	// Name is the name of the scheme in the configuration
+	Name() string
+	// Hash returns the encoded hash of a new password
+	Hash(password string) (string, error)
+	// Verify returns ErrMismatch when the password does not match and
+	// whether the hash was made with settings other than the current ones
+	Verify(encoded string, password string) (bool, error)
+	// Recognizes reports whether the hash was made by the scheme
+	Recognizes(encoded string) bool
+}
+
+// Hasher hashes with the current scheme and verifies with all of them
+type Hasher struct {
+	current Scheme
+	schemes []Scheme
+}
+
+// New creates a Hasher from the validated configuration
+func New(cfg config.AuthConfig) *Hasher {
+	argon := newArgon2id(cfg)
+	bcrypt := newBcrypt(cfg)
+	h := &Hasher{schemes: []Scheme{argon, bcrypt}}
+	for _, s := range h.schemes {
+		if s.Name() == cfg.PasswordHasher {
+			h.current = s
+		}
+	}
+	if h.current == nil {
+		h.current = argon
+	}
+	return h
+}
+
+// Hash hashes a new password with the current scheme
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify checks a password against its stored hash. rehash is true when the
+// password matched but the hash should be replaced by a new one from Hash.
+func (h *Hasher) Verify(encoded string, password string) (rehash bool, err error) {
+	if encoded == "" {
+		// Accounts created by single sign-on have no password
+		return false, ErrMismatch
+	}
+	for _, s := range h.schemes {
+		if !s.Recognizes(encoded) {
+			continue
+		}
+		rehash, err := s.Verify(encoded, password)
+		if err != nil {
+			return false, err
+		}
+		return rehash || s != h.current, nil
+	}
+	return false, errUnknownScheme
+}
@@ -0,0 +1,188 @@
+package password
+
+import (
+	"errors"
+	"gambler/backend/config"
+	"strings"
+	"testing"
+)
+
+// authConfig is a cheap configuration, tests change what they compare
+func authConfig(change func(*config.AuthConfig)) config.AuthConfig {
+	cfg := config.AuthConfig{
+		HashSecret:      "hash-secret",
+		BcryptCost:      4,
+		PasswordHasher:  "argon2id",
+		Argon2Memory:    64,
+		Argon2Time:      1,
+		Argon2Threads:   1,
+		PasswordPeppers: []string{"k1=first-pepper", "k2=second-pepper"},
+	}
+	if change != nil {
+		change(&cfg)
+	}
+	return cfg
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// hashed is the configuration the stored hash was made with,
+		// current the one verifying it
+		hashed   func(*config.AuthConfig)
+		current  func(*config.AuthConfig)
+		password string
+		rehash   bool
+		err      error
+	}{
+		{name: "argon2id", password: "hunter22"},
+		{name: "wrong password", password: "hunter23", err: ErrMismatch},
+		{name: "bcrypt is upgraded",
+			hashed:   func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt" },
+			password: "hunter22", rehash: true},
+		{name: "bcrypt with the wrong password",
+			hashed:   func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt" },
+			password: "hunter23", err: ErrMismatch},
+		{name: "bcrypt stays while configured",
+			hashed:   func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt" },
+			current:  func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt" },
+			password: "hunter22"},
+		{name: "bcrypt cost raised",
+			hashed:   func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt" },
+			current:  func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt"; c.BcryptCost = 5 },
+			password: "hunter22", rehash: true},
+		{name: "bcrypt of another hash secret",
+			hashed:   func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt"; c.HashSecret = "old" },
+			password: "hunter22", err: ErrMismatch},
+		{name: "argon2id is downgraded when bcrypt is configured",
+			current:  func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt" },
+			password: "hunter22", rehash: true},
+		{name: "memory raised",
+			current:  func(c *config.AuthConfig) { c.Argon2Memory = 128 },
+			password: "hunter22", rehash: true},
+		{name: "passes raised",
+			current:  func(c *config.AuthConfig) { c.Argon2Time = 2 },
+			password: "hunter22", rehash: true},
+		{name: "lanes raised",
+			current:  func(c *config.AuthConfig) { c.Argon2Threads = 2 },
+			password: "hunter22", rehash: true},
+		{name: "pepper",
+			hashed:   func(c *config.AuthConfig) { c.PasswordPepper = "k1" },
+			current:  func(c *config.AuthConfig) { c.PasswordPepper = "k1" },
+			password: "hunter22"},
+		{name: "pepper added",
+			current:  func(c *config.AuthConfig) { c.PasswordPepper = "k1" },
+			password: "hunter22", rehash: true},
+		{name: "pepper rotated",
+			hashed:   func(c *config.AuthConfig) { c.PasswordPepper = "k1" },
+			current:  func(c *config.AuthConfig) { c.PasswordPepper = "k2" },
+			password: "hunter22", rehash: true},
+		{name: "rotated pepper with the wrong password",
+			hashed:   func(c *config.AuthConfig) { c.PasswordPepper = "k1" },
+			current:  func(c *config.AuthConfig) { c.PasswordPepper = "k2" },
+			password: "hunter23", err: ErrMismatch},
+		{name: "pepper removed from the configuration",
+			hashed:   func(c *config.AuthConfig) { c.PasswordPepper = "k1" },
+			current:  func(c *config.AuthConfig) { c.PasswordPeppers = []string{"k2=second-pepper"} },
+			password: "hunter22", err: errors.New(`password hash uses the unknown pepper "k1"`)},
+		{name: "pepper secret changed",
+			hashed:   func(c *config.AuthConfig) { c.PasswordPepper = "k1" },
+			current:  func(c *config.AuthConfig) { c.PasswordPeppers = []string{"k1=changed"}; c.PasswordPepper = "k1" },
+			password: "hunter22", err: ErrMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := New(authConfig(tt.hashed)).Hash("hunter22")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rehash, err := New(authConfig(tt.current)).Verify(encoded, tt.password)
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err == ErrMismatch && !errors.Is(err, ErrMismatch):
+				t.Fatalf("error = %v, want %v", err, ErrMismatch)
+			case tt.err != nil && (err == nil || err.Error() != tt.err.Error()):
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if rehash != tt.rehash {
+				t.Errorf("rehash = %v, want %v", rehash, tt.rehash)
+			}
+		})
+	}
+}
+
+// TestUpgrade signs in with a bcrypt hash the way the auth service does:
+// the rehashed password is stored and verifies without a further rehash
+func TestUpgrade(t *testing.T) {
+	old, err := New(authConfig(func(c *config.AuthConfig) { c.PasswordHasher = "bcrypt" })).Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(authConfig(func(c *config.AuthConfig) { c.PasswordPepper = "k1" }))
+
+	rehash, err := h.Verify(old, "hunter22")
+	if err != nil || !rehash {
+		t.Fatalf("Verify(bcrypt) = %v, %v, want a rehash", rehash, err)
+	}
+	upgraded, err := h.Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(upgraded, "$argon2id$v=19$m=64,t=1,p=1,keyid=k1$") {
+		t.Errorf("upgraded hash = %s, want argon2id with the current parameters", upgraded)
+	}
+	if rehash, err := h.Verify(upgraded, "hunter22"); err != nil || rehash {
+		t.Errorf("Verify(upgraded) = %v, %v, want a match without rehash", rehash, err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	h := New(authConfig(nil))
+	tests := []struct {
+		name    string
+		encoded string
+		err     error
+	}{
+		{"no password", "", ErrMismatch},
+		{"unknown scheme", "$1$salt$hash", errUnknownScheme},
+		{"plain text", "hunter22", errUnknownScheme},
+		{"missing parts", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", nil},
+		{"other version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaA", nil},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$aGFzaA", nil},
+		{"missing passes", "$argon2id$v=19$m=64,p=1$c2FsdHNhbHQ$aGFzaA", nil},
+		{"too many lanes", "$argon2id$v=19$m=64,t=1,p=256$c2FsdHNhbHQ$aGFzaA", nil},
+		{"unknown parameter", "$argon2id$v=19$m=64,t=1,p=1,x=1$c2FsdHNhbHQ$aGFzaA", nil},
+		{"empty hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := h.Verify(tt.encoded, "hunter22")
+			if err == nil || rehash {
+				t.Fatalf("Verify = %v, %v, want an error", rehash, err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+			if errors.Is(err, ErrMismatch) && tt.err != ErrMismatch {
+				t.Errorf("malformed hash reported as a wrong password")
+			}
+		})
+	}
+}
+
+func TestHashSalts(t *testing.T) {
+	h := New(authConfig(nil))
+	first, err := h.Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := h.Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("two hashes of the same password are equal")
+	}
+}
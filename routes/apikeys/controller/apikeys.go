@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"gambler/backend/middleware"
+	"gambler/backend/routes/apikeys/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func InitAPIKeysRoute(c fiber.Router, guards *middleware.Auth, svc *service.Service) {
+	group := c.Group("/api-keys", guards.JwtGuardHandler)
+	group.Get("/", svc.ListAPIKeys)
+	group.Post("/", svc.CreateAPIKey)
+	group.Delete("/:id<int>", svc.DeleteAPIKey)
+}
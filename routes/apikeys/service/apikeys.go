@@ -0,0 +1,127 @@
+package service
+
+import (
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	"gambler/backend/middleware"
+	"gambler/backend/tools"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+type (
+	CreateAPIKeyReq struct {
+		Name   string   `json:"name" validate:"required,max=50"`
+		Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=bets:read bets:place bets:create admin"`
+		// ExpiresInDays is the lifetime of the key, 0 for a key that does
+		// not expire
+		ExpiresInDays int `json:"expires_in_days" validate:"min=0,max=365"`
+	}
+
+	// CreateAPIKeyRes is the only response that contains the key
+	CreateAPIKeyRes struct {
+		models.APIKey
+		Key string `json:"key"`
+	}
+)
+
+// Service holds the API key routes
+type Service struct {
+	auth   config.AuthConfig
+	guards *middleware.Auth
+}
+
+// New limits the keys of a user to cfg.APIKeysPerUser
+func New(cfg config.AuthConfig, guards *middleware.Auth) *Service {
+	return &Service{auth: cfg, guards: guards}
+}
+
+func (s *Service) ListAPIKeys(c *fiber.Ctx) error {
+	userID, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	keys, err := handlers.DB.WithContext(c.UserContext()).ListAPIKeys(userID)
+	if err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, keys)
+}
+
+func (s *Service) CreateAPIKey(c *fiber.Ctx) error {
+	req := new(CreateAPIKeyReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	userID, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !tools.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if tools.Contains(scopes, models.ScopeAdmin) {
+		admin, err := s.guards.IsAdmin(c)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			return apperr.ErrForbidden.WithMessage("Only admins can create keys with the admin scope")
+		}
+	}
+
+	key, hash, err := tools.NewAPIKey()
+	if err != nil {
+		return apperr.ErrInternal.Wrap(err)
+	}
+
+	apiKey := models.APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  key[:12],
+		KeyHash: hash,
+		Scopes:  pq.StringArray(scopes),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).CreateAPIKey(&apiKey, s.auth.APIKeysPerUser); err != nil {
+		return err
+	}
+
+	return tools.ReturnData(c, 200, CreateAPIKeyRes{
+		APIKey: apiKey,
+		Key:    key,
+	})
+}
+
+func (s *Service) DeleteAPIKey(c *fiber.Ctx) error {
+	userID, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).DeleteAPIKey(userID, tools.ParseUInt(c.Params("id"))); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, true)
+}
+
+func currentUser(c *fiber.Ctx) (uint, error) {
+	userID, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
+	if jwtErr != nil {
+		return 0, apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+	return tools.ParseUInt(userID), nil
+}
@@ -7,10 +7,26 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func InitAuthRoute(c *fiber.App) {
+func InitAuthRoute(c fiber.Router, guards *middleware.Auth, svc *service.Service) {
 	group := c.Group("/auth")
-	group.Post("/login", service.Login)
-	group.Put("/register", service.Register)
-	group.Get("/refresh", service.RefreshToken)
-	group.Get("/ping", middleware.JwtGuardHandler, service.Ping)
+	group.Post("/login", svc.Login)
+	group.Post("/login/mfa", svc.LoginMFA)
+	group.Put("/register", svc.Register)
+	group.Get("/refresh", svc.RefreshToken)
+	group.Post("/logout", svc.Logout)
+	group.Get("/oidc/login", svc.OIDCLogin)
+	group.Get("/oidc/callback", svc.OIDCCallback)
+	group.Post("/verify-email", svc.VerifyEmail)
+	group.Post("/verify-email/request", guards.JwtGuardHandler, svc.RequestVerification)
+	group.Post("/password-reset", svc.ResetPassword)
+	group.Post("/password-reset/request", svc.RequestPasswordReset)
+	group.Get("/ping", guards.JwtGuardHandler, svc.Ping)
+	group.Get("/sessions", guards.JwtGuardHandler, svc.ListSessions)
+	group.Delete("/sessions", guards.JwtGuardHandler, svc.RevokeAllSessions)
+	group.Delete("/sessions/:id", guards.JwtGuardHandler, svc.RevokeSession)
+	group.Get("/mfa", guards.JwtGuardHandler, svc.MFAStatus)
+	group.Post("/mfa/totp", guards.JwtGuardHandler, svc.StartTOTP)
+	group.Post("/mfa/totp/confirm", guards.JwtGuardHandler, svc.ConfirmTOTP)
+	group.Post("/mfa/totp/disable", guards.JwtGuardHandler, svc.DisableTOTP)
+	group.Post("/mfa/recovery-codes", guards.JwtGuardHandler, svc.RegenerateRecoveryCodes)
 }
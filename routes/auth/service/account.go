@@ -0,0 +1,153 @@
+package service
+
+import (
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	"gambler/backend/mailer"
+	"gambler/backend/tools"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type (
+	VerifyEmailReq struct {
+		Token string `json:"token" validate:"required,max=100"`
+	}
+
+	PasswordResetRequestReq struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	PasswordResetReq struct {
+		Token    string `json:"token" validate:"required,max=100"`
+		Password string `json:"password" validate:"required,min=8,ascii,excludes=:"`
+	}
+)
+
+// Frontend pages the links in emails open
+const (
+	verifyEmailPath   = "/verify-email"
+	resetPasswordPath = "/reset-password"
+)
+
+// RequestVerification sends a new verification link to the address of the
+// signed in user
+func (s *Service) RequestVerification(c *fiber.Ctx) error {
+	userId, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(userId))
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return apperr.ErrEmailVerified
+	}
+	if err := s.sendLink(c, user, models.TokenVerifyEmail); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, true)
+}
+
+// VerifyEmail confirms the address with the token of a verification link
+func (s *Service) VerifyEmail(c *fiber.Ctx) error {
+	req := new(VerifyEmailReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	ctx := audit.WithActor(c.UserContext(), audit.AnonymousActor(c))
+	user, err := handlers.DB.WithContext(ctx).VerifyEmail(tools.HashLinkToken(req.Token))
+	if err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, user)
+}
+
+// RequestPasswordReset sends a reset link if the address belongs to an
+// account. The answer is the same either way, so it cannot be used to find
+// out who has an account.
+func (s *Service) RequestPasswordReset(c *fiber.Ctx) error {
+	req := new(PasswordResetRequestReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByEmail(req.Email)
+	if err != nil && !errors.Is(err, apperr.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil {
+		if err := s.sendLink(c, user, models.TokenResetPassword); err != nil {
+			return err
+		}
+	}
+	return tools.ReturnData(c, 200, true)
+}
+
+// ResetPassword sets a new password with the token of a reset link, signs
+// the user out everywhere and deletes their API keys
+func (s *Service) ResetPassword(c *fiber.Ctx) error {
+	req := new(PasswordResetReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return apperr.ErrInternal.Wrap(err)
+	}
+
+	ctx := audit.WithActor(c.UserContext(), audit.AnonymousActor(c))
+	revoked, err := handlers.DB.WithContext(ctx).ResetPassword(tools.HashLinkToken(req.Token), hashedPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.denySessions(c, revoked); err != nil {
+		return err
+	}
+	s.cookies.ClearSession(c)
+	return tools.ReturnData(c, 200, true)
+}
+
+// sendLink stores a new link token of the purpose and emails it to the user
+func (s *Service) sendLink(c *fiber.Ctx, user *models.User, purpose string) error {
+	token, hash, err := tools.NewLinkToken()
+	if err != nil {
+		return apperr.ErrInternal.Wrap(err)
+	}
+
+	ttl, path := s.auth.VerifyEmailTTL, verifyEmailPath
+	if purpose == models.TokenResetPassword {
+		ttl, path = s.auth.ResetTTL, resetPasswordPath
+	}
+	err = handlers.DB.WithContext(c.UserContext()).CreateUserToken(models.UserToken{
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := mailer.Link(s.mail.LinkBaseURL, path, token)
+	msg := mailer.VerifyEmail(user.Email, user.Name, link, ttl)
+	if purpose == models.TokenResetPassword {
+		msg = mailer.ResetPassword(user.Email, user.Name, link, ttl)
+	}
+	mailer.Mail.Deliver(c.UserContext(), msg)
+	return nil
+}
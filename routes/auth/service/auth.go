@@ -1,15 +1,25 @@
 package service
 
 import (
-	"fmt"
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/config"
 	"gambler/backend/database/models"
 	"gambler/backend/handlers"
 	"gambler/backend/middleware"
+	"gambler/backend/oidc"
+	"gambler/backend/password"
 	"gambler/backend/tools"
-	"strings"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type (
@@ -28,136 +38,416 @@ type (
 	LoginRes struct {
 		User *models.User  `json:"user"`
 		Bets *[]models.Bet `json:"bets"`
+		// MFAToken is returned instead of the session cookies when the user
+		// has two-factor authentication, /auth/login/mfa takes it with a code
+		MFAToken     string     `json:"mfa_token,omitempty"`
+		MFAExpiresAt *time.Time `json:"mfa_expires_at,omitempty"`
+	}
+
+	SessionRes struct {
+		models.Session
+		// Current marks the session of the request
+		Current bool `json:"current"`
+	}
+
+	RevokeSessionsRes struct {
+		Revoked int `json:"revoked"`
 	}
 )
 
-func Login(c *fiber.Ctx) error {
+// maxUserAgent bounds the user agent stored with a session
+const maxUserAgent = 255
+
+// Service holds the auth routes. The password hashing settings, token
+// lifetimes, link base URL of emails and identity provider come from the
+// config it was built with.
+type Service struct {
+	auth    config.AuthConfig
+	mail    config.MailConfig
+	sso     config.OIDCConfig
+	tokens  *middleware.Auth
+	cookies *tools.Cookies
+	// provider is nil while single sign-on is not configured
+	provider *oidc.Provider
+	hasher   *password.Hasher
+	// dummyHash is compared with the password of unknown usernames, it is
+	// made on the first use
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+func New(cfg config.AuthConfig, mail config.MailConfig, sso config.OIDCConfig, tokens *middleware.Auth, cookies *tools.Cookies) *Service {
+	s := &Service{
+		auth:    cfg,
+		mail:    mail,
+		sso:     sso,
+		tokens:  tokens,
+		cookies: cookies,
+		hasher:  password.New(cfg),
+	}
+	if sso.Enabled() {
+		s.provider = oidc.New(sso)
+	}
+	return s
+}
+
+func (s *Service) dummy() string {
+	s.dummyOnce.Do(func() {
+		s.dummyHash, _ = s.hasher.Hash(uuid.NewString())
+	})
+	return s.dummyHash
+}
+
+func (s *Service) Login(c *fiber.Ctx) error {
 	req := new(LoginReq)
 
-	if err := c.BodyParser(req); err != nil {
-		tools.ReturnData(c, 400, nil, -1)
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
 	}
 
-	if errs := handlers.VHandler.Validate(req); len(errs) > 0 && errs[0].Error {
-		return tools.ReturnData(c, 400, errs, -1)
+	if err := s.checkLoginBlocked(c, req.Username); err != nil {
+		return err
 	}
 
-	user, err := handlers.DB.GetUserByUsername(req.Username)
-	if err != -1 {
-		if err == tools.DB_REC_NOTFOUND {
-			return tools.ReturnData(c, 404, nil, tools.DB_REC_NOTFOUND)
-		} else {
-			return c.Status(500).JSON(tools.GlobalErrorHandlerResp{
-				Success: false,
-				Message: "Internal server error",
-				Code:    500,
-			})
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByUsername(req.Username)
+	if errors.Is(err, apperr.ErrRecordNotFound) {
+		// Takes as long as a wrong password, so the answer time does not
+		// tell whether the username exists
+		s.hasher.Verify(s.dummy(), req.Password)
+		if err := s.recordLoginFailure(c, req.Username); err != nil {
+			return err
 		}
+		return apperr.ErrInvalidCredentials.Wrap(err)
 	}
-	hashedPassword := user.Password
-	valid := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(tools.HASH_SECRET+":"+req.Password))
-	if valid != nil {
-		fmt.Println(valid)
-		return tools.ReturnData(c, 401, strings.Split(valid.Error(), ": ")[1], -1)
+	if err != nil {
+		return err
 	}
-	tokens, err := middleware.Sign(user.ID)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	rehash, err := s.hasher.Verify(user.Password, req.Password)
+	if errors.Is(err, password.ErrMismatch) {
+		s.recordLogin(c, audit.AnonymousActor(c), audit.ActionLoginFailed, user.ID)
+		if err := s.recordLoginFailure(c, req.Username); err != nil {
+			return err
+		}
+		return apperr.ErrInvalidCredentials.Wrap(err)
+	}
+	if err != nil {
+		return apperr.ErrInternal.Wrap(err)
+	}
+	if rehash {
+		s.upgradePassword(c, user, req.Password)
 	}
 
-	bets := &[]models.Bet{}
-	bets, err = handlers.Cache.GetAllBet()
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	if user.TOTPEnabledAt != nil {
+		token, expiresAt, err := s.tokens.SignChallenge(user.ID)
+		if err != nil {
+			return err
+		}
+		return tools.ReturnData(c, 200, LoginRes{MFAToken: token, MFAExpiresAt: &expiresAt})
 	}
+	return s.finishLogin(c, user)
+}
 
-	tools.CreateCookie(c, tokens.AccessToken, tokens.RefreshToken, user.ID)
+// upgradePassword replaces a hash made with outdated settings after the
+// password was checked. A failure only keeps the old hash, so it is logged.
+func (s *Service) upgradePassword(c *fiber.Ctx, user *models.User, plain string) {
+	hashed, err := s.hasher.Hash(plain)
+	if err == nil {
+		err = handlers.DB.WithContext(c.UserContext()).UpdatePasswordHash(user.ID, user.Password, hashed)
+	}
+	if err != nil {
+		slog.WarnContext(c.UserContext(), "failed to upgrade password hash", "user_id", user.ID, "error", err)
+		return
+	}
+	user.Password = hashed
+}
+
+// finishLogin starts the session of a user whose credentials were checked
+func (s *Service) finishLogin(c *fiber.Ctx, user *models.User) error {
+	if err := handlers.Cache.WithContext(c.UserContext()).ClearLoginFailures(user.Username); err != nil {
+		return err
+	}
+	tokens, err := s.startSession(c, user.ID)
+	if err != nil {
+		return err
+	}
+	s.recordLogin(c, audit.UserActor(c, user.ID), audit.ActionLogin, user.ID)
+
+	bets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
+	}
+
+	s.cookies.CreateSession(c, tokens.AccessToken, tokens.AccessTokenExpDate, tokens.RefreshToken, tokens.RefreshTokenExpDate, user.ID)
 	return tools.ReturnData(c, 200, LoginRes{
 		User: user,
 		Bets: bets,
-	}, -1)
+	})
+}
+
+// checkLoginBlocked refuses the sign in while the account or the address
+// has to wait after failed ones
+func (s *Service) checkLoginBlocked(c *fiber.Ctx, username string) error {
+	blocked, err := handlers.Cache.WithContext(c.UserContext()).LoginBlocked(username, c.IP())
+	if err != nil {
+		return err
+	}
+	if blocked > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(blocked.Seconds()))))
+		return apperr.ErrLoginThrottled
+	}
+	return nil
+}
+
+// recordLoginFailure counts a wrong password or second factor against the
+// account and the address
+func (s *Service) recordLoginFailure(c *fiber.Ctx, username string) error {
+	return handlers.Cache.WithContext(c.UserContext()).RecordLoginFailure(s.auth, username, c.IP())
+}
+
+// recordLogin writes a login attempt to the audit log, a failure to do so
+// does not fail the login
+func (s *Service) recordLogin(c *fiber.Ctx, actor audit.Actor, action string, userID uint) {
+	ctx := audit.WithActor(c.UserContext(), actor)
+	if err := handlers.DB.WithContext(ctx).RecordAudit(action, audit.TargetUser, userID, nil, nil); err != nil {
+		slog.ErrorContext(ctx, "failed to audit login", "user_id", userID, "error", err)
+	}
 }
 
-func RefreshToken(c *fiber.Ctx) error {
-	header := c.Cookies("refresh_token")
+// startSession signs the tokens of a new session, one per sign in
+func (s *Service) startSession(c *fiber.Ctx, userID uint) (*middleware.Jwt, error) {
+	sessionID := uuid.NewString()
+	tokens, err := s.tokens.Sign(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
 
-	claims, err := middleware.Decode(header, true)
-	if err != -1 {
-		return tools.ReturnData(c, 401, nil, err)
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgent {
+		userAgent = userAgent[:maxUserAgent]
+	}
+	err = handlers.DB.WithContext(c.UserContext()).CreateSession(models.Session{
+		ID:             sessionID,
+		CreatedAt:      time.Now(),
+		UserID:         userID,
+		RefreshTokenID: tokens.RefreshTokenID,
+		UserAgent:      userAgent,
+		IP:             audit.ClientIP(c),
+		LastUsedAt:     time.Now(),
+		ExpiresAt:      tokens.RefreshTokenExpDate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RefreshToken rotates the refresh token of the session, the presented one
+// cannot be used again
+func (s *Service) RefreshToken(c *fiber.Ctx) error {
+	header := s.cookies.Get(c, tools.RefreshTokenCookie)
+
+	claims, err := s.tokens.Decode(header, true)
+	if err != nil {
+		return err
 	}
 
 	rawUserId, jwtErr := claims.GetSubject()
 	if jwtErr != nil {
-		return tools.ReturnData(c, 401, nil, tools.JWT_INVALID)
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
 	}
 
 	userId := tools.ParseUInt(rawUserId)
+	sessionID := middleware.SessionID(claims)
 
-	tokens, err := middleware.Sign(userId)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(userId)
+	if errors.Is(err, apperr.ErrRecordNotFound) {
+		// The account was deleted after the token was issued
+		return apperr.ErrTokenInvalid.Wrap(err)
+	}
+	if err != nil {
+		return err
 	}
-	tools.CreateCookie(c, tokens.AccessToken, tokens.RefreshToken, userId)
 
-	user, err := handlers.DB.GetUserByID(userId)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	tokens, err := s.tokens.Sign(userId, sessionID)
+	if err != nil {
+		return err
+	}
+	ctx := audit.WithActor(c.UserContext(), audit.UserActor(c, userId))
+	refreshTokenID, refreshTokenExpDate, err := handlers.DB.WithContext(ctx).RotateSession(sessionID, userId, middleware.TokenID(claims), tokens.RefreshTokenID, tokens.RefreshTokenExpDate)
+	if errors.Is(err, apperr.ErrTokenReused) {
+		// Whoever copied the refresh token may also hold an access token
+		if denyErr := s.denySessions(c, []string{sessionID}); denyErr != nil {
+			return denyErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if refreshTokenID != tokens.RefreshTokenID {
+		// A concurrent request rotated the token first, both get its result
+		tokens, err = s.tokens.Reissue(userId, sessionID, refreshTokenID, refreshTokenExpDate)
+		if err != nil {
+			return err
+		}
 	}
+	s.cookies.CreateSession(c, tokens.AccessToken, tokens.AccessTokenExpDate, tokens.RefreshToken, tokens.RefreshTokenExpDate, userId)
 
-	bets, err := handlers.Cache.GetAllBet()
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	bets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
 	}
 
 	return tools.ReturnData(c, 200, fiber.Map{
 		"user": user,
 		"bets": bets,
-	}, -1)
+	})
 }
 
-func Register(c *fiber.Ctx) error {
+func (s *Service) Register(c *fiber.Ctx) error {
 	req := new(RegisterReq)
 
-	if err := c.BodyParser(req); err != nil {
-		fmt.Println(err)
-		return tools.ReturnData(c, 400, nil, -1)
-	}
-
-	if errs := handlers.VHandler.Validate(req); len(errs) > 0 && errs[0].Error {
-		return tools.ReturnData(c, 400, errs, -1)
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
 	}
 
-	hashedPasssword, err := bcrypt.GenerateFromPassword([]byte(tools.HASH_SECRET+":"+req.Password), bcrypt.MinCost*2)
+	hashedPasssword, err := s.hasher.Hash(req.Password)
 	if err != nil {
-		fmt.Println(err)
-		return tools.ReturnData(c, 500, nil, -1)
+		return apperr.ErrInternal.Wrap(err)
 	}
 
 	user := models.User{
 		Username: req.Username,
-		Password: string(hashedPasssword),
+		Password: hashedPasssword,
 		Email:    req.Email,
 		Name:     req.Name,
 		UserBet:  []models.UserBet{},
 	}
 
-	dbErr := handlers.DB.CreateUser(user)
-	if dbErr != -1 {
-		return tools.ReturnData(c, 500, nil, dbErr)
+	if err := handlers.DB.WithContext(c.UserContext()).CreateUser(user); err != nil {
+		if errors.Is(err, apperr.ErrDuplicateKey) {
+			return apperr.From(err).WithMessage("Username or email already taken")
+		}
+		return err
 	}
 
-	bets := &[]models.Bet{}
-	bets, dbErr = handlers.Cache.GetAllBet()
-	if dbErr != -1 {
-		return tools.ReturnData(c, 500, nil, dbErr)
+	created, err := handlers.DB.WithContext(c.UserContext()).GetUserByUsername(user.Username)
+	if err != nil {
+		return err
+	}
+	// The account exists at this point, it can ask for another link
+	if err := s.sendLink(c, created, models.TokenVerifyEmail); err != nil {
+		slog.ErrorContext(c.UserContext(), "failed to send verification email", "user_id", created.ID, "error", err)
+	}
+
+	bets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
 	}
 
 	return tools.ReturnData(c, 200, LoginRes{
-		User: &user,
+		User: created,
 		Bets: bets,
-	}, -1)
+	})
+}
+
+func (s *Service) Ping(c *fiber.Ctx) error {
+	return tools.ReturnData(c, 200, "Pong!")
+}
+
+// ListSessions returns the devices the user is signed in on
+func (s *Service) ListSessions(c *fiber.Ctx) error {
+	claims := c.Locals("claims").(jwt.Claims)
+	userId, jwtErr := claims.GetSubject()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+
+	sessions, err := handlers.DB.WithContext(c.UserContext()).ListSessions(tools.ParseUInt(userId))
+	if err != nil {
+		return err
+	}
+
+	current := middleware.SessionID(claims)
+	res := make([]SessionRes, 0, len(*sessions))
+	for _, session := range *sessions {
+		res = append(res, SessionRes{Session: session, Current: session.ID == current})
+	}
+	return tools.ReturnData(c, 200, res)
+}
+
+// RevokeSession signs the user out on one device
+func (s *Service) RevokeSession(c *fiber.Ctx) error {
+	userId, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+
+	sessionID := c.Params("id")
+	err := handlers.DB.WithContext(c.UserContext()).RevokeSession(tools.ParseUInt(userId), sessionID, handlers.RevokedByUser)
+	if err != nil {
+		return err
+	}
+	if err := s.denySessions(c, []string{sessionID}); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, true)
+}
+
+// RevokeAllSessions signs the user out everywhere, including this device
+func (s *Service) RevokeAllSessions(c *fiber.Ctx) error {
+	userId, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+
+	revoked, err := handlers.DB.WithContext(c.UserContext()).RevokeAllSessions(tools.ParseUInt(userId), handlers.RevokedLogoutAll)
+	if err != nil {
+		return err
+	}
+	if err := s.denySessions(c, revoked); err != nil {
+		return err
+	}
+	s.cookies.ClearSession(c)
+	return tools.ReturnData(c, 200, RevokeSessionsRes{Revoked: len(revoked)})
+}
+
+// Logout signs the user out on this device. It also works once the access
+// token expired, the session is then taken from the refresh token.
+func (s *Service) Logout(c *fiber.Ctx) error {
+	var sessionID, subject string
+	if claims, err := s.tokens.Decode(s.cookies.Get(c, tools.AccessTokenCookie), false); err == nil {
+		expiresAt, jwtErr := claims.GetExpirationTime()
+		if jwtErr != nil {
+			return apperr.ErrTokenInvalid.Wrap(jwtErr)
+		}
+		if err := handlers.Cache.WithContext(c.UserContext()).DenyToken(middleware.TokenID(claims), expiresAt.Time); err != nil {
+			return err
+		}
+		sessionID = middleware.SessionID(claims)
+		subject, _ = claims.GetSubject()
+	} else if claims, err := s.tokens.Decode(s.cookies.Get(c, tools.RefreshTokenCookie), true); err == nil {
+		sessionID = middleware.SessionID(claims)
+		subject, _ = claims.GetSubject()
+	}
+
+	if sessionID != "" && subject != "" {
+		userId := tools.ParseUInt(subject)
+		ctx := audit.WithActor(c.UserContext(), audit.UserActor(c, userId))
+		err := handlers.DB.WithContext(ctx).RevokeSession(userId, sessionID, handlers.RevokedLogout)
+		// Signing out of an ended session only clears the cookies
+		if err != nil && !errors.Is(err, apperr.ErrRecordNotFound) {
+			return err
+		}
+		if err := s.denySessions(c, []string{sessionID}); err != nil {
+			return err
+		}
+	}
+
+	s.cookies.ClearSession(c)
+	return tools.ReturnData(c, 200, true)
 }
 
-func Ping(c *fiber.Ctx) error {
-	return tools.ReturnData(c, 200, "Pong!", -1)
+// denySessions ends the access tokens the sessions were issued so far
+func (s *Service) denySessions(c *fiber.Ctx, ids []string) error {
+	return handlers.Cache.WithContext(c.UserContext()).DenySessions(ids, s.auth.AccessTokenTTL)
 }
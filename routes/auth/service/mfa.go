@@ -0,0 +1,297 @@
+package service
+
+import (
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	"gambler/backend/mfa"
+	"gambler/backend/middleware"
+	"gambler/backend/tools"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type (
+	LoginMFAReq struct {
+		MFAToken string `json:"mfa_token" validate:"required"`
+		// Code is the code of the authenticator app or a recovery code
+		Code string `json:"code" validate:"required,min=6,max=20"`
+	}
+
+	MFACodeReq struct {
+		Code string `json:"code" validate:"required,min=6,max=20"`
+	}
+
+	MFAStatusRes struct {
+		Enabled       bool  `json:"enabled"`
+		RecoveryCodes int64 `json:"recovery_codes"`
+	}
+
+	TOTPEnrollmentRes struct {
+		Secret string `json:"secret"`
+		// URI is the otpauth URI to show as a QR code
+		URI string `json:"uri"`
+	}
+
+	RecoveryCodesRes struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+)
+
+// maxChallengeAttempts is the number of codes that can be tried with one
+// MFA token, afterwards the password has to be entered again
+const maxChallengeAttempts = 5
+
+// LoginMFA is the second step of a sign in with two-factor authentication,
+// it starts the session like Login does
+func (s *Service) LoginMFA(c *fiber.Ctx) error {
+	req := new(LoginMFAReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	claims, err := s.tokens.DecodeChallenge(req.MFAToken)
+	if err != nil {
+		return err
+	}
+	rawUserId, jwtErr := claims.GetSubject()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+	expiresAt, jwtErr := claims.GetExpirationTime()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+
+	cache := handlers.Cache.WithContext(c.UserContext())
+	tokenID := middleware.TokenID(claims)
+	used, err := cache.IsTokenDenied(tokenID, "")
+	if err != nil {
+		return err
+	}
+	if used {
+		return apperr.ErrTokenInvalid
+	}
+	attempts, err := cache.CountChallengeAttempt(tokenID, expiresAt.Time)
+	if err != nil {
+		return err
+	}
+	if attempts > maxChallengeAttempts {
+		return apperr.ErrMFAAttempts
+	}
+
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(rawUserId))
+	if errors.Is(err, apperr.ErrRecordNotFound) {
+		return apperr.ErrTokenInvalid.Wrap(err)
+	}
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		// Two-factor authentication was turned off since the password was
+		// checked, a new sign in skips this step
+		return apperr.ErrTokenInvalid
+	}
+	if err := s.checkLoginBlocked(c, user.Username); err != nil {
+		return err
+	}
+	if err := s.checkSecondFactor(c, user, req.Code); err != nil {
+		if errors.Is(err, apperr.ErrMFAInvalid) {
+			s.recordLogin(c, audit.AnonymousActor(c), audit.ActionLoginFailed, user.ID)
+			if err := s.recordLoginFailure(c, user.Username); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	// The MFA token works once
+	if err := cache.DenyToken(tokenID, expiresAt.Time); err != nil {
+		return err
+	}
+	return s.finishLogin(c, user)
+}
+
+// MFAStatus tells whether the signed in user has two-factor authentication
+func (s *Service) MFAStatus(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	res := MFAStatusRes{Enabled: user.TOTPEnabledAt != nil}
+	if res.Enabled {
+		res.RecoveryCodes, err = handlers.DB.WithContext(c.UserContext()).CountRecoveryCodes(user.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tools.ReturnData(c, 200, res)
+}
+
+// StartTOTP generates the secret for the authenticator app. It is only used
+// for sign ins once a code of it was confirmed.
+func (s *Service) StartTOTP(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt != nil {
+		return apperr.ErrMFAEnabled
+	}
+
+	secret, err := mfa.NewSecret()
+	if err != nil {
+		return apperr.ErrInternal.Wrap(err)
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).StartTOTP(user.ID, secret); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, TOTPEnrollmentRes{
+		Secret: secret,
+		URI:    mfa.URI(s.auth.MFAIssuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication with the first code of the
+// authenticator app and returns the recovery codes, they are not shown again
+func (s *Service) ConfirmTOTP(c *fiber.Ctx) error {
+	req := new(MFACodeReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt != nil {
+		return apperr.ErrMFAEnabled
+	}
+	if user.TOTPSecret == "" {
+		return apperr.ErrMFANotStarted
+	}
+	counter, ok := mfa.Validate(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		return apperr.ErrMFAInvalid
+	}
+
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).EnableTOTP(user.ID, counter, hashes); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, RecoveryCodesRes{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off, it takes a code like a
+// sign in does
+func (s *Service) DisableTOTP(c *fiber.Ctx) error {
+	req := new(MFACodeReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return apperr.ErrMFANotEnabled
+	}
+	if err := s.checkSecondFactor(c, user, req.Code); err != nil {
+		return err
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).DisableTOTP(user.ID); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, true)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user
+func (s *Service) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	req := new(MFACodeReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return apperr.ErrMFANotEnabled
+	}
+	if err := s.checkSecondFactor(c, user, req.Code); err != nil {
+		return err
+	}
+
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, RecoveryCodesRes{RecoveryCodes: codes})
+}
+
+// checkSecondFactor accepts a code of the authenticator app that was not
+// used before, or an unused recovery code
+func (s *Service) checkSecondFactor(c *fiber.Ctx, user *models.User, code string) error {
+	db := handlers.DB.WithContext(c.UserContext())
+	if mfa.IsCode(code) {
+		counter, ok := mfa.Validate(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return apperr.ErrMFAInvalid
+		}
+		fresh, err := db.UseTOTPCounter(user.ID, counter)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return apperr.ErrMFAInvalid
+		}
+		return nil
+	}
+
+	used, err := db.UseRecoveryCode(user.ID, mfa.HashRecoveryCode(s.auth.HashSecret, code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return apperr.ErrMFAInvalid
+	}
+	return nil
+}
+
+func (s *Service) newRecoveryCodes() ([]string, []string, error) {
+	codes, err := mfa.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, apperr.ErrInternal.Wrap(err)
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = mfa.HashRecoveryCode(s.auth.HashSecret, code)
+	}
+	return codes, hashes, nil
+}
+
+// currentUser loads the signed in user, it has to run after JwtGuardHandler
+func currentUser(c *fiber.Ctx) (*models.User, error) {
+	userId, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
+	if jwtErr != nil {
+		return nil, apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+	return handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(userId))
+}
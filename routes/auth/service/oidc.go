@@ -0,0 +1,191 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"gambler/backend/apperr"
+	"gambler/backend/audit"
+	"gambler/backend/database/models"
+	"gambler/backend/database/models/customTypes"
+	"gambler/backend/handlers"
+	"gambler/backend/oidc"
+	"gambler/backend/tools"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// oidcStateCookie ties the callback to the browser that started the sign in
+const oidcStateCookie = "oidc_state"
+
+// maxName is the longest display name accepted by the registration
+const maxName = 50
+
+// OIDCLogin sends the browser to the identity provider
+func (s *Service) OIDCLogin(c *fiber.Ctx) error {
+	if s.provider == nil {
+		return apperr.ErrOIDCDisabled
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := oidc.NewSecret()
+		if err != nil {
+			return apperr.ErrInternal.Wrap(err)
+		}
+		secrets[i] = secret
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := s.provider.AuthCodeURL(c.UserContext(), state, nonce, verifier)
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "identity provider unavailable", "error", err)
+		return apperr.ErrOIDCFailed.Wrap(err)
+	}
+	login := handlers.OIDCLogin{Nonce: nonce, Verifier: verifier}
+	if err := handlers.Cache.WithContext(c.UserContext()).SaveOIDCLogin(state, login, s.sso.StateTTL); err != nil {
+		return err
+	}
+
+	// Lax even with cookies.same_site Strict, the callback is a navigation
+	// from the identity provider
+	s.cookies.Set(c, &fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Expires:  time.Now().Add(s.sso.StateTTL),
+		SameSite: fiber.CookieSameSiteLaxMode,
+		HTTPOnly: true,
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallback finishes the sign in at the identity provider, links the
+// identity to a user and sends the browser to the frontend with the session
+// cookies. Two-factor authentication is left to the identity provider.
+func (s *Service) OIDCCallback(c *fiber.Ctx) error {
+	if s.provider == nil {
+		return apperr.ErrOIDCDisabled
+	}
+
+	state := c.Query("state")
+	expected := s.cookies.Get(c, oidcStateCookie)
+	s.cookies.Clear(c, oidcStateCookie)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		return apperr.ErrOIDCState
+	}
+	login, err := handlers.Cache.WithContext(c.UserContext()).TakeOIDCLogin(state)
+	if err != nil {
+		return err
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		return apperr.ErrOIDCFailed.Wrap(fmt.Errorf("identity provider answered %s: %s", reason, c.Query("error_description")))
+	}
+	code := c.Query("code")
+	if code == "" {
+		return apperr.ErrOIDCFailed.Wrap(errors.New("callback without code"))
+	}
+	identity, err := s.provider.Exchange(c.UserContext(), code, login.Verifier, login.Nonce)
+	if err != nil {
+		slog.WarnContext(c.UserContext(), "single sign-on failed", "error", err)
+		return apperr.ErrOIDCFailed.Wrap(err)
+	}
+
+	ctx := audit.WithActor(c.UserContext(), audit.AnonymousActor(c))
+	user, err := handlers.DB.WithContext(ctx).SignInWithIdentity(models.UserIdentity{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	}, profileOf(identity), s.sso.LinkByEmail, s.sso.CreateUsers)
+	if errors.Is(err, apperr.ErrDuplicateKey) {
+		return apperr.From(err).WithMessage("An account with this email address exists, sign in with its password")
+	}
+	if err != nil {
+		return err
+	}
+
+	if user, err = s.syncRole(c, user, identity.Groups); err != nil {
+		return err
+	}
+
+	tokens, err := s.startSession(c, user.ID)
+	if err != nil {
+		return err
+	}
+	s.recordLogin(c, audit.UserActor(c, user.ID), audit.ActionLogin, user.ID)
+	s.cookies.CreateSession(c, tokens.AccessToken, tokens.AccessTokenExpDate, tokens.RefreshToken, tokens.RefreshTokenExpDate, user.ID)
+	return c.Redirect(s.sso.PostLoginURL, fiber.StatusFound)
+}
+
+// profileOf describes the user created for a new identity. The email
+// address only counts as verified when the identity provider says so.
+func profileOf(identity *oidc.Identity) models.User {
+	username := "user"
+	for _, candidate := range []string{identity.PreferredUsername, strings.Split(identity.Email, "@")[0], identity.Name} {
+		if candidate = alphanumeric(candidate); len(candidate) >= 3 {
+			username = candidate
+			break
+		}
+	}
+	if len(username) > 20 {
+		username = username[:20]
+	}
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name = username
+	}
+	if len(name) > maxName {
+		name = name[:maxName]
+	}
+
+	user := models.User{
+		Username: username,
+		Email:    identity.Email,
+		Name:     name,
+		Role:     customTypes.RoleUser,
+	}
+	if identity.EmailVerified && identity.Email != "" {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return user
+}
+
+// syncRole makes members of OIDC_ADMIN_GROUPS admins and everyone else a
+// user, so access is managed at the identity provider. Users listed in
+// MASTER_IDS keep their role.
+func (s *Service) syncRole(c *fiber.Ctx, user *models.User, groups []string) (*models.User, error) {
+	if len(s.sso.AdminGroups) == 0 || s.auth.IsMaster(fmt.Sprintf("%d", user.ID)) {
+		return user, nil
+	}
+	role := groupRole(s.sso.AdminGroups, groups)
+	if user.Role == role || (user.Role == "" && role == customTypes.RoleUser) {
+		return user, nil
+	}
+	ctx := audit.WithActor(c.UserContext(), audit.UserActor(c, user.ID))
+	return handlers.DB.WithContext(ctx).SetUserRole(user.ID, role)
+}
+
+// groupRole is the role of a member of groups, admin when one of them is
+// an admin group
+func groupRole(adminGroups []string, groups []string) customTypes.UserRole {
+	for _, group := range groups {
+		if tools.Contains(adminGroups, group) {
+			return customTypes.RoleAdmin
+		}
+	}
+	return customTypes.RoleUser
+}
+
+func alphanumeric(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
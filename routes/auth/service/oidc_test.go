@@ -0,0 +1,115 @@
+package service
+
+import (
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/database/models/customTypes"
+	"gambler/backend/oidc"
+	"gambler/backend/tools"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGroupRole(t *testing.T) {
+	admins := []string{"gambler-admins", "ops"}
+	tests := []struct {
+		name   string
+		groups []string
+		want   customTypes.UserRole
+	}{
+		{"admin group", []string{"staff", "gambler-admins"}, customTypes.RoleAdmin},
+		{"second admin group", []string{"ops"}, customTypes.RoleAdmin},
+		{"other groups", []string{"staff", "gambler-users"}, customTypes.RoleUser},
+		{"group names are exact", []string{"Gambler-Admins", "gambler-admins-old"}, customTypes.RoleUser},
+		{"no groups", nil, customTypes.RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupRole(admins, tt.groups); got != tt.want {
+				t.Errorf("groupRole(%v) = %s, want %s", tt.groups, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity oidc.Identity
+		username string
+		display  string
+		verified bool
+	}{
+		{"preferred username", oidc.Identity{PreferredUsername: "jane.doe", Email: "jd@example.com", Name: "Jane Doe", EmailVerified: true}, "janedoe", "Jane Doe", true},
+		{"email when the username is too short", oidc.Identity{PreferredUsername: "jd", Email: "jane@example.com", Name: "Jane Doe"}, "jane", "Jane Doe", false},
+		{"name as the last resort", oidc.Identity{Email: "j@example.com", Name: "Jane Doe"}, "JaneDoe", "Jane Doe", false},
+		{"fallback", oidc.Identity{Name: "Jo"}, "user", "Jo", false},
+		{"long username", oidc.Identity{PreferredUsername: strings.Repeat("a", 30)}, strings.Repeat("a", 20), strings.Repeat("a", 20), false},
+		{"long name", oidc.Identity{PreferredUsername: "jane", Name: strings.Repeat("b", 60)}, "jane", strings.Repeat("b", maxName), false},
+		{"verified without email", oidc.Identity{PreferredUsername: "jane", EmailVerified: true}, "jane", "jane", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := profileOf(&tt.identity)
+			if user.Username != tt.username || user.Name != tt.display {
+				t.Errorf("profile = %q %q, want %q %q", user.Username, user.Name, tt.username, tt.display)
+			}
+			if (user.EmailVerifiedAt != nil) != tt.verified {
+				t.Errorf("email verified = %v, want %v", user.EmailVerifiedAt != nil, tt.verified)
+			}
+			if user.Role != customTypes.RoleUser {
+				t.Errorf("role = %s, want user", user.Role)
+			}
+		})
+	}
+}
+
+// TestOIDCCallbackState covers the callbacks rejected before the provider
+// or the stored sign in are looked at
+func TestOIDCCallbackState(t *testing.T) {
+	sso := config.OIDCConfig{Issuer: "http://127.0.0.1:1", ClientID: "gambler"}
+	tests := []struct {
+		name   string
+		sso    config.OIDCConfig
+		query  string
+		cookie string
+		err    *apperr.Error
+	}{
+		{"disabled", config.OIDCConfig{}, "?state=s1&code=c", "s1", apperr.ErrOIDCDisabled},
+		{"without state", sso, "?code=c", "s1", apperr.ErrOIDCState},
+		{"without cookie", sso, "?state=s1&code=c", "", apperr.ErrOIDCState},
+		{"state of another browser", sso, "?state=s2&code=c", "s1", apperr.ErrOIDCState},
+		{"empty state and cookie", sso, "?state=&code=c", "", apperr.ErrOIDCState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies := tools.NewCookies(config.CookieConfig{HostPrefix: true, Secure: true})
+			s := New(config.AuthConfig{}, config.MailConfig{}, tt.sso, nil, cookies)
+			app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+				return c.Status(apperr.Status(err)).SendString(string(apperr.CodeOf(err)))
+			}})
+			app.Get("/callback", s.OIDCCallback)
+
+			req := httptest.NewRequest(http.MethodGet, "/callback"+tt.query, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "__Host-" + oidcStateCookie, Value: tt.cookie})
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.err.Status || string(body) != string(tt.err.Code) {
+				t.Errorf("answered %d %s, want %d %s", resp.StatusCode, body, tt.err.Status, tt.err.Code)
+			}
+			if tt.err == apperr.ErrOIDCState && !strings.Contains(resp.Header.Get("Set-Cookie"), "__Host-"+oidcStateCookie+"=;") {
+				t.Errorf("state cookie not cleared: %q", resp.Header.Get("Set-Cookie"))
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"gambler/backend/database/models"
 	"gambler/backend/handlers"
 	"gambler/backend/middleware"
 	"gambler/backend/routes/bets/service"
@@ -9,11 +10,15 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func InitBetsRoute(c *fiber.App) {
-	group := c.Group("/bets", middleware.JwtGuardHandler)
-	group.Get("/", handlers.AddCache(time.Minute*3), service.GetAllBetsHandler)
-	group.Post("/create", service.CreateBet)
-	group.Get("/:id<int>", handlers.AddCache(time.Second*10), service.GetBet)
-	group.Put("/place/:id<int>", service.PlaceBet)
-	group.Put("/remove/:id<int>", service.PlaceBet)
+func InitBetsRoute(c fiber.Router, guards *middleware.Auth) {
+	read := guards.Scoped(models.ScopeBetsRead)
+	place := guards.Scoped(models.ScopeBetsPlace)
+
+	group := c.Group("/bets")
+	group.Get("/", read, handlers.AddCache(time.Minute*3), service.GetAllBetsHandler)
+	group.Get("/search", read, service.SearchBets)
+	group.Post("/create", guards.Scoped(models.ScopeBetsCreate), service.CreateBet)
+	group.Get("/:id<int>", read, handlers.AddCache(time.Second*10), service.GetBet)
+	group.Put("/place/:id<int>", place, service.PlaceBet)
+	group.Put("/remove/:id<int>", place, service.PlaceBet)
 }
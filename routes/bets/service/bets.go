@@ -1,17 +1,20 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"gambler/backend/apperr"
 	"gambler/backend/database/models"
 	"gambler/backend/database/models/customTypes"
 	"gambler/backend/handlers"
 	"gambler/backend/handlers/websocket"
 	"gambler/backend/tools"
+	"log/slog"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/lib/pq"
 )
@@ -29,46 +32,59 @@ type (
 		Amount float64 `json:"amount" validate:"required,min=1"`
 		Option string  `json:"option" validate:"required"`
 	}
+	SearchBetsReq struct {
+		Query  string `query:"q" validate:"required,min=2,max=100"`
+		Status string `query:"status"`
+		Page   int    `query:"page" validate:"min=0"`
+		Limit  int    `query:"limit" validate:"min=0,max=50"`
+	}
+	SearchBetsRes struct {
+		Hits  []handlers.BetSearchHit `json:"hits"`
+		Total int64                   `json:"total"`
+		Page  int                     `json:"page"`
+		Limit int                     `json:"limit"`
+	}
 )
 
+const defaultSearchLimit = 20
+
 func PlaceBet(c *fiber.Ctx) error {
 
 	req := new(PlaceBetReq)
 
-	if err := c.BodyParser(req); err != nil {
-		return tools.ReturnData(c, 400, nil, -1)
-	}
-
-	if errs := handlers.VHandler.Validate(req); len(errs) > 0 && errs[0].Error {
-		return tools.ReturnData(c, 400, errs, -1)
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
 	}
 
 	claims := c.Locals("claims").(jwt.MapClaims)
 	userID, jwtErr := claims.GetSubject()
 	if jwtErr != nil {
-		return tools.ReturnData(c, 400, nil, -1)
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
 	}
 
 	betID := c.Params("id")
-	bet, err := handlers.Cache.GetBetById(tools.ParseUInt(betID))
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	bet, err := handlers.Cache.WithContext(c.UserContext()).GetBetById(tools.ParseUInt(betID))
+	if errors.Is(err, apperr.ErrCacheNotFound) {
+		// Only open bets are cached
+		return apperr.ErrBetNotActive.Wrap(err)
+	}
+	if err != nil {
+		return err
 	}
 
-	user, err := handlers.DB.GetUserByID(tools.ParseUInt(userID))
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(userID))
+	if err != nil {
+		return err
 	}
 
 	if bet.EndsAt.Before(time.Now()) {
-		return tools.ReturnData(c, 400, nil, tools.BET_NOT_ACTIVE)
+		return apperr.ErrBetNotActive
 	}
 	if bet.Status != customTypes.Open {
-		return tools.ReturnData(c, 400, nil, tools.BET_NOT_ACTIVE)
+		return apperr.ErrBetNotActive
 	}
 	if tools.Contains(bet.BetOptions, req.Option) == false {
-		log.Info(bet.BetOptions, req.Option)
-		return tools.ReturnData(c, 400, nil, tools.BET_OPTION_NOT_FOUND)
+		return apperr.ErrBetOptionNotFound
 	}
 
 	userBet := models.UserBet{
@@ -78,27 +94,27 @@ func PlaceBet(c *fiber.Ctx) error {
 		BetOption: req.Option,
 	}
 
-	err = handlers.DB.PlaceBet(userBet)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	err = handlers.DB.WithContext(c.UserContext()).PlaceBet(userBet)
+	if err != nil {
+		return err
 	}
 
-	err = handlers.Cache.UpdateBet(bet.ID)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	err = handlers.Cache.WithContext(c.UserContext()).UpdateBet(bet.ID)
+	if err != nil {
+		return err
 	}
 
-	err = handlers.DB.UpdateUserBalance(-req.Amount, *user, fmt.Sprintf("Placed bet on %s", bet.Name))
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	err = handlers.DB.WithContext(c.UserContext()).UpdateUserBalance(-req.Amount, *user, fmt.Sprintf("Placed bet on %s", bet.Name))
+	if err != nil {
+		return err
 	}
 
-	err = websocket.WebSocket.UpdateBet(bet.ID)
-	if err != -1 {
-		log.Info("Failed to update bet in websocket")
+	err = websocket.WebSocket.UpdateBet(c.UserContext(), bet.ID)
+	if err != nil {
+		slog.WarnContext(c.UserContext(), "failed to broadcast bet update", "bet_id", bet.ID, "error", err)
 	}
 
-	return tools.ReturnData(c, 200, true, -1)
+	return tools.ReturnData(c, 200, true)
 }
 
 func GetAllBetsHandler(c *fiber.Ctx) error {
@@ -118,18 +134,18 @@ func GetAllBetsHandler(c *fiber.Ctx) error {
 }
 
 func GetAllActiveBets(c *fiber.Ctx) error {
-	bets, err := handlers.Cache.GetAllBet()
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	bets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
 	}
-	return tools.ReturnData(c, 200, bets, -1)
+	return tools.ReturnData(c, 200, bets)
 }
 
 func GetAllPendingBets(c *fiber.Ctx) error {
 	res := []models.Bet{}
-	bets, err := handlers.Cache.GetAllBet()
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	bets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
 	}
 
 	for _, bet := range *bets {
@@ -138,14 +154,14 @@ func GetAllPendingBets(c *fiber.Ctx) error {
 		}
 	}
 
-	return tools.ReturnData(c, 200, res, -1)
+	return tools.ReturnData(c, 200, res)
 }
 
 func GetAllClosedBets(c *fiber.Ctx) error {
 	res := []models.Bet{}
-	bets, err := handlers.Cache.GetAllBet()
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	bets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
 	}
 
 	for _, bet := range *bets {
@@ -154,14 +170,14 @@ func GetAllClosedBets(c *fiber.Ctx) error {
 		}
 	}
 
-	return tools.ReturnData(c, 200, res, -1)
+	return tools.ReturnData(c, 200, res)
 }
 
 func GetAllCancelledBets(c *fiber.Ctx) error {
 	res := []models.Bet{}
-	bets, err := handlers.Cache.GetAllBet()
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	bets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
 	}
 
 	for _, bet := range *bets {
@@ -170,24 +186,20 @@ func GetAllCancelledBets(c *fiber.Ctx) error {
 		}
 	}
 
-	return tools.ReturnData(c, 200, res, -1)
+	return tools.ReturnData(c, 200, res)
 }
 
 func CreateBet(c *fiber.Ctx) error {
 
 	req := new(CreateBetReq)
 
-	if err := c.BodyParser(req); err != nil {
-		return tools.ReturnData(c, 400, nil, -1)
-	}
-
-	if errs := handlers.VHandler.Validate(req); len(errs) > 0 && errs[0].Error {
-		return tools.ReturnData(c, 400, errs, -1)
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
 	}
 
 	userIDString, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
 	if jwtErr != nil {
-		return tools.ReturnData(c, 401, nil, tools.JWT_INVALID)
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
 	}
 
 	userId := tools.ParseUInt(userIDString)
@@ -200,19 +212,60 @@ func CreateBet(c *fiber.Ctx) error {
 		BetOptions:  pq.StringArray(req.BetOptions),
 		Status:      customTypes.Open,
 		EndsAt:      tools.ParseTimestamp(req.EndsAt),
-		Author:      userId,
+		Author:      &userId,
+	}
+
+	err := handlers.DB.WithContext(c.UserContext()).CreateBet(bet, userId, req.InputOption, req.InputBet)
+	if err != nil {
+		return err
+	}
+
+	websocket.WebSocket.SendMessageToAll(c.UserContext(), []byte{tools.BET_UPDATE, websocket.WebSocket.Version, byte(255)})
+
+	return tools.ReturnData(c, 200, bet)
+}
+
+func SearchBets(c *fiber.Ctx) error {
+	req := new(SearchBetsReq)
+
+	if err := handlers.ParseQuery(c, req); err != nil {
+		return err
 	}
 
-	log.Info(bet)
+	statuses := []customTypes.BetStatus{}
+	if req.Status != "" {
+		for _, raw := range strings.Split(req.Status, ",") {
+			status, ok := customTypes.ParseBetStatus(strings.TrimSpace(raw))
+			if !ok {
+				return apperr.ErrBetInvalidStatus.WithDetails(raw)
+			}
+			statuses = append(statuses, status)
+		}
+	}
 
-	err := handlers.DB.CreateBet(bet, userId, req.InputOption, req.InputBet)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+	if req.Page == 0 {
+		req.Page = 1
 	}
 
-	websocket.WebSocket.SendMessageToAll([]byte{tools.BET_UPDATE, tools.WEBSOCKET_VERSION, byte(255)})
+	result, err := handlers.DB.WithContext(c.UserContext()).SearchBets(handlers.BetSearchQuery{
+		Query:    req.Query,
+		Statuses: statuses,
+		Limit:    req.Limit,
+		Offset:   (req.Page - 1) * req.Limit,
+	})
+	if err != nil {
+		return err
+	}
 
-	return tools.ReturnData(c, 200, bet, -1)
+	return tools.ReturnData(c, 200, SearchBetsRes{
+		Hits:  result.Hits,
+		Total: result.Total,
+		Page:  req.Page,
+		Limit: req.Limit,
+	})
 }
 
 func GetBet(c *fiber.Ctx) error {
@@ -220,15 +273,10 @@ func GetBet(c *fiber.Ctx) error {
 
 	id := tools.ParseUInt(paramsId)
 
-	bet, err := handlers.DB.GetBetByID(id)
-	if err != -1 {
-		log.Info(tools.GetErrorString(err))
-		return tools.ReturnData(c, 500, nil, err)
-	}
-
-	if bet == nil {
-		return tools.ReturnData(c, 404, nil, tools.DB_REC_NOTFOUND)
+	bet, err := handlers.DB.WithContext(c.UserContext()).GetBetByID(id)
+	if err != nil {
+		return err
 	}
 
-	return tools.ReturnData(c, 200, bet, -1)
+	return tools.ReturnData(c, 200, bet)
 }
@@ -1,13 +1,18 @@
 package controller
 
 import (
+	"gambler/backend/database/models"
 	"gambler/backend/middleware"
 	"gambler/backend/routes/root/service"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func InitRootRoute(c *fiber.App) {
-	group := c.Group("/s", middleware.JwtGuardHandler)
+func InitRootRoute(c fiber.Router, guards *middleware.Auth) {
+	group := c.Group("/s", guards.Scoped(models.ScopeAdmin), guards.AdminGuardHandler)
 	group.Put("/user/balance", service.AddBalanceToUser)
+	group.Post("/user/unlock", service.UnlockUser)
+	group.Get("/audit", service.ListAuditLogs)
+	group.Get("/audit/verify", service.VerifyAuditLog)
+	group.Get("/webhooks", service.ListAllWebhooks)
 }
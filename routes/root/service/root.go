@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
+	"gambler/backend/audit"
 	"gambler/backend/handlers"
 	"gambler/backend/tools"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -10,30 +13,150 @@ import (
 type (
 	AddBalanceReq struct {
 		Amount float64 `json:"amount" validate:"required,min=1"`
-		Reason string  `json:"reason" validate:"required,min=1,max=3,ascii"`
-		UserId string  `json:"user_id" validate:"required,min=1"`
+		Reason string  `json:"reason" validate:"required,min=10,max=200"`
+		UserId string  `json:"user_id" validate:"required,min=1,numeric"`
+	}
+
+	AddBalanceRes struct {
+		UserID  uint    `json:"user_id"`
+		Balance float64 `json:"balance"`
+	}
+
+	ListAuditReq struct {
+		ActorID    uint   `query:"actor_id"`
+		Action     string `query:"action" validate:"max=50"`
+		TargetType string `query:"target_type" validate:"max=20"`
+		TargetID   string `query:"target_id" validate:"max=50"`
+		From       string `query:"from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+		To         string `query:"to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+		Page       int    `query:"page" validate:"min=0"`
+		Limit      int    `query:"limit" validate:"min=0,max=200"`
+	}
+
+	UnlockUserReq struct {
+		Username string `json:"username" validate:"required,min=3,max=20,alphanum"`
+	}
+
+	UnlockUserRes struct {
+		UserID uint `json:"user_id"`
+		// Locked tells whether the account was locked, the failed sign ins
+		// counted towards a lock are cleared either way
+		Locked bool `json:"locked"`
+	}
+
+	ListAuditRes struct {
+		handlers.AuditPage
+		Page  int `json:"page"`
+		Limit int `json:"limit"`
 	}
 )
 
+const defaultAuditLimit = 50
+
 func AddBalanceToUser(c *fiber.Ctx) error {
-	var req AddBalanceReq
+	req := new(AddBalanceReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	user, err := handlers.DB.WithContext(c.UserContext()).AdjustUserBalance(tools.ParseUInt(req.UserId), req.Amount, req.Reason)
+	if err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, AddBalanceRes{
+		UserID:  user.ID,
+		Balance: user.Balance,
+	})
+}
+
+func ListAuditLogs(c *fiber.Ctx) error {
+	req := new(ListAuditReq)
+
+	if err := handlers.ParseQuery(c, req); err != nil {
+		return err
+	}
 
-	if err := c.BodyParser(req); err != nil {
-		return tools.ReturnData(c, 400, nil, -1)
+	if req.Limit == 0 {
+		req.Limit = defaultAuditLimit
+	}
+	if req.Page == 0 {
+		req.Page = 1
+	}
+
+	query := handlers.AuditQuery{
+		Action:     req.Action,
+		TargetType: req.TargetType,
+		TargetID:   req.TargetID,
+		Limit:      req.Limit,
+		Offset:     (req.Page - 1) * req.Limit,
+	}
+	if req.ActorID != 0 {
+		query.ActorID = &req.ActorID
+	}
+	if req.From != "" {
+		from := tools.ParseTimestamp(req.From)
+		query.From = &from
+	}
+	if req.To != "" {
+		to := tools.ParseTimestamp(req.To)
+		query.To = &to
 	}
 
-	if errs := handlers.VHandler.Validate(req); len(errs) > 0 && errs[0].Error {
-		return tools.ReturnData(c, 400, errs, -1)
+	page, err := handlers.DB.WithContext(c.UserContext()).ListAuditLogs(query)
+	if err != nil {
+		return err
 	}
 
-	user, err := handlers.DB.GetUserByID(tools.ParseUInt(req.UserId))
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	return tools.ReturnData(c, 200, ListAuditRes{
+		AuditPage: *page,
+		Page:      req.Page,
+		Limit:     req.Limit,
+	})
+}
+
+func VerifyAuditLog(c *fiber.Ctx) error {
+	// Walking the whole chain can take a while on a large log
+	ctx, cancel := context.WithTimeout(c.UserContext(), 30*time.Second)
+	defer cancel()
+
+	result, err := handlers.DB.WithContext(ctx).VerifyAuditChain()
+	if err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, result)
+}
+
+// ListAllWebhooks returns the webhooks of every user
+func ListAllWebhooks(c *fiber.Ctx) error {
+	hooks, err := handlers.DB.WithContext(c.UserContext()).ListWebhooks(nil)
+	if err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, hooks)
+}
+
+// UnlockUser lets a user locked out by failed sign ins sign in again
+func UnlockUser(c *fiber.Ctx) error {
+	req := new(UnlockUserReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByUsername(req.Username)
+	if err != nil {
+		return err
+	}
+	locked, err := handlers.Cache.WithContext(c.UserContext()).UnlockLogin(user.Username)
+	if err != nil {
+		return err
 	}
-	newAmount := user.Balance + req.Amount
-	err = handlers.DB.UpdateUserBalance(newAmount, *user, req.Reason)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	err = handlers.DB.WithContext(c.UserContext()).RecordAudit(audit.ActionUserUnlock, audit.TargetUser, user.ID, nil, map[string]interface{}{
+		"locked": locked,
+	})
+	if err != nil {
+		return err
 	}
-	return tools.ReturnData(c, 200, nil, -1)
+	return tools.ReturnData(c, 200, UnlockUserRes{UserID: user.ID, Locked: locked})
 }
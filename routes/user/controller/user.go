@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"gambler/backend/database/models"
 	"gambler/backend/handlers"
 	"gambler/backend/middleware"
 	"gambler/backend/routes/user/service"
@@ -9,8 +10,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func InitUserRoute(c *fiber.App) {
-	group := c.Group("/user", middleware.JwtGuardHandler)
+func InitUserRoute(c fiber.Router, guards *middleware.Auth) {
+	group := c.Group("/user", guards.Scoped(models.ScopeBetsRead))
 	group.Get("/@me", handlers.AddCache(time.Second*5), service.GetSelf)
 	group.Get("/balance", service.GetUserBalance)
 	group.Get("/bets", service.GetUserBets)
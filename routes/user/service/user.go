@@ -1,11 +1,11 @@
 package service
 
 import (
+	"gambler/backend/apperr"
 	"gambler/backend/handlers"
 	"gambler/backend/tools"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -20,71 +20,60 @@ type (
 
 func GetUserByID(c *fiber.Ctx) error {
 	userId := c.Params("id")
-	user, err := handlers.DB.GetUserByID(tools.ParseUInt(userId))
-	log.Info(user)
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(userId))
+	if err != nil {
+		return err
 	}
 	user.Password = ""
 	user.Email = ""
-	return tools.ReturnData(c, 200, user, -1)
+	return tools.ReturnData(c, 200, user)
 }
 
 func GetSelf(c *fiber.Ctx) error {
 	claims := c.Locals("claims").(jwt.Claims)
 	if claims == nil {
-		return tools.ReturnData(c, 500, nil, -1)
+		return apperr.ErrUnauthorized
 	}
-	log.Info(claims)
 	userId, jwtErr := claims.GetSubject()
 	if jwtErr != nil {
-		return tools.ReturnData(c, 401, nil, -1)
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
 	}
-	log.Info(userId)
-	user, err := handlers.DB.GetUserByID(tools.ParseUInt(userId))
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	user, err := handlers.DB.WithContext(c.UserContext()).GetUserByID(tools.ParseUInt(userId))
+	if err != nil {
+		return err
 	}
 
-	activeBets, err := handlers.Cache.GetAllBet()
-	if err != -1 {
-		return tools.ReturnData(c, 500, nil, err)
+	activeBets, err := handlers.Cache.WithContext(c.UserContext()).GetAllBet()
+	if err != nil {
+		return err
 	}
 
 	return tools.ReturnData(c, 200, fiber.Map{
 		"user": user,
 		"bets": activeBets,
-	}, -1)
+	})
 }
 
 func GetUserBalance(c *fiber.Ctx) error {
 	userId, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
 	if jwtErr != nil {
-		return tools.ReturnData(c, 401, nil, -1)
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
 	}
-	balance, err := handlers.DB.FindBalanceHistoryByUser(tools.ParseUInt(userId))
-	if err != -1 {
-		if err == tools.DB_REC_NOTFOUND {
-			return tools.ReturnData(c, 404, nil, tools.DB_REC_NOTFOUND)
-		} else {
-			return tools.ReturnData(c, 500, nil, err)
-		}
+	balance, err := handlers.DB.WithContext(c.UserContext()).FindBalanceHistoryByUser(tools.ParseUInt(userId))
+	if err != nil {
+		return err
 	}
-	return tools.ReturnData(c, 200, balance, -1)
+	return tools.ReturnData(c, 200, balance)
 }
 
 func GetUserBets(c *fiber.Ctx) error {
 	userId, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
 	if jwtErr != nil {
-		return tools.ReturnData(c, 401, nil, -1)
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
 	}
-	bets, err := handlers.DB.GetUserBet(tools.ParseUInt(userId))
-	if err != -1 {
-		if err == tools.DB_REC_NOTFOUND {
-			return tools.ReturnData(c, 404, nil, tools.DB_REC_NOTFOUND)
-		} else {
-			return tools.ReturnData(c, 500, nil, err)
-		}
+	bets, err := handlers.DB.WithContext(c.UserContext()).GetUserBet(tools.ParseUInt(userId))
+	if err != nil {
+		return err
 	}
-	return tools.ReturnData(c, 200, bets, -1)
+	return tools.ReturnData(c, 200, bets)
 }
@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"gambler/backend/middleware"
+	"gambler/backend/routes/webhooks/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func InitWebhooksRoute(c fiber.Router, guards *middleware.Auth, svc *service.Service) {
+	group := c.Group("/webhooks", guards.JwtGuardHandler)
+	group.Get("/", svc.ListWebhooks)
+	group.Post("/", svc.CreateWebhook)
+	group.Delete("/:id<int>", svc.DeleteWebhook)
+	group.Get("/:id<int>/deliveries", svc.ListDeliveries)
+	group.Post("/:id<int>/deliveries/:delivery<int>/redeliver", svc.Redeliver)
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/database/models"
+	"gambler/backend/handlers"
+	"gambler/backend/middleware"
+	"gambler/backend/tools"
+	"gambler/backend/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+type (
+	CreateWebhookReq struct {
+		URL         string   `json:"url" validate:"required,http_url,max=500"`
+		Description string   `json:"description" validate:"max=200"`
+		Events      []string `json:"events" validate:"required,min=1,dive,oneof=bet.created bet.placed bet.closed bet.settled bet.cancelled"`
+	}
+
+	// CreateWebhookRes is the only response that contains the secret
+	CreateWebhookRes struct {
+		models.Webhook
+		Secret string `json:"secret"`
+	}
+
+	ListDeliveriesReq struct {
+		Status string `query:"status" validate:"omitempty,oneof=pending delivered failed"`
+		Page   int    `query:"page" validate:"min=0"`
+		Limit  int    `query:"limit" validate:"min=0,max=100"`
+	}
+
+	ListDeliveriesRes struct {
+		handlers.WebhookDeliveryPage
+		Page  int `json:"page"`
+		Limit int `json:"limit"`
+	}
+)
+
+const defaultDeliveryLimit = 20
+
+// Service holds the webhook routes
+type Service struct {
+	cfg    config.WebhookConfig
+	guards *middleware.Auth
+}
+
+// New applies the limits of cfg to new webhooks
+func New(cfg config.WebhookConfig, guards *middleware.Auth) *Service {
+	return &Service{cfg: cfg, guards: guards}
+}
+
+func (s *Service) ListWebhooks(c *fiber.Ctx) error {
+	userID, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	hooks, err := handlers.DB.WithContext(c.UserContext()).ListWebhooks(&userID)
+	if err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, hooks)
+}
+
+func (s *Service) CreateWebhook(c *fiber.Ctx) error {
+	req := new(CreateWebhookReq)
+
+	if err := handlers.ParseBody(c, req); err != nil {
+		return err
+	}
+
+	userID, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return apperr.ErrInternal.Wrap(err)
+	}
+
+	events := []string{}
+	for _, event := range req.Events {
+		if !tools.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	hook := models.Webhook{
+		OwnerID:     userID,
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      pq.StringArray(events),
+		Secret:      secret,
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).CreateWebhook(&hook, s.cfg.MaxPerUser); err != nil {
+		return err
+	}
+
+	return tools.ReturnData(c, 200, CreateWebhookRes{
+		Webhook: hook,
+		Secret:  secret,
+	})
+}
+
+func (s *Service) DeleteWebhook(c *fiber.Ctx) error {
+	hook, err := s.ownWebhook(c)
+	if err != nil {
+		return err
+	}
+	if err := handlers.DB.WithContext(c.UserContext()).DeleteWebhook(*hook); err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, true)
+}
+
+func (s *Service) ListDeliveries(c *fiber.Ctx) error {
+	req := new(ListDeliveriesReq)
+
+	if err := handlers.ParseQuery(c, req); err != nil {
+		return err
+	}
+
+	hook, err := s.ownWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultDeliveryLimit
+	}
+	if req.Page == 0 {
+		req.Page = 1
+	}
+
+	page, err := handlers.DB.WithContext(c.UserContext()).ListWebhookDeliveries(handlers.WebhookDeliveryQuery{
+		WebhookID: hook.ID,
+		Status:    req.Status,
+		Limit:     req.Limit,
+		Offset:    (req.Page - 1) * req.Limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tools.ReturnData(c, 200, ListDeliveriesRes{
+		WebhookDeliveryPage: *page,
+		Page:                req.Page,
+		Limit:               req.Limit,
+	})
+}
+
+func (s *Service) Redeliver(c *fiber.Ctx) error {
+	hook, err := s.ownWebhook(c)
+	if err != nil {
+		return err
+	}
+
+	delivery, err := handlers.DB.WithContext(c.UserContext()).RedeliverWebhook(hook.ID, tools.ParseUInt(c.Params("delivery")))
+	if err != nil {
+		return err
+	}
+	return tools.ReturnData(c, 200, delivery)
+}
+
+// ownWebhook loads the webhook of the :id parameter. Webhooks of other users
+// are reported as not found unless the user is an admin.
+func (s *Service) ownWebhook(c *fiber.Ctx) (*models.Webhook, error) {
+	userID, err := currentUser(c)
+	if err != nil {
+		return nil, err
+	}
+	hook, err := handlers.DB.WithContext(c.UserContext()).GetWebhook(tools.ParseUInt(c.Params("id")))
+	if err != nil {
+		return nil, err
+	}
+	if hook.OwnerID == userID {
+		return hook, nil
+	}
+
+	admin, err := s.guards.IsAdmin(c)
+	if err != nil {
+		return nil, err
+	}
+	if !admin {
+		return nil, apperr.ErrRecordNotFound.Wrap(errors.New("webhook of another user"))
+	}
+	return hook, nil
+}
+
+func currentUser(c *fiber.Ctx) (uint, error) {
+	userID, jwtErr := c.Locals("claims").(jwt.Claims).GetSubject()
+	if jwtErr != nil {
+		return 0, apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+	return tools.ParseUInt(userID), nil
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"gambler/backend/middleware"
 	"gambler/backend/routes/ws/service"
+	"gambler/backend/tools"
 
 	W "gambler/backend/handlers/websocket"
 
@@ -9,7 +11,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func InitWsRoute(c *fiber.App) {
-	c.Use(service.CompatibleCheck)
-	c.Get("/ws/:id", websocket.New(W.WebSocket.HandleWebSocketConnection))
+func InitWsRoute(c *fiber.App, guards *middleware.Auth, cookies *tools.Cookies) {
+	c.Get("/ws/:id", service.CompatibleCheck, service.Authorize(guards, cookies), websocket.New(W.WebSocket.HandleWebSocketConnection))
 }
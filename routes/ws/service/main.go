@@ -1,11 +1,12 @@
 package service
 
 import (
-	"strings"
+	"gambler/backend/apperr"
+	"gambler/backend/middleware"
+	"gambler/backend/tools"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 )
 
 type Message struct {
@@ -16,14 +17,36 @@ type Message struct {
 }
 
 func CompatibleCheck(c *fiber.Ctx) error {
-	if !strings.HasPrefix(c.Route().Path, "/ws") {
-		return c.Next()
-	}
 	if websocket.IsWebSocketUpgrade(c) {
 		c.Locals("allowed", true)
-		log.Info("Allowed Connection!")
 		return c.Next()
 	}
-	log.Error("Connection refused!")
-	return fiber.ErrUpgradeRequired
+	return apperr.ErrUpgradeRequired
+}
+
+// Authorize lets users only open their own session. The access token is
+// checked once during the handshake, signing out ends the next one.
+func Authorize(guards *middleware.Auth, cookies *tools.Cookies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return authorize(c, guards, cookies)
+	}
+}
+
+func authorize(c *fiber.Ctx, guards *middleware.Auth, cookies *tools.Cookies) error {
+	token := cookies.Get(c, tools.AccessTokenCookie)
+	if token == "" {
+		return apperr.ErrNoToken
+	}
+	claims, err := guards.Authenticate(c.UserContext(), token)
+	if err != nil {
+		return err
+	}
+	userId, jwtErr := claims.GetSubject()
+	if jwtErr != nil {
+		return apperr.ErrTokenInvalid.Wrap(jwtErr)
+	}
+	if userId != c.Params("id") {
+		return apperr.ErrForbidden
+	}
+	return c.Next()
 }
@@ -1,14 +0,0 @@
-use chrono::NaiveDateTime;
-use diesel::prelude::*;
-
-#[derive(Queryable, Selectable)]
-#[diesel(table_name = crate::schema::users)]
-#[diesel(check_for_backend(diesel::pg::Pg))]
-pub struct Users {
-    pub id: i32,
-    pub username: String,
-    pub password: String,
-    pub balance: i32,
-    pub created_at: Option<NaiveDateTime>,
-    pub updated_at: Option<NaiveDateTime>,
-}
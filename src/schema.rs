@@ -1,14 +0,0 @@
-// @generated automatically by Diesel CLI.
-
-diesel::table! {
-    users (id) {
-        id -> Int4,
-        #[max_length = 255]
-        username -> Varchar,
-        #[max_length = 255]
-        password -> Varchar,
-        balance -> Int4,
-        created_at -> Nullable<Timestamp>,
-        updated_at -> Nullable<Timestamp>,
-    }
-}
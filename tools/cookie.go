@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"fmt"
+	"gambler/backend/config"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cookies set by the server, read and written through Cookies so the
+// configured name prefix is applied
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	UserIDCookie       = "user_id"
+	CSRFCookie         = "csrf_token"
+)
+
+// CSRFHeader repeats the csrf_token cookie on state changing requests
+const CSRFHeader = "X-CSRF-Token"
+
+// Cookies sets the attributes of every cookie the server sets
+type Cookies struct {
+	cfg config.CookieConfig
+}
+
+func NewCookies(cfg config.CookieConfig) *Cookies {
+	return &Cookies{cfg: cfg}
+}
+
+// Name returns the name a cookie is sent under, __Host-access_token with
+// cookies.host_prefix
+func (k *Cookies) Name(name string) string {
+	if k.cfg.HostPrefix {
+		return "__Host-" + name
+	}
+	return name
+}
+
+// Get returns the value of a cookie set by the server
+func (k *Cookies) Get(c *fiber.Ctx, name string) string {
+	return c.Cookies(k.Name(name))
+}
+
+// Sent returns the value of a cookie set by the response so far, a cleared
+// cookie is sent with an empty value
+func (k *Cookies) Sent(c *fiber.Ctx, name string) (string, bool) {
+	header := c.Response().Header.PeekCookie(k.Name(name))
+	if header == nil {
+		return "", false
+	}
+	pair, _, _ := strings.Cut(string(header), ";")
+	_, value, _ := strings.Cut(pair, "=")
+	return value, true
+}
+
+// Set sets cookie with the configured name prefix, Secure and Domain.
+// SameSite is configured too unless the cookie sets its own.
+func (k *Cookies) Set(c *fiber.Ctx, cookie *fiber.Cookie) {
+	cookie.Name = k.Name(cookie.Name)
+	cookie.Path = "/"
+	cookie.Secure = k.cfg.Secure
+	if !k.cfg.HostPrefix {
+		cookie.Domain = k.cfg.Domain
+	}
+	if cookie.SameSite == "" {
+		cookie.SameSite = k.cfg.SameSite
+	}
+	c.Cookie(cookie)
+}
+
+// Clear expires cookies set by Set
+func (k *Cookies) Clear(c *fiber.Ctx, names ...string) {
+	for _, name := range names {
+		k.Set(c, &fiber.Cookie{
+			Name:     name,
+			Value:    "",
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			HTTPOnly: true,
+		})
+	}
+}
+
+// CreateSession sets the token cookies of a session
+func (k *Cookies) CreateSession(c *fiber.Ctx, accessToken string, accessTokenExpDate time.Time, refreshToken string, refreshTokenExpDate time.Time, userId uint) {
+	k.Set(c, &fiber.Cookie{
+		Name:     RefreshTokenCookie,
+		Value:    refreshToken,
+		Expires:  refreshTokenExpDate,
+		HTTPOnly: true,
+	})
+	k.Set(c, &fiber.Cookie{
+		Name:     AccessTokenCookie,
+		Value:    accessToken,
+		Expires:  accessTokenExpDate,
+		HTTPOnly: true,
+	})
+	k.Set(c, &fiber.Cookie{
+		Name:     UserIDCookie,
+		Value:    fmt.Sprintf("%d", userId),
+		Expires:  refreshTokenExpDate,
+		HTTPOnly: true,
+	})
+}
+
+// ClearSession expires the cookies set by CreateSession
+func (k *Cookies) ClearSession(c *fiber.Ctx) {
+	k.Clear(c, RefreshTokenCookie, AccessTokenCookie, UserIDCookie)
+}
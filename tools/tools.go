@@ -1,102 +1,29 @@
 package tools
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"net/http"
-	"os"
-	"runtime"
-	"strconv"
+	"gambler/backend/apiversion"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"gambler/backend/health"
+	"gambler/backend/logging"
+	"gambler/backend/metrics"
+	"gambler/backend/tracing"
+	"log/slog"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/healthcheck"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/joho/godotenv"
 )
 
-type (
-	GlobalErrorHandlerResp struct {
-		Success bool        `json:"success"`
-		Message string      `json:"message"`
-		Code    int         `json:"code"`
-		Body    interface{} `json:"body,omitempty"`
-	}
-)
-
-var (
-	DATABASE          string
-	JWT_SECRET        []byte
-	HASH_SECRET       string
-	COOKIE_SECRET     string
-	HOST_REDIS        string
-	PSW_REDIS         string
-	URL_REDIS         string
-	WEBSOCKET_VERSION byte
-	MASTER_IDS        string
-)
-
-func InitEnvVars() {
-	err := godotenv.Load(".env")
-	if err != nil {
-		panic(err)
-	}
-
-	DATABASE = os.Getenv("POSTGRES_DB")
-	JWT_SECRET = []byte(os.Getenv("JWT_SECRET"))
-	HASH_SECRET = os.Getenv("HASH_SECRET")
-	COOKIE_SECRET = os.Getenv("COOKIE_SECRET")
-	HOST_REDIS = os.Getenv("REDIS_HOST")
-	PSW_REDIS = os.Getenv("REDIS_PSW")
-	URL_REDIS = os.Getenv("REDIS_URL")
-	ver, err := strconv.ParseInt(os.Getenv("WEBSOCKET_VERSION"), 10, 64)
-	if err != nil {
-		panic(err)
-	}
-	WEBSOCKET_VERSION = byte(ver)
-	MASTER_IDS = os.Getenv("MASTER_IDS")
-	// Check for missing variables and log them
-	missingVars := []string{}
-	if DATABASE == "" {
-		missingVars = append(missingVars, "POSTGRES_DB")
-	}
-	if len(JWT_SECRET) == 0 {
-		missingVars = append(missingVars, "JWT_SECRET")
-	}
-	if HASH_SECRET == "" {
-		missingVars = append(missingVars, "HASH_SECRET")
-	}
-	if COOKIE_SECRET == "" {
-		missingVars = append(missingVars, "COOKIE_SECRET")
-	}
-	if HOST_REDIS == "" {
-		missingVars = append(missingVars, "REDIS_HOST")
-	}
-	if PSW_REDIS == "" {
-		missingVars = append(missingVars, "REDIS_PSW")
-	}
-	if URL_REDIS == "" {
-		missingVars = append(missingVars, "REDIS_URL")
-	}
-	if WEBSOCKET_VERSION == 0 {
-		missingVars = append(missingVars, "WEBSOCKET_VERSION")
-	}
-	if MASTER_IDS == "" {
-		missingVars = append(missingVars, "MASTER_IDS")
-	}
-
-	// If there are any missing variables, log them and panic
-	if len(missingVars) > 0 {
-		log.Fatalf("[ENV] The following environment variables are missing: %v", missingVars)
-		panic("Some Environment Variables are missing")
-	}
-	fmt.Println("[ENV] Loaded Enviroment Variables")
-	fmt.Println(DATABASE)
-}
+// GlobalErrorHandlerResp is the body of the answers of version 1
+type GlobalErrorHandlerResp = apiversion.Response
 
 func ParseUInt(s string) uint {
 	var n uint
@@ -108,73 +35,40 @@ func AddCacheTime(c *fiber.Ctx, duration time.Duration) {
 	c.Response().Header.Add("Cache-Time", fmt.Sprintf("%d", int(duration.Seconds())))
 }
 
-func ConfigureApp(app *fiber.App) {
-	app.Use(healthcheck.New())
+func ConfigureApp(app *fiber.App, cfg config.ServerConfig) {
+	app.Use(logging.Middleware())
+	app.Use(metrics.Middleware())
+	app.Get("/metrics", metrics.Handler(cfg.MetricsToken))
+	app.Use(tracing.Middleware())
+
+	app.Get("/livez", health.Checks.LivenessHandler())
+	app.Get("/readyz", health.Checks.ReadinessHandler())
 
+	// Only the listed origins may send credentialed requests, any other
+	// page could act as the signed in user otherwise
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "http://localhost:4200, http://192.168.178.2",
-		AllowHeaders:     "Origin, Content-Type, Accept",
+		AllowOrigins:     strings.Join(cfg.CORSOrigins, ","),
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, " + CSRFHeader,
 		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
 		AllowCredentials: true,
-		AllowOriginsFunc: func(origin string) bool {
-			log.Info(origin)
-			return true
-		},
 	}))
 
+	// Nobody is exempt: behind a reverse proxy on the same host without
+	// server.proxy_header every client would connect from the loopback
 	app.Use(limiter.New(limiter.Config{
-		Next: func(c *fiber.Ctx) bool {
-			return c.IP() == "127.0.0.1"
-		},
-		Max:        20,
-		Expiration: 1 * time.Minute,
+		Max:        cfg.RateLimitMax,
+		Expiration: cfg.RateLimitWindow,
 		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.Get("x-forwarded-for")
+			return c.IP()
 		},
 		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(429).JSON(GlobalErrorHandlerResp{
-				Success: false,
-				Message: "Too many requests",
-				Code:    429,
-			})
+			return apperr.ErrTooManyRequests
 		},
 	}))
 }
 
-func CreateCookie(c *fiber.Ctx, accessToken string, refreshToken string, userId uint) int {
-	rtC := &fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(24 * time.Hour * 7),
-		HTTPOnly: true,
-		Secure:   false,
-		SameSite: "lax",
-	}
-	atC := &fiber.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		Expires:  time.Now().Add(15 * time.Minute),
-		Secure:   false,
-		SameSite: "lax",
-		HTTPOnly: true,
-	}
-	udC := &fiber.Cookie{
-		Name:     "user_id",
-		Value:    fmt.Sprintf("%d", userId),
-		Expires:  time.Now().Add(24 * time.Hour * 7),
-		Secure:   false,
-		SameSite: "lax",
-		HTTPOnly: true,
-	}
-	c.Cookie(rtC)
-	c.Cookie(atC)
-	c.Cookie(udC)
-	return -1
-}
-
 func HeaderParser(c *fiber.Ctx) string {
 	headers := c.GetReqHeaders()
-	log.Info(headers)
 	if len(headers["Authorization"]) == 0 || headers["Authorization"] == nil {
 		return ""
 	}
@@ -187,118 +81,77 @@ func HeaderParser(c *fiber.Ctx) string {
 	return token
 }
 
-func ParseTimestamp(timestamp string) time.Time {
-	t, err := time.Parse(time.RFC3339, timestamp)
-	if err != nil {
-		log.Error(err)
+// NewLinkToken generates the token of an email link and the hash stored in
+// its place
+func NewLinkToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
 	}
-	return t
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashLinkToken(token), nil
 }
 
-type Payload struct {
-	Content string `json:"content"`
+// HashLinkToken returns the stored form of an email link token. The token is
+// random, so a plain SHA-256 cannot be reversed by guessing.
+func HashLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-func SendWebHook(err string) int {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Info(fmt.Sprintf("Called from %s, line %d", file, line))
-	}
-	webhookURL := "https://discordapp.com/api/webhooks/1274463723960143883/__YvfQkphIcyetuB0VBtS3RysKraGv2LORHolSyfMXDvmWuMFwVcEqXB4Hj7A0ZM5Hh4"
-
-	// Create the payload
-	payload := Payload{Content: fmt.Sprintf("----\n**Error:** %s\n**File:** %s\n**Line:** %d", err, file, line)}
-
-	// Encode payload into JSON
-	payloadBytes, jErr := json.Marshal(payload)
-	if jErr != nil {
-		log.Error(jErr)
-		return JSON_MARSHAL_ERROR
+// NewAPIKey generates a key like gbk_<43 characters> and the hash stored in
+// its place
+func NewAPIKey() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
 	}
+	key := "gbk_" + base64.RawURLEncoding.EncodeToString(buf)
+	return key, HashAPIKey(key), nil
+}
 
-	// Send the POST request
-	resp, hErr := http.Post(webhookURL, "application/json", bytes.NewBuffer(payloadBytes))
-	if hErr != nil {
-		log.Errorf("failed to send webhook: %v", err)
-		return WEBHOOK_ERROR
-	}
-	defer resp.Body.Close()
+// HashAPIKey returns the stored form of an API key, random like the tokens
+// of email links
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
 
-	// Check for non-200 HTTP status codes
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		log.Errorf("unexpected status code: %d", resp.StatusCode)
-		return WEBHOOK_ERROR
+func ParseTimestamp(timestamp string) time.Time {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		slog.Warn("failed to parse timestamp", "value", timestamp, "error", err)
 	}
-
-	return -1
+	return t
 }
 
 func ConvertKeyToBetID(key string) uint {
 	return ParseUInt(strings.TrimPrefix(key, "b-"))
 }
 
-func ReturnData(c *fiber.Ctx, code int, body interface{}, err int) error {
-	if err != -1 {
-		return c.Status(code).JSON(GlobalErrorHandlerResp{
-			Success: false,
-			Message: GetErrorString(err),
-			Code:    err,
-			Body:    body,
-		})
-	} else if code >= 400 {
-		return c.Status(code).JSON(GlobalErrorHandlerResp{
-			Success: false,
-			Message: StatusText(code),
-			Code:    code,
-			Body:    body,
-		})
-	}
-	return c.Status(code).JSON(GlobalErrorHandlerResp{
-		Success: true,
-		Message: "Success",
-		Code:    200,
-		Body:    body,
-	})
+// ReturnData sends a successful response, errors are returned from the
+// handlers instead and rendered by ErrorHandler
+func ReturnData(c *fiber.Ctx, code int, body interface{}) error {
+	return c.Status(code).JSON(apiversion.EnvelopeOf(c).Success(code, body))
 }
 
-func StatusText(code int) string {
-	switch code {
-	case http.StatusOK:
-		return "OK"
-	case http.StatusCreated:
-		return "Created"
-	case http.StatusAccepted:
-		return "Accepted"
-	case http.StatusNoContent:
-		return "No Content"
-	case http.StatusBadRequest:
-		return "Bad Request"
-	case http.StatusUnauthorized:
-		return "Unauthorized"
-	case http.StatusForbidden:
-		return "Forbidden"
-	case http.StatusNotFound:
-		return "Not Found"
-	case http.StatusInternalServerError:
-		return "Internal Server Error"
-	case http.StatusNotImplemented:
-		return "Not Implemented"
-	case http.StatusBadGateway:
-		return "Bad Gateway"
-	case http.StatusServiceUnavailable:
-		return "Service Unavailable"
-	// Add more status codes as needed
-	default:
-		return "Unknown Status Code"
-	}
+// ErrorHandler renders every error returned by a handler, it is the only
+// place that turns errors into responses. Server errors are logged with
+// their cause, which is never sent to the client.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	e := apperr.From(err)
+	if e.Status >= 500 {
+		slog.ErrorContext(c.UserContext(), "request failed", "code", e.Code, "error", err)
+	} else {
+		slog.DebugContext(c.UserContext(), "request rejected", "code", e.Code, "error", err)
+	}
+	return c.Status(e.Status).JSON(apiversion.EnvelopeOf(c).Failure(e))
 }
 
 func Contains(slice []string, item string) bool {
 	var res bool = false
 	for _, str := range slice {
-		log.Info(str, item)
 		if str == item {
-			log.Info("Found")
 			res = true
 			break
 		}
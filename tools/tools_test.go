@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"gambler/backend/apperr"
+	"gambler/backend/config"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestRateLimitKey checks that clients cannot get a fresh rate limit by
+// sending another X-Forwarded-For or proxy header, and that the loopback is
+// limited like any other client. app.Test connects from 0.0.0.0.
+func TestRateLimitKey(t *testing.T) {
+	clients := []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"}
+	tests := []struct {
+		name    string
+		proxies []string
+		header  string
+		ips     []string
+		allowed int
+	}{
+		{"no proxy", nil, "X-Forwarded-For", clients, 2},
+		{"untrusted proxy", []string{"10.0.0.0/8"}, "X-Real-IP", clients, 2},
+		{"trusted proxy", []string{"0.0.0.0"}, "X-Real-IP", clients, 3},
+		{"loopback", []string{"0.0.0.0"}, "X-Real-IP", []string{"127.0.0.1", "127.0.0.1", "127.0.0.1"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ServerConfig{
+				CORSOrigins:     []string{"http://localhost:4200"},
+				RateLimitMax:    2,
+				RateLimitWindow: time.Minute,
+			}
+			proxyHeader := ""
+			if tt.proxies != nil {
+				proxyHeader = tt.header
+			}
+			app := fiber.New(fiber.Config{
+				ErrorHandler:            ErrorHandler,
+				EnableTrustedProxyCheck: true,
+				TrustedProxies:          tt.proxies,
+				ProxyHeader:             proxyHeader,
+			})
+			ConfigureApp(app, cfg)
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(c.IP())
+			})
+
+			allowed := 0
+			for _, ip := range tt.ips {
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Set(tt.header, ip)
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode == fiber.StatusOK {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("%d requests allowed, want %d", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+// TestErrorHandler renders errors with their code and status, the cause
+// stays in the logs
+func TestErrorHandler(t *testing.T) {
+	cause := errors.New(`pq: relation "users" does not exist`)
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   apperr.Code
+	}{
+		{"application error", apperr.ErrDatabase.Wrap(cause), 500, apperr.ErrDatabase.Code},
+		{"client error", apperr.ErrBetOptionNotFound, 400, apperr.ErrBetOptionNotFound.Code},
+		{"fiber error", fiber.ErrMethodNotAllowed, 405, apperr.ErrMethodNotAllowed.Code},
+		{"plain error", cause, 500, apperr.ErrInternal.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/", func(c *fiber.Ctx) error { return tt.err })
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body GlobalErrorHandlerResp
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Fatalf("body %q: %v", raw, err)
+			}
+			if resp.StatusCode != tt.status || body.Code != tt.status || body.Error != tt.code || body.Success {
+				t.Errorf("status %d with %+v, want %d and %s", resp.StatusCode, body, tt.status, tt.code)
+			}
+			if strings.Contains(string(raw), "relation") {
+				t.Errorf("body %s reveals the cause", raw)
+			}
+		})
+	}
+}
@@ -22,3 +22,26 @@ func ChunkBigNumber(n int) []byte {
 	}
 	return largeNumberBytes
 }
+
+var eventNames = map[int]string{
+	WS_CONNECTION:     "connection",
+	WS_CLOSE:          "close",
+	WS_ERR:            "error",
+	MESSAGE:           "message",
+	BET_ACTION_BET:    "bet_action_bet",
+	BET_ACTION_CANCEL: "bet_action_cancel",
+	BET_INFO:          "bet_info",
+	BET_INFO_RES:      "bet_info_res",
+	BET_UPDATE:        "bet_update",
+	USER_UPDATE:       "user_update",
+	PING:              "ping",
+	PONG:              "pong",
+}
+
+// GetEventName returns the name of a websocket event, used as metric label
+func GetEventName(event int) string {
+	if name, ok := eventNames[event]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,24 @@
+package tracing
+
+import (
+	"github.com/gofiber/contrib/otelfiber/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Middleware opens a server span per request, continuing the trace of the
+// caller when it sends a traceparent header. Handlers find the span in
+// c.UserContext(). Probes and scrapes of /metrics are not traced.
+func Middleware() fiber.Handler {
+	return otelfiber.Middleware(
+		otelfiber.WithNext(func(c *fiber.Ctx) bool {
+			switch c.Path() {
+			case "/metrics", "/livez", "/readyz":
+				return true
+			}
+			return false
+		}),
+		otelfiber.WithSpanNameFormatter(func(c *fiber.Ctx) string {
+			return c.Method() + " " + c.Route().Path
+		}),
+	)
+}
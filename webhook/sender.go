@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// Sender posts deliveries to the webhook endpoints
+type Sender struct {
+	client *http.Client
+}
+
+// errBlockedAddress is returned for endpoints in private networks, which
+// would let users probe the internal services of the deployment
+var errBlockedAddress = errors.New("address is not publicly routable")
+
+// NewSender creates a Sender, allowPrivate disables the check of the
+// resolved address for local development
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// Checked after name resolution, so DNS cannot point a public name
+		// at an internal address
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip, err := netip.ParseAddr(host); err != nil || !isPublic(ip) {
+				return fmt.Errorf("%s: %w", host, errBlockedAddress)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Sender{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// A redirect is answered like a failure, following it would
+			// send the signed payload to a URL the user did not register
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send posts body to url and returns the status code of the answer. Every
+// status outside of 2xx is an error.
+func (s *Sender) Send(ctx context.Context, url string, secret string, event string, deliveryID uint, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gambler-Webhooks/1")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, fmt.Sprintf("%d", deliveryID))
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+	}
+	return resp.StatusCode, nil
+}
+
+// blockedPrefixes are the special purpose ranges of the IANA registries
+// that do not reach a public host, or may reach an internal one
+var blockedPrefixes = func() []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, prefix := range []string{
+		"0.0.0.0/8",       // this network
+		"10.0.0.0/8",      // private
+		"100.64.0.0/10",   // carrier-grade NAT, also cloud metadata such as 100.100.100.200
+		"127.0.0.0/8",     // loopback
+		"169.254.0.0/16",  // link local, cloud metadata at 169.254.169.254
+		"172.16.0.0/12",   // private
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"192.88.99.0/24",  // 6to4 relay anycast
+		"192.168.0.0/16",  // private
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"224.0.0.0/4",     // multicast
+		"240.0.0.0/4",     // reserved and broadcast
+		"::/96",           // unspecified, loopback and IPv4-compatible
+		"::ffff:0:0/96",   // IPv4-mapped, checked as IPv4 before
+		"64:ff9b::/96",    // NAT64, reaches any IPv4 address
+		"64:ff9b:1::/48",  // local NAT64
+		"100::/64",        // discard
+		"2001::/23",       // IETF protocol assignments, Teredo
+		"2001:db8::/32",   // documentation
+		"2002::/16",       // 6to4, reaches any IPv4 address
+		"fc00::/7",        // unique local
+		"fe80::/10",       // link local
+		"fec0::/10",       // site local
+		"ff00::/8",        // multicast
+	} {
+		prefixes = append(prefixes, netip.MustParsePrefix(prefix))
+	}
+	return prefixes
+}()
+
+// isPublic reports whether ip is outside every blocked range. IPv4-mapped
+// addresses are checked as the IPv4 address they carry.
+func isPublic(ip netip.Addr) bool {
+	ip = ip.WithZone("").Unmap()
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return ip.IsValid()
+}
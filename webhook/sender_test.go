@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestSendSignsDelivery(t *testing.T) {
+	body := []byte(`{"id":"1","event":"bet.created"}`)
+	var verifyErr error
+	var event, delivery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		verifyErr = Verify("whsec_test", r.Header.Get(HeaderSignature), received, time.Minute)
+		event, delivery = r.Header.Get(HeaderEvent), r.Header.Get(HeaderDelivery)
+	}))
+	defer server.Close()
+
+	status, err := NewSender(time.Second, true).Send(context.Background(), server.URL, "whsec_test", EventBetCreated, 12, body)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Send = %d, %v", status, err)
+	}
+	if verifyErr != nil {
+		t.Errorf("receiver could not verify the delivery: %v", verifyErr)
+	}
+	if event != EventBetCreated || delivery != "12" {
+		t.Errorf("headers = %q %q, want %q 12", event, delivery, EventBetCreated)
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		case "/error":
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		allowPrivate bool
+		status       int
+		blocked      bool
+	}{
+		{"private address", "/", false, 0, true},
+		{"redirect is not followed", "/redirect", true, http.StatusFound, false},
+		{"error status", "/error", true, http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := NewSender(time.Second, tt.allowPrivate).Send(context.Background(), server.URL+tt.path, "whsec_test", EventBetCreated, 1, []byte(`{}`))
+			if err == nil {
+				t.Fatal("Send succeeded")
+			}
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			if blocked := errors.Is(err, errBlockedAddress); blocked != tt.blocked {
+				t.Errorf("blocked = %v, want %v: %v", blocked, tt.blocked, err)
+			}
+		})
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"198.20.0.1", true},
+		{"2606:4700:4700::1111", true},
+		{"::ffff:8.8.8.8", true},
+
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.100.100.200", false},
+		{"100.127.255.255", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"192.0.0.170", false},
+		{"192.0.2.1", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"198.51.100.7", false},
+		{"203.0.113.9", false},
+		{"224.0.0.251", false},
+		{"255.255.255.255", false},
+		{"::", false},
+		{"::1", false},
+		{"::127.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:100.100.100.200", false},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::808:808", false},
+		{"64:ff9b:1::1", false},
+		{"2001::1", false},
+		{"2001:db8::1", false},
+		{"2002:a00:1::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"fe80::1%eth0", false},
+		{"ff02::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPublic(netip.MustParseAddr(tt.ip)); got != tt.public {
+				t.Errorf("isPublic(%s) = %v, want %v", tt.ip, got, tt.public)
+			}
+		})
+	}
+}
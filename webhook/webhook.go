@@ -0,0 +1,217 @@
+// Package webhook signs and sends bet lifecycle events to the URLs users
+// subscribed to them. Events are written to webhook_deliveries in the same
+// transaction as the change they describe and sent by the worker in
+// handlers/routine, so they survive restarts. This is unrelated to the
+// alerting webhooks of the notifier package.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gambler/backend/database/models"
+	"gambler/backend/database/models/customTypes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Events a webhook can subscribe to
+const (
+	EventBetCreated   = "bet.created"
+	EventBetPlaced    = "bet.placed"
+	EventBetClosed    = "bet.closed"
+	EventBetSettled   = "bet.settled"
+	EventBetCancelled = "bet.cancelled"
+)
+
+var Events = []string{EventBetCreated, EventBetPlaced, EventBetClosed, EventBetSettled, EventBetCancelled}
+
+// Statuses of a delivery
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Gambler-Event"
+	HeaderDelivery  = "X-Gambler-Delivery"
+	HeaderSignature = "X-Gambler-Signature"
+)
+
+type (
+	// Payload is the body of every delivery. ID identifies the event, it is
+	// the same for every webhook and for redeliveries, so receivers can
+	// ignore duplicates.
+	Payload struct {
+		ID        string      `json:"id"`
+		Event     string      `json:"event"`
+		CreatedAt time.Time   `json:"created_at"`
+		Data      interface{} `json:"data"`
+	}
+
+	// BetData is the data of every event except bet.placed
+	BetData struct {
+		ID          uint                  `json:"id"`
+		Name        string                `json:"name"`
+		Description string                `json:"description"`
+		Options     []string              `json:"options"`
+		Status      customTypes.BetStatus `json:"status"`
+		Result      string                `json:"result,omitempty"`
+		EndsAt      time.Time             `json:"ends_at"`
+		Author      *uint                 `json:"author"`
+		// Payouts lists the amount credited to each user id when the bet is
+		// settled or cancelled
+		Payouts map[uint]float64 `json:"payouts,omitempty"`
+	}
+
+	// PlacementData is the data of bet.placed
+	PlacementData struct {
+		BetID  uint    `json:"bet_id"`
+		UserID uint    `json:"user_id"`
+		Option string  `json:"option"`
+		Amount float64 `json:"amount"`
+	}
+
+	// Scoped is implemented by the data of events with details of single
+	// users. The webhooks of users who are not admins receive ForUser of
+	// their owner, and no delivery when it reports false.
+	Scoped interface {
+		ForUser(userID uint) (interface{}, bool)
+	}
+)
+
+const maxBackoff = 6 * time.Hour
+
+// Bet describes a bet for an event
+func Bet(bet models.Bet, payouts map[uint]float64) BetData {
+	return BetData{
+		ID:          bet.ID,
+		Name:        bet.Name,
+		Description: bet.Description,
+		Options:     bet.BetOptions,
+		Status:      bet.Status,
+		Result:      bet.Result,
+		EndsAt:      bet.EndsAt,
+		Author:      bet.Author,
+		Payouts:     payouts,
+	}
+}
+
+// Placement describes a stake for bet.placed
+func Placement(userBet models.UserBet) PlacementData {
+	return PlacementData{
+		BetID:  userBet.BetID,
+		UserID: userBet.UserID,
+		Option: userBet.BetOption,
+		Amount: userBet.Amount,
+	}
+}
+
+// ForUser keeps only the payout of the user
+func (b BetData) ForUser(userID uint) (interface{}, bool) {
+	if b.Payouts != nil {
+		own := map[uint]float64{}
+		if amount, ok := b.Payouts[userID]; ok {
+			own[userID] = amount
+		}
+		b.Payouts = own
+	}
+	return b, true
+}
+
+// ForUser only reports the stakes of the user
+func (p PlacementData) ForUser(userID uint) (interface{}, bool) {
+	return p, p.UserID == userID
+}
+
+// NewPayload starts a new event, Encode adds the data of each webhook
+func NewPayload(event string) Payload {
+	return Payload{
+		ID:        uuid.NewString(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// Encode returns the body of the event with data. The body is stored and
+// sent as is, so the signature always covers the same bytes.
+func (p Payload) Encode(data interface{}) ([]byte, error) {
+	p.Data = data
+	return json.Marshal(p)
+}
+
+// NewSecret generates the signing secret of a new webhook
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Sign returns the X-Gambler-Signature header of body sent at t, e.g.
+// t=1700000000,v1=5257a8... where v1 is the hex encoded HMAC-SHA256 of
+// "<t>.<body>" keyed with the secret of the webhook
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, signature(secret, timestamp, body))
+}
+
+// Verify checks a signature header the way receivers should: the HMAC has
+// to match and the timestamp must not be older than tolerance, which stops
+// replays of captured deliveries
+func Verify(secret string, header string, body []byte, tolerance time.Duration) error {
+	var timestamp, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			sig = value
+		}
+	}
+	if timestamp == "" || sig == "" {
+		return fmt.Errorf("malformed signature header")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed signature timestamp: %w", err)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature timestamp outside of the tolerance")
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, timestamp, body))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func signature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the delay after the given number of failed attempts,
+// doubling from base up to six hours
+func Backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
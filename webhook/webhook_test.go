@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"1","event":"bet.created"}`)
+	at := time.Unix(1700000000, 0)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("whsec_test", at, body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"id":"1","event":"bet.settled","data":{"payouts":{"7":120}}}`)
+	now := time.Now()
+	valid := Sign(secret, now, body)
+	timestamp, sig, _ := strings.Cut(valid, ",")
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		err    string
+	}{
+		{"valid", secret, valid, body, ""},
+		{"parts in any order", secret, sig + "," + timestamp, body, ""},
+		{"wrong secret", "whsec_other", valid, body, "signature mismatch"},
+		{"tampered body", secret, valid, []byte(`{"id":"1","event":"bet.settled","data":{"payouts":{"7":1200}}}`), "signature mismatch"},
+		{"replayed", secret, Sign(secret, now.Add(-10*time.Minute), body), body, "outside of the tolerance"},
+		{"from the future", secret, Sign(secret, now.Add(10*time.Minute), body), body, "outside of the tolerance"},
+		{"timestamp swapped", secret, "t=" + "1700000000," + sig, body, "outside of the tolerance"},
+		{"missing signature", secret, timestamp, body, "malformed signature header"},
+		{"empty", secret, "", body, "malformed signature header"},
+		{"malformed timestamp", secret, "t=soon," + sig, body, "malformed signature timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, maxBackoff},
+		{1000, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := Backoff(time.Minute, tt.attempts); got != tt.want {
+			t.Errorf("Backoff(1m, %d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}